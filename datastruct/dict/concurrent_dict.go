@@ -114,6 +114,9 @@ func (dict *ConcurrentDict[K, V]) Put(key K, val V) (result int) {
 		bucket.m[key] = val
 		return 0
 	}
+	if bucket.m == nil {
+		bucket.m = make(map[K]V) // Detach之后第一次写入
+	}
 	atomic.AddInt32(&dict.length, 1)
 	bucket.m[key] = val
 	return 1
@@ -129,6 +132,9 @@ func (dict *ConcurrentDict[K, V]) PutIfAbsent(key K, val V) (result int) {
 	if existed {
 		return 0 // 已存在
 	} else {
+		if bucket.m == nil {
+			bucket.m = make(map[K]V) // Detach之后第一次写入
+		}
 		bucket.m[key] = val              // 未存在
 		atomic.AddInt32(&dict.length, 1) // atomically
 		return 1
@@ -313,7 +319,34 @@ func (dict *ConcurrentDict[K, V]) RandomDistinctKeys(num int) []K {
 
 func (dict *ConcurrentDict[K, V]) Clear() {
 	checkNilDict(dict)
-	*dict = *NewConcurrentDict[K, V](dict.bucketNum)
+	dict.Detach()
+}
+
+// Detach 逐个bucket加锁并替换为空的map，可与其他操作并发执行，耗时只与bucket个数有关
+// 新的map在第一次写入时才创建，返回的dict中原本为空的bucket共用同一个bucket，避免为大量bucket分配内存
+func (dict *ConcurrentDict[K, V]) Detach() Dict[K, V] {
+	checkNilDict(dict)
+	detached := &ConcurrentDict[K, V]{
+		buckets:   make([]*bucket[K, V], dict.bucketNum),
+		bucketNum: dict.bucketNum,
+	}
+	empty := &bucket[K, V]{}
+	for i, b := range dict.buckets {
+		b.lock.Lock()
+		m := b.m
+		b.m = nil
+		if n := int32(len(m)); n > 0 {
+			atomic.AddInt32(&dict.length, -n)
+			detached.length += n
+		}
+		b.lock.Unlock()
+		if len(m) > 0 {
+			detached.buckets[i] = &bucket[K, V]{m: m}
+		} else {
+			detached.buckets[i] = empty
+		}
+	}
+	return detached
 }
 
 func checkNilDict(dict any) {
@@ -20,6 +20,7 @@ type Dict[K comparable, V any] interface {
 	RandomKeys(num int) []K         // 随机获取指定个数的key，且key可以重复
 	RandomDistinctKeys(num int) []K // 随机获取指定个数的key，且所有key都唯一
 	Clear()
+	Detach() Dict[K, V] // 清空dict，并返回包含原有键值对的dict，用于flush时只分离数据而不逐个删除
 }
 
 type Consumer[K comparable, V any] func(key K, val V) bool
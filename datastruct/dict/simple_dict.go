@@ -184,3 +184,12 @@ func (dict *SimpleDict[K, V]) Clear() {
 	//}
 	*dict = *NewSimpleDict[K, V]()
 }
+
+func (dict *SimpleDict[K, V]) Detach() Dict[K, V] {
+	if dict == nil {
+		panic("dict is nil")
+	}
+	detached := &SimpleDict[K, V]{dict.m}
+	dict.m = make(map[K]V)
+	return detached
+}
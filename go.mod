@@ -1,2 +1,5 @@
 module go-redis
-go 1.19
\ No newline at end of file
+
+go 1.19
+
+require github.com/yuin/gopher-lua v1.1.1
@@ -1,17 +1,44 @@
 package _interface
 
-import _type "go-redis/interface/type"
+import (
+	"crypto/tls"
+	_type "go-redis/interface/type"
+	"time"
+)
 
 type Client interface {
 	Write([]byte) (int, error)
+	WriteReply(reply Reply) (int, error)
+	AddReply(reply Reply)
+	Flush()
+	GetOutputBufferSize() int
 	Close() error
+	Kill()
 	RemoteAddr() string
+	LocalAddr() string
+	IsUnixSocket() bool
+	TLSConnectionState() *tls.ConnectionState
+
+	GetId() int64
+	GetName() string
+	SetName(string)
+	GetProtocol() int
+	SetProtocol(int)
+
+	GetCreatedAt() time.Time
+	GetLastTime() time.Time
+	GetLastCmd() string
+	SetLastCmd(cmd string)
+	IsNoEvict() bool
+	SetNoEvict(flag bool)
+	SetReplyMode(mode string)
+	ShouldReply() bool
 
 	GetSelectDB() int
 	SetSelectDB(int)
 
-	SetPassword(string)
-	GetPassword() string
+	SetUser(string)
+	GetUser() string
 
 	Subscribe(channel string)
 	UnSubscribe(channel string)
@@ -25,10 +52,13 @@ type Client interface {
 	ClearTxQueue()
 	AddTxError(err error)
 	GetTxError() []error
-	InitWatch(dbNum int)
+	SetTxAOF(toAOF func(dbIdx int, cmdLine _type.CmdLine))
+	GetTxAOF() func(dbIdx int, cmdLine _type.CmdLine)
 	DestroyWatch()
-	SetWatchKey(dbIdx int, key string, version int)
-	GetWatchKeys() []map[string]int
+	SetWatchKey(dbIdx int, key string, expired bool)
+	GetWatchKeys() map[int]map[string]bool
+	SetWatchDirty()
+	IsWatchDirty() bool
 }
 
 type Server interface {
@@ -36,9 +66,8 @@ type Server interface {
 	ExecForTX(client Client, cmdLine _type.CmdLine) Reply
 	ExecForAOF(client Client, cmdLine _type.CmdLine) Reply
 
-	SetTxing(flag bool)
-	IsTxing() bool
-
+	AddClient(client Client) error
 	CloseClient(client Client)
+	ReloadConfig() error
 	Close()
 }
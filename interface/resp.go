@@ -8,3 +8,9 @@ type ErrorReply interface {
 	Error() string
 	ToBytes() []byte
 }
+
+// RESP3Reply 在RESP3协议下编码方式不同的回复，ToBytes为RESP2下的编码
+type RESP3Reply interface {
+	Reply
+	ToRESP3() []byte
+}
@@ -7,4 +7,5 @@ import (
 type Handler interface {
 	Handle(conn net.Conn)
 	Close() error
+	Reload() error // 重新加载配置
 }
@@ -5,6 +5,9 @@ import (
 	"go-redis/datastruct/list"
 	Set "go-redis/datastruct/set"
 	ZSet "go-redis/datastruct/zset"
+	"math/rand"
+	"sync/atomic"
+	"time"
 )
 
 // CmdLine 一个完整的redis命令
@@ -26,11 +29,72 @@ type Type interface {
 }
 
 type Entity struct {
-	Data any
+	Data       any
+	accessTime int64  // 最近一次访问的时间，unix毫秒，用于object idletime
+	freq       uint32 // 访问频率的对数计数器，与redis的LFU一致，用于object freq
 }
 
 func NewEntity(data any) *Entity {
-	return &Entity{Data: data}
+	return &Entity{Data: data, accessTime: time.Now().UnixMilli(), freq: lfuInitVal}
+}
+
+// LFU计数器的参数，与redis的默认配置一致
+const (
+	lfuInitVal   = 5           // 新key的初始计数，避免新key被立即淘汰
+	lfuLogFactor = 10          // 计数越大增长越慢，约一百万次访问达到255
+	lfuDecayTime = time.Minute // 每隔一段时间未访问，计数减1
+)
+
+// Touch 记录一次访问，更新访问时间及访问频率，可能被持有读锁的多个goroutine同时调用
+func (entity *Entity) Touch() {
+	now := time.Now().UnixMilli()
+	last := atomic.SwapInt64(&entity.accessTime, now)
+	for {
+		old := atomic.LoadUint32(&entity.freq)
+		counter := lfuIncr(lfuDecr(old, now-last))
+		if atomic.CompareAndSwapUint32(&entity.freq, old, counter) {
+			return
+		}
+	}
+}
+
+// IdleTime 距离最近一次访问的时间
+func (entity *Entity) IdleTime() time.Duration {
+	idle := time.Now().UnixMilli() - atomic.LoadInt64(&entity.accessTime)
+	return time.Duration(idle) * time.Millisecond
+}
+
+// Freq 访问频率的对数计数，包括自最近一次访问以来的衰减
+func (entity *Entity) Freq() int {
+	idle := time.Now().UnixMilli() - atomic.LoadInt64(&entity.accessTime)
+	return int(lfuDecr(atomic.LoadUint32(&entity.freq), idle))
+}
+
+// 计数按对数增长，计数越大增加的概率越低
+func lfuIncr(counter uint32) uint32 {
+	if counter >= 255 {
+		return 255
+	}
+	if counter <= lfuInitVal {
+		return counter + 1
+	}
+	p := 1.0 / float64((counter-lfuInitVal)*lfuLogFactor+1)
+	if rand.Float64() < p {
+		counter++
+	}
+	return counter
+}
+
+// 每经过lfuDecayTime未访问，计数减1
+func lfuDecr(counter uint32, idleMillis int64) uint32 {
+	periods := idleMillis / lfuDecayTime.Milliseconds()
+	if periods <= 0 {
+		return counter
+	}
+	if periods >= int64(counter) {
+		return 0
+	}
+	return counter - uint32(periods)
 }
 
 func (entity *Entity) GetType() int {
@@ -5,14 +5,43 @@ import (
 	"go-redis/redis"
 	"go-redis/tcp"
 	"go-redis/utils/logger"
+	"os"
+	"runtime"
 )
 
 func main() {
 	logger.Info("go-redis is running.....")
 	redis.InitConfig("redis.conf") // 从redis.conf中读取配置
-	address := fmt.Sprintf("%s:%d", redis.Config.Bind, redis.Config.Port)
+	// port为0时不监听普通连接
+	address := ""
+	if redis.Config.Port > 0 {
+		address = fmt.Sprintf("%s:%d", redis.Config.Bind, redis.Config.Port)
+	}
 	handler := tcp.NewHandler()
 	server := tcp.NewServer(address, handler)
+	// unix socket
+	if redis.Config.Unixsocket != "" {
+		server.EnableUnixSocket(redis.Config.Unixsocket, os.FileMode(redis.Config.Unixsocketperm))
+	}
+	// tls
+	if redis.Config.TlsPort > 0 {
+		if err := redis.LoadTLS(); err != nil {
+			logger.Fatal(err)
+		}
+		server.EnableTLS(fmt.Sprintf("%s:%d", redis.Config.Bind, redis.Config.TlsPort), redis.TLSConfig())
+	}
+	// 网络模型
+	if redis.Config.IoModel == redis.IOModelEpoll {
+		loops := redis.Config.EventLoops
+		if loops <= 0 {
+			loops = runtime.NumCPU()
+		}
+		if err := server.EnableEventLoop(loops); err != nil {
+			logger.Warn(err.Error() + ", fallback to io-model goroutine")
+		} else {
+			logger.Info(fmt.Sprintf("io-model epoll with %d event loops", loops))
+		}
+	}
 	// 开启服务
 	err := server.Start()
 	if err != nil {
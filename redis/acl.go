@@ -0,0 +1,838 @@
+package redis
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	_interface "go-redis/interface"
+	_type "go-redis/interface/type"
+	"go-redis/redis/utils"
+	Reply "go-redis/resp/reply"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultUser  = "default"
+	aclLogMaxLen = 128
+)
+
+// 无需鉴权、也不受ACL限制的命令
+var aclExempt = map[string]bool{
+	"auth": true,
+}
+
+// 涉及channel的命令，返回其访问的channel
+var channelsFind = map[string]func(args _type.Args) []string{
+	"subscribe": func(args _type.Args) []string {
+		channels := make([]string, len(args))
+		for i, arg := range args {
+			channels[i] = string(arg)
+		}
+		return channels
+	},
+	"publish": func(args _type.Args) []string {
+		return []string{string(args[0])}
+	},
+}
+
+type keyPattern struct {
+	pattern string
+	read    bool
+	write   bool
+}
+
+func (kp keyPattern) String() string {
+	switch {
+	case kp.read && kp.write:
+		return "~" + kp.pattern
+	case kp.read:
+		return "%R~" + kp.pattern
+	default:
+		return "%W~" + kp.pattern
+	}
+}
+
+// User ACL用户，创建后不再修改，ACL SETUSER时复制一份并整体替换
+type User struct {
+	Name      string
+	enabled   bool
+	noPass    bool
+	passwords map[string]bool // sha256后的密码
+	commands  map[string]bool // 允许执行的命令
+	cmdRules  []string        // 用于描述commands的规则，如"+@all -keys"
+	keys      []keyPattern
+	channels  []string
+}
+
+func newUser(name string) *User {
+	return &User{
+		Name:      name,
+		passwords: make(map[string]bool),
+		commands:  make(map[string]bool),
+	}
+}
+
+func (user *User) clone() *User {
+	cp := newUser(user.Name)
+	cp.enabled = user.enabled
+	cp.noPass = user.noPass
+	for pass := range user.passwords {
+		cp.passwords[pass] = true
+	}
+	for cmd, allowed := range user.commands {
+		cp.commands[cmd] = allowed
+	}
+	cp.cmdRules = append(cp.cmdRules, user.cmdRules...)
+	cp.keys = append(cp.keys, user.keys...)
+	cp.channels = append(cp.channels, user.channels...)
+	return cp
+}
+
+func hashPassword(password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
+
+// 按类别返回命令及有单独分类的子命令，"all"表示所有命令
+func commandsInCategory(category string) ([]string, bool) {
+	all := CommandNames()
+	for _, name := range CommandNames() {
+		all = append(all, subcommandNames(name)...)
+	}
+	if category == "all" {
+		return all, true
+	}
+	found := false
+	for _, cat := range Categories {
+		if cat == category {
+			found = true
+		}
+	}
+	if !found {
+		return nil, false
+	}
+	names := make([]string, 0)
+	for _, name := range all {
+		categories, _ := CommandCategories(name)
+		for _, cat := range categories {
+			if cat == category {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	return names, true
+}
+
+// applyRule 应用一条ACL规则
+func (user *User) applyRule(rule string) error {
+	lower := strings.ToLower(rule)
+	switch lower {
+	case "on":
+		user.enabled = true
+	case "off":
+		user.enabled = false
+	case "nopass":
+		user.noPass = true
+		user.passwords = make(map[string]bool)
+	case "resetpass":
+		user.noPass = false
+		user.passwords = make(map[string]bool)
+	case "allkeys":
+		user.keys = []keyPattern{{pattern: "*", read: true, write: true}}
+	case "resetkeys":
+		user.keys = nil
+	case "allchannels":
+		user.channels = []string{"*"}
+	case "resetchannels":
+		user.channels = nil
+	case "allcommands":
+		return user.applyRule("+@all")
+	case "nocommands":
+		return user.applyRule("-@all")
+	case "reset":
+		for _, r := range []string{"resetpass", "resetkeys", "resetchannels", "off", "-@all"} {
+			_ = user.applyRule(r)
+		}
+	default:
+		if len(rule) == 0 {
+			return errors.New("Syntax error")
+		}
+		switch rule[0] {
+		case '>':
+			user.passwords[hashPassword(rule[1:])] = true
+			user.noPass = false
+		case '<':
+			hash := hashPassword(rule[1:])
+			if !user.passwords[hash] {
+				return errors.New("The password you are trying to remove from the user does not exist")
+			}
+			delete(user.passwords, hash)
+		case '#', '!':
+			hash := strings.ToLower(rule[1:])
+			if _, err := hex.DecodeString(hash); err != nil || len(hash) != sha256.Size*2 {
+				return errors.New("The password hash must be exactly 64 characters and contain only lowercase hexadecimal characters")
+			}
+			if rule[0] == '#' {
+				user.passwords[hash] = true
+				user.noPass = false
+			} else {
+				if !user.passwords[hash] {
+					return errors.New("The password you are trying to remove from the user does not exist")
+				}
+				delete(user.passwords, hash)
+			}
+		case '~':
+			user.keys = append(user.keys, keyPattern{pattern: rule[1:], read: true, write: true})
+		case '%':
+			idx := strings.IndexByte(rule, '~')
+			if idx < 2 {
+				return errors.New("Syntax error")
+			}
+			kp := keyPattern{pattern: rule[idx+1:]}
+			for _, flag := range strings.ToUpper(rule[1:idx]) {
+				switch flag {
+				case 'R':
+					kp.read = true
+				case 'W':
+					kp.write = true
+				default:
+					return errors.New("Syntax error")
+				}
+			}
+			user.keys = append(user.keys, kp)
+		case '&':
+			user.channels = append(user.channels, rule[1:])
+		case '+', '-':
+			return user.applyCommandRule(lower)
+		default:
+			return errors.New("Syntax error")
+		}
+	}
+	return nil
+}
+
+// 应用+cmd、-cmd、+@category、-@category规则
+func (user *User) applyCommandRule(rule string) error {
+	allow := rule[0] == '+'
+	var names []string
+	if strings.HasPrefix(rule[1:], "@") {
+		var ok bool
+		names, ok = commandsInCategory(rule[2:])
+		if !ok {
+			return errors.New("Unknown command or category name in ACL")
+		}
+	} else {
+		if _, ok := CommandCategories(rule[1:]); !ok {
+			return errors.New("Unknown command or category name in ACL")
+		}
+		// +cmd同时作用于其所有子命令
+		names = append([]string{rule[1:]}, subcommandNames(rule[1:])...)
+	}
+	for _, name := range names {
+		user.commands[name] = allow
+	}
+	if rule[1:] == "@all" {
+		user.cmdRules = []string{rule}
+	} else {
+		user.cmdRules = append(user.cmdRules, rule)
+	}
+	return nil
+}
+
+func (user *User) flags() []string {
+	flags := make([]string, 0, 2)
+	if user.enabled {
+		flags = append(flags, "on")
+	} else {
+		flags = append(flags, "off")
+	}
+	if user.noPass {
+		flags = append(flags, "nopass")
+	}
+	return flags
+}
+
+func (user *User) passwordHashes() []string {
+	hashes := make([]string, 0, len(user.passwords))
+	for hash := range user.passwords {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+	return hashes
+}
+
+func (user *User) commandsString() string {
+	if len(user.cmdRules) == 0 {
+		return "-@all"
+	}
+	return strings.Join(user.cmdRules, " ")
+}
+
+func (user *User) keysString() string {
+	patterns := make([]string, len(user.keys))
+	for i, kp := range user.keys {
+		patterns[i] = kp.String()
+	}
+	return strings.Join(patterns, " ")
+}
+
+func (user *User) channelsString() string {
+	patterns := make([]string, len(user.channels))
+	for i, channel := range user.channels {
+		patterns[i] = "&" + channel
+	}
+	return strings.Join(patterns, " ")
+}
+
+// describe 以规则的形式描述用户，用于ACL LIST和aclfile
+func (user *User) describe() string {
+	parts := []string{"user", user.Name}
+	parts = append(parts, user.flags()...)
+	for _, hash := range user.passwordHashes() {
+		parts = append(parts, "#"+hash)
+	}
+	if keys := user.keysString(); keys != "" {
+		parts = append(parts, keys)
+	} else {
+		parts = append(parts, "resetkeys")
+	}
+	if channels := user.channelsString(); channels != "" {
+		parts = append(parts, channels)
+	} else {
+		parts = append(parts, "resetchannels")
+	}
+	parts = append(parts, user.commandsString())
+	return strings.Join(parts, " ")
+}
+
+func (user *User) checkPassword(password string) bool {
+	return user.noPass || user.passwords[hashPassword(password)]
+}
+
+func (user *User) canAccessKey(key string, write bool) bool {
+	for _, kp := range user.keys {
+		if ((write && kp.write) || (!write && kp.read)) && utils.MatchPattern(kp.pattern, key) {
+			return true
+		}
+	}
+	return false
+}
+
+func (user *User) canAccessChannel(channel string) bool {
+	for _, pattern := range user.channels {
+		if utils.MatchPattern(pattern, channel) {
+			return true
+		}
+	}
+	return false
+}
+
+/* ---- ACL log ---- */
+
+type aclLogEntry struct {
+	id         int64
+	count      int
+	reason     string // command、key、channel、auth
+	context    string // toplevel、multi、lua
+	object     string
+	username   string
+	clientInfo string
+	created    time.Time
+	updated    time.Time
+}
+
+/* ---- ACL ---- */
+
+type ACL struct {
+	users map[string]*User
+	lock  sync.RWMutex
+
+	log       []*aclLogEntry // 按时间倒序
+	logLock   sync.Mutex
+	nextLogId int64
+}
+
+// NewACL 创建ACL，并根据requirepass初始化default用户
+func NewACL() *ACL {
+	acl := &ACL{
+		users: make(map[string]*User),
+	}
+	acl.users[defaultUser] = newDefaultUser(Config.Requirepass)
+	return acl
+}
+
+func newDefaultUser(password string) *User {
+	user := newUser(defaultUser)
+	for _, rule := range []string{"on", "allkeys", "allchannels", "+@all"} {
+		_ = user.applyRule(rule)
+	}
+	if password != "" {
+		_ = user.applyRule(">" + password)
+	} else {
+		_ = user.applyRule("nopass")
+	}
+	return user
+}
+
+func (acl *ACL) GetUser(name string) (*User, bool) {
+	acl.lock.RLock()
+	defer acl.lock.RUnlock()
+	user, ok := acl.users[name]
+	return user, ok
+}
+
+// CurrentUser 返回client当前的用户，未通过鉴权时返回nil
+func (acl *ACL) CurrentUser(client _interface.Client) *User {
+	name := client.GetUser()
+	if name == "" {
+		// 未执行过auth时，若default用户无需密码，则视为default用户
+		user, ok := acl.GetUser(defaultUser)
+		if ok && user.enabled && user.noPass {
+			return user
+		}
+		return nil
+	}
+	user, ok := acl.GetUser(name)
+	if !ok || !user.enabled {
+		return nil
+	}
+	return user
+}
+
+// Authenticate 校验用户名和密码
+func (acl *ACL) Authenticate(client _interface.Client, username string, password string) bool {
+	user, ok := acl.GetUser(username)
+	if !ok || !user.enabled || !user.checkPassword(password) {
+		acl.addLog(client, "auth", "toplevel", "AUTH", username)
+		return false
+	}
+	return true
+}
+
+// Check 检查用户是否有权限执行该命令，context为toplevel、multi或lua
+func (acl *ACL) Check(client _interface.Client, user *User, cmdLine _type.CmdLine, context string) _interface.ErrorReply {
+	name := strings.ToLower(string(cmdLine[0]))
+	if aclExempt[name] {
+		return nil
+	}
+	if _, ok := CommandCategories(name); !ok {
+		return nil // 未知命令交由后续流程报错
+	}
+	// 有单独分类的子命令按parent|sub检查
+	perm := name
+	if len(cmdLine) > 1 {
+		sub := name + "|" + strings.ToLower(string(cmdLine[1]))
+		if _, ok := CommandCategories(sub); ok {
+			perm = sub
+		}
+	}
+	if !user.commands[perm] {
+		acl.addLog(client, "command", context, perm, user.Name)
+		return Reply.StandardError(fmt.Sprintf("NOPERM User %s has no permissions to run the '%s' command", user.Name, perm))
+	}
+	args := _type.Args(cmdLine[1:])
+	// 数据库命令与指定了key位置的系统命令(如copy、move)都检查key的权限
+	if meta, ok := lookupCommand(name); ok && meta.keysFind.Find != nil && utils.CheckArgNum(meta.Arity, cmdLine) {
+		writeKeys, readKeys := meta.keysFind.Find(args)
+		for _, key := range writeKeys {
+			if !user.canAccessKey(key, true) {
+				acl.addLog(client, "key", context, key, user.Name)
+				return Reply.StandardError("NOPERM No permissions to access a key")
+			}
+		}
+		for _, key := range readKeys {
+			if !user.canAccessKey(key, false) {
+				acl.addLog(client, "key", context, key, user.Name)
+				return Reply.StandardError("NOPERM No permissions to access a key")
+			}
+		}
+	}
+	if find, ok := channelsFind[name]; ok && len(args) > 0 {
+		for _, channel := range find(args) {
+			if !user.canAccessChannel(channel) {
+				acl.addLog(client, "channel", context, channel, user.Name)
+				return Reply.StandardError("NOPERM No permissions to access a channel")
+			}
+		}
+	}
+	return nil
+}
+
+// SetUser 创建或修改用户，所有规则都合法时才生效
+func (acl *ACL) SetUser(name string, rules []string) error {
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	var user *User
+	if old, ok := acl.users[name]; ok {
+		user = old.clone()
+	} else {
+		user = newUser(name)
+	}
+	for _, rule := range rules {
+		if err := user.applyRule(rule); err != nil {
+			return fmt.Errorf("Error in ACL SETUSER modifier '%s': %s", rule, err.Error())
+		}
+	}
+	acl.users[name] = user
+	return nil
+}
+
+// SetDefaultPassword requirepass修改时同步修改default用户的密码
+func (acl *ACL) SetDefaultPassword(password string) {
+	rules := []string{"resetpass", "nopass"}
+	if password != "" {
+		rules = []string{"resetpass", ">" + password}
+	}
+	_ = acl.SetUser(defaultUser, rules)
+}
+
+func (acl *ACL) DelUser(names ...string) (int, error) {
+	acl.lock.Lock()
+	defer acl.lock.Unlock()
+	for _, name := range names {
+		if name == defaultUser {
+			return 0, errors.New("The 'default' user cannot be removed")
+		}
+	}
+	count := 0
+	for _, name := range names {
+		if _, ok := acl.users[name]; ok {
+			delete(acl.users, name)
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Users 返回按用户名排序的所有用户
+func (acl *ACL) Users() []*User {
+	acl.lock.RLock()
+	defer acl.lock.RUnlock()
+	users := make([]*User, 0, len(acl.users))
+	for _, user := range acl.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Name < users[j].Name
+	})
+	return users
+}
+
+// LoadFile 从aclfile中加载用户，文件中的任意一行出错时不做任何修改
+func (acl *ACL) LoadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	users := make(map[string]*User)
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		fields := strings.Fields(line)
+		if fields[0] != "user" || len(fields) < 2 {
+			return fmt.Errorf("%s:%d: line should start with user keyword", path, lineNum)
+		}
+		name := fields[1]
+		if _, exists := users[name]; exists {
+			return fmt.Errorf("%s:%d: duplicate user '%s' found", path, lineNum, name)
+		}
+		user := newUser(name)
+		for _, rule := range fields[2:] {
+			if err = user.applyRule(rule); err != nil {
+				return fmt.Errorf("%s:%d: %s. ", path, lineNum, err.Error())
+			}
+		}
+		users[name] = user
+	}
+	if err = scanner.Err(); err != nil {
+		return err
+	}
+	if _, ok := users[defaultUser]; !ok {
+		users[defaultUser] = newDefaultUser(Config.Requirepass)
+	}
+	acl.lock.Lock()
+	acl.users = users
+	acl.lock.Unlock()
+	return nil
+}
+
+// SaveFile 将所有用户写入aclfile，先写临时文件再替换
+func (acl *ACL) SaveFile(path string) error {
+	var builder strings.Builder
+	for _, user := range acl.Users() {
+		builder.WriteString(user.describe())
+		builder.WriteString("\n")
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "acl-*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.WriteString(builder.String())
+	if err == nil {
+		err = tmp.Sync()
+	}
+	_ = tmp.Close()
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (acl *ACL) addLog(client _interface.Client, reason string, context string, object string, username string) {
+	acl.logLock.Lock()
+	defer acl.logLock.Unlock()
+	now := time.Now()
+	// 相同的拒绝记录合并为一条
+	for _, entry := range acl.log {
+		if entry.reason == reason && entry.context == context && entry.object == object && entry.username == username {
+			entry.count++
+			entry.updated = now
+			entry.clientInfo = "addr=" + client.RemoteAddr()
+			return
+		}
+	}
+	entry := &aclLogEntry{
+		id:         acl.nextLogId,
+		count:      1,
+		reason:     reason,
+		context:    context,
+		object:     object,
+		username:   username,
+		clientInfo: "addr=" + client.RemoteAddr(),
+		created:    now,
+		updated:    now,
+	}
+	acl.nextLogId++
+	acl.log = append([]*aclLogEntry{entry}, acl.log...)
+	if len(acl.log) > aclLogMaxLen {
+		acl.log = acl.log[:aclLogMaxLen]
+	}
+}
+
+func (acl *ACL) logReply(count int) _interface.Reply {
+	acl.logLock.Lock()
+	defer acl.logLock.Unlock()
+	if count < 0 || count > len(acl.log) {
+		count = len(acl.log)
+	}
+	now := time.Now()
+	replies := make([]_interface.Reply, count)
+	for i, entry := range acl.log[:count] {
+		age := now.Sub(entry.created).Seconds()
+		replies[i] = Reply.NewRawArrayReply([]_interface.Reply{
+			Reply.StringToBulkReply("count"), Reply.NewIntegerReply(int64(entry.count)),
+			Reply.StringToBulkReply("reason"), Reply.StringToBulkReply(entry.reason),
+			Reply.StringToBulkReply("context"), Reply.StringToBulkReply(entry.context),
+			Reply.StringToBulkReply("object"), Reply.StringToBulkReply(entry.object),
+			Reply.StringToBulkReply("username"), Reply.StringToBulkReply(entry.username),
+			Reply.StringToBulkReply("age-seconds"), Reply.StringToBulkReply(strconv.FormatFloat(age, 'f', 3, 64)),
+			Reply.StringToBulkReply("client-info"), Reply.StringToBulkReply(entry.clientInfo),
+			Reply.StringToBulkReply("entry-id"), Reply.NewIntegerReply(entry.id),
+			Reply.StringToBulkReply("timestamp-created"), Reply.NewIntegerReply(entry.created.UnixMilli()),
+			Reply.StringToBulkReply("timestamp-last-updated"), Reply.NewIntegerReply(entry.updated.UnixMilli()),
+		})
+	}
+	return Reply.NewRawArrayReply(replies)
+}
+
+func (acl *ACL) resetLog() {
+	acl.logLock.Lock()
+	acl.log = nil
+	acl.logLock.Unlock()
+}
+
+/* ---- commands ---- */
+
+func execAuth(server *Server, client _interface.Client, args _type.Args) _interface.Reply {
+	var username, password string
+	switch len(args) {
+	case 1:
+		username, password = defaultUser, string(args[0])
+		user, ok := server.acl.GetUser(defaultUser)
+		if ok && user.noPass {
+			return Reply.StandardError("AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?")
+		}
+	case 2:
+		username, password = string(args[0]), string(args[1])
+	default:
+		return Reply.SyntaxError()
+	}
+	if !server.acl.Authenticate(client, username, password) {
+		return Reply.StandardError("WRONGPASS invalid username-password pair or user is disabled.")
+	}
+	client.SetUser(username)
+	return Reply.NewOkReply()
+}
+
+func execACL(server *Server, client _interface.Client, args _type.Args) _interface.Reply {
+	sub := strings.ToLower(string(args[0]))
+	args = args[1:]
+	switch sub {
+	case "setuser":
+		if len(args) < 1 {
+			return Reply.ArgNumError("acl|setuser")
+		}
+		rules := make([]string, len(args)-1)
+		for i, rule := range args[1:] {
+			rules[i] = string(rule)
+		}
+		if err := server.acl.SetUser(string(args[0]), rules); err != nil {
+			return Reply.StandardError(err.Error())
+		}
+		return Reply.NewOkReply()
+	case "getuser":
+		if len(args) != 1 {
+			return Reply.ArgNumError("acl|getuser")
+		}
+		user, ok := server.acl.GetUser(string(args[0]))
+		if !ok {
+			return Reply.NewNilBulkReply()
+		}
+		return Reply.NewRawArrayReply([]_interface.Reply{
+			Reply.StringToBulkReply("flags"), Reply.StringToArrayReply(user.flags()...),
+			Reply.StringToBulkReply("passwords"), Reply.StringToArrayReply(user.passwordHashes()...),
+			Reply.StringToBulkReply("commands"), Reply.StringToBulkReply(user.commandsString()),
+			Reply.StringToBulkReply("keys"), Reply.StringToBulkReply(user.keysString()),
+			Reply.StringToBulkReply("channels"), Reply.StringToBulkReply(user.channelsString()),
+			Reply.StringToBulkReply("selectors"), Reply.NewEmptyArrayReply(),
+		})
+	case "deluser":
+		if len(args) < 1 {
+			return Reply.ArgNumError("acl|deluser")
+		}
+		names := make([]string, len(args))
+		for i, arg := range args {
+			names[i] = string(arg)
+		}
+		count, err := server.acl.DelUser(names...)
+		if err != nil {
+			return Reply.StandardError(err.Error())
+		}
+		// 与redis一致，断开以被删除的用户鉴权的连接
+		for _, c := range server.allClients() {
+			if containsString(names, c.GetUser()) {
+				c.Kill()
+			}
+		}
+		return Reply.NewIntegerReply(int64(count))
+	case "list", "users":
+		if len(args) != 0 {
+			return Reply.ArgNumError("acl|" + sub)
+		}
+		users := server.acl.Users()
+		lines := make([]string, len(users))
+		for i, user := range users {
+			if sub == "list" {
+				lines[i] = user.describe()
+			} else {
+				lines[i] = user.Name
+			}
+		}
+		return Reply.StringToArrayReply(lines...)
+	case "whoami":
+		if len(args) != 0 {
+			return Reply.ArgNumError("acl|whoami")
+		}
+		user := server.acl.CurrentUser(client)
+		if user == nil {
+			return Reply.NewNilBulkReply()
+		}
+		return Reply.StringToBulkReply(user.Name)
+	case "cat":
+		if len(args) > 1 {
+			return Reply.ArgNumError("acl|cat")
+		}
+		if len(args) == 0 {
+			return Reply.StringToArrayReply(Categories...)
+		}
+		names, ok := commandsInCategory(strings.ToLower(string(args[0])))
+		if !ok {
+			return Reply.StandardError("Unknown category '" + string(args[0]) + "'")
+		}
+		sort.Strings(names)
+		return Reply.StringToArrayReply(names...)
+	case "log":
+		if len(args) > 1 {
+			return Reply.ArgNumError("acl|log")
+		}
+		count := -1
+		if len(args) == 1 {
+			if strings.ToLower(string(args[0])) == "reset" {
+				server.acl.resetLog()
+				return Reply.NewOkReply()
+			}
+			n, err := strconv.Atoi(string(args[0]))
+			if err != nil || n < 0 {
+				return Reply.StandardError("value is out of range, must be positive")
+			}
+			count = n
+		}
+		return server.acl.logReply(count)
+	case "dryrun":
+		if len(args) < 2 {
+			return Reply.ArgNumError("acl|dryrun")
+		}
+		user, ok := server.acl.GetUser(string(args[0]))
+		if !ok {
+			return Reply.StandardError("User '" + string(args[0]) + "' not found")
+		}
+		cmdLine := _type.CmdLine(args[1:])
+		if _, ok := CommandCategories(strings.ToLower(string(cmdLine[0]))); !ok {
+			return Reply.StandardError("Command '" + string(cmdLine[0]) + "' not found")
+		}
+		// dryrun不记录ACL LOG，因此使用一个临时的ACL
+		dry := &ACL{users: map[string]*User{user.Name: user}}
+		if errReply := dry.Check(client, user, cmdLine, "toplevel"); errReply != nil {
+			return Reply.StringToBulkReply(errReply.Error())
+		}
+		return Reply.NewOkReply()
+	case "genpass":
+		bits := 256
+		if len(args) == 1 {
+			n, err := strconv.Atoi(string(args[0]))
+			if err != nil || n <= 0 || n > 4096 {
+				return Reply.StandardError("ACL GENPASS argument must be the number of bits for the output password, a positive number up to 4096")
+			}
+			bits = n
+		}
+		buf := make([]byte, (bits+7)/8)
+		_, _ = rand.Read(buf)
+		pass := hex.EncodeToString(buf)
+		return Reply.StringToBulkReply(pass[:(bits+3)/4])
+	case "load", "save":
+		if len(args) != 0 {
+			return Reply.ArgNumError("acl|" + sub)
+		}
+		if Config.Aclfile == "" {
+			return Reply.StandardError("This Redis instance is not configured to use an ACL file. You may want to specify users via the ACL SETUSER command and then issue a CONFIG REWRITE (assuming you have a Redis configuration file set) in order to store users in the Redis configuration.")
+		}
+		var err error
+		if sub == "load" {
+			err = server.acl.LoadFile(Config.Aclfile)
+		} else {
+			err = server.acl.SaveFile(Config.Aclfile)
+		}
+		if err != nil {
+			return Reply.StandardError(err.Error())
+		}
+		return Reply.NewOkReply()
+	}
+	return Reply.StandardError(fmt.Sprintf("unknown subcommand '%s'", sub))
+}
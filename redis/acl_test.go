@@ -0,0 +1,261 @@
+package redis_test
+
+import (
+	"go-redis/redis"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestACL_ClientSubcommandCategories(t *testing.T) {
+	server := newTestServer(t)
+	admin := newTestClient(t, server)
+	admin.expect("+OK\r\n", "acl", "setuser", "conn", "on", "nopass", "+@connection", "-@dangerous")
+	admin.expect("+OK\r\n", "acl", "setuser", "nodanger", "on", "nopass", "+@all", "-@dangerous")
+	admin.expect("+OK\r\n", "acl", "setuser", "allclient", "on", "nopass", "-@all", "+client")
+	admin.expect("+OK\r\n", "acl", "setuser", "nokill", "on", "nopass", "+client", "-client|kill")
+
+	denied := map[string][][]string{
+		"conn":     {{"client", "kill", "id", "1"}, {"client", "pause", "10"}, {"client", "unpause"}, {"client", "no-evict", "on"}},
+		"nodanger": {{"client", "kill", "id", "1"}, {"client", "pause", "10"}},
+		"nokill":   {{"client", "kill", "id", "1"}},
+	}
+	for name, cmdLines := range denied {
+		c := newTestClient(t, server)
+		c.expect("+OK\r\n", "auth", name, "x")
+		if got := c.do("client", "id"); strings.Contains(got, "NOPERM") {
+			t.Fatalf("%s: client id denied: %q", name, got)
+		}
+		for _, cmdLine := range cmdLines {
+			if got := c.do(cmdLine...); !strings.Contains(got, "NOPERM") || !strings.Contains(got, "client|"+cmdLine[1]) {
+				t.Fatalf("%s: %s: got %q, want NOPERM", name, strings.Join(cmdLine, " "), got)
+			}
+		}
+	}
+
+	c := newTestClient(t, server)
+	c.expect("+OK\r\n", "auth", "allclient", "x")
+	c.expect("+OK\r\n", "client", "unpause")
+	c.expect("+OK\r\n", "client", "no-evict", "on")
+}
+
+// copy、move等系统命令同样检查key的权限，copy读取源key、写入目标key
+func TestACL_CopyMoveKeyPermissions(t *testing.T) {
+	server := newTestServer(t)
+	admin := newTestClient(t, server)
+	admin.expect("+OK\r\n", "acl", "setuser", "pub", "on", "nopass", "~pub*", "+@all")
+	admin.expect("+OK\r\n", "acl", "setuser", "reader", "on", "nopass", "%R~secret", "~pub*", "+@all")
+	admin.expect("+OK\r\n", "set", "secret", "s")
+	admin.expect("+OK\r\n", "set", "pub0", "p")
+
+	c := newTestClient(t, server)
+	c.expect("+OK\r\n", "auth", "pub", "x")
+	for _, cmdLine := range [][]string{
+		{"get", "secret"},
+		{"copy", "secret", "pub1"},
+		{"copy", "pub0", "secret", "replace"},
+		{"move", "secret", "1"},
+	} {
+		if got := c.do(cmdLine...); !strings.Contains(got, "NOPERM") {
+			t.Fatalf("%s: got %q, want NOPERM", strings.Join(cmdLine, " "), got)
+		}
+	}
+	c.expect("$-1\r\n", "get", "pub1")
+	c.expect(":1\r\n", "copy", "pub0", "pub1")
+	c.expect(":1\r\n", "move", "pub1", "1")
+
+	// 只读权限的key可以作为copy的源，不能作为目标或被move
+	c = newTestClient(t, server)
+	c.expect("+OK\r\n", "auth", "reader", "x")
+	c.expect(":1\r\n", "copy", "secret", "pub2")
+	if got := c.do("copy", "pub0", "secret", "replace"); !strings.Contains(got, "NOPERM") {
+		t.Fatalf("copy to read-only key: got %q, want NOPERM", got)
+	}
+	if got := c.do("move", "secret", "1"); !strings.Contains(got, "NOPERM") {
+		t.Fatalf("move of read-only key: got %q, want NOPERM", got)
+	}
+	admin.expect("$1\r\ns\r\n", "get", "secret")
+}
+
+// expectNoPerm 检查命令因权限不足被拒绝
+func expectNoPerm(t *testing.T, c *testClient, args ...string) {
+	t.Helper()
+	if got := c.do(args...); !strings.HasPrefix(got, "-ERR: NOPERM") {
+		t.Fatalf("%s: got %q, want NOPERM", strings.Join(args, " "), got)
+	}
+}
+
+// ~pattern允许读写，%R~只允许读，%W~只允许写
+func TestACL_KeyPatterns(t *testing.T) {
+	server := newTestServer(t)
+	admin := newTestClient(t, server)
+	admin.expect("+OK\r\n", "acl", "setuser", "u", "on", ">pw", "+@all", "~rw:*", "%R~ro:*", "%W~wo:*")
+	for _, key := range []string{"rw:1", "ro:1", "wo:1", "other"} {
+		admin.expect("+OK\r\n", "set", key, "v")
+	}
+	c := newTestClient(t, server)
+	c.expect("+OK\r\n", "auth", "u", "pw")
+
+	c.expect("$1\r\nv\r\n", "get", "rw:1")
+	c.expect("+OK\r\n", "set", "rw:1", "x")
+	c.expect("$1\r\nv\r\n", "get", "ro:1")
+	expectNoPerm(t, c, "set", "ro:1", "x")
+	expectNoPerm(t, c, "get", "wo:1")
+	c.expect("+OK\r\n", "set", "wo:1", "x")
+	expectNoPerm(t, c, "get", "other")
+	expectNoPerm(t, c, "set", "other", "x")
+	// 多个key的命令中任意一个key不允许访问即被拒绝
+	expectNoPerm(t, c, "mget", "rw:1", "other")
+	expectNoPerm(t, c, "rename", "ro:1", "rw:2")
+	c.expect("+OK\r\n", "rename", "rw:1", "wo:2")
+	// 事务中的命令在入队时检查
+	c.expect("+OK\r\n", "multi")
+	expectNoPerm(t, c, "get", "other")
+	c.expect("-ERR: EXECABORT Transaction discarded because of previous errors.\r\n", "exec")
+	// 脚本中的命令同样检查key的权限
+	if got := c.do("eval", "return redis.call('get', KEYS[1])", "1", "other"); !strings.Contains(got, "NOPERM") {
+		t.Fatalf("eval on other key: got %q, want NOPERM", got)
+	}
+	admin.expect("$1\r\nv\r\n", "get", "other")
+	admin.expect("$1\r\nv\r\n", "get", "ro:1")
+}
+
+// &pattern限制subscribe、publish可以访问的channel
+func TestACL_ChannelPatterns(t *testing.T) {
+	server := newTestServer(t)
+	admin := newTestClient(t, server)
+	admin.expect("+OK\r\n", "acl", "setuser", "u", "on", ">pw", "+@all", "resetchannels", "&news.*")
+	c := newTestClient(t, server)
+	c.expect("+OK\r\n", "auth", "u", "pw")
+	c.expect(":0\r\n", "publish", "news.1", "m")
+	expectNoPerm(t, c, "publish", "secret", "m")
+	expectNoPerm(t, c, "subscribe", "news.1", "secret")
+	if got := c.do("subscribe", "news.1"); strings.Contains(got, "NOPERM") {
+		t.Fatalf("subscribe news.1: got %q", got)
+	}
+	admin.expect(":1\r\n", "publish", "news.1", "m")
+	admin.expect(":0\r\n", "publish", "secret", "m")
+}
+
+// AUTH user pass校验用户名、密码及用户是否开启，失败时保持之前的用户
+func TestACL_Auth(t *testing.T) {
+	server := newTestServer(t)
+	admin := newTestClient(t, server)
+	admin.expect("+OK\r\n", "acl", "setuser", "u", "on", ">pw", "+@all", "~*")
+	admin.expect("+OK\r\n", "acl", "setuser", "disabled", "off", ">pw", "+@all", "~*")
+	c := newTestClient(t, server)
+	wrongPass := "-ERR: WRONGPASS invalid username-password pair or user is disabled.\r\n"
+	c.expect(wrongPass, "auth", "u", "wrong")
+	c.expect(wrongPass, "auth", "nosuchuser", "pw")
+	c.expect(wrongPass, "auth", "disabled", "pw")
+	c.expect("$7\r\ndefault\r\n", "acl", "whoami")
+	c.expect("+OK\r\n", "auth", "u", "pw")
+	c.expect("$1\r\nu\r\n", "acl", "whoami")
+	c.expect(wrongPass, "auth", "u", "wrong")
+	c.expect("$1\r\nu\r\n", "acl", "whoami")
+	// 失败的鉴权记录在ACL LOG中
+	if got := admin.do("acl", "log"); !strings.Contains(got, "nosuchuser") || !strings.Contains(got, "auth") {
+		t.Fatalf("acl log does not record failed auth: %q", got)
+	}
+	// 关闭用户后，已鉴权的连接不能再执行命令
+	admin.expect("+OK\r\n", "acl", "setuser", "u", "off")
+	if got := c.do("get", "k"); !strings.Contains(got, "NOAUTH") {
+		t.Fatalf("get after user disabled: got %q, want NOAUTH", got)
+	}
+}
+
+// ACL DELUSER断开以被删除的用户鉴权的连接，其他连接不受影响
+func TestACL_DelUserDisconnects(t *testing.T) {
+	server := newTestServer(t)
+	admin := newTestClient(t, server)
+	admin.expect("+OK\r\n", "acl", "setuser", "u", "on", ">pw", "+@all", "~*")
+	admin.expect("+OK\r\n", "acl", "setuser", "other", "on", ">pw", "+@all", "~*")
+	connect := func(user string) net.Conn {
+		conn, peer := net.Pipe()
+		client := redis.NewClient(conn)
+		if err := server.AddClient(client); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			server.CloseClient(client)
+			_ = peer.Close()
+		})
+		if reply := server.ExecCommand(client, [][]byte{[]byte("auth"), []byte(user), []byte("pw")}); string(reply.ToBytes()) != "+OK\r\n" {
+			t.Fatalf("auth %s: %q", user, reply.ToBytes())
+		}
+		return peer
+	}
+	deleted, kept := connect("u"), connect("other")
+	admin.expect(":1\r\n", "acl", "deluser", "u")
+	_ = deleted.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := io.ReadAll(deleted); err != nil {
+		t.Fatalf("connection of deleted user was not closed: %v", err)
+	}
+	_ = kept.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, err := kept.Read(make([]byte, 1)); err == io.EOF {
+		t.Fatal("connection of another user was closed")
+	}
+	admin.expect("-ERR: The 'default' user cannot be removed\r\n", "acl", "deluser", "default")
+}
+
+// newACLServer 以aclfile创建server，启动时从文件加载用户
+func newACLServer(t *testing.T, filename string) *redis.Server {
+	t.Helper()
+	aclfile := redis.Config.Aclfile
+	redis.Config.Aclfile = filename
+	t.Cleanup(func() { redis.Config.Aclfile = aclfile })
+	return newTestServer(t)
+}
+
+// 启动时加载aclfile，ACL SAVE写入的文件可以被ACL LOAD及重启后的server加载，出错的文件不做任何修改
+func TestACL_FileRoundTrip(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "users.acl")
+	content := "# comment\nuser alice on >pw ~a:* +get\n"
+	if err := os.WriteFile(filename, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	server := newACLServer(t, filename)
+	admin := newTestClient(t, server)
+	alice := newTestClient(t, server)
+	alice.expect("+OK\r\n", "auth", "alice", "pw")
+	alice.expect("$-1\r\n", "get", "a:1")
+	expectNoPerm(t, alice, "get", "b:1")
+	expectNoPerm(t, alice, "set", "a:1", "v")
+
+	admin.expect("+OK\r\n", "acl", "setuser", "bob", "on", ">secret", "%R~x:*", "resetchannels", "&news", "+@read", "-keys")
+	admin.expect("+OK\r\n", "acl", "save")
+	list := admin.do("acl", "list")
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "user bob on") || strings.Contains(string(data), "secret") {
+		t.Fatalf("saved acl file %q", data)
+	}
+
+	// 修改后重新加载，恢复为文件中的用户
+	admin.expect("+OK\r\n", "acl", "setuser", "carol", "on", "nopass")
+	admin.expect("+OK\r\n", "acl", "load")
+	admin.expect(list, "acl", "list")
+
+	// 重启后加载相同的用户
+	restarted := newTestClient(t, newACLServer(t, filename))
+	restarted.expect(list, "acl", "list")
+	restarted.expect("+OK\r\n", "auth", "bob", "secret")
+	restarted.expect("$-1\r\n", "get", "x:1")
+	expectNoPerm(t, restarted, "set", "x:1", "v")
+	expectNoPerm(t, restarted, "keys", "*")
+
+	// 文件中有错误时ACL LOAD失败，用户保持不变
+	if err := os.WriteFile(filename, []byte(content+"user dave on +nosuchcommand\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if got := admin.do("acl", "load"); !strings.HasPrefix(got, "-ERR") {
+		t.Fatalf("acl load of invalid file: got %q", got)
+	}
+	admin.expect(list, "acl", "list")
+}
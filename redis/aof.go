@@ -1,18 +1,22 @@
 package redis
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 	_type "go-redis/interface/type"
 	"go-redis/redis/utils"
 	"go-redis/resp"
 	Reply "go-redis/resp/reply"
 	"go-redis/utils/logger"
+	_sync "go-redis/utils/sync"
 	"io"
 	"io/ioutil"
 	"os"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -22,10 +26,15 @@ const (
 	FsyncNo       = "no"
 )
 
-type aofMsg struct {
+type aofCmd struct {
 	cmdLine _type.CmdLine
 	dbIdx   int
-	wg      *sync.WaitGroup
+}
+
+type aofMsg struct {
+	cmds  []aofCmd // 待写入的命令
+	multi bool     // 是否以MULTI/EXEC包裹，用于事务
+	wg    *sync.WaitGroup
 }
 
 type Persister struct {
@@ -34,15 +43,22 @@ type Persister struct {
 	server *Server // 当前针对的服务实例
 	dbIdx  int     // 当前针对的server中的数据库
 
-	filename string   // aof文件路径
-	fsync    string   // aof文件写入策略：always/everysec/no
-	file     *os.File // aof文件描述符
+	filename string       // aof文件路径
+	fsync    atomic.Value // aof文件写入策略：always/everysec/no，可通过config set修改
+	file     *os.File     // aof文件描述符
 
 	msgCh   chan *aofMsg  // 主线程通知Persister进行aof
 	doneCh  chan struct{} // 通知主线程aof操作已完成
 	reading bool          // 是否正处于reading状态
 	pausing sync.Mutex    // 用于rewrite和fsync时暂停aof
 
+	// 重写的状态，用于info
+	rewriting         _sync.Boolean
+	lastRewriteStatus string
+	lastRewriteTime   time.Duration
+	rewrites          int64
+	fsyncLatency      *histogram
+	statLock          sync.Mutex
 }
 
 func NewPersister(server *Server, filename string, fsync string) *Persister {
@@ -54,7 +70,7 @@ func NewPersister(server *Server, filename string, fsync string) *Persister {
 	pst.dbIdx = 0
 
 	pst.filename = filename
-	pst.fsync = fsync
+	pst.fsync.Store(fsync)
 	aofFile, err := os.OpenFile(pst.filename, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0600)
 	if err != nil {
 		panic(err)
@@ -64,6 +80,8 @@ func NewPersister(server *Server, filename string, fsync string) *Persister {
 	pst.msgCh = make(chan *aofMsg, 1<<16)
 	pst.doneCh = make(chan struct{})
 	pst.reading = false
+	pst.lastRewriteStatus = "ok"
+	pst.fsyncLatency = newHistogram()
 	return pst
 }
 
@@ -72,43 +90,71 @@ func (pst *Persister) Listening() {
 	go func() {
 		for msg := range pst.msgCh {
 			pst.WriteAOF(msg)
+			if msg.wg != nil {
+				msg.wg.Done()
+			}
 		}
 		pst.doneCh <- struct{}{}
 	}()
-	// everysec
-	if pst.fsync == FsyncEverysec {
-		ticker := time.NewTicker(time.Second)
-		go func() {
-			for {
-				select {
-				case <-ticker.C:
-					pst.pausing.Lock() // 暂停aof
-					err := pst.file.Sync()
-					if err != nil {
-						logger.Error("fsync failed: " + err.Error())
-					}
-					pst.pausing.Unlock()
-				case <-pst.ctx.Done():
-					return
+	// everysec，写入策略可能被修改，因此每次都检查
+	ticker := time.NewTicker(time.Second)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if pst.GetFsync() != FsyncEverysec {
+					continue
 				}
+				pst.pausing.Lock() // 暂停aof
+				err := pst.sync()
+				if err != nil {
+					logger.Error("fsync failed: " + err.Error())
+				}
+				pst.pausing.Unlock()
+			case <-pst.ctx.Done():
+				return
 			}
-		}()
-	}
+		}
+	}()
+}
+
+func (pst *Persister) GetFsync() string {
+	fsync, _ := pst.fsync.Load().(string)
+	return fsync
+}
+
+// SetFsync 修改写入策略，立即生效
+func (pst *Persister) SetFsync(fsync string) {
+	pst.fsync.Store(fsync)
 }
 
 func (pst *Persister) ToAOF(dbIdx int, cmdLine _type.CmdLine) {
+	pst.send(&aofMsg{cmds: []aofCmd{{cmdLine: cmdLine, dbIdx: dbIdx}}})
+}
+
+// ToAOFTx 将事务中的写命令以MULTI/EXEC包裹后一次性写入，使宕机后不会只恢复事务的一部分
+func (pst *Persister) ToAOFTx(cmds []aofCmd) {
+	if len(cmds) == 0 {
+		return
+	}
+	pst.send(&aofMsg{cmds: cmds, multi: len(cmds) > 1})
+}
+
+func (pst *Persister) send(msg *aofMsg) {
 	// reading状态中不进行写入
 	if pst.reading {
 		return
 	}
-	msg := &aofMsg{
-		cmdLine: cmdLine,
-		dbIdx:   dbIdx,
-	}
-	// always
-	if pst.fsync == FsyncAlways {
-		pst.WriteAOF(msg)
-		err := pst.file.Sync() // 直接写入
+	// always，同样经过listening协程写入，保证与之前的命令顺序一致
+	if pst.GetFsync() == FsyncAlways {
+		msg.wg = &sync.WaitGroup{}
+		msg.wg.Add(1)
+		pst.msgCh <- msg
+		msg.wg.Wait()
+		pst.pausing.Lock()
+		err := pst.sync() // 直接写入
+		pst.pausing.Unlock()
 		if err != nil {
 			logger.Warn(err)
 		}
@@ -117,28 +163,43 @@ func (pst *Persister) ToAOF(dbIdx int, cmdLine _type.CmdLine) {
 	}
 }
 
+// 写磁盘，并记录耗时
+func (pst *Persister) sync() error {
+	start := time.Now()
+	err := pst.file.Sync()
+	duration := time.Since(start)
+	pst.fsyncLatency.observe(duration)
+	LatencyMonitor.Add("aof-fsync", duration)
+	return err
+}
+
 func (pst *Persister) WriteAOF(msg *aofMsg) {
 	// 上锁，防止write期间进行aof重写
 	pst.pausing.Lock()
 	defer pst.pausing.Unlock()
-	// pst针对的db与目标db不符
-	if msg.dbIdx != pst.dbIdx {
-		// 写入一个"Select db"命令
-		cmdLine := utils.ToCmd("SELECT", []byte(strconv.Itoa(msg.dbIdx)))
-		data := Reply.NewArrayReply(cmdLine).ToBytes()
-		_, err := pst.file.Write(data) // 写入
-		if err != nil {
-			logger.Warn(err)
-			return // 此时应该跳过这条命令
+	// 编码后一次性写入，事务不会被重写或fsync分隔开
+	var buf bytes.Buffer
+	if msg.multi {
+		buf.Write(Reply.NewArrayReply(utils.ToCmd("MULTI")).ToBytes())
+	}
+	dbIdx := pst.dbIdx
+	for _, cmd := range msg.cmds {
+		// pst针对的db与目标db不符，写入一个"Select db"命令
+		if cmd.dbIdx != dbIdx {
+			buf.Write(Reply.NewArrayReply(utils.ToCmd("SELECT", []byte(strconv.Itoa(cmd.dbIdx)))).ToBytes())
+			dbIdx = cmd.dbIdx
 		}
-		pst.dbIdx = msg.dbIdx // 修改pst针对的db
+		buf.Write(Reply.NewArrayReply(cmd.cmdLine).ToBytes())
+	}
+	if msg.multi {
+		buf.Write(Reply.NewArrayReply(utils.ToCmd("EXEC")).ToBytes())
 	}
-	// 写入当前命令
-	data := Reply.NewArrayReply(msg.cmdLine).ToBytes()
-	_, err := pst.file.Write(data) // 写入
+	_, err := pst.file.Write(buf.Bytes()) // 写入
 	if err != nil {
 		logger.Warn(err)
+		return
 	}
+	pst.dbIdx = dbIdx // 修改pst针对的db
 }
 
 // ReadAOF 加载AOF文件以恢复数据，size为读取的字节数，size<0表示读取整个文件
@@ -167,7 +228,13 @@ func (pst *Persister) ReadAOF(size int64) {
 	}
 	ch := resp.NewParser(reader).ParseFile()
 	aofConn := GetAofClient()
+	var txQueue []_type.CmdLine // MULTI之后的命令，读到EXEC后才执行
+	inTx := false
+	var offset, txOffset int64 // 已解析的字节数，以及MULTI的起始位置，均为解析器实际读取的位置
+	txDbIdx := 0
 	for payload := range ch {
+		start := offset
+		offset = payload.Offset
 		if payload.Err != nil {
 			if payload.Err == io.EOF {
 				break // 已结束
@@ -184,22 +251,95 @@ func (pst *Persister) ReadAOF(size int64) {
 			logger.Error("reply error: require multi bulk reply")
 			continue
 		}
+		name := strings.ToLower(string(cmd.Bulks[0]))
 		// 若为"select"命令，更新dbIdx
-		if strings.ToLower(string(cmd.Bulks[0])) == "select" {
+		if name == "select" {
 			dbIdx, err := strconv.Atoi(string(cmd.Bulks[1]))
 			if err == nil {
 				pst.dbIdx = dbIdx
 			}
 		}
-		// 执行命令
-		reply := pst.server.ExecForAOF(aofConn, cmd.Bulks)
-		if Reply.IsErrorReply(reply) {
-			logger.Error("execute error: ", string(reply.ToBytes()))
+		// 事务中的命令先缓存，读到EXEC后再一起执行
+		switch {
+		case name == "multi":
+			inTx, txQueue = true, nil
+			txOffset, txDbIdx = start, pst.dbIdx
+			continue
+		case name == "exec" && inTx:
+			for _, cmdLine := range txQueue {
+				pst.execAOF(aofConn, cmdLine)
+			}
+			inTx, txQueue = false, nil
+			continue
+		case inTx:
+			txQueue = append(txQueue, cmd.Bulks)
+			continue
+		}
+		pst.execAOF(aofConn, cmd.Bulks)
+	}
+	// 文件在事务中间结束(如写入事务时宕机)，丢弃不完整的事务
+	if inTx {
+		logger.Warn(fmt.Sprintf("aof file ends inside a transaction, discarding %d commands", len(txQueue)))
+		pst.dbIdx = txDbIdx
+		// 加载整个文件时截断不完整的事务，否则之后追加的命令会被当作该事务的一部分
+		if size < 0 {
+			if err := os.Truncate(pst.filename, txOffset); err != nil {
+				logger.Warn("truncate aof file failed: " + err.Error())
+			}
 		}
 	}
 }
 
+// 执行aof文件中的命令
+func (pst *Persister) execAOF(aofConn *Client, cmdLine _type.CmdLine) {
+	reply := pst.server.ExecForAOF(aofConn, cmdLine)
+	if Reply.IsErrorReply(reply) {
+		logger.Error("execute error: ", string(reply.ToBytes()))
+	}
+}
+
 func (pst *Persister) ReWrite() error {
+	pst.rewriting.Set(true)
+	defer pst.rewriting.Set(false)
+	start := time.Now()
+	err := pst.reWrite()
+	pst.statLock.Lock()
+	pst.lastRewriteTime = time.Since(start)
+	pst.rewrites++
+	LatencyMonitor.Add("aof-rewrite", pst.lastRewriteTime)
+	if err != nil {
+		pst.lastRewriteStatus = "err"
+	} else {
+		pst.lastRewriteStatus = "ok"
+	}
+	pst.statLock.Unlock()
+	return err
+}
+
+// RewriteStats 返回是否正在重写、上次重写的状态及耗时
+func (pst *Persister) RewriteStats() (bool, string, time.Duration) {
+	pst.statLock.Lock()
+	defer pst.statLock.Unlock()
+	return pst.rewriting.Get(), pst.lastRewriteStatus, pst.lastRewriteTime
+}
+
+// Rewrites 返回重写的次数
+func (pst *Persister) Rewrites() int64 {
+	pst.statLock.Lock()
+	defer pst.statLock.Unlock()
+	return pst.rewrites
+}
+
+// FileSize 返回当前aof文件的大小
+func (pst *Persister) FileSize() int64 {
+	fileInfo, err := os.Stat(pst.filename)
+	if err != nil {
+		return 0
+	}
+	return fileInfo.Size()
+}
+
+func (pst *Persister) reWrite() error {
 	// 准备工作
 	newFile, oldSize, oldIdx, err := pst.preReWrite()
 	if err != nil {
@@ -213,6 +353,13 @@ func (pst *Persister) ReWrite() error {
 	tempServer.persister = tempPersister
 	// 临时server加载原aof文件，只读取oldSize字节
 	tempServer.persister.ReadAOF(oldSize)
+	// 写入函数库
+	for _, cmd := range tempServer.functions.ToCmds() {
+		_, err = newFile.Write(cmd.ToBytes())
+		if err != nil {
+			return err
+		}
+	}
 	// 将临时server的数据写入新aof文件
 	for i := 0; i < len(tempServer.databases); i++ {
 		// select
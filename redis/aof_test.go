@@ -0,0 +1,116 @@
+package redis_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 文件在事务中间结束时，从MULTI之前截断，位置不受空行、null bulk等非规范编码的影响
+func TestAOF_TruncateIncompleteTx(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "appendonly.aof")
+	committed := "*3\r\n$3\r\nset\r\n$1\r\na\r\n$1\r\n1\r\n" +
+		"\r\n\n" + // 空行被忽略
+		"*3\r\n$3\r\nset\r\n$1\r\nb\r\n$-1\r\n" + // null bulk按空字符串执行
+		"*3\r\n$3\r\nset\r\n$3\r\nlen\r\n$10\r\n0123456789\r\n"
+	partial := "*1\r\n$5\r\nmulti\r\n*3\r\n$3\r\nset\r\n$1\r\nc\r\n$1\r\n1\r\n"
+	if err := os.WriteFile(filename, []byte(committed+partial), 0600); err != nil {
+		t.Fatal(err)
+	}
+	server := newAOFServer(t, filename)
+	c := newTestClient(t, server)
+	c.expect("$1\r\n1\r\n", "get", "a")
+	c.expect("$0\r\n\r\n", "get", "b")
+	c.expect("$10\r\n0123456789\r\n", "get", "len")
+	c.expect("$-1\r\n", "get", "c")
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != committed {
+		t.Fatalf("aof truncated to %q, want %q", data, committed)
+	}
+}
+
+// waitAOF 等待aof文件中出现want，写入aof是异步的
+func waitAOF(t *testing.T, filename string, want string) string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, _ := os.ReadFile(filename)
+		if strings.Contains(string(data), want) {
+			return string(data)
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("aof file %q does not contain %q", data, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// 脚本中的多个写命令以MULTI/EXEC包裹写入aof
+func TestAOF_ScriptWrappedInMulti(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "appendonly.aof")
+	server := newAOFServer(t, filename)
+	c := newTestClient(t, server)
+	c.expect(":2\r\n", "eval", "redis.call('set', KEYS[1], '1'); return redis.call('incr', KEYS[1])", "1", "k")
+	c.expect("+OK\r\n", "set", "after", "1")
+	want := "*1\r\n$5\r\nMULTI\r\n" +
+		"*3\r\n$3\r\nSet\r\n$1\r\nk\r\n$1\r\n1\r\n" +
+		"*2\r\n$4\r\nIncr\r\n$1\r\nk\r\n" +
+		"*1\r\n$4\r\nEXEC\r\n"
+	waitAOF(t, filename, "after")
+	waitAOF(t, filename, want)
+}
+
+// 事务整体以MULTI/EXEC包裹写入aof，事务中的SELECT在重启后仍作用于之后的命令
+func TestAOF_TxWithSelect(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "appendonly.aof")
+	server := newAOFServer(t, filename)
+	c := newTestClient(t, server)
+	c.expect("+OK\r\n", "multi")
+	c.expect("+QUEUED\r\n", "set", "a", "1")
+	c.expect("+QUEUED\r\n", "select", "1")
+	c.expect("+QUEUED\r\n", "set", "b", "2")
+	c.expect("*3\r\n+OK\r\n+OK\r\n+OK\r\n", "exec")
+	want := "*1\r\n$5\r\nMULTI\r\n" +
+		"*3\r\n$3\r\nSet\r\n$1\r\na\r\n$1\r\n1\r\n" +
+		"*2\r\n$6\r\nSELECT\r\n$1\r\n1\r\n" +
+		"*3\r\n$3\r\nSet\r\n$1\r\nb\r\n$1\r\n2\r\n" +
+		"*1\r\n$4\r\nEXEC\r\n"
+	waitAOF(t, filename, want)
+
+	c = newTestClient(t, newAOFServer(t, filename))
+	c.expect("$1\r\n1\r\n", "get", "a")
+	c.expect("$-1\r\n", "get", "b")
+	c.expect("+OK\r\n", "select", "1")
+	c.expect("$1\r\n2\r\n", "get", "b")
+	c.expect("$-1\r\n", "get", "a")
+}
+
+// 文件在切换了db的事务中间结束，截断后追加的命令写入正确的db
+func TestAOF_TruncatedTxRestoresDB(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "appendonly.aof")
+	committed := "*3\r\n$3\r\nset\r\n$1\r\na\r\n$1\r\n1\r\n"
+	partial := "*1\r\n$5\r\nmulti\r\n" +
+		"*2\r\n$6\r\nselect\r\n$1\r\n1\r\n" +
+		"*3\r\n$3\r\nset\r\n$1\r\nb\r\n$1\r\n1\r\n"
+	if err := os.WriteFile(filename, []byte(committed+partial), 0600); err != nil {
+		t.Fatal(err)
+	}
+	c := newTestClient(t, newAOFServer(t, filename))
+	c.expect("+OK\r\n", "select", "1")
+	c.expect("$-1\r\n", "get", "b")
+	c.expect("+OK\r\n", "set", "c", "1")
+	// 截断后aof针对的db回到db0，因此c之前需要写入SELECT 1
+	waitAOF(t, filename, "*2\r\n$6\r\nSELECT\r\n$1\r\n1\r\n*3\r\n$3\r\nSet\r\n$1\r\nc\r\n")
+
+	c = newTestClient(t, newAOFServer(t, filename))
+	c.expect("$1\r\n1\r\n", "get", "a")
+	c.expect("$-1\r\n", "get", "c")
+	c.expect("+OK\r\n", "select", "1")
+	c.expect("$1\r\n1\r\n", "get", "c")
+	c.expect("$-1\r\n", "get", "b")
+}
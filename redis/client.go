@@ -1,105 +1,467 @@
 package redis
 
 import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	_interface "go-redis/interface"
 	_type "go-redis/interface/type"
-	_sync "go-redis/utils/sync"
+	Reply "go-redis/resp/reply"
+	"go-redis/utils/logger"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type Client struct {
-	conn       net.Conn
-	selectedDB int        // 选择的数据库id
-	password   string     // 密码
-	wait       _sync.Wait // 等待数据发送完毕
+	conn net.Conn
+	id   int64 // 唯一id，从1开始递增
+
+	// 以下字段会被其他client的client list/info及clientsCron读取，由infoLock保护
+	infoLock   sync.Mutex
+	name       string // 通过hello setname设置的名称
+	protocol   int    // RESP协议版本，2或3
+	selectedDB int    // 选择的数据库id
+	user       string // 通过auth认证的用户名
+
+	createdAt time.Time       // 建立连接的时间
+	lastTime  time.Time       // 最近一次执行命令的时间
+	lastCmd   string          // 最近一次执行的命令
+	replyOff  bool            // client reply off
+	replySkip int             // 需要跳过回复的命令数，用于client reply skip
+	noEvict   bool            // client no-evict
+	txState   bool            // 事务状态
+	txQueue   []_type.CmdLine // 命令队列
+
+	// 输出缓冲区，由writer goroutine负责发送
+	out           []byte        // 待发送的数据
+	outSpare      []byte        // 发送完毕的缓冲区，复用以减少内存分配
+	outSending    int           // 正在发送的数据长度
+	outLock       sync.Mutex    // 输出缓冲区的锁
+	outSignal     chan struct{} // 通知writer goroutine发送
+	outDone       chan struct{} // writer goroutine已退出
+	outClosing    bool          // 正在关闭，发送完剩余数据后writer goroutine退出
+	outDropped    bool          // 超过输出缓冲区限制或发送失败，不再写入
+	outLazy       bool          // 只在有数据待发送时才开启writer goroutine，发送完毕后退出
+	outWriting    bool          // lazy模式下writer goroutine正在运行
+	softReachedAt time.Time     // 首次超过软限制的时间
 
 	// 发布订阅
 	channels map[string]bool // 当前订阅的channel
 	subLock  sync.Mutex      // sub/unsub时的锁
 
 	// 事务
-	txState bool             // 事务状态
-	txQueue []_type.CmdLine  // 命令队列
-	txError []error          // 错误
-	txWatch []map[string]int // watch的key
+	txError []error                                // 错误
+	txWatch map[int]map[string]bool                // watch的key，按数据库编号，值为watch时key是否已过期
+	txDirty int32                                  // watch的key已被修改，exec将放弃执行
+	txAOF   func(dbIdx int, cmdLine _type.CmdLine) // exec期间写入aof的命令先缓存，执行完毕后一起写入
 }
 
-// 连接池
-var clientPool = sync.Pool{
-	New: func() any {
-		return &Client{}
-	},
-}
+// 下一个client的id
+var nextClientId int64
+
+// 因超过输出缓冲区限制而断开的连接数
+var outputBufferLimitDisconnections int64
+
+var errOutputBufferLimit = errors.New("output buffer limit reached")
 
 func NewClient(conn net.Conn) *Client {
-	client, ok := clientPool.Get().(*Client) // 尝试从连接池中获取
-	if !ok {
-		client = &Client{} // 从连接池中获取失败，新建一个
-	}
-	client.conn = conn
+	client := newClient(conn)
+	client.outSignal = make(chan struct{}, 1)
+	client.outDone = make(chan struct{})
+	go client.writing()
 	return client
 }
 
+// NewLazyClient 用于由event loop处理的连接，writer goroutine只在有数据待发送时运行，空闲时不占用goroutine
+func NewLazyClient(conn net.Conn) *Client {
+	client := newClient(conn)
+	client.outLazy = true
+	return client
+}
+
+func newClient(conn net.Conn) *Client {
+	// client不放回池中复用，关闭后仍可能被client list、clientsCron等持有
+	now := time.Now()
+	return &Client{
+		conn:      conn,
+		id:        atomic.AddInt64(&nextClientId, 1),
+		protocol:  2,
+		createdAt: now,
+		lastTime:  now,
+	}
+}
+
 // GetAofClient 用于aof
 func GetAofClient() *Client {
-	return &Client{}
+	return &Client{protocol: 2}
 }
 
+// Write 写入数据并立即发送，用于pub/sub、monitor等不属于当前命令的回复
 func (client *Client) Write(b []byte) (int, error) {
+	n, err := client.write(b)
+	if err == nil {
+		client.Flush()
+	}
+	return n, err
+}
+
+// WriteReply 按client的协议版本编码回复，写入并立即发送
+func (client *Client) WriteReply(reply _interface.Reply) (int, error) {
+	return client.Write(Reply.Encode(reply, client.GetProtocol()))
+}
+
+// AddReply 将命令的回复写入输出缓冲区，在Flush时才发送，使pipeline中的多条回复合并发送
+func (client *Client) AddReply(reply _interface.Reply) {
+	_, _ = client.write(Reply.Encode(reply, client.GetProtocol()))
+}
+
+// Flush 通知writer goroutine发送输出缓冲区中的数据
+func (client *Client) Flush() {
+	if client.outLazy {
+		client.startWriter()
+		return
+	}
+	select {
+	case client.outSignal <- struct{}{}:
+	default: // 已有未处理的通知
+	}
+}
+
+// GetOutputBufferSize 输出缓冲区中未发送完毕的数据长度
+func (client *Client) GetOutputBufferSize() int {
+	client.outLock.Lock()
+	defer client.outLock.Unlock()
+	return len(client.out) + client.outSending
+}
+
+// 写入输出缓冲区，超过client-output-buffer-limit时断开连接
+func (client *Client) write(b []byte) (int, error) {
 	if len(b) == 0 {
 		return 0, nil
 	}
-	client.wait.Add(1) // 加入等待组
-	defer func() {
-		client.wait.Done()
-	}()
-	return client.conn.Write(b)
+	client.outLock.Lock()
+	defer client.outLock.Unlock()
+	if client.outDropped {
+		return 0, errOutputBufferLimit
+	}
+	client.out = append(client.out, b...)
+	if client.checkOutputBufferLimit(len(client.out) + client.outSending) {
+		// 丢弃未发送的数据，关闭连接，由读取该连接的goroutine负责清理
+		client.outDropped = true
+		client.out = nil
+		atomic.AddInt64(&outputBufferLimitDisconnections, 1)
+		logger.Warn(fmt.Sprintf("client [%s] closed for overcoming of output buffer limits", client.RemoteAddr()))
+		client.Kill()
+		return 0, errOutputBufferLimit
+	}
+	return len(b), nil
+}
+
+// 判断输出缓冲区是否超过限制：超过硬限制，或持续超过软限制的时间大于soft-seconds
+func (client *Client) checkOutputBufferLimit(size int) bool {
+	limit := Config.ClientOutputBufferLimit[client.outputBufferClass()]
+	if limit.Hard > 0 && int64(size) >= limit.Hard {
+		return true
+	}
+	if limit.Soft <= 0 || int64(size) < limit.Soft {
+		client.softReachedAt = time.Time{}
+		return false
+	}
+	now := time.Now()
+	if client.softReachedAt.IsZero() {
+		client.softReachedAt = now // 首次超过软限制
+		return false
+	}
+	return now.Sub(client.softReachedAt) > time.Duration(limit.SoftSeconds)*time.Second
+}
+
+// 订阅了channel的client使用pubsub的限制，其余使用normal的限制
+func (client *Client) outputBufferClass() int {
+	if client.ChannelsCount() > 0 {
+		return ClientClassPubsub
+	}
+	return ClientClassNormal
+}
+
+// writing 循环发送输出缓冲区中的数据，直到client关闭
+func (client *Client) writing() {
+	defer close(client.outDone)
+	for range client.outSignal {
+		client.outLock.Lock()
+		data := client.out
+		client.out = client.outSpare[:0]
+		client.outSending = len(data)
+		closing := client.outClosing
+		client.outLock.Unlock()
+		var err error
+		if len(data) > 0 {
+			_, err = client.conn.Write(data)
+		}
+		client.outLock.Lock()
+		client.outSpare = data
+		client.outSending = 0
+		client.outLock.Unlock()
+		if closing || err != nil {
+			return
+		}
+	}
+}
+
+// startWriter lazy模式下，输出缓冲区不为空且writer goroutine未运行时，开启writer goroutine
+func (client *Client) startWriter() {
+	client.outLock.Lock()
+	defer client.outLock.Unlock()
+	if client.outWriting || client.outDropped || len(client.out) == 0 {
+		return
+	}
+	client.outWriting = true
+	client.outDone = make(chan struct{})
+	go client.drain(client.outDone)
+}
+
+// drain lazy模式下的writer goroutine，发送输出缓冲区中的数据，缓冲区为空时退出
+func (client *Client) drain(done chan struct{}) {
+	defer close(done)
+	for {
+		client.outLock.Lock()
+		data := client.out
+		if len(data) == 0 || client.outDropped {
+			client.outWriting = false
+			client.outSpare = nil // 空闲的连接不保留缓冲区
+			client.outLock.Unlock()
+			return
+		}
+		client.out = client.outSpare[:0]
+		client.outSending = len(data)
+		client.outLock.Unlock()
+		_, err := client.conn.Write(data)
+		client.outLock.Lock()
+		client.outSpare = data
+		client.outSending = 0
+		if err != nil {
+			client.outDropped = true
+			client.out = nil
+		}
+		client.outLock.Unlock()
+	}
 }
 
 func (client *Client) Close() error {
-	// 初始化该client，并放回连接池
-	client.wait.WaitWithTimeout(10 * time.Second) // 等待执行结束或超时
+	if client.outLazy {
+		return client.closeLazy()
+	}
+	// 发送剩余数据后关闭连接，超时则直接关闭
+	client.outLock.Lock()
+	client.outClosing = true
+	client.outLock.Unlock()
+	client.Flush()
+	select {
+	case <-client.outDone:
+	case <-time.After(10 * time.Second):
+	}
+	err := client.conn.Close()
+	<-client.outDone // 连接关闭后writer goroutine会立即退出
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		if _, ok := client.conn.(*tls.Conn); !ok {
+			return err // 被client kill关闭的连接，无需报错
+		}
+		// tls连接关闭时对端可能已断开，发送close_notify失败无需报错
+	}
+	return nil
+}
+
+// closeLazy 与Close相同，发送剩余数据后关闭连接，之后不再开启writer goroutine
+func (client *Client) closeLazy() error {
+	client.startWriter()
+	client.outLock.Lock()
+	done := client.outDone
+	client.outLock.Unlock()
+	if done != nil {
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+		}
+	}
 	err := client.conn.Close()
-	if err != nil {
+	client.outLock.Lock()
+	client.outDropped = true
+	client.outLock.Unlock()
+	if done != nil {
+		<-done
+	}
+	if err != nil && !errors.Is(err, net.ErrClosed) {
 		return err
 	}
-	client.selectedDB = 0
-	client.password = ""
-	client.channels = nil
-	client.txState = false
-	client.txQueue = nil
-	client.txError = nil
-	client.txWatch = nil
-	clientPool.Put(client) // 放回连接池
 	return nil
 }
 
+// RemoteAddr unix socket的连接没有对端地址，与redis一样以"<path>:0"表示
 func (client *Client) RemoteAddr() string {
+	if client.IsUnixSocket() {
+		return client.conn.LocalAddr().String() + ":0"
+	}
 	if client.conn != nil {
 		return client.conn.RemoteAddr().String()
 	}
 	return ""
 }
 
+// TLSConnectionState 返回tls连接的状态(包括客户端证书)，非tls连接返回nil
+func (client *Client) TLSConnectionState() *tls.ConnectionState {
+	if conn, ok := client.conn.(*tls.Conn); ok {
+		state := conn.ConnectionState()
+		return &state
+	}
+	return nil
+}
+
+func (client *Client) LocalAddr() string {
+	if client.IsUnixSocket() {
+		return client.conn.LocalAddr().String() + ":0"
+	}
+	if client.conn != nil {
+		return client.conn.LocalAddr().String()
+	}
+	return ""
+}
+
+// IsUnixSocket 是否为通过unix socket建立的连接
+func (client *Client) IsUnixSocket() bool {
+	return client.conn != nil && client.conn.LocalAddr().Network() == "unix"
+}
+
+// Kill 断开连接，由读取该连接的goroutine负责清理
+func (client *Client) Kill() {
+	if client.conn != nil {
+		_ = client.conn.Close()
+	}
+}
+
+/* ---- client info ---- */
+
+func (client *Client) GetCreatedAt() time.Time {
+	client.infoLock.Lock()
+	defer client.infoLock.Unlock()
+	return client.createdAt
+}
+
+func (client *Client) GetLastTime() time.Time {
+	client.infoLock.Lock()
+	defer client.infoLock.Unlock()
+	return client.lastTime
+}
+
+func (client *Client) GetLastCmd() string {
+	client.infoLock.Lock()
+	defer client.infoLock.Unlock()
+	return client.lastCmd
+}
+
+// SetLastCmd 记录最近执行的命令及时间
+func (client *Client) SetLastCmd(cmd string) {
+	now := time.Now()
+	client.infoLock.Lock()
+	defer client.infoLock.Unlock()
+	client.lastCmd = cmd
+	client.lastTime = now
+}
+
+func (client *Client) IsNoEvict() bool {
+	client.infoLock.Lock()
+	defer client.infoLock.Unlock()
+	return client.noEvict
+}
+
+func (client *Client) SetNoEvict(flag bool) {
+	client.infoLock.Lock()
+	defer client.infoLock.Unlock()
+	client.noEvict = flag
+}
+
+/* ---- client reply ---- */
+
+// SetReplyMode 设置client reply的模式：on、off、skip
+func (client *Client) SetReplyMode(mode string) {
+	switch mode {
+	case "on":
+		client.replyOff, client.replySkip = false, 0
+	case "off":
+		client.replyOff = true
+	case "skip":
+		client.replySkip = 2 // client reply skip自身以及下一条命令
+	}
+}
+
+// ShouldReply 当前命令的回复是否需要发送给客户端
+func (client *Client) ShouldReply() bool {
+	if client.replyOff {
+		return false
+	}
+	if client.replySkip > 0 {
+		client.replySkip--
+		return false
+	}
+	return true
+}
+
+/* ---- id/name/protocol ---- */
+
+func (client *Client) GetId() int64 {
+	return client.id
+}
+
+func (client *Client) GetName() string {
+	client.infoLock.Lock()
+	defer client.infoLock.Unlock()
+	return client.name
+}
+
+func (client *Client) SetName(name string) {
+	client.infoLock.Lock()
+	defer client.infoLock.Unlock()
+	client.name = name
+}
+
+func (client *Client) GetProtocol() int {
+	client.infoLock.Lock()
+	defer client.infoLock.Unlock()
+	return client.protocol
+}
+
+func (client *Client) SetProtocol(protocol int) {
+	client.infoLock.Lock()
+	defer client.infoLock.Unlock()
+	client.protocol = protocol
+}
+
 /* ---- select db ---- */
 
 func (client *Client) GetSelectDB() int {
+	client.infoLock.Lock()
+	defer client.infoLock.Unlock()
 	return client.selectedDB
 }
 
 func (client *Client) SetSelectDB(n int) {
+	client.infoLock.Lock()
+	defer client.infoLock.Unlock()
 	client.selectedDB = n
 }
 
 /* ---- authentication ---- */
 
-func (client *Client) SetPassword(password string) {
-	client.password = password
+func (client *Client) SetUser(user string) {
+	client.infoLock.Lock()
+	defer client.infoLock.Unlock()
+	client.user = user
 }
 
-func (client *Client) GetPassword() string {
-	return client.password
+func (client *Client) GetUser() string {
+	client.infoLock.Lock()
+	defer client.infoLock.Unlock()
+	return client.user
 }
 
 /* ---- publish/subscribe ---- */
@@ -123,10 +485,14 @@ func (client *Client) UnSubscribe(channel string) {
 }
 
 func (client *Client) ChannelsCount() int {
+	client.subLock.Lock()
+	defer client.subLock.Unlock()
 	return len(client.channels)
 }
 
 func (client *Client) GetChannels() []string {
+	client.subLock.Lock()
+	defer client.subLock.Unlock()
 	if client.channels == nil {
 		return make([]string, 0)
 	}
@@ -142,22 +508,35 @@ func (client *Client) GetChannels() []string {
 /* ---- transaction ---- */
 
 func (client *Client) IsTxState() bool {
+	client.infoLock.Lock()
+	defer client.infoLock.Unlock()
 	return client.txState
 }
 
 func (client *Client) SetTxState(flag bool) {
+	client.infoLock.Lock()
+	defer client.infoLock.Unlock()
 	client.txState = flag
 }
 
 func (client *Client) EnTxQueue(cmdLine _type.CmdLine) {
+	client.infoLock.Lock()
+	defer client.infoLock.Unlock()
 	client.txQueue = append(client.txQueue, cmdLine)
 }
 
 func (client *Client) GetTxQueue() []_type.CmdLine {
+	client.infoLock.Lock()
+	defer client.infoLock.Unlock()
 	return client.txQueue
 }
+
+// ClearTxQueue 清空命令队列及入队时的错误
 func (client *Client) ClearTxQueue() {
+	client.infoLock.Lock()
 	client.txQueue = nil
+	client.infoLock.Unlock()
+	client.txError = nil
 }
 
 func (client *Client) AddTxError(err error) {
@@ -168,25 +547,40 @@ func (client *Client) GetTxError() []error {
 	return client.txError
 }
 
-func (client *Client) InitWatch(dbNum int) {
-	if client.txWatch != nil {
-		return
-	}
-	txWatch := make([]map[string]int, dbNum)
-	for i := 0; i < dbNum; i++ {
-		txWatch[i] = make(map[string]int)
-	}
-	client.txWatch = txWatch
+func (client *Client) SetTxAOF(toAOF func(dbIdx int, cmdLine _type.CmdLine)) {
+	client.txAOF = toAOF
+}
+
+func (client *Client) GetTxAOF() func(dbIdx int, cmdLine _type.CmdLine) {
+	return client.txAOF
 }
 
 func (client *Client) DestroyWatch() {
 	client.txWatch = nil
+	atomic.StoreInt32(&client.txDirty, 0)
 }
 
-func (client *Client) SetWatchKey(dbIdx int, key string, version int) {
-	client.txWatch[dbIdx][key] = version
+func (client *Client) SetWatchKey(dbIdx int, key string, expired bool) {
+	if client.txWatch == nil {
+		client.txWatch = make(map[int]map[string]bool)
+	}
+	if client.txWatch[dbIdx] == nil {
+		client.txWatch[dbIdx] = make(map[string]bool)
+	}
+	if _, ok := client.txWatch[dbIdx][key]; !ok {
+		client.txWatch[dbIdx][key] = expired
+	}
 }
 
-func (client *Client) GetWatchKeys() []map[string]int {
+func (client *Client) GetWatchKeys() map[int]map[string]bool {
 	return client.txWatch
 }
+
+// SetWatchDirty watch的key被其他client修改，由修改key的goroutine调用
+func (client *Client) SetWatchDirty() {
+	atomic.StoreInt32(&client.txDirty, 1)
+}
+
+func (client *Client) IsWatchDirty() bool {
+	return atomic.LoadInt32(&client.txDirty) == 1
+}
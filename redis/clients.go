@@ -0,0 +1,443 @@
+package redis
+
+import (
+	"fmt"
+	_interface "go-redis/interface"
+	_type "go-redis/interface/type"
+	Reply "go-redis/resp/reply"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 含有子命令的命令，记录最近执行的命令时带上子命令，如client|list
+var containerCmds = map[string]bool{
+	"client":   true,
+	"config":   true,
+	"acl":      true,
+	"script":   true,
+	"function": true,
+	"slowlog":  true,
+	"latency":  true,
+	"command":  true,
+}
+
+// 返回命令的完整名称
+func fullCmdName(cmdLine _type.CmdLine) string {
+	name := strings.ToLower(string(cmdLine[0]))
+	if containerCmds[name] && len(cmdLine) > 1 {
+		return name + "|" + strings.ToLower(string(cmdLine[1]))
+	}
+	return name
+}
+
+/* ---- client pause ---- */
+
+// clientPause client pause的状态
+type clientPause struct {
+	lock  sync.Mutex
+	all   bool          // 暂停所有命令，否则只暂停写命令
+	until time.Time     // 暂停的结束时间
+	ch    chan struct{} // client unpause时关闭
+}
+
+// Pause 暂停client的命令，已处于暂停状态时取更严格的模式与更晚的结束时间
+func (pause *clientPause) Pause(timeout time.Duration, all bool) {
+	pause.lock.Lock()
+	defer pause.lock.Unlock()
+	until := time.Now().Add(timeout)
+	if pause.ch != nil && time.Now().Before(pause.until) {
+		all = all || pause.all
+		if pause.until.After(until) {
+			until = pause.until
+		}
+	} else {
+		pause.ch = make(chan struct{})
+	}
+	pause.all = all
+	pause.until = until
+}
+
+func (pause *clientPause) Unpause() {
+	pause.lock.Lock()
+	defer pause.lock.Unlock()
+	if pause.ch != nil {
+		close(pause.ch)
+		pause.ch = nil
+	}
+}
+
+// Wait 处于暂停状态时阻塞，直到暂停结束
+func (pause *clientPause) Wait(client _interface.Client, cmdLine _type.CmdLine) {
+	for {
+		pause.lock.Lock()
+		if pause.ch == nil || !time.Now().Before(pause.until) {
+			pause.lock.Unlock()
+			return
+		}
+		if !pause.all && !isWriteCmd(client, cmdLine) {
+			pause.lock.Unlock()
+			return
+		}
+		ch, remain := pause.ch, time.Until(pause.until)
+		pause.lock.Unlock()
+		timer := time.NewTimer(remain)
+		select {
+		case <-ch:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// 判断命令是否可能修改数据，用于client pause write
+func isWriteCmd(client _interface.Client, cmdLine _type.CmdLine) bool {
+	name := strings.ToLower(string(cmdLine[0]))
+	if cmd, ok := CmdRouter[name]; ok {
+		return cmd.Status == ReadWrite
+	}
+	switch name {
+	case "eval", "evalsha", "fcall", "publish":
+		return true
+	case "exec":
+		for _, queued := range client.GetTxQueue() {
+			if isWriteCmd(client, queued) {
+				return true
+			}
+		}
+		return false
+	}
+	categories, _ := CommandCategories(name)
+	return containsString(categories, CatWrite)
+}
+
+/* ---- client info ---- */
+
+// 客户端名称只能包含'!'到'~'之间的字符
+func validClientName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if name[i] < '!' || name[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// clientInfo 以client list的格式描述client
+func (server *Server) clientInfo(client _interface.Client) string {
+	now := time.Now()
+	flags := ""
+	multi := -1
+	if client.IsTxState() {
+		flags += "x"
+		multi = len(client.GetTxQueue())
+	}
+	if client.ChannelsCount() > 0 {
+		flags += "P"
+	}
+	if server.monitor.IsMonitor(client) {
+		flags += "O"
+	}
+	if state, ok := server.tracking.getState(client); ok {
+		flags += "t"
+		if state.broken {
+			flags += "R"
+		}
+	}
+	if client.IsNoEvict() {
+		flags += "e"
+	}
+	if client.IsUnixSocket() {
+		flags += "U"
+	}
+	if flags == "" {
+		flags = "N"
+	}
+	user := client.GetUser()
+	if user == "" {
+		user = defaultUser
+	}
+	cmd := client.GetLastCmd()
+	if cmd == "" {
+		cmd = "NULL"
+	}
+	return fmt.Sprintf("id=%d addr=%s laddr=%s name=%s age=%d idle=%d flags=%s db=%d sub=%d psub=0 multi=%d omem=%d user=%s resp=%d cmd=%s",
+		client.GetId(), client.RemoteAddr(), client.LocalAddr(), client.GetName(),
+		int64(now.Sub(client.GetCreatedAt()).Seconds()), int64(now.Sub(client.GetLastTime()).Seconds()),
+		flags, client.GetSelectDB(), client.ChannelsCount(), multi, client.GetOutputBufferSize(), user, client.GetProtocol(), cmd)
+}
+
+// 按id排序的所有client
+func (server *Server) allClients() []_interface.Client {
+	clients := make([]_interface.Client, 0)
+	server.clients.Range(func(key, value any) bool {
+		clients = append(clients, value.(_interface.Client))
+		return true
+	})
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].GetId() < clients[j].GetId()
+	})
+	return clients
+}
+
+// 判断client是否属于指定的类型
+func matchClientType(client _interface.Client, clientType string) (bool, error) {
+	switch clientType {
+	case "normal":
+		return client.ChannelsCount() == 0, nil
+	case "pubsub":
+		return client.ChannelsCount() > 0, nil
+	case "master", "replica", "slave":
+		return false, nil
+	}
+	return false, fmt.Errorf("Unknown client type '%s'", clientType)
+}
+
+/* ---- commands ---- */
+
+func execClient(server *Server, client _interface.Client, args _type.Args) _interface.Reply {
+	sub := strings.ToLower(string(args[0]))
+	args = args[1:]
+	switch sub {
+	case "id":
+		if len(args) != 0 {
+			return Reply.ArgNumError("client|id")
+		}
+		return Reply.NewIntegerReply(client.GetId())
+	case "setname":
+		if len(args) != 1 {
+			return Reply.ArgNumError("client|setname")
+		}
+		name := string(args[0])
+		if !validClientName(name) {
+			return Reply.StandardError("Client names cannot contain spaces, newlines or special characters.")
+		}
+		client.SetName(name)
+		return Reply.NewOkReply()
+	case "getname":
+		if len(args) != 0 {
+			return Reply.ArgNumError("client|getname")
+		}
+		if client.GetName() == "" {
+			return Reply.NewNilBulkReply()
+		}
+		return Reply.StringToBulkReply(client.GetName())
+	case "info":
+		if len(args) != 0 {
+			return Reply.ArgNumError("client|info")
+		}
+		return Reply.NewVerbatimReply("txt", server.clientInfo(client)+"\n")
+	case "list":
+		return clientList(server, args)
+	case "kill":
+		return clientKill(server, client, args)
+	case "pause":
+		return clientPauseCmd(server, args)
+	case "unpause":
+		if len(args) != 0 {
+			return Reply.ArgNumError("client|unpause")
+		}
+		server.pause.Unpause()
+		return Reply.NewOkReply()
+	case "reply":
+		if len(args) != 1 {
+			return Reply.ArgNumError("client|reply")
+		}
+		mode := strings.ToLower(string(args[0]))
+		if mode != "on" && mode != "off" && mode != "skip" {
+			return Reply.SyntaxError()
+		}
+		client.SetReplyMode(mode)
+		return Reply.NewOkReply()
+	case "no-evict":
+		if len(args) != 1 {
+			return Reply.ArgNumError("client|no-evict")
+		}
+		switch strings.ToLower(string(args[0])) {
+		case "on":
+			client.SetNoEvict(true)
+		case "off":
+			client.SetNoEvict(false)
+		default:
+			return Reply.SyntaxError()
+		}
+		return Reply.NewOkReply()
+	case "unblock":
+		if len(args) != 1 && len(args) != 2 {
+			return Reply.ArgNumError("client|unblock")
+		}
+		if _, err := strconv.ParseInt(string(args[0]), 10, 64); err != nil {
+			return Reply.StandardError("value is not an integer or out of range")
+		}
+		if len(args) == 2 {
+			mode := strings.ToLower(string(args[1]))
+			if mode != "timeout" && mode != "error" {
+				return Reply.StandardError("CLIENT UNBLOCK reason should be TIMEOUT or ERROR")
+			}
+		}
+		return Reply.NewIntegerReply(0) // 不存在阻塞命令，没有可以解除阻塞的client
+	case "tracking":
+		return clientTracking(server, client, args)
+	case "caching":
+		return clientCaching(server, client, args)
+	case "getredir":
+		return clientGetRedir(server, client, args)
+	case "trackinginfo":
+		return clientTrackingInfo(server, client, args)
+	}
+	return Reply.StandardError(fmt.Sprintf("unknown subcommand '%s'", sub))
+}
+
+// client list [TYPE normal|master|replica|pubsub] [ID id [id ...]]
+func clientList(server *Server, args _type.Args) _interface.Reply {
+	clientType := ""
+	var ids map[int64]bool
+	for i := 0; i < len(args); i++ {
+		opt := strings.ToLower(string(args[i]))
+		switch {
+		case opt == "type" && i+1 < len(args):
+			clientType = strings.ToLower(string(args[i+1]))
+			i++
+		case opt == "id" && i+1 < len(args):
+			ids = make(map[int64]bool)
+			for i++; i < len(args); i++ {
+				id, err := strconv.ParseInt(string(args[i]), 10, 64)
+				if err != nil || id <= 0 {
+					return Reply.StandardError("Invalid client ID")
+				}
+				ids[id] = true
+			}
+		default:
+			return Reply.SyntaxError()
+		}
+	}
+	var builder strings.Builder
+	for _, c := range server.allClients() {
+		if ids != nil && !ids[c.GetId()] {
+			continue
+		}
+		if clientType != "" {
+			matched, err := matchClientType(c, clientType)
+			if err != nil {
+				return Reply.StandardError(err.Error())
+			}
+			if !matched {
+				continue
+			}
+		}
+		builder.WriteString(server.clientInfo(c))
+		builder.WriteString("\n")
+	}
+	return Reply.NewVerbatimReply("txt", builder.String())
+}
+
+// client kill addr:port
+// client kill [ID id] [ADDR addr] [LADDR addr] [USER username] [TYPE type] [SKIPME yes|no]
+func clientKill(server *Server, client _interface.Client, args _type.Args) _interface.Reply {
+	if len(args) == 0 {
+		return Reply.ArgNumError("client|kill")
+	}
+	// 旧的格式，只按地址匹配
+	if len(args) == 1 {
+		addr := string(args[0])
+		for _, c := range server.allClients() {
+			if c.RemoteAddr() == addr {
+				c.Kill()
+				return Reply.NewOkReply()
+			}
+		}
+		return Reply.StandardError("No such client")
+	}
+	if len(args)%2 != 0 {
+		return Reply.SyntaxError()
+	}
+	var filters []func(c _interface.Client) (bool, error)
+	skipMe := true
+	for i := 0; i < len(args); i += 2 {
+		opt, value := strings.ToLower(string(args[i])), string(args[i+1])
+		switch opt {
+		case "id":
+			id, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || id <= 0 {
+				return Reply.StandardError("client-id should be greater than 0")
+			}
+			filters = append(filters, func(c _interface.Client) (bool, error) { return c.GetId() == id, nil })
+		case "addr":
+			filters = append(filters, func(c _interface.Client) (bool, error) { return c.RemoteAddr() == value, nil })
+		case "laddr":
+			filters = append(filters, func(c _interface.Client) (bool, error) { return c.LocalAddr() == value, nil })
+		case "user":
+			if _, ok := server.acl.GetUser(value); !ok {
+				return Reply.StandardError(fmt.Sprintf("No such user '%s'", value))
+			}
+			filters = append(filters, func(c _interface.Client) (bool, error) {
+				user := c.GetUser()
+				if user == "" {
+					user = defaultUser
+				}
+				return user == value, nil
+			})
+		case "type":
+			clientType := strings.ToLower(value)
+			if _, err := matchClientType(client, clientType); err != nil {
+				return Reply.StandardError(err.Error())
+			}
+			filters = append(filters, func(c _interface.Client) (bool, error) { return matchClientType(c, clientType) })
+		case "skipme":
+			switch strings.ToLower(value) {
+			case "yes":
+				skipMe = true
+			case "no":
+				skipMe = false
+			default:
+				return Reply.SyntaxError()
+			}
+		default:
+			return Reply.SyntaxError()
+		}
+	}
+	killed := 0
+	for _, c := range server.allClients() {
+		if skipMe && c == client {
+			continue
+		}
+		matched := true
+		for _, filter := range filters {
+			if ok, _ := filter(c); !ok {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			c.Kill()
+			killed++
+		}
+	}
+	return Reply.NewIntegerReply(int64(killed))
+}
+
+// client pause timeout [WRITE|ALL]
+func clientPauseCmd(server *Server, args _type.Args) _interface.Reply {
+	if len(args) != 1 && len(args) != 2 {
+		return Reply.ArgNumError("client|pause")
+	}
+	timeout, err := strconv.ParseInt(string(args[0]), 10, 64)
+	if err != nil || timeout < 0 {
+		return Reply.StandardError("timeout is not an integer or out of range")
+	}
+	all := true
+	if len(args) == 2 {
+		switch strings.ToLower(string(args[1])) {
+		case "write":
+			all = false
+		case "all":
+			all = true
+		default:
+			return Reply.SyntaxError()
+		}
+	}
+	server.pause.Pause(time.Duration(timeout)*time.Millisecond, all)
+	return Reply.NewOkReply()
+}
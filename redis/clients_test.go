@@ -0,0 +1,85 @@
+package redis_test
+
+import (
+	"go-redis/redis"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// client list读取其他client的字段，与这些client执行命令并发进行，使用-race检查
+func TestClientList_ConcurrentWithCommands(t *testing.T) {
+	server := newTestServer(t)
+	observer := newTestClient(t, server)
+	worker := newTestClient(t, server)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			worker.do("client", "setname", "worker"+strconv.Itoa(i))
+			worker.do("select", strconv.Itoa(i%2))
+			worker.do("multi")
+			worker.do("set", "k", "v")
+			worker.do("discard")
+			worker.do("hello", strconv.Itoa(2+i%2))
+		}
+	}()
+	for i := 0; i < 200; i++ {
+		observer.do("client", "list")
+		observer.do("client", "info")
+	}
+	wg.Wait()
+}
+
+// timeout后空闲的client被clientsCron断开，期间不断有client连接和关闭，使用-race检查
+func TestClientsCron_IdleTimeout(t *testing.T) {
+	timeout := redis.Config.Timeout
+	redis.Config.Timeout = 1
+	defer func() { redis.Config.Timeout = timeout }()
+	server := newTestServer(t)
+
+	conn, peer := net.Pipe()
+	idle := redis.NewClient(conn)
+	if err := server.AddClient(idle); err != nil {
+		t.Fatal(err)
+	}
+	defer server.CloseClient(idle)
+	closed := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(io.Discard, peer)
+		close(closed)
+	}()
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			conn, peer := net.Pipe()
+			go func() { _, _ = io.Copy(io.Discard, peer) }()
+			client := redis.NewClient(conn)
+			if server.AddClient(client) == nil {
+				server.ExecCommand(client, [][]byte{[]byte("ping")})
+				server.CloseClient(client)
+			}
+			_ = peer.Close()
+		}
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Error("idle client not closed")
+	}
+	close(stop)
+	wg.Wait()
+}
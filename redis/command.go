@@ -0,0 +1,268 @@
+package redis
+
+import (
+	"fmt"
+	_interface "go-redis/interface"
+	_type "go-redis/interface/type"
+	"go-redis/redis/utils"
+	Reply "go-redis/resp/reply"
+	"sort"
+	"strings"
+)
+
+// 按名称排序的所有命令
+func sortedCommands() []*commandMeta {
+	names := CommandNames()
+	sort.Strings(names)
+	metas := make([]*commandMeta, len(names))
+	for i, name := range names {
+		metas[i], _ = lookupCommand(name)
+	}
+	return metas
+}
+
+// 写命令及脚本中的key可读写，读命令中的key只读
+func (meta *commandMeta) keyFlags() []string {
+	if containsString(meta.Categories, CatWrite) || meta.keysFind.Movable {
+		return []string{"RW", "UPDATE"}
+	}
+	return []string{"RO", "ACCESS"}
+}
+
+// key specs，由First、Last、Step得出
+func (meta *commandMeta) keySpecs() _interface.Reply {
+	keysFind := meta.keysFind
+	if keysFind.Movable {
+		return Reply.NewRawArrayReply([]_interface.Reply{Reply.NewMapReply([]_interface.Reply{
+			Reply.StringToBulkReply("flags"), stringsToStatusSet(meta.keyFlags()),
+			Reply.StringToBulkReply("begin_search"), Reply.NewMapReply([]_interface.Reply{
+				Reply.StringToBulkReply("type"), Reply.StringToBulkReply("index"),
+				Reply.StringToBulkReply("spec"), Reply.NewMapReply([]_interface.Reply{
+					Reply.StringToBulkReply("index"), Reply.NewIntegerReply(2),
+				}),
+			}),
+			Reply.StringToBulkReply("find_keys"), Reply.NewMapReply([]_interface.Reply{
+				Reply.StringToBulkReply("type"), Reply.StringToBulkReply("keynum"),
+				Reply.StringToBulkReply("spec"), Reply.NewMapReply([]_interface.Reply{
+					Reply.StringToBulkReply("keynumidx"), Reply.NewIntegerReply(0),
+					Reply.StringToBulkReply("firstkey"), Reply.NewIntegerReply(1),
+					Reply.StringToBulkReply("keystep"), Reply.NewIntegerReply(1),
+				}),
+			}),
+		})})
+	}
+	if keysFind.First == 0 {
+		return Reply.NewEmptyArrayReply()
+	}
+	// lastkey相对于第一个key
+	lastKey := keysFind.Last
+	if lastKey >= 0 {
+		lastKey -= keysFind.First
+	}
+	return Reply.NewRawArrayReply([]_interface.Reply{Reply.NewMapReply([]_interface.Reply{
+		Reply.StringToBulkReply("flags"), stringsToStatusSet(meta.keyFlags()),
+		Reply.StringToBulkReply("begin_search"), Reply.NewMapReply([]_interface.Reply{
+			Reply.StringToBulkReply("type"), Reply.StringToBulkReply("index"),
+			Reply.StringToBulkReply("spec"), Reply.NewMapReply([]_interface.Reply{
+				Reply.StringToBulkReply("index"), Reply.NewIntegerReply(int64(keysFind.First)),
+			}),
+		}),
+		Reply.StringToBulkReply("find_keys"), Reply.NewMapReply([]_interface.Reply{
+			Reply.StringToBulkReply("type"), Reply.StringToBulkReply("range"),
+			Reply.StringToBulkReply("spec"), Reply.NewMapReply([]_interface.Reply{
+				Reply.StringToBulkReply("lastkey"), Reply.NewIntegerReply(int64(lastKey)),
+				Reply.StringToBulkReply("keystep"), Reply.NewIntegerReply(int64(keysFind.Step)),
+				Reply.StringToBulkReply("limit"), Reply.NewIntegerReply(0),
+			}),
+		}),
+	})})
+}
+
+// info 以command info的格式描述命令
+func (meta *commandMeta) info() _interface.Reply {
+	categories := make([]string, len(meta.Categories))
+	for i, category := range meta.Categories {
+		categories[i] = "@" + category
+	}
+	return Reply.NewRawArrayReply([]_interface.Reply{
+		Reply.StringToBulkReply(meta.Name),
+		Reply.NewIntegerReply(int64(meta.Arity)),
+		stringsToStatusSet(meta.flags()),
+		Reply.NewIntegerReply(int64(meta.keysFind.First)),
+		Reply.NewIntegerReply(int64(meta.keysFind.Last)),
+		Reply.NewIntegerReply(int64(meta.keysFind.Step)),
+		stringsToStatusSet(categories),
+		Reply.NewEmptyArrayReply(), // tips
+		meta.keySpecs(),
+		meta.subcommandsInfo(),
+	})
+}
+
+// 有单独ACL分类的子命令的command info
+func (meta *commandMeta) subcommandsInfo() _interface.Reply {
+	names := make([]string, 0, len(meta.subcommands))
+	for sub := range meta.subcommands {
+		names = append(names, sub)
+	}
+	sort.Strings(names)
+	replies := make([]_interface.Reply, len(names))
+	for i, sub := range names {
+		replies[i] = meta.subcommands[sub].info()
+	}
+	return Reply.NewRawArrayReply(replies)
+}
+
+// docs 以command docs的格式描述命令
+func (meta *commandMeta) docs() _interface.Reply {
+	pairs := []_interface.Reply{
+		Reply.StringToBulkReply("summary"), Reply.StringToBulkReply(meta.Doc.Summary),
+		Reply.StringToBulkReply("since"), Reply.StringToBulkReply(meta.Doc.Since),
+		Reply.StringToBulkReply("group"), Reply.StringToBulkReply(commandGroup(meta.Categories)),
+	}
+	if meta.Doc.Complexity != "" {
+		pairs = append(pairs, Reply.StringToBulkReply("complexity"), Reply.StringToBulkReply(meta.Doc.Complexity))
+	}
+	return Reply.NewMapReply(pairs)
+}
+
+// RESP2中为状态回复组成的数组，RESP3中为集合
+func stringsToStatusSet(items []string) _interface.Reply {
+	replies := make([]_interface.Reply, len(items))
+	for i, item := range items {
+		replies[i] = Reply.NewStringReply(item)
+	}
+	return Reply.NewSetReply(replies)
+}
+
+/* ---- command ---- */
+
+func execCommands(server *Server, client _interface.Client, args _type.Args) _interface.Reply {
+	if len(args) == 0 {
+		metas := sortedCommands()
+		replies := make([]_interface.Reply, len(metas))
+		for i, meta := range metas {
+			replies[i] = meta.info()
+		}
+		return Reply.NewRawArrayReply(replies)
+	}
+	sub := strings.ToLower(string(args[0]))
+	args = args[1:]
+	switch sub {
+	case "count":
+		if len(args) != 0 {
+			return Reply.ArgNumError("command|count")
+		}
+		return Reply.NewIntegerReply(int64(len(CmdRouter) + len(SysCmdRouter)))
+	case "list":
+		return commandList(args)
+	case "info":
+		return commandInfo(args)
+	case "docs":
+		return commandDocsReply(args)
+	case "getkeys":
+		return commandGetKeys(args, false)
+	case "getkeysandflags":
+		return commandGetKeys(args, true)
+	}
+	return Reply.StandardError(fmt.Sprintf("unknown subcommand '%s'", sub))
+}
+
+// command list [FILTERBY MODULE module-name | ACLCAT category | PATTERN pattern]
+func commandList(args _type.Args) _interface.Reply {
+	filter := func(meta *commandMeta) bool { return true }
+	if len(args) > 0 {
+		if len(args) != 3 || strings.ToLower(string(args[0])) != "filterby" {
+			return Reply.SyntaxError()
+		}
+		value := string(args[2])
+		switch strings.ToLower(string(args[1])) {
+		case "module":
+			filter = func(meta *commandMeta) bool { return false }
+		case "aclcat":
+			filter = func(meta *commandMeta) bool { return containsString(meta.Categories, strings.ToLower(value)) }
+		case "pattern":
+			filter = func(meta *commandMeta) bool { return utils.MatchPattern(value, meta.Name) }
+		default:
+			return Reply.SyntaxError()
+		}
+	}
+	names := make([]string, 0)
+	for _, meta := range sortedCommands() {
+		if filter(meta) {
+			names = append(names, meta.Name)
+		}
+	}
+	return Reply.StringToArrayReply(names...)
+}
+
+// command info [command-name ...]，不存在的命令返回nil
+func commandInfo(args _type.Args) _interface.Reply {
+	if len(args) == 0 {
+		return execCommands(nil, nil, nil)
+	}
+	replies := make([]_interface.Reply, len(args))
+	for i, arg := range args {
+		meta, ok := lookupCommand(strings.ToLower(string(arg)))
+		if !ok {
+			replies[i] = Reply.NewNilBulkReply()
+			continue
+		}
+		replies[i] = meta.info()
+	}
+	return Reply.NewRawArrayReply(replies)
+}
+
+// command docs [command-name ...]，不存在的命令被忽略
+func commandDocsReply(args _type.Args) _interface.Reply {
+	metas := make([]*commandMeta, 0)
+	if len(args) == 0 {
+		metas = sortedCommands()
+	}
+	for _, arg := range args {
+		if meta, ok := lookupCommand(strings.ToLower(string(arg))); ok {
+			metas = append(metas, meta)
+		}
+	}
+	pairs := make([]_interface.Reply, 0, 2*len(metas))
+	for _, meta := range metas {
+		pairs = append(pairs, Reply.StringToBulkReply(meta.Name), meta.docs())
+	}
+	return Reply.NewMapReply(pairs)
+}
+
+// command getkeys/getkeysandflags command [arg ...]
+func commandGetKeys(args _type.Args, withFlags bool) _interface.Reply {
+	if len(args) == 0 {
+		if withFlags {
+			return Reply.ArgNumError("command|getkeysandflags")
+		}
+		return Reply.ArgNumError("command|getkeys")
+	}
+	meta, ok := lookupCommand(strings.ToLower(string(args[0])))
+	if !ok {
+		return Reply.StandardError("Invalid command specified")
+	}
+	if !utils.CheckArgNum(meta.Arity, _type.CmdLine(args)) {
+		return Reply.StandardError("Invalid number of arguments specified for command")
+	}
+	writeKeys, readKeys := meta.keysFind.Find(args[1:])
+	if len(writeKeys)+len(readKeys) == 0 {
+		return Reply.StandardError("The command has no key arguments")
+	}
+	replies := make([]_interface.Reply, 0, len(writeKeys)+len(readKeys))
+	for _, keys := range []struct {
+		keys  []string
+		flags []string
+	}{{writeKeys, []string{"RW", "UPDATE"}}, {readKeys, []string{"RO", "ACCESS"}}} {
+		for _, key := range keys.keys {
+			if withFlags {
+				replies = append(replies, Reply.NewRawArrayReply([]_interface.Reply{
+					Reply.StringToBulkReply(key), stringsToStatusSet(keys.flags),
+				}))
+			} else {
+				replies = append(replies, Reply.StringToBulkReply(key))
+			}
+		}
+	}
+	return Reply.NewRawArrayReply(replies)
+}
@@ -0,0 +1,50 @@
+package redis_test
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCommand_GetKeys(t *testing.T) {
+	c := newTestClient(t, newTestServer(t))
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"set", "k", "v"}, "*1\r\n$1\r\nk\r\n"},
+		{[]string{"set", "k", "v", "ex", "10"}, "*1\r\n$1\r\nk\r\n"},
+		{[]string{"mset", "a", "1", "b", "2"}, "*2\r\n$1\r\na\r\n$1\r\nb\r\n"},
+		{[]string{"eval", "return 1", "2", "x", "y", "arg"}, "*2\r\n$1\r\nx\r\n$1\r\ny\r\n"},
+		{[]string{"eval", "return 1", "0"}, "-ERR: The command has no key arguments\r\n"},
+		{[]string{"ping"}, "-ERR: The command has no key arguments\r\n"},
+		{[]string{"set", "k"}, "-ERR: Invalid number of arguments specified for command\r\n"},
+		{[]string{"nosuchcmd", "a"}, "-ERR: Invalid command specified\r\n"},
+	}
+	for _, tt := range tests {
+		c.expect(tt.want, append([]string{"command", "getkeys"}, tt.args...)...)
+	}
+}
+
+// COMMAND INFO每个命令回复10个元素：名称、参数个数、flags、第一个key、最后一个key、步长、ACL分类、tips、key specs、子命令
+func TestCommand_InfoShape(t *testing.T) {
+	c := newTestClient(t, newTestServer(t))
+	tests := []struct {
+		name   string
+		prefix string
+	}{
+		{"get", "*10\r\n$3\r\nget\r\n:2\r\n*2\r\n+readonly\r\n+fast\r\n:1\r\n:1\r\n:1\r\n*3\r\n+@string\r\n+@read\r\n+@fast\r\n*0\r\n*1\r\n"},
+		{"mset", "*10\r\n$4\r\nmset\r\n:-3\r\n"},
+		{"ping", "*10\r\n$4\r\nping\r\n:-1\r\n"},
+	}
+	for _, tt := range tests {
+		got := c.do("command", "info", tt.name)
+		if !strings.HasPrefix(got, "*1\r\n"+tt.prefix) {
+			t.Fatalf("command info %s: got %q, want prefix %q", tt.name, got, tt.prefix)
+		}
+	}
+	// 未知命令回复空值，位置与请求一致
+	got := c.do("command", "info", "nosuchcmd", "get")
+	if !strings.HasPrefix(got, "*2\r\n$-1\r\n*10\r\n$3\r\nget\r\n") {
+		t.Fatalf("command info nosuchcmd get: got %q", got)
+	}
+}
@@ -10,20 +10,20 @@ import (
 )
 
 func init() {
-	redis.RegisterCommand("HSet", execHSet, utils.WriteFirst, -4, redis.ReadWrite)
-	redis.RegisterCommand("HSetNX", execHSetNX, utils.WriteFirst, 4, redis.ReadWrite)
-	redis.RegisterCommand("HGet", execHGet, utils.ReadFirst, 3, redis.ReadOnly)
-	redis.RegisterCommand("HMGet", execHMGet, utils.ReadFirst, -3, redis.ReadOnly)
-	redis.RegisterCommand("HKeys", execHKeys, utils.ReadFirst, 2, redis.ReadOnly)
-	redis.RegisterCommand("HVals", execHVals, utils.ReadFirst, 2, redis.ReadOnly)
-	redis.RegisterCommand("HGetAll", execHGetAll, utils.ReadFirst, 2, redis.ReadOnly)
-	redis.RegisterCommand("HDel", execHDel, utils.WriteFirst, -3, redis.ReadWrite)
-	redis.RegisterCommand("HLen", execHLen, utils.ReadFirst, 2, redis.ReadOnly)
-	redis.RegisterCommand("HExists", execHExists, utils.ReadFirst, 3, redis.ReadOnly)
-	redis.RegisterCommand("HStrlen", execHStrlen, utils.ReadFirst, 3, redis.ReadOnly)
-	redis.RegisterCommand("HIncrBy", execHIncrBy, utils.WriteFirst, 4, redis.ReadWrite)
-	redis.RegisterCommand("HIncrByFloat", execHIncrByFloat, utils.WriteFirst, 4, redis.ReadWrite)
-	redis.RegisterCommand("HRandField", execHRandField, utils.ReadFirst, -2, redis.ReadOnly)
+	redis.RegisterCommand("HSet", execHSet, utils.WriteFirst, -4, redis.ReadWrite, redis.CatHash)
+	redis.RegisterCommand("HSetNX", execHSetNX, utils.WriteFirst, 4, redis.ReadWrite, redis.CatHash)
+	redis.RegisterCommand("HGet", execHGet, utils.ReadFirst, 3, redis.ReadOnly, redis.CatHash)
+	redis.RegisterCommand("HMGet", execHMGet, utils.ReadFirst, -3, redis.ReadOnly, redis.CatHash)
+	redis.RegisterCommand("HKeys", execHKeys, utils.ReadFirst, 2, redis.ReadOnly, redis.CatHash)
+	redis.RegisterCommand("HVals", execHVals, utils.ReadFirst, 2, redis.ReadOnly, redis.CatHash)
+	redis.RegisterCommand("HGetAll", execHGetAll, utils.ReadFirst, 2, redis.ReadOnly, redis.CatHash)
+	redis.RegisterCommand("HDel", execHDel, utils.WriteFirst, -3, redis.ReadWrite, redis.CatHash)
+	redis.RegisterCommand("HLen", execHLen, utils.ReadFirst, 2, redis.ReadOnly, redis.CatHash)
+	redis.RegisterCommand("HExists", execHExists, utils.ReadFirst, 3, redis.ReadOnly, redis.CatHash)
+	redis.RegisterCommand("HStrlen", execHStrlen, utils.ReadFirst, 3, redis.ReadOnly, redis.CatHash)
+	redis.RegisterCommand("HIncrBy", execHIncrBy, utils.WriteFirst, 4, redis.ReadWrite, redis.CatHash)
+	redis.RegisterCommand("HIncrByFloat", execHIncrByFloat, utils.WriteFirst, 4, redis.ReadWrite, redis.CatHash)
+	redis.RegisterCommand("HRandField", execHRandField, utils.ReadFirst, -2, redis.ReadOnly, redis.CatHash)
 }
 
 func execHSet(db *redis.Database, args _type.Args) _interface.Reply {
@@ -124,7 +124,7 @@ func execHGetAll(db *redis.Database, args _type.Args) _interface.Reply {
 		return errReply
 	}
 	if dict == nil {
-		return Reply.NewEmptyArrayReply()
+		return Reply.NewMapReply(nil)
 	}
 	length := dict.Len()
 	result := make([][]byte, 2*length)
@@ -136,7 +136,7 @@ func execHGetAll(db *redis.Database, args _type.Args) _interface.Reply {
 		return true
 	}
 	dict.ForEach(consumer)
-	return Reply.NewArrayReply(result)
+	return Reply.NewMapReply(Reply.BulksToReplies(result))
 }
 
 func execHDel(db *redis.Database, args _type.Args) _interface.Reply {
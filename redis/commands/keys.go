@@ -1,6 +1,7 @@
 package commands
 
 import (
+	"fmt"
 	Dict "go-redis/datastruct/dict"
 	List "go-redis/datastruct/list"
 	Set "go-redis/datastruct/set"
@@ -11,25 +12,31 @@ import (
 	"go-redis/redis/utils"
 	Reply "go-redis/resp/reply"
 	"strconv"
+	"strings"
 	"time"
 )
 
 func init() {
-	redis.RegisterCommand("Exists", execExists, utils.ReadAll, -2, redis.ReadOnly)
-	redis.RegisterCommand("Del", execDel, utils.WriteAll, -2, redis.ReadWrite)
-	redis.RegisterCommand("Expire", execExpire, utils.WriteFirst, 3, redis.ReadWrite)
-	redis.RegisterCommand("ExpireAt", execExpireAt, utils.WriteFirst, 3, redis.ReadWrite)
-	redis.RegisterCommand("TTL", execTTL, utils.ReadFirst, 2, redis.ReadOnly)
-	redis.RegisterCommand("ExpireTime", execExpireTime, utils.ReadFirst, 2, redis.ReadOnly)
-	redis.RegisterCommand("PExpire", execPExpire, utils.WriteFirst, 3, redis.ReadWrite)
-	redis.RegisterCommand("PExpireAt", execPExpireAt, utils.WriteFirst, 3, redis.ReadWrite)
-	redis.RegisterCommand("PTTL", execPTTL, utils.ReadFirst, 2, redis.ReadOnly)
-	redis.RegisterCommand("PExpireTime", execPExpireTime, utils.ReadFirst, 2, redis.ReadOnly)
-	redis.RegisterCommand("Persist", execPersist, utils.WriteFirst, 2, redis.ReadWrite)
-	redis.RegisterCommand("Type", execType, utils.ReadFirst, 2, redis.ReadOnly)
-	redis.RegisterCommand("Rename", execRename, utils.WriteFirstReadSecond, 3, redis.ReadOnly)
-	redis.RegisterCommand("RenameNx", execRenameNx, utils.WriteFirstReadSecond, 3, redis.ReadOnly)
-	redis.RegisterCommand("Keys", execKeys, utils.WriteNilReadNil, 2, redis.ReadOnly)
+	redis.RegisterCommand("Exists", execExists, utils.ReadAll, -2, redis.ReadOnly, redis.CatKeyspace)
+	redis.RegisterCommand("Del", execDel, utils.WriteAll, -2, redis.ReadWrite, redis.CatKeyspace)
+	redis.RegisterCommand("Expire", execExpire, utils.WriteFirst, 3, redis.ReadWrite, redis.CatKeyspace)
+	redis.RegisterCommand("ExpireAt", execExpireAt, utils.WriteFirst, 3, redis.ReadWrite, redis.CatKeyspace)
+	redis.RegisterCommand("TTL", execTTL, utils.ReadFirst, 2, redis.ReadOnly, redis.CatKeyspace)
+	redis.RegisterCommand("ExpireTime", execExpireTime, utils.ReadFirst, 2, redis.ReadOnly, redis.CatKeyspace)
+	redis.RegisterCommand("PExpire", execPExpire, utils.WriteFirst, 3, redis.ReadWrite, redis.CatKeyspace)
+	redis.RegisterCommand("PExpireAt", execPExpireAt, utils.WriteFirst, 3, redis.ReadWrite, redis.CatKeyspace)
+	redis.RegisterCommand("PTTL", execPTTL, utils.ReadFirst, 2, redis.ReadOnly, redis.CatKeyspace)
+	redis.RegisterCommand("PExpireTime", execPExpireTime, utils.ReadFirst, 2, redis.ReadOnly, redis.CatKeyspace)
+	redis.RegisterCommand("Persist", execPersist, utils.WriteFirst, 2, redis.ReadWrite, redis.CatKeyspace)
+	redis.RegisterCommand("Type", execType, utils.ReadFirst, 2, redis.ReadOnly, redis.CatKeyspace)
+	redis.RegisterCommand("Rename", execRename, utils.WriteAll, 3, redis.ReadWrite, redis.CatKeyspace)
+	redis.RegisterCommand("RenameNx", execRenameNx, utils.WriteAll, 3, redis.ReadWrite, redis.CatKeyspace)
+	redis.RegisterCommand("Keys", execKeys, utils.WriteNilReadNil, 2, redis.ReadOnly, redis.CatKeyspace, redis.CatDangerous)
+	redis.RegisterCommand("Unlink", execUnlink, utils.WriteAll, -2, redis.ReadWrite, redis.CatKeyspace)
+	redis.RegisterCommand("Touch", execTouch, utils.ReadAll, -2, redis.ReadOnly, redis.CatKeyspace)
+	redis.RegisterCommand("DBSize", execDBSize, utils.WriteNilReadNil, 1, redis.ReadOnly, redis.CatKeyspace)
+	redis.RegisterCommand("RandomKey", execRandomKey, utils.WriteNilReadNil, 1, redis.ReadOnly, redis.CatKeyspace)
+	redis.RegisterCommand("Object", execObject, utils.ReadSecond, 3, redis.ReadOnly, redis.CatKeyspace)
 }
 
 func execExists(db *redis.Database, args _type.Args) _interface.Reply {
@@ -55,6 +62,92 @@ func execDel(db *redis.Database, args _type.Args) _interface.Reply {
 	return Reply.NewIntegerReply(int64(count))
 }
 
+// execUnlink 与del相同，go中被移除的值由GC回收，del同样不会阻塞
+func execUnlink(db *redis.Database, args _type.Args) _interface.Reply {
+	keys := make([]string, len(args))
+	for i, key := range args {
+		keys[i] = string(key)
+	}
+	count := db.Removes(keys...)
+	if count > 0 {
+		db.ToAOF(utils.ToCmd("Unlink", args...))
+	}
+	return Reply.NewIntegerReply(int64(count))
+}
+
+// execTouch 更新key的访问时间，返回存在的key的个数
+func execTouch(db *redis.Database, args _type.Args) _interface.Reply {
+	var count int64 = 0
+	for _, key := range args {
+		if _, existed := db.Get(string(key)); existed {
+			count++
+		}
+	}
+	return Reply.NewIntegerReply(count)
+}
+
+func execDBSize(db *redis.Database, args _type.Args) _interface.Reply {
+	keys, _ := db.Size()
+	return Reply.NewIntegerReply(int64(keys))
+}
+
+func execRandomKey(db *redis.Database, args _type.Args) _interface.Reply {
+	key, ok := db.RandomKey()
+	if !ok {
+		return Reply.NewNilBulkReply() // 数据库为空
+	}
+	return Reply.NewBulkReply([]byte(key))
+}
+
+// execObject OBJECT ENCODING|IDLETIME|FREQ|REFCOUNT key，查看key不会更新其访问信息
+func execObject(db *redis.Database, args _type.Args) _interface.Reply {
+	sub := strings.ToLower(string(args[0]))
+	switch sub {
+	case "encoding", "idletime", "freq", "refcount":
+	default:
+		return Reply.StandardError(fmt.Sprintf("unknown subcommand '%s'", sub))
+	}
+	entity, existed := db.Peek(string(args[1]))
+	if !existed {
+		return Reply.NewNilBulkReply()
+	}
+	switch sub {
+	case "encoding":
+		return Reply.NewBulkReply([]byte(objectEncoding(entity)))
+	case "idletime":
+		return Reply.NewIntegerReply(int64(entity.IdleTime() / time.Second))
+	case "freq":
+		return Reply.NewIntegerReply(int64(entity.Freq()))
+	default:
+		return Reply.NewIntegerReply(1) // 值不会被共享
+	}
+}
+
+// objectEncoding 返回与redis对应的编码名称
+func objectEncoding(entity *_type.Entity) string {
+	switch data := entity.Data.(type) {
+	case []byte:
+		if len(data) <= 20 {
+			if _, err := strconv.ParseInt(string(data), 10, 64); err == nil {
+				return "int"
+			}
+		}
+		if len(data) <= 44 {
+			return "embstr"
+		}
+		return "raw"
+	case List.List[[]byte]:
+		return "quicklist"
+	case Dict.Dict[string, []byte]:
+		return "hashtable"
+	case Set.Set[string]:
+		return "hashtable"
+	case zset.ZSet[string]:
+		return "skiplist"
+	}
+	return "unknown"
+}
+
 func execExpire(db *redis.Database, args _type.Args) _interface.Reply {
 	ttlArg, err := strconv.ParseInt(string(args[1]), 10, 64)
 	if err != nil {
@@ -216,6 +309,9 @@ func execRename(db *redis.Database, args _type.Args) _interface.Reply {
 	if !existed {
 		return Reply.StandardError("no such key") // 键不存在
 	}
+	if key != newKey {
+		db.Remove(newKey) // 丢弃newKey的旧值及ttl
+	}
 	// 重新设置newKey，旧值被覆盖
 	db.Put(newKey, entity)
 	// 设置ttl
@@ -11,18 +11,18 @@ import (
 )
 
 func init() {
-	redis.RegisterCommand("LPush", execLPush, utils.WriteFirst, -3, redis.ReadWrite)
-	redis.RegisterCommand("RPush", execRPush, utils.WriteFirst, -3, redis.ReadWrite)
-	redis.RegisterCommand("LPushX", execLPushX, utils.WriteFirst, -3, redis.ReadWrite)
-	redis.RegisterCommand("RPushX", execRPushX, utils.WriteFirst, -3, redis.ReadWrite)
-	redis.RegisterCommand("LPop", execLPop, utils.WriteFirst, 2, redis.ReadWrite)
-	redis.RegisterCommand("RPop", execRPop, utils.WriteFirst, 2, redis.ReadWrite)
-	redis.RegisterCommand("RPopLPush", execRPopLPush, utils.ReadFirstTwo, 3, redis.ReadWrite)
-	redis.RegisterCommand("LLen", execLLen, utils.ReadFirst, 2, redis.ReadOnly)
-	redis.RegisterCommand("LIndex", execLIndex, utils.ReadFirst, 3, redis.ReadOnly)
-	redis.RegisterCommand("LSet", execLSet, utils.WriteFirst, 4, redis.ReadWrite)
-	redis.RegisterCommand("LRem", execLRem, utils.WriteFirst, 4, redis.ReadWrite)
-	redis.RegisterCommand("LRange", execLRange, utils.ReadFirst, 4, redis.ReadOnly)
+	redis.RegisterCommand("LPush", execLPush, utils.WriteFirst, -3, redis.ReadWrite, redis.CatList)
+	redis.RegisterCommand("RPush", execRPush, utils.WriteFirst, -3, redis.ReadWrite, redis.CatList)
+	redis.RegisterCommand("LPushX", execLPushX, utils.WriteFirst, -3, redis.ReadWrite, redis.CatList)
+	redis.RegisterCommand("RPushX", execRPushX, utils.WriteFirst, -3, redis.ReadWrite, redis.CatList)
+	redis.RegisterCommand("LPop", execLPop, utils.WriteFirst, 2, redis.ReadWrite, redis.CatList)
+	redis.RegisterCommand("RPop", execRPop, utils.WriteFirst, 2, redis.ReadWrite, redis.CatList)
+	redis.RegisterCommand("RPopLPush", execRPopLPush, utils.ReadFirstTwo, 3, redis.ReadWrite, redis.CatList)
+	redis.RegisterCommand("LLen", execLLen, utils.ReadFirst, 2, redis.ReadOnly, redis.CatList)
+	redis.RegisterCommand("LIndex", execLIndex, utils.ReadFirst, 3, redis.ReadOnly, redis.CatList)
+	redis.RegisterCommand("LSet", execLSet, utils.WriteFirst, 4, redis.ReadWrite, redis.CatList)
+	redis.RegisterCommand("LRem", execLRem, utils.WriteFirst, 4, redis.ReadWrite, redis.CatList)
+	redis.RegisterCommand("LRange", execLRange, utils.ReadFirst, 4, redis.ReadOnly, redis.CatList)
 }
 
 func execLPush(db *redis.Database, args _type.Args) _interface.Reply {
@@ -11,19 +11,19 @@ import (
 )
 
 func init() {
-	redis.RegisterCommand("SAdd", execSAdd, utils.WriteFirst, -3, redis.ReadWrite)
-	redis.RegisterCommand("SRem", execSRem, utils.WriteFirst, -3, redis.ReadWrite)
-	redis.RegisterCommand("SPop", execSPop, utils.WriteFirst, -2, redis.ReadWrite)
-	redis.RegisterCommand("SRandMember", execSRandMember, utils.ReadFirst, -2, redis.ReadOnly)
-	redis.RegisterCommand("SCard", execSCard, utils.ReadFirst, 2, redis.ReadOnly)
-	redis.RegisterCommand("SIsMember", execSIsMember, utils.ReadFirst, 3, redis.ReadOnly)
-	redis.RegisterCommand("SMembers", execSMembers, utils.ReadFirst, 2, redis.ReadOnly)
-	redis.RegisterCommand("SInter", execSInter, utils.ReadAll, -2, redis.ReadOnly)
-	redis.RegisterCommand("SUnion", execSUnion, utils.ReadAll, -2, redis.ReadOnly)
-	redis.RegisterCommand("SDiff", execSDiff, utils.ReadAll, -2, redis.ReadOnly)
-	redis.RegisterCommand("SInterStore", execSInterStore, utils.WriteFirstReadOthers, -3, redis.ReadWrite)
-	redis.RegisterCommand("SUnionStore", execSUnionStore, utils.WriteFirstReadOthers, -3, redis.ReadWrite)
-	redis.RegisterCommand("SDiffStore", execSDiffStore, utils.WriteFirstReadOthers, -3, redis.ReadWrite)
+	redis.RegisterCommand("SAdd", execSAdd, utils.WriteFirst, -3, redis.ReadWrite, redis.CatSet)
+	redis.RegisterCommand("SRem", execSRem, utils.WriteFirst, -3, redis.ReadWrite, redis.CatSet)
+	redis.RegisterCommand("SPop", execSPop, utils.WriteFirst, -2, redis.ReadWrite, redis.CatSet)
+	redis.RegisterCommand("SRandMember", execSRandMember, utils.ReadFirst, -2, redis.ReadOnly, redis.CatSet)
+	redis.RegisterCommand("SCard", execSCard, utils.ReadFirst, 2, redis.ReadOnly, redis.CatSet)
+	redis.RegisterCommand("SIsMember", execSIsMember, utils.ReadFirst, 3, redis.ReadOnly, redis.CatSet)
+	redis.RegisterCommand("SMembers", execSMembers, utils.ReadFirst, 2, redis.ReadOnly, redis.CatSet)
+	redis.RegisterCommand("SInter", execSInter, utils.ReadAll, -2, redis.ReadOnly, redis.CatSet)
+	redis.RegisterCommand("SUnion", execSUnion, utils.ReadAll, -2, redis.ReadOnly, redis.CatSet)
+	redis.RegisterCommand("SDiff", execSDiff, utils.ReadAll, -2, redis.ReadOnly, redis.CatSet)
+	redis.RegisterCommand("SInterStore", execSInterStore, utils.WriteFirstReadOthers, -3, redis.ReadWrite, redis.CatSet)
+	redis.RegisterCommand("SUnionStore", execSUnionStore, utils.WriteFirstReadOthers, -3, redis.ReadWrite, redis.CatSet)
+	redis.RegisterCommand("SDiffStore", execSDiffStore, utils.WriteFirstReadOthers, -3, redis.ReadWrite, redis.CatSet)
 }
 
 func execSAdd(db *redis.Database, args _type.Args) _interface.Reply {
@@ -170,14 +170,14 @@ func execSMembers(db *redis.Database, args _type.Args) _interface.Reply {
 		return errReply
 	}
 	if set == nil {
-		return reply.NewEmptyArrayReply()
+		return reply.NewSetReply(nil)
 	}
 	members, size := set.Members(), set.Len()
 	result := make([][]byte, size)
 	for i := 0; i < size; i++ {
 		result[i] = []byte(members[i])
 	}
-	return reply.NewArrayReply(result)
+	return reply.NewSetReply(reply.BulksToReplies(result))
 }
 
 func execSInter(db *redis.Database, args _type.Args) _interface.Reply {
@@ -13,25 +13,25 @@ import (
 
 // 注册命令
 func init() {
-	redis.RegisterCommand("Set", execSet, utils.WriteFirst, -3, redis.ReadWrite)
-	redis.RegisterCommand("SetNX", execSetNX, utils.WriteFirst, 3, redis.ReadWrite)
-	redis.RegisterCommand("SetEX", execSetEX, utils.WriteFirst, 4, redis.ReadWrite)
-	redis.RegisterCommand("Get", execGet, utils.ReadFirst, 2, redis.ReadOnly)
-	redis.RegisterCommand("GetEX", execGetEX, utils.WriteFirst, -2, redis.ReadWrite)
-	redis.RegisterCommand("GetSet", execGetSet, utils.WriteFirst, 3, redis.ReadWrite)
-	redis.RegisterCommand("GetDel", execGetDel, utils.WriteFirst, 2, redis.ReadWrite)
-	redis.RegisterCommand("StrLen", execStrLen, utils.ReadFirst, 2, redis.ReadOnly)
-	redis.RegisterCommand("Append", execAppend, utils.WriteFirst, 3, redis.ReadWrite)
-	redis.RegisterCommand("MSet", execMSet, utils.WriteEven, -3, redis.ReadWrite)
-	redis.RegisterCommand("MSetNX", execMSetNX, utils.WriteEven, -3, redis.ReadWrite)
-	redis.RegisterCommand("MGet", execMGet, utils.ReadAll, -2, redis.ReadOnly)
-	redis.RegisterCommand("SetRange", execSetRange, utils.WriteFirst, 4, redis.ReadWrite)
-	redis.RegisterCommand("GetRange", execGetRange, utils.ReadFirst, 4, redis.ReadWrite)
-	redis.RegisterCommand("Incr", execIncr, utils.WriteFirst, 2, redis.ReadWrite)
-	redis.RegisterCommand("IncrBy", execIncrBy, utils.WriteFirst, 3, redis.ReadWrite)
-	redis.RegisterCommand("IncrByFloat", execIncrByFloat, utils.WriteFirst, 3, redis.ReadWrite)
-	redis.RegisterCommand("Decr", execDecr, utils.WriteFirst, 2, redis.ReadWrite)
-	redis.RegisterCommand("DecrBy", execDecrBy, utils.WriteFirst, 3, redis.ReadWrite)
+	redis.RegisterCommand("Set", execSet, utils.WriteFirst, -3, redis.ReadWrite, redis.CatString)
+	redis.RegisterCommand("SetNX", execSetNX, utils.WriteFirst, 3, redis.ReadWrite, redis.CatString)
+	redis.RegisterCommand("SetEX", execSetEX, utils.WriteFirst, 4, redis.ReadWrite, redis.CatString)
+	redis.RegisterCommand("Get", execGet, utils.ReadFirst, 2, redis.ReadOnly, redis.CatString)
+	redis.RegisterCommand("GetEX", execGetEX, utils.WriteFirst, -2, redis.ReadWrite, redis.CatString)
+	redis.RegisterCommand("GetSet", execGetSet, utils.WriteFirst, 3, redis.ReadWrite, redis.CatString)
+	redis.RegisterCommand("GetDel", execGetDel, utils.WriteFirst, 2, redis.ReadWrite, redis.CatString)
+	redis.RegisterCommand("StrLen", execStrLen, utils.ReadFirst, 2, redis.ReadOnly, redis.CatString)
+	redis.RegisterCommand("Append", execAppend, utils.WriteFirst, 3, redis.ReadWrite, redis.CatString)
+	redis.RegisterCommand("MSet", execMSet, utils.WriteEven, -3, redis.ReadWrite, redis.CatString)
+	redis.RegisterCommand("MSetNX", execMSetNX, utils.WriteEven, -3, redis.ReadWrite, redis.CatString)
+	redis.RegisterCommand("MGet", execMGet, utils.ReadAll, -2, redis.ReadOnly, redis.CatString)
+	redis.RegisterCommand("SetRange", execSetRange, utils.WriteFirst, 4, redis.ReadWrite, redis.CatString)
+	redis.RegisterCommand("GetRange", execGetRange, utils.ReadFirst, 4, redis.ReadOnly, redis.CatString)
+	redis.RegisterCommand("Incr", execIncr, utils.WriteFirst, 2, redis.ReadWrite, redis.CatString)
+	redis.RegisterCommand("IncrBy", execIncrBy, utils.WriteFirst, 3, redis.ReadWrite, redis.CatString)
+	redis.RegisterCommand("IncrByFloat", execIncrByFloat, utils.WriteFirst, 3, redis.ReadWrite, redis.CatString)
+	redis.RegisterCommand("Decr", execDecr, utils.WriteFirst, 2, redis.ReadWrite, redis.CatString)
+	redis.RegisterCommand("DecrBy", execDecrBy, utils.WriteFirst, 3, redis.ReadWrite, redis.CatString)
 }
 
 func execSet(db *redis.Database, args _type.Args) _interface.Reply {
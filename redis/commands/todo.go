@@ -9,10 +9,10 @@ import (
 )
 
 func init() {
-	redis.RegisterCommand("SetBit", execSetBit, utils.WriteFirst, 4, redis.ReadWrite)
-	redis.RegisterCommand("GetBit", execGetBit, utils.ReadFirst, 3, redis.ReadWrite)
-	redis.RegisterCommand("BitCount", execBitCount, utils.ReadFirst, -2, redis.ReadWrite)
-	redis.RegisterCommand("BitPos", execBitPos, utils.ReadFirst, -3, redis.ReadWrite)
+	redis.RegisterCommand("SetBit", execSetBit, utils.WriteFirst, 4, redis.ReadWrite, redis.CatBitmap)
+	redis.RegisterCommand("GetBit", execGetBit, utils.ReadFirst, 3, redis.ReadOnly, redis.CatBitmap)
+	redis.RegisterCommand("BitCount", execBitCount, utils.ReadFirst, -2, redis.ReadOnly, redis.CatBitmap)
+	redis.RegisterCommand("BitPos", execBitPos, utils.ReadFirst, -3, redis.ReadOnly, redis.CatBitmap)
 }
 
 func execSetBit(db *redis.Database, args _type.Args) _interface.Reply {
@@ -10,21 +10,21 @@ import (
 )
 
 func init() {
-	redis.RegisterCommand("ZAdd", execZAdd, utils.WriteFirst, -4, redis.ReadWrite)
-	redis.RegisterCommand("ZRem", execZRem, utils.WriteFirst, -3, redis.ReadWrite)
-	redis.RegisterCommand("ZRemRangeByScore", execZRemRangeByScore, utils.WriteFirst, 4, redis.ReadWrite)
-	redis.RegisterCommand("ZRemRangeByRank", execZRemRangeByRank, utils.WriteFirst, 4, redis.ReadWrite)
-	redis.RegisterCommand("ZCard", execZCard, utils.ReadFirst, 2, redis.ReadOnly)
-	redis.RegisterCommand("ZCount", execZCount, utils.ReadFirst, 4, redis.ReadOnly)
-	redis.RegisterCommand("ZScore", execZScore, utils.ReadFirst, 3, redis.ReadOnly)
-	redis.RegisterCommand("ZRank", execZRank, utils.ReadFirst, -3, redis.ReadOnly)
-	redis.RegisterCommand("ZRevRank", execZRevRank, utils.ReadFirst, -3, redis.ReadOnly)
-	redis.RegisterCommand("ZRange", execZRange, utils.ReadFirst, -4, redis.ReadOnly)
-	redis.RegisterCommand("ZRevRange", execZRevRange, utils.ReadFirst, -4, redis.ReadOnly)
-	redis.RegisterCommand("ZRangeByScore", execZRangeByScore, utils.ReadFirst, -4, redis.ReadOnly)
-	redis.RegisterCommand("ZRevRangeByScore", execZRevRangeByScore, utils.ReadFirst, -4, redis.ReadOnly)
-	redis.RegisterCommand("ZPopMin", execZPopMin, utils.WriteFirst, -2, redis.ReadWrite)
-	redis.RegisterCommand("ZIncrBy", execZIncrBy, utils.WriteFirst, 4, redis.ReadWrite)
+	redis.RegisterCommand("ZAdd", execZAdd, utils.WriteFirst, -4, redis.ReadWrite, redis.CatSortedSet)
+	redis.RegisterCommand("ZRem", execZRem, utils.WriteFirst, -3, redis.ReadWrite, redis.CatSortedSet)
+	redis.RegisterCommand("ZRemRangeByScore", execZRemRangeByScore, utils.WriteFirst, 4, redis.ReadWrite, redis.CatSortedSet)
+	redis.RegisterCommand("ZRemRangeByRank", execZRemRangeByRank, utils.WriteFirst, 4, redis.ReadWrite, redis.CatSortedSet)
+	redis.RegisterCommand("ZCard", execZCard, utils.ReadFirst, 2, redis.ReadOnly, redis.CatSortedSet)
+	redis.RegisterCommand("ZCount", execZCount, utils.ReadFirst, 4, redis.ReadOnly, redis.CatSortedSet)
+	redis.RegisterCommand("ZScore", execZScore, utils.ReadFirst, 3, redis.ReadOnly, redis.CatSortedSet)
+	redis.RegisterCommand("ZRank", execZRank, utils.ReadFirst, -3, redis.ReadOnly, redis.CatSortedSet)
+	redis.RegisterCommand("ZRevRank", execZRevRank, utils.ReadFirst, -3, redis.ReadOnly, redis.CatSortedSet)
+	redis.RegisterCommand("ZRange", execZRange, utils.ReadFirst, -4, redis.ReadOnly, redis.CatSortedSet)
+	redis.RegisterCommand("ZRevRange", execZRevRange, utils.ReadFirst, -4, redis.ReadOnly, redis.CatSortedSet)
+	redis.RegisterCommand("ZRangeByScore", execZRangeByScore, utils.ReadFirst, -4, redis.ReadOnly, redis.CatSortedSet)
+	redis.RegisterCommand("ZRevRangeByScore", execZRevRangeByScore, utils.ReadFirst, -4, redis.ReadOnly, redis.CatSortedSet)
+	redis.RegisterCommand("ZPopMin", execZPopMin, utils.WriteFirst, -2, redis.ReadWrite, redis.CatSortedSet)
+	redis.RegisterCommand("ZIncrBy", execZIncrBy, utils.WriteFirst, 4, redis.ReadWrite, redis.CatSortedSet)
 }
 
 func execZAdd(db *redis.Database, args _type.Args) _interface.Reply {
@@ -169,8 +169,7 @@ func execZScore(db *redis.Database, args _type.Args) _interface.Reply {
 	if !existed {
 		return Reply.NewNilBulkReply()
 	}
-	value := strconv.FormatFloat(score, 'f', -1, 64)
-	return Reply.NewBulkReply([]byte(value))
+	return Reply.NewDoubleReply(score)
 }
 
 func execZRank(db *redis.Database, args _type.Args) _interface.Reply {
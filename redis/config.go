@@ -4,25 +4,64 @@ import (
 	"bufio"
 	"errors"
 	"fmt"
+	"go-redis/redis/utils"
+	"go-redis/resp"
 	"go-redis/utils/logger"
 	"os"
-	"reflect"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
+// ServerConfig 所有配置项，配置项的名称、类型、校验等见configOptions
 type ServerConfig struct {
-	// 为进行反射，所有字段都仅有首字母大写
 	Bind        string // 绑定ip
 	Port        int    // 端口
 	Maxclients  int    // 同一时刻的最大客户端数
+	Timeout     int    // client空闲超过该时间(秒)后断开连接，为0时不断开
 	Databases   int    //数据库的数量
 	Requirepass string // 密码
+	Aclfile     string // ACL用户文件
 
 	Appendonly     bool   // 是否开启aof
 	Appendfilename string // aof文件名
 	Appendfsync    string // aof文件写磁盘策略
 
+	LuaTimeLimit int // lua脚本的最长执行时间(毫秒)，不大于0时不限制
+
+	SlowlogLogSlowerThan    int // 慢日志阈值(微秒)，小于0时不记录，等于0时记录所有命令
+	SlowlogMaxLen           int // 慢日志的最大条数
+	LatencyMonitorThreshold int // 延迟监控阈值(毫秒)，为0时关闭延迟监控
+
+	Unixsocket     string // unix socket的路径，为空时不监听
+	Unixsocketperm int    // unix socket文件的权限，为0时使用默认权限
+
+	TcpKeepalive int // TCP keepalive的间隔(秒)，为0时不开启
+	TcpBacklog   int // listen的backlog
+
+	IoModel    string // 网络模型：goroutine、epoll
+	EventLoops int    // epoll模型下event loop的数量，为0时与CPU核数相同
+
+	TlsPort            int    // tls端口，为0时不开启
+	TlsCertFile        string // 服务端证书
+	TlsKeyFile         string // 服务端私钥
+	TlsCaCertFile      string // 用于校验客户端证书的CA证书
+	TlsAuthClients     string // 是否要求客户端证书：no、optional、yes
+	TlsAuthClientsUser string // 为CN时，以客户端证书的CN作为ACL用户自动鉴权
+	TlsProtocols       string // 允许的协议版本，如"TLSv1.2 TLSv1.3"
+	TlsCiphers         string // TLSv1.2及以下版本允许的加密套件
+
+	MetricsPort int // Prometheus指标的http端口，不大于0时不开启
+
+	TrackingTableMaxKeys int // client tracking失效表中key的最大个数，超过时淘汰key并发送失效消息，为0时不限制
+
+	ProtoMaxBulkLen        int64 // 单个bulk string的最大长度(字节)
+	ClientQueryBufferLimit int64 // 单个client输入缓冲区的最大长度(字节)
+
+	ClientOutputBufferLimit [3]OutputBufferLimit // 各类client的输出缓冲区限制
+
 	//MasterAuth        string   `cfg:"masterauth"`
 	//SlaveAnnouncePort int      `cfg:"slave-announce-port"`
 	//SlaveAnnounceIP   string   `cfg:"slave-announce-ip"`
@@ -31,93 +70,658 @@ type ServerConfig struct {
 	//Self              string   `cfg:"self"`
 }
 
+// io-model的取值
+const (
+	IOModelGoroutine = "goroutine" // 每个连接一个goroutine
+	IOModelEpoll     = "epoll"     // 由少量event loop通过epoll处理所有连接，仅支持linux
+)
+
 // Config 全局配置变量
 var Config = &ServerConfig{
 	Bind:        "127.0.0.1",
 	Port:        6666,
 	Maxclients:  128,
+	Databases:   16,
 	Requirepass: "",
 	Appendonly:  false,
+
+	TcpKeepalive: 300,
+	TcpBacklog:   511,
+
+	IoModel: IOModelGoroutine,
+
+	TlsAuthClients:     TLSAuthYes,
+	TlsAuthClientsUser: "off",
+
+	Appendfilename: "appendonly.aof",
+	Appendfsync:    FsyncEverysec,
+
+	LuaTimeLimit: 5000,
+
+	SlowlogLogSlowerThan:    10000,
+	SlowlogMaxLen:           128,
+	LatencyMonitorThreshold: 0,
+
+	TrackingTableMaxKeys: 1000000,
+
+	ProtoMaxBulkLen:        512 * 1024 * 1024,
+	ClientQueryBufferLimit: 1024 * 1024 * 1024,
+
+	ClientOutputBufferLimit: [3]OutputBufferLimit{
+		ClientClassNormal:  {0, 0, 0},
+		ClientClassReplica: {256 * 1024 * 1024, 64 * 1024 * 1024, 60},
+		ClientClassPubsub:  {32 * 1024 * 1024, 8 * 1024 * 1024, 60},
+	},
+}
+
+// client的类别，用于client-output-buffer-limit
+const (
+	ClientClassNormal = iota
+	ClientClassReplica
+	ClientClassPubsub
+)
+
+var clientClassNames = []string{"normal", "replica", "pubsub"}
+
+// OutputBufferLimit 输出缓冲区限制，超过硬限制，或持续超过软限制SoftSeconds秒，则断开连接，为0时不限制
+type OutputBufferLimit struct {
+	Hard        int64
+	Soft        int64
+	SoftSeconds int
+}
+
+/* ---- 配置项的类型 ---- */
+
+// configValue 配置项的值，set时进行校验
+type configValue interface {
+	get() string
+	set(val string) error
+}
+
+type boolValue struct {
+	ptr *bool
+}
+
+func (v *boolValue) get() string {
+	if *v.ptr {
+		return "yes"
+	}
+	return "no"
+}
+
+func (v *boolValue) set(val string) error {
+	switch strings.ToLower(val) {
+	case "yes":
+		*v.ptr = true
+	case "no":
+		*v.ptr = false
+	default:
+		return errors.New("argument must be 'yes' or 'no'")
+	}
+	return nil
+}
+
+type stringValue struct {
+	ptr *string
+}
+
+func (v *stringValue) get() string {
+	return *v.ptr
+}
+
+func (v *stringValue) set(val string) error {
+	*v.ptr = val
+	return nil
+}
+
+// enumValue 只能取若干个值之一，不区分大小写
+type enumValue struct {
+	ptr    *string
+	values []string
+}
+
+func (v *enumValue) get() string {
+	return *v.ptr
+}
+
+func (v *enumValue) set(val string) error {
+	val = strings.ToLower(val)
+	for _, value := range v.values {
+		if value == val {
+			*v.ptr = val
+			return nil
+		}
+	}
+	return fmt.Errorf("argument(s) must be one of the following: %s", strings.Join(v.values, ", "))
+}
+
+type intValue struct {
+	ptr      *int
+	min, max int
+}
+
+func (v *intValue) get() string {
+	return strconv.Itoa(*v.ptr)
+}
+
+func (v *intValue) set(val string) error {
+	n, err := strconv.Atoi(val)
+	if err != nil {
+		return errors.New("argument couldn't be parsed into an integer")
+	}
+	if n < v.min || n > v.max {
+		return fmt.Errorf("argument must be between %d and %d inclusive", v.min, v.max)
+	}
+	*v.ptr = n
+	return nil
+}
+
+// octalValue 八进制整数，如文件权限700
+type octalValue struct {
+	ptr *int
+}
+
+func (v *octalValue) get() string {
+	return strconv.FormatInt(int64(*v.ptr), 8)
+}
+
+func (v *octalValue) set(val string) error {
+	n, err := strconv.ParseUint(val, 8, 32)
+	if err != nil {
+		return errors.New("argument couldn't be parsed into an octal integer")
+	}
+	*v.ptr = int(n)
+	return nil
+}
+
+// memoryValue 字节数，支持单位k/kb/m/mb/g/gb，如100mb
+type memoryValue struct {
+	ptr      *int64
+	min, max int64
+}
+
+func (v *memoryValue) get() string {
+	return strconv.FormatInt(*v.ptr, 10)
+}
+
+func (v *memoryValue) set(val string) error {
+	n, err := ParseMemory(val)
+	if err != nil {
+		return err
+	}
+	if n < v.min || n > v.max {
+		return fmt.Errorf("argument must be between %d and %d inclusive", v.min, v.max)
+	}
+	*v.ptr = n
+	return nil
+}
+
+// ParseMemory 解析带单位的字节数，k/m/g为1000的倍数，kb/mb/gb为1024的倍数
+func ParseMemory(val string) (int64, error) {
+	units := []struct {
+		suffix string
+		unit   int64
+	}{
+		{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30},
+		{"k", 1000}, {"m", 1000 * 1000}, {"g", 1000 * 1000 * 1000}, {"b", 1},
+	}
+	lower := strings.ToLower(val)
+	unit := int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(lower, u.suffix) {
+			lower, unit = strings.TrimSuffix(lower, u.suffix), u.unit
+			break
+		}
+	}
+	n, err := strconv.ParseInt(lower, 10, 64)
+	if err != nil {
+		return 0, errors.New("argument must be a memory value")
+	}
+	return n * unit, nil
+}
+
+// timeValue 以unit为单位的时间，不带单位时即为unit，也可带单位us/ms/s/m/h，如5s
+type timeValue struct {
+	ptr      *int
+	unit     time.Duration
+	min, max int
+}
+
+func (v *timeValue) get() string {
+	return strconv.Itoa(*v.ptr)
+}
+
+func (v *timeValue) set(val string) error {
+	n, err := ParseTime(val, v.unit)
+	if err != nil {
+		return err
+	}
+	if n < v.min || n > v.max {
+		return fmt.Errorf("argument must be between %d and %d inclusive", v.min, v.max)
+	}
+	*v.ptr = n
+	return nil
+}
+
+// ParseTime 解析带单位的时间，返回以unit为单位的值，不带单位时直接返回
+func ParseTime(val string, unit time.Duration) (int, error) {
+	if n, err := strconv.Atoi(val); err == nil {
+		return n, nil
+	}
+	lower := strings.ToLower(val)
+	// time.ParseDuration不支持天
+	if strings.HasSuffix(lower, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(lower, "d"))
+		if err != nil {
+			return 0, errors.New("argument must be a time value")
+		}
+		return int(time.Duration(days) * 24 * time.Hour / unit), nil
+	}
+	duration, err := time.ParseDuration(lower)
+	if err != nil {
+		return 0, errors.New("argument must be a time value")
+	}
+	return int(duration / unit), nil
+}
+
+// outputBufferLimitValue 格式为"<class> <hard> <soft> <soft-seconds>"，可包含多组，未给出的类别保持不变
+type outputBufferLimitValue struct {
+	p *[3]OutputBufferLimit
+}
+
+func (v *outputBufferLimitValue) get() string {
+	parts := make([]string, 0, len(v.p))
+	for class, limit := range v.p {
+		parts = append(parts, fmt.Sprintf("%s %d %d %d", clientClassNames[class], limit.Hard, limit.Soft, limit.SoftSeconds))
+	}
+	return strings.Join(parts, " ")
+}
+
+func (v *outputBufferLimitValue) set(val string) error {
+	fields := strings.Fields(val)
+	if len(fields) == 0 || len(fields)%4 != 0 {
+		return errors.New("Wrong number of arguments in buffer limit configuration.")
+	}
+	limits := *v.p
+	for i := 0; i < len(fields); i += 4 {
+		class := -1
+		switch strings.ToLower(fields[i]) {
+		case "normal":
+			class = ClientClassNormal
+		case "replica", "slave":
+			class = ClientClassReplica
+		case "pubsub":
+			class = ClientClassPubsub
+		default:
+			return errors.New("Invalid client class specified in buffer limit configuration.")
+		}
+		hard, err1 := ParseMemory(fields[i+1])
+		soft, err2 := ParseMemory(fields[i+2])
+		seconds, err3 := strconv.Atoi(fields[i+3])
+		if err1 != nil || err2 != nil || err3 != nil || hard < 0 || soft < 0 || seconds < 0 {
+			return errors.New("Error in hard, soft or soft_seconds setting in buffer limit configuration.")
+		}
+		limits[class] = OutputBufferLimit{Hard: hard, Soft: soft, SoftSeconds: seconds}
+	}
+	*v.p = limits
+	return nil
+}
+
+/* ---- 配置项 ---- */
+
+// configOption 配置项，immutable的配置项只能在配置文件中设置
+// apply在CONFIG SET成功后调用，使修改立即生效，返回错误时修改会被回滚
+type configOption struct {
+	name         string
+	alias        string
+	immutable    bool
+	value        configValue
+	apply        func(server *Server) error
+	defaultValue string // 默认值，用于CONFIG REWRITE
 }
 
-var ConfigType = reflect.TypeOf(Config).Elem()
+const maxInt = int(^uint(0) >> 1)
 
-var ConfigValue = reflect.ValueOf(Config).Elem()
+var configOptions = []*configOption{
+	{name: "bind", immutable: true, value: &stringValue{&Config.Bind}},
+	{name: "port", immutable: true, value: &intValue{&Config.Port, 0, 65535}},
+	{name: "maxclients", value: &intValue{&Config.Maxclients, 1, maxInt}},
+	{name: "unixsocket", immutable: true, value: &stringValue{&Config.Unixsocket}},
+	{name: "unixsocketperm", immutable: true, value: &octalValue{&Config.Unixsocketperm}},
+	{name: "timeout", value: &timeValue{&Config.Timeout, time.Second, 0, maxInt}},
+	{name: "tcp-keepalive", value: &timeValue{&Config.TcpKeepalive, time.Second, 0, maxInt}},
+	{name: "tcp-backlog", immutable: true, value: &intValue{&Config.TcpBacklog, 0, maxInt}},
+	{name: "io-model", immutable: true, value: &enumValue{&Config.IoModel, []string{IOModelGoroutine, IOModelEpoll}}},
+	{name: "event-loops", immutable: true, value: &intValue{&Config.EventLoops, 0, 1024}},
+	{name: "databases", immutable: true, value: &intValue{&Config.Databases, 1, maxInt}},
+	{name: "requirepass", value: &stringValue{&Config.Requirepass}, apply: applyRequirepass},
+	{name: "aclfile", immutable: true, value: &stringValue{&Config.Aclfile}},
+	{name: "appendonly", immutable: true, value: &boolValue{&Config.Appendonly}},
+	{name: "appendfilename", immutable: true, value: &stringValue{&Config.Appendfilename}},
+	{name: "appendfsync", value: &enumValue{&Config.Appendfsync, []string{FsyncAlways, FsyncEverysec, FsyncNo}}, apply: applyAppendfsync},
+	{name: "lua-time-limit", alias: "busy-reply-threshold", value: &timeValue{&Config.LuaTimeLimit, time.Millisecond, 0, maxInt}},
+	{name: "slowlog-log-slower-than", value: &timeValue{&Config.SlowlogLogSlowerThan, time.Microsecond, -1, maxInt}},
+	{name: "slowlog-max-len", value: &intValue{&Config.SlowlogMaxLen, 0, maxInt}, apply: applySlowlogMaxLen},
+	{name: "latency-monitor-threshold", value: &timeValue{&Config.LatencyMonitorThreshold, time.Millisecond, 0, maxInt}},
+	{name: "tls-port", immutable: true, value: &intValue{&Config.TlsPort, 0, 65535}},
+	{name: "tls-cert-file", value: &stringValue{&Config.TlsCertFile}, apply: applyTLS},
+	{name: "tls-key-file", value: &stringValue{&Config.TlsKeyFile}, apply: applyTLS},
+	{name: "tls-ca-cert-file", value: &stringValue{&Config.TlsCaCertFile}, apply: applyTLS},
+	{name: "tls-auth-clients", value: &enumValue{&Config.TlsAuthClients, []string{TLSAuthNo, TLSAuthOptional, TLSAuthYes}}, apply: applyTLS},
+	{name: "tls-auth-clients-user", value: &enumValue{&Config.TlsAuthClientsUser, []string{"off", "cn"}}},
+	{name: "tls-protocols", value: &stringValue{&Config.TlsProtocols}, apply: applyTLS},
+	{name: "tls-ciphers", value: &stringValue{&Config.TlsCiphers}, apply: applyTLS},
+	{name: "metrics-port", immutable: true, value: &intValue{&Config.MetricsPort, 0, 65535}},
+	{name: "tracking-table-max-keys", value: &intValue{&Config.TrackingTableMaxKeys, 0, maxInt}, apply: applyTrackingTableMaxKeys},
+	{name: "client-output-buffer-limit", value: &outputBufferLimitValue{&Config.ClientOutputBufferLimit}},
+	{name: "proto-max-bulk-len", value: &memoryValue{&Config.ProtoMaxBulkLen, 1 << 20, 1 << 40}, apply: applyProtoMaxBulkLen},
+	{name: "client-query-buffer-limit", value: &memoryValue{&Config.ClientQueryBufferLimit, 1 << 20, 1 << 40}, apply: applyClientQueryBufferLimit},
+}
+
+func init() {
+	for _, option := range configOptions {
+		option.defaultValue = option.value.get()
+	}
+}
+
+// 根据名称或别名查找配置项，不区分大小写
+func lookupConfig(name string) (*configOption, bool) {
+	name = strings.ToLower(name)
+	for _, option := range configOptions {
+		if option.name == name || (option.alias != "" && option.alias == name) {
+			return option, true
+		}
+	}
+	return nil, false
+}
+
+func applyRequirepass(server *Server) error {
+	server.acl.SetDefaultPassword(Config.Requirepass) // 同步修改default用户的密码
+	return nil
+}
+
+func applyAppendfsync(server *Server) error {
+	if server.persister != nil {
+		server.persister.SetFsync(Config.Appendfsync)
+	}
+	return nil
+}
+
+func applySlowlogMaxLen(server *Server) error {
+	server.slowlog.Trim()
+	return nil
+}
+
+func applyTrackingTableMaxKeys(server *Server) error {
+	server.tracking.Trim()
+	return nil
+}
+
+func applyProtoMaxBulkLen(server *Server) error {
+	resp.SetMaxBulkLen(Config.ProtoMaxBulkLen)
+	return nil
+}
+
+func applyClientQueryBufferLimit(server *Server) error {
+	resp.SetMaxQueryBufferLen(Config.ClientQueryBufferLimit)
+	return nil
+}
+
+/* ---- 配置文件 ---- */
+
+// ConfigFile 配置文件的路径
+var ConfigFile string
 
 func InitConfig(path string) {
+	ConfigFile, _ = filepath.Abs(path)
+	err := readConfigFile(path, 0, func(key string, val string) {
+		// 注入config
+		if err := SetConfig(key, val); err != nil {
+			logger.Warn(err.Error())
+		}
+	})
+	if err != nil {
+		panic(err)
+	}
+	resp.SetMaxBulkLen(Config.ProtoMaxBulkLen)
+	resp.SetMaxQueryBufferLen(Config.ClientQueryBufferLimit)
+}
+
+// include的最大嵌套层数，避免循环include
+const maxIncludeDepth = 16
+
+// readConfigFile 逐行读取配置文件，include的文件在该行的位置被展开
+// include的相对路径相对于当前配置文件所在的目录，支持通配符
+func readConfigFile(path string, depth int, fn func(key string, val string)) error {
+	if depth > maxIncludeDepth {
+		return fmt.Errorf("too many nested includes in '%s'", path)
+	}
 	// 打开文件
 	file, err := os.Open(path)
 	if err != nil {
-		panic(err)
+		return err
 	}
 	defer file.Close() // 关闭文件
 	// 读取文件
 	scanner := bufio.NewScanner(file)
+	lineNum := 0
 	for scanner.Scan() {
-		line := scanner.Text()
-		// 忽略注释(#开头)
-		if len(line) > 0 && strings.TrimLeft(line, " ")[0] == '#' {
+		lineNum++
+		key, val, ok, err := parseConfigArgs(scanner.Text())
+		if err != nil {
+			logger.Warn(fmt.Sprintf("%s:%d: %s", path, lineNum, err.Error()))
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if key != "include" {
+			fn(key, val)
+			continue
+		}
+		pattern := val
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(path), pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %s", path, lineNum, err.Error())
+		}
+		if len(matches) == 0 {
+			return fmt.Errorf("%s:%d: no such file to include '%s'", path, lineNum, val)
+		}
+		for _, match := range matches {
+			if err = readConfigFile(match, depth+1, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// 解析配置行，忽略空行和注释(#开头)
+// 只用于判断配置行对应的配置项，值以parseConfigArgs为准
+func parseConfigLine(line string) (string, string, bool) {
+	key, val, ok, err := parseConfigArgs(line)
+	if err != nil {
+		return "", "", false
+	}
+	return key, val, ok
+}
+
+// parseConfigArgs 将配置行拆分为配置项名称和值，值由一个或多个参数以空格连接而成
+// 参数可以用双引号(支持\n、\"、\xHH等转义)或单引号(只支持\'转义)包裹，以包含空格或表示空值
+func parseConfigArgs(line string) (string, string, bool, error) {
+	args, err := splitConfigArgs(line)
+	if err != nil {
+		return "", "", false, err
+	}
+	if len(args) == 0 || strings.HasPrefix(args[0], "#") {
+		return "", "", false, nil
+	}
+	if len(args) == 1 {
+		return "", "", false, fmt.Errorf("missing value for config option '%s'", args[0])
+	}
+	return strings.ToLower(args[0]), strings.Join(args[1:], " "), true, nil
+}
+
+func splitConfigArgs(line string) ([]string, error) {
+	if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, "#") {
+		return []string{trimmed}, nil // 注释
+	}
+	cmdLine, err := utils.ParseCmds([]byte(line))
+	if err != nil {
+		return nil, errors.New(err.Error() + " in configuration line")
+	}
+	args := make([]string, len(cmdLine))
+	for i, arg := range cmdLine {
+		args[i] = string(arg)
+	}
+	return args, nil
+}
+
+// ReloadConfig 重新读取配置文件，使其中可修改的配置项立即生效，用于SIGHUP
+// 不可修改的配置项若有变化只打印警告，值不合法的配置项保持原值
+func (server *Server) ReloadConfig() error {
+	if ConfigFile == "" {
+		return errors.New("the server is running without a config file")
+	}
+	values := make(map[*configOption]string)
+	order := make([]*configOption, 0)
+	err := readConfigFile(ConfigFile, 0, func(key string, val string) {
+		option, ok := lookupConfig(key)
+		if !ok {
+			logger.Warn(fmt.Sprintf("unknown config option '%s'", key))
+			return
+		}
+		if _, ok = values[option]; !ok {
+			order = append(order, option)
+		}
+		values[option] = val // 同一配置项以最后一次出现为准
+	})
+	if err != nil {
+		return err
+	}
+	for _, option := range order {
+		old := option.value.get()
+		if err = option.value.set(values[option]); err != nil {
+			logger.Warn(fmt.Sprintf("invalid value for config option '%s': %s", option.name, err.Error()))
 			continue
 		}
-		// 解析配置行
-		pivot := strings.IndexAny(line, " ")
-		if pivot > 0 && pivot < len(line)-1 {
-			key := strings.ToLower(line[0:pivot])
-			val := strings.Trim(line[pivot+1:], " ")
-			// 注入config
-			err = SetConfig(key, val)
-			if err != nil {
-				logger.Warn(err.Error())
+		val := option.value.get()
+		if val == old {
+			continue
+		}
+		if option.immutable {
+			_ = option.value.set(old)
+			logger.Warn(fmt.Sprintf("config option '%s' can't be changed without restart", option.name))
+			continue
+		}
+		if option.apply != nil {
+			if err = option.apply(server); err != nil {
+				_ = option.value.set(old)
+				_ = option.apply(server)
+				logger.Warn(fmt.Sprintf("failed to apply config option '%s': %s", option.name, err.Error()))
+				continue
 			}
 		}
+		logger.Info(fmt.Sprintf("config option '%s' changed from '%s' to '%s'", option.name, old, val))
 	}
-	if err = scanner.Err(); err != nil {
-		logger.Fatal(err)
+	// 证书文件的路径不变时内容也可能已更新，总是重新加载
+	if Config.TlsPort > 0 {
+		if err = LoadTLS(); err != nil {
+			logger.Warn("failed to reload TLS certificates: " + err.Error())
+		}
 	}
+	return nil
 }
 
 func SetConfig(key string, val string) error {
-	name := strings.ToUpper(key[:1]) + strings.ToLower(key[1:])
-	fieldVal := ConfigValue.FieldByName(name)
-	field, ok := ConfigType.FieldByName(name)
+	option, ok := lookupConfig(key)
 	if !ok {
-		return errors.New(fmt.Sprintf("unknown config option '%s'", name))
-	}
-	switch field.Type.Kind() {
-	case reflect.Bool:
-		fieldVal.SetBool("yes" == val)
-	case reflect.String:
-		fieldVal.SetString(val)
-	case reflect.Int:
-		intValue, err := strconv.ParseInt(val, 10, 64)
-		if err != nil {
-			return errors.New(fmt.Sprintf("invalid value for config option '%s'", name))
-		}
-		fieldVal.SetInt(intValue)
-	case reflect.Slice:
-		if field.Type.Elem().Kind() == reflect.String {
-			slice := strings.Split(val, ",")
-			fieldVal.Set(reflect.ValueOf(slice))
-		}
+		return errors.New(fmt.Sprintf("unknown config option '%s'", key))
+	}
+	if err := option.value.set(val); err != nil {
+		return fmt.Errorf("invalid value for config option '%s': %s", key, err.Error())
 	}
 	return nil
 }
 
 func GetConfig(key string) (string, bool) {
-	name := strings.ToUpper(key[:1]) + strings.ToLower(key[1:])
-	fieldVal := ConfigValue.FieldByName(name)
-	field, ok := ConfigType.FieldByName(name)
+	option, ok := lookupConfig(key)
 	if !ok {
 		return "", false
 	}
-	var val string
-	switch field.Type.Kind() {
-	case reflect.Bool:
-		val = strconv.FormatBool(fieldVal.Bool())
-	case reflect.String:
-		val = fieldVal.String()
-	case reflect.Int:
-		val = strconv.FormatInt(fieldVal.Int(), 10)
+	return option.value.get(), true
+}
+
+// rewriteConfig 将当前配置写回配置文件，保留注释及未知的配置行
+// 已存在的配置行被替换为当前值(重复的行被删除)，不存在且不是默认值的配置项追加到文件末尾
+func rewriteConfig(path string) error {
+	if path == "" {
+		return errors.New("The server is running without a config file")
+	}
+	content, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	lines := make([]string, 0)
+	if len(content) > 0 {
+		lines = strings.Split(strings.TrimRight(string(content), "\n"), "\n")
+	}
+	written := make(map[string]bool)
+	result := make([]string, 0, len(lines))
+	for _, line := range lines {
+		key, _, ok := parseConfigLine(line)
+		if !ok {
+			result = append(result, line)
+			continue
+		}
+		option, ok := lookupConfig(key)
+		if !ok {
+			result = append(result, line)
+			continue
+		}
+		if written[option.name] {
+			continue
+		}
+		written[option.name] = true
+		result = append(result, formatConfigLine(option))
+	}
+	appended := false
+	for _, option := range configOptions {
+		if written[option.name] || option.value.get() == option.defaultValue {
+			continue
+		}
+		if !appended {
+			result = append(result, "", "# Generated by CONFIG REWRITE")
+			appended = true
+		}
+		result = append(result, formatConfigLine(option))
+	}
+	// 先写入临时文件再替换，避免写入过程中出错导致配置文件损坏
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, []byte(strings.Join(result, "\n")+"\n"), 0644); err != nil {
+		return err
 	}
-	return val, true
+	return os.Rename(tmp, path)
+}
+
+// 含空格、引号或为空的值需要加引号
+func formatConfigLine(option *configOption) string {
+	val := option.value.get()
+	if val == "" || strings.ContainsAny(val, " \t\"'") {
+		val = strconv.Quote(val)
+	}
+	return option.name + " " + val
+}
+
+// 按名称排序的配置项
+func sortedConfigOptions() []*configOption {
+	options := make([]*configOption, len(configOptions))
+	copy(options, configOptions)
+	sort.Slice(options, func(i, j int) bool {
+		return options[i].name < options[j].name
+	})
+	return options
 }
@@ -0,0 +1,288 @@
+package redis_test
+
+import (
+	"go-redis/redis"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// restoreConfig 测试结束时恢复配置项的值
+func restoreConfig(t *testing.T, names ...string) {
+	t.Helper()
+	saved := make(map[string]string, len(names))
+	for _, name := range names {
+		val, ok := redis.GetConfig(name)
+		if !ok {
+			t.Fatalf("unknown config option '%s'", name)
+		}
+		saved[name] = val
+	}
+	t.Cleanup(func() {
+		for name, val := range saved {
+			_ = redis.SetConfig(name, val)
+		}
+	})
+}
+
+func TestParseMemory(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+		ok       bool
+	}{
+		{"100", 100, true},
+		{"100b", 100, true},
+		{"1k", 1000, true},
+		{"1kb", 1024, true},
+		{"1KB", 1024, true},
+		{"5m", 5 * 1000 * 1000, true},
+		{"5mb", 5 << 20, true},
+		{"1g", 1000 * 1000 * 1000, true},
+		{"1Gb", 1 << 30, true},
+		{"-1", -1, true},
+		{"", 0, false},
+		{"mb", 0, false},
+		{"1.5mb", 0, false},
+		{"1tb", 0, false},
+	}
+	for _, test := range tests {
+		n, err := redis.ParseMemory(test.input)
+		if (err == nil) != test.ok || n != test.expected {
+			t.Errorf("ParseMemory(%q) = %d, %v, want %d, ok=%v", test.input, n, err, test.expected, test.ok)
+		}
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	tests := []struct {
+		input    string
+		unit     time.Duration
+		expected int
+		ok       bool
+	}{
+		{"100", time.Second, 100, true},
+		{"100", time.Millisecond, 100, true},
+		{"5s", time.Second, 5, true},
+		{"5s", time.Millisecond, 5000, true},
+		{"1500ms", time.Second, 1, true},
+		{"10us", time.Microsecond, 10, true},
+		{"2m", time.Second, 120, true},
+		{"1h", time.Second, 3600, true},
+		{"1d", time.Second, 86400, true},
+		{"1H", time.Second, 3600, true},
+		{"-1", time.Microsecond, -1, true},
+		{"", time.Second, 0, false},
+		{"5x", time.Second, 0, false},
+		{"d", time.Second, 0, false},
+	}
+	for _, test := range tests {
+		n, err := redis.ParseTime(test.input, test.unit)
+		if (err == nil) != test.ok || n != test.expected {
+			t.Errorf("ParseTime(%q, %s) = %d, %v, want %d, ok=%v", test.input, test.unit, n, err, test.expected, test.ok)
+		}
+	}
+}
+
+// 任一参数校验失败或生效时出错，所有参数都保持原值
+func TestConfigSet_Rollback(t *testing.T) {
+	restoreConfig(t, "maxclients", "timeout", "tls-port", "tls-cert-file", "tls-key-file")
+	server := newTestServer(t)
+	c := newTestClient(t, server)
+	c.expect("+OK\r\n", "config", "set", "maxclients", "100", "timeout", "0")
+
+	tests := [][]string{
+		{"maxclients", "7", "timeout", "5s", "no-such-option", "1"},
+		{"maxclients", "7", "timeout", "abc"},
+		{"maxclients", "7", "port", "1234"},
+		{"maxclients", "7", "maxclients", "8"},
+	}
+	for _, args := range tests {
+		if got := c.do(append([]string{"config", "set"}, args...)...); got[0] != '-' {
+			t.Fatalf("config set %v: got %q, want error", args, got)
+		}
+		c.expect("*4\r\n$10\r\nmaxclients\r\n$3\r\n100\r\n$7\r\ntimeout\r\n$1\r\n0\r\n", "config", "get", "maxclients", "timeout")
+	}
+
+	// 开启tls时证书文件不存在，apply出错
+	if err := redis.SetConfig("tls-port", "1"); err != nil {
+		t.Fatal(err)
+	}
+	got := c.do("config", "set", "maxclients", "7", "tls-cert-file", "/nonexistent/cert.pem", "tls-key-file", "/nonexistent/key.pem")
+	if got[0] != '-' {
+		t.Fatalf("got %q, want error", got)
+	}
+	c.expect("*4\r\n$10\r\nmaxclients\r\n$3\r\n100\r\n$13\r\ntls-cert-file\r\n$0\r\n\r\n", "config", "get", "maxclients", "tls-cert-file")
+}
+
+func TestConfigGet_PatternAndAlias(t *testing.T) {
+	restoreConfig(t, "lua-time-limit", "slowlog-max-len")
+	server := newTestServer(t)
+	c := newTestClient(t, server)
+	c.expect("+OK\r\n", "config", "set", "busy-reply-threshold", "6000", "slowlog-max-len", "64")
+
+	c.expect("*2\r\n$14\r\nlua-time-limit\r\n$4\r\n6000\r\n", "config", "get", "busy-reply-threshold")
+	c.expect("*2\r\n$14\r\nlua-time-limit\r\n$4\r\n6000\r\n", "config", "get", "LUA-TIME-LIMIT")
+	c.expect("*2\r\n$15\r\nslowlog-max-len\r\n$2\r\n64\r\n", "config", "get", "*-max-len")
+	c.expect("*2\r\n$15\r\nslowlog-max-len\r\n$2\r\n64\r\n", "config", "get", "slowlog-max-le?")
+	// 多个模式匹配同一配置项时只返回一次
+	c.expect("*2\r\n$15\r\nslowlog-max-len\r\n$2\r\n64\r\n", "config", "get", "slowlog-max-len", "slowlog-max-*")
+	c.expect("*0\r\n", "config", "get", "no-such-*")
+}
+
+// rewrite保留注释、空行及未知的配置行，替换已有的配置行并删除重复的行，追加不是默认值的配置项
+func TestConfigRewrite(t *testing.T) {
+	restoreConfig(t, "maxclients", "slowlog-max-len", "tls-protocols")
+	configFile := redis.ConfigFile
+	t.Cleanup(func() { redis.ConfigFile = configFile })
+	redis.ConfigFile = filepath.Join(t.TempDir(), "redis.conf")
+	input := "# 注释\n" +
+		"\n" +
+		"maxclients 10\n" +
+		"some-unknown-option yes\n" +
+		"  # 缩进的注释\n" +
+		"MAXCLIENTS 20\n"
+	if err := os.WriteFile(redis.ConfigFile, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	server := newTestServer(t)
+	c := newTestClient(t, server)
+	c.expect("+OK\r\n", "config", "set", "maxclients", "30", "slowlog-max-len", "64", "tls-protocols", "TLSv1.2 TLSv1.3")
+	c.expect("+OK\r\n", "config", "rewrite")
+	content, err := os.ReadFile(redis.ConfigFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "# 注释\n" +
+		"\n" +
+		"maxclients 30\n" +
+		"some-unknown-option yes\n" +
+		"  # 缩进的注释\n" +
+		"\n" +
+		"# Generated by CONFIG REWRITE\n" +
+		"slowlog-max-len 64\n" +
+		"tls-protocols \"TLSv1.2 TLSv1.3\"\n"
+	if string(content) != expected {
+		t.Fatalf("got:\n%s\nwant:\n%s", content, expected)
+	}
+}
+
+// writeConfigFiles 在临时目录中写入配置文件，返回目录
+func writeConfigFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(strings.ReplaceAll(content, "$DIR", dir)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// include的文件在该行的位置展开，相对路径相对于包含它的文件所在的目录，支持通配符
+func TestReadConfigFile_Include(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  []string
+		err   string
+	}{
+		{
+			name:  "relative",
+			files: map[string]string{"redis.conf": "port 1\ninclude sub/a.conf\nport 3\n", "sub/a.conf": "port 2\n"},
+			want:  []string{"port 1", "port 2", "port 3"},
+		},
+		{
+			name:  "absolute",
+			files: map[string]string{"redis.conf": "include $DIR/sub/a.conf\n", "sub/a.conf": "port 2\n"},
+			want:  []string{"port 2"},
+		},
+		{
+			name:  "glob",
+			files: map[string]string{"redis.conf": "include conf.d/*.conf\n", "conf.d/b.conf": "port 2\n", "conf.d/a.conf": "port 1\n", "conf.d/c.txt": "port 3\n"},
+			want:  []string{"port 1", "port 2"},
+		},
+		{
+			name:  "nested relative to including file",
+			files: map[string]string{"redis.conf": "include sub/a.conf\n", "sub/a.conf": "include b.conf\n", "sub/b.conf": "port 2\n"},
+			want:  []string{"port 2"},
+		},
+		{
+			name:  "missing",
+			files: map[string]string{"redis.conf": "include nosuch.conf\n"},
+			err:   "no such file to include 'nosuch.conf'",
+		},
+		{
+			name:  "glob matches nothing",
+			files: map[string]string{"redis.conf": "include conf.d/*.conf\n"},
+			err:   "no such file to include 'conf.d/*.conf'",
+		},
+		{
+			name:  "include loop",
+			files: map[string]string{"redis.conf": "include a.conf\n", "a.conf": "include redis.conf\n"},
+			err:   "too many nested includes",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeConfigFiles(t, tt.files)
+			got, err := redis.ReadConfigFile(filepath.Join(dir, "redis.conf"))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// 重新加载配置文件时可修改的配置项立即生效，不可修改或值不合法的配置项保持原值
+func TestReloadConfig(t *testing.T) {
+	restoreConfig(t, "maxclients", "slowlog-max-len", "port")
+	configFile := redis.ConfigFile
+	t.Cleanup(func() { redis.ConfigFile = configFile })
+	server := newTestServer(t)
+	c := newTestClient(t, server)
+	redis.ConfigFile = ""
+	if err := server.ReloadConfig(); err == nil {
+		t.Fatal("reload without a config file should fail")
+	}
+
+	c.expect("+OK\r\n", "config", "set", "maxclients", "100", "slowlog-max-len", "64")
+	port, _ := redis.GetConfig("port")
+	dir := writeConfigFiles(t, map[string]string{
+		"redis.conf":    "maxclients 50\nport 1\ninclude conf.d/*.conf\n",
+		"conf.d/a.conf": "slowlog-max-len -1\n",
+	})
+	redis.ConfigFile = filepath.Join(dir, "redis.conf")
+	if err := server.ReloadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"maxclients", "50"},
+		{"port", port},
+		{"slowlog-max-len", "64"},
+	}
+	for _, tt := range tests {
+		if got, _ := redis.GetConfig(tt.name); got != tt.want {
+			t.Fatalf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
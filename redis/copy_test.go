@@ -0,0 +1,14 @@
+package redis
+
+import (
+	_type "go-redis/interface/type"
+	"testing"
+)
+
+// 无法拷贝的类型返回错误，而不是返回nil被写入数据库
+func TestCopyEntity_UnsupportedType(t *testing.T) {
+	clone, errReply := copyEntity(_type.NewEntity(struct{}{}))
+	if errReply == nil || clone != nil {
+		t.Fatalf("copyEntity of unsupported type returned %v, %v", clone, errReply)
+	}
+}
@@ -14,6 +14,7 @@ import (
 	_sync "go-redis/utils/sync"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -24,62 +25,120 @@ const (
 )
 
 type Database struct {
-	idx     int                              // 数据库编号
+	idx     int32                            // 数据库编号，swapdb时被修改
+	id      int64                            // 唯一标识，swapdb后不变，用于时间轮中的任务及跨数据库加锁的顺序
 	data    Dict.Dict[string, *_type.Entity] // 数据
-	version Dict.Dict[string, int]           // 版本，用于watch
 	ttlTime Dict.Dict[string, time.Time]     // 超时时间
 	locker  *_sync.Locker                    // 锁，用于执行命令时为key加锁
 	ToAOF   func(_type.CmdLine)              // 添加命令到aof
+	stats   *dbStats                         // 统计信息，用于info
+
+	// client tracking，分别在读取key与修改key后调用，client可能为nil(如key过期)
+	TrackKeys      func(client _interface.Client, keys []string)
+	InvalidateKeys func(client _interface.Client, keys []string)
+	// watch，key被修改或删除后调用
+	TouchKeys func(keys []string)
 }
 
+// 下一个数据库的唯一标识
+var nextDatabaseId int64
+
 func NewDatabase(idx int) *Database {
 	database := &Database{
-		idx:     idx,
+		idx:     int32(idx),
+		id:      atomic.AddInt64(&nextDatabaseId, 1),
 		data:    Dict.NewConcurrentDict[string, *_type.Entity](dataSize),
-		version: Dict.NewConcurrentDict[string, int](dataSize),
 		ttlTime: Dict.NewConcurrentDict[string, time.Time](ttlSize),
 		locker:  _sync.MakeLocker(lockerSize),
 		ToAOF:   func(line _type.CmdLine) {},
+		stats:   &dbStats{},
+
+		TrackKeys:      func(client _interface.Client, keys []string) {},
+		InvalidateKeys: func(client _interface.Client, keys []string) {},
+		TouchKeys:      func(keys []string) {},
 	}
 	return database
 }
 
 func NewSimpleDatabase(idx int) *Database {
 	database := &Database{
-		idx:     idx,
+		idx:     int32(idx),
+		id:      atomic.AddInt64(&nextDatabaseId, 1),
 		data:    Dict.NewSimpleDict[string, *_type.Entity](),
-		version: Dict.NewSimpleDict[string, int](),
 		ttlTime: Dict.NewSimpleDict[string, time.Time](),
 		locker:  _sync.MakeLocker(1),
 		ToAOF:   func(line _type.CmdLine) {},
+		stats:   &dbStats{},
+
+		TrackKeys:      func(client _interface.Client, keys []string) {},
+		InvalidateKeys: func(client _interface.Client, keys []string) {},
+		TouchKeys:      func(keys []string) {},
 	}
 	return database
 }
 
-// Execute 执行命令
-func (db *Database) Execute(client _interface.Client, cmdLine _type.CmdLine) _interface.Reply {
+// Execute 执行命令，dbIdx为client选择的数据库编号
+// 加锁后发现数据库已被swapdb交换到其他编号时不执行并返回false，由调用方重新获取数据库
+func (db *Database) Execute(client _interface.Client, dbIdx int, cmdLine _type.CmdLine) (_interface.Reply, bool) {
 	cmdName := strings.ToLower(string(cmdLine[0])) // 获取命令
 	cmd, ok := CmdRouter[cmdName]
 	if !ok {
 		// 不存在该命令
-		return Reply.StandardError("unknown command '" + cmdName + "'")
+		return Reply.StandardError("unknown command '" + cmdName + "'"), true
 	}
 	if !utils.CheckArgNum(cmd.Arity, cmdLine) {
 		// 参数个数不满足要求
-		return Reply.ArgNumError(cmdName)
+		return Reply.ArgNumError(cmdName), true
 	}
 	args := _type.Args(cmdLine[1:])
 	// 获取有关的key并加锁，这里的加锁解锁对相同的一组key是有固定顺序的，避免因循环等待而产生死锁
-	writeKeys, readKeys := cmd.keysFind(args)
+	writeKeys, readKeys := cmd.keysFind.Find(args)
 	db.lockKeys(writeKeys, readKeys)
 	defer db.unLockKeys(writeKeys, readKeys)
-	// 修改版本，用于watch命令
-	db.AddVersion(writeKeys...)
+	if db.index() != dbIdx {
+		return nil, false
+	}
+	return db.execute(client, cmd, args, writeKeys, readKeys), true
+}
+
+// ExecuteWithoutLock 执行命令但不为key加锁，调用方需已持有相关key的锁，用于lua脚本及事务
+func (db *Database) ExecuteWithoutLock(client _interface.Client, cmdLine _type.CmdLine) _interface.Reply {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	cmd, ok := CmdRouter[cmdName]
+	if !ok {
+		return Reply.StandardError("unknown command '" + cmdName + "'")
+	}
+	if !utils.CheckArgNum(cmd.Arity, cmdLine) {
+		return Reply.ArgNumError(cmdName)
+	}
+	args := _type.Args(cmdLine[1:])
+	writeKeys, readKeys := cmd.keysFind.Find(args)
+	return db.execute(client, cmd, args, writeKeys, readKeys)
+}
+
+func (db *Database) execute(client _interface.Client, cmd *command, args _type.Args, writeKeys []string, readKeys []string) _interface.Reply {
 	// 执行
 	reply := cmd.Executor(db, args)
+	// client tracking：记录只读命令读取的key，使被写命令修改的key失效
+	if _, isErr := reply.(_interface.ErrorReply); !isErr {
+		if cmd.Status == ReadOnly {
+			db.countLookups(readKeys)
+			db.TrackKeys(client, readKeys)
+		}
+		if len(writeKeys) > 0 {
+			db.signalModifiedKeys(client, writeKeys)
+		}
+	}
 	return reply
 }
 
+// withAOF 返回写入aof的方式不同的数据库视图，数据、锁及统计信息与原数据库共享，用于事务中的命令
+func (db *Database) withAOF(toAOF func(_type.CmdLine)) *Database {
+	view := *db
+	view.ToAOF = toAOF
+	return &view
+}
+
 // QuickExecute 快速执行命令，用于AOF文件的加载
 func (db *Database) QuickExecute(client _interface.Client, cmdLine _type.CmdLine) _interface.Reply {
 	cmdName := strings.ToLower(string(cmdLine[0]))
@@ -89,6 +148,57 @@ func (db *Database) QuickExecute(client _interface.Client, cmdLine _type.CmdLine
 	return reply
 }
 
+/* ----- Stats ----- */
+
+type dbStats struct {
+	keyspaceHits   int64
+	keyspaceMisses int64
+	expiredKeys    int64
+}
+
+// 统计只读命令访问key的命中与未命中次数
+func (db *Database) countLookups(keys []string) {
+	for _, key := range keys {
+		if _, ok := db.Peek(key); ok {
+			atomic.AddInt64(&db.stats.keyspaceHits, 1)
+		} else {
+			atomic.AddInt64(&db.stats.keyspaceMisses, 1)
+		}
+	}
+}
+
+// Stats 返回key的命中次数、未命中次数以及过期的key的个数
+func (db *Database) Stats() (hits int64, misses int64, expired int64) {
+	return atomic.LoadInt64(&db.stats.keyspaceHits), atomic.LoadInt64(&db.stats.keyspaceMisses), atomic.LoadInt64(&db.stats.expiredKeys)
+}
+
+func (db *Database) ResetStats() {
+	atomic.StoreInt64(&db.stats.keyspaceHits, 0)
+	atomic.StoreInt64(&db.stats.keyspaceMisses, 0)
+	atomic.StoreInt64(&db.stats.expiredKeys, 0)
+}
+
+// Size 返回key的个数以及设置了过期时间的key的个数
+func (db *Database) Size() (keys int, expires int) {
+	return db.data.Len(), db.ttlTime.Len()
+}
+
+/* ----- Index ----- */
+
+func (db *Database) index() int {
+	return int(atomic.LoadInt32(&db.idx))
+}
+
+// setIndex 修改数据库编号，用于swapdb，调用方需已持有整个数据库的锁
+func (db *Database) setIndex(idx int) {
+	atomic.StoreInt32(&db.idx, int32(idx))
+}
+
+// 时间轮中过期任务的key，使用数据库的唯一标识，swapdb后仍能找到对应的任务
+func (db *Database) taskKey(key string) string {
+	return strconv.FormatInt(db.id, 10) + ":" + key
+}
+
 /* ----- Lock Keys----- */
 
 func (db *Database) lockKeys(writeKeys []string, readKeys []string) {
@@ -99,12 +209,21 @@ func (db *Database) unLockKeys(writeKeys []string, readKeys []string) {
 	db.locker.UnLockKeys(writeKeys, readKeys)
 }
 
+// lockAll 为整个数据库加锁，等待正在执行的命令结束，并阻塞之后对任意key的命令
+func (db *Database) lockAll() {
+	db.locker.LockAll()
+}
+
+func (db *Database) unLockAll() {
+	db.locker.UnLockAll()
+}
+
 /* ----- Time To Live ----- */
 
 func (db *Database) SetExpire(key string, expire time.Time) {
 	db.ttlTime.Put(key, expire)
 	// 创建定时任务
-	taskKey := strconv.FormatInt(int64(db.idx), 10) + ":" + key
+	taskKey := db.taskKey(key)
 	TimeWheel.AddTask(expire.Sub(time.Now()), taskKey, func() {
 		keys := []string{key}
 		db.lockKeys(keys, nil)
@@ -114,18 +233,23 @@ func (db *Database) SetExpire(key string, expire time.Time) {
 			return
 		}
 		// 确保已经过期后再移除
-		if time.Now().After(expireTime) {
+		if now := time.Now(); now.After(expireTime) {
+			defer func() { LatencyMonitor.Add("expire-cycle", time.Since(now)) }()
 			db.data.Remove(key)
-			db.version.Remove(key)
 			db.ttlTime.Remove(key)
+			atomic.AddInt64(&db.stats.expiredKeys, 1)
+			db.signalModifiedKeys(nil, keys)
 			logger.Info(fmt.Sprintf("key '%s' expired", key))
+		} else {
+			// 时间轮的精度为一格，任务可能在过期前最多一格触发，此时按剩余时间重新添加任务，否则key不会被删除
+			db.SetExpire(key, expireTime)
 		}
 	})
 }
 
 func (db *Database) Persist(key string) {
 	db.ttlTime.Remove(key)
-	taskKey := strconv.FormatInt(int64(db.idx), 10) + ":" + key
+	taskKey := db.taskKey(key)
 	TimeWheel.RemoveTask(taskKey)
 }
 
@@ -145,26 +269,27 @@ func (db *Database) IsExpired(key string) bool {
 	return time.Now().After(expire)
 }
 
-/* ----- Version ----- */
+/* ----- Modified Keys ----- */
 
-func (db *Database) AddVersion(keys ...string) {
-	for _, key := range keys {
-		version := db.GetVersion(key)
-		db.version.Put(key, version+1)
-	}
-}
-
-func (db *Database) GetVersion(key string) int {
-	version, ok := db.version.Get(key)
-	if !ok {
-		return 0
-	}
-	return version
+// signalModifiedKeys key被修改或删除后，使client tracking中的key失效，并使watch了这些key的事务放弃执行
+func (db *Database) signalModifiedKeys(client _interface.Client, keys []string) {
+	db.InvalidateKeys(client, keys)
+	db.TouchKeys(keys)
 }
 
 /* ----- Entity Operation ----- */
 
+// Get 获取key对应的entity，并记录一次访问
 func (db *Database) Get(key string) (*_type.Entity, bool) {
+	entity, ok := db.Peek(key)
+	if ok {
+		entity.Touch()
+	}
+	return entity, ok
+}
+
+// Peek 获取key对应的entity，不记录访问，用于object等不应影响访问信息的命令
+func (db *Database) Peek(key string) (*_type.Entity, bool) {
 	entity, ok := db.data.Get(key)
 	if !ok {
 		return nil, false // key不存在
@@ -175,6 +300,36 @@ func (db *Database) Get(key string) (*_type.Entity, bool) {
 	return entity, true
 }
 
+// Exists key是否存在且未过期
+func (db *Database) Exists(key string) bool {
+	_, ok := db.Peek(key)
+	return ok
+}
+
+// RandomKey 随机返回一个未过期的key，数据库为空时返回false
+func (db *Database) RandomKey() (string, bool) {
+	// 过期但还未被删除的key会被跳过，多次尝试后仍未找到则遍历
+	for i := 0; i < 16; i++ {
+		keys := db.data.RandomKeys(1)
+		if len(keys) == 0 {
+			return "", false
+		}
+		if !db.IsExpired(keys[0]) {
+			return keys[0], true
+		}
+	}
+	var found string
+	ok := false
+	db.data.ForEach(func(key string, entity *_type.Entity) bool {
+		if db.IsExpired(key) {
+			return true
+		}
+		found, ok = key, true
+		return false
+	})
+	return found, ok
+}
+
 func (db *Database) Put(key string, entity *_type.Entity) int {
 	return db.data.Put(key, entity)
 }
@@ -189,9 +344,8 @@ func (db *Database) PutIfAbsent(key string, entity *_type.Entity) int {
 
 func (db *Database) Remove(key string) {
 	db.data.Remove(key)
-	db.version.Remove(key)
 	db.ttlTime.Remove(key)
-	taskKey := strconv.FormatInt(int64(db.idx), 10) + ":" + key
+	taskKey := db.taskKey(key)
 	TimeWheel.RemoveTask(taskKey)
 }
 
@@ -219,11 +373,11 @@ func (db *Database) ForEach(operate func(key string, entity *_type.Entity, expir
 	db.data.ForEach(consumer)
 }
 
+// Flush 清空数据，锁保持不变，事务中的flushdb执行时其他key的锁仍由exec持有
+// 旧数据从数据库中分离后由GC回收，耗时只与bucket的个数有关
 func (db *Database) Flush() {
-	db.data.Clear()
-	db.ttlTime.Clear()
-	db.version.Clear()
-	db.locker = _sync.MakeLocker(lockerSize) // 重置锁
+	db.data.Detach()
+	db.ttlTime.Detach()
 }
 
 /* ----- GetScore Entity ----- */
@@ -330,16 +484,7 @@ func (db *Database) GetOrInitZSet(key string) (zset ZSet.ZSet[string], isNew boo
 	isNew = false
 	if zset == nil {
 		// 初始化zset，提供string类型的比较函数
-		compare := func(a string, b string) int {
-			if a < b {
-				return -1
-			} else if a > b {
-				return 1
-			} else {
-				return 0
-			}
-		}
-		zset = ZSet.MakeSortedSet[string](compare) // zest由string类型的SortedSet实现
+		zset = ZSet.MakeSortedSet[string](compareString) // zest由string类型的SortedSet实现
 		entity := _type.NewEntity(zset)
 		db.Put(key, entity)
 		isNew = true
@@ -362,3 +507,56 @@ func (db *Database) GetOrInitDict(key string) (set Dict.Dict[string, []byte], is
 	}
 	return set, isNew, nil
 }
+
+// zset中member的比较函数
+func compareString(a string, b string) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	} else {
+		return 0
+	}
+}
+
+// copyEntity 深拷贝entity，用于copy命令，拷贝与原值不共享任何内存，无法拷贝的类型返回错误
+func copyEntity(entity *_type.Entity) (*_type.Entity, _interface.ErrorReply) {
+	cloneBytes := func(b []byte) []byte {
+		return append(make([]byte, 0, len(b)), b...)
+	}
+	switch data := entity.Data.(type) {
+	case []byte:
+		return _type.NewEntity(cloneBytes(data)), nil
+	case List.List[[]byte]:
+		list := List.NewQuickList[[]byte]()
+		data.ForEach(func(i int, val []byte) bool {
+			list.RPush(cloneBytes(val))
+			return true
+		})
+		return _type.NewEntity(list), nil
+	case Set.Set[string]:
+		set := Set.NewSimpleSet[string]()
+		data.ForEach(func(member string) bool {
+			set.Add(member)
+			return true
+		})
+		return _type.NewEntity(set), nil
+	case ZSet.ZSet[string]:
+		zset := ZSet.MakeSortedSet[string](compareString)
+		if data.Len() > 0 {
+			data.ForEach(0, data.Len(), false, func(member string, score float64) bool {
+				zset.Add(member, score)
+				return true
+			})
+		}
+		return _type.NewEntity(zset), nil
+	case Dict.Dict[string, []byte]:
+		dict := Dict.NewSimpleDict[string, []byte]()
+		data.ForEach(func(field string, val []byte) bool {
+			dict.Put(field, cloneBytes(val))
+			return true
+		})
+		return _type.NewEntity(dict), nil
+	}
+	return nil, Reply.StandardError(fmt.Sprintf("unsupported type %T", entity.Data))
+}
@@ -0,0 +1,62 @@
+package redis_test
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flushall async与不加锁遍历keyspace的命令并发执行，使用-race检查
+func TestFlushAsync_ConcurrentWithScan(t *testing.T) {
+	server := newTestServer(t)
+	writer := newTestClient(t, server)
+	reader := newTestClient(t, server)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 5; i++ {
+			for j := 0; j < 100; j++ {
+				writer.do("rpush", "list"+strconv.Itoa(j), "a", "b", "c")
+			}
+			writer.do("flushall", "async")
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		reader.do("keys", "*")
+		reader.do("scan", "0", "count", "1000")
+		reader.do("randomkey")
+	}
+	wg.Wait()
+	writer.expect(":0\r\n", "dbsize")
+	writer.expect("-ERR: syntax error\r\n", "flushdb", "lazy")
+}
+
+// 时间轮每秒前进一格，任务按延迟的整秒数放入时间格，可能在过期之前最多一秒触发
+// 此时需重新添加任务，否则key只会在被访问时视为不存在，而不会被删除
+func TestExpire_TimeWheelFiresEarly(t *testing.T) {
+	server := newTestServer(t)
+	c := newTestClient(t, server)
+	waitEmpty := func(timeout time.Duration) bool {
+		deadline := time.Now().Add(timeout)
+		for c.do("dbsize") != ":0\r\n" {
+			if time.Now().After(deadline) {
+				return false
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return true
+	}
+	// 等待时间轮前进一格，以确定之后添加的任务的触发时间
+	c.expect("+OK\r\n", "set", "probe", "v", "px", "1")
+	if !waitEmpty(3 * time.Second) {
+		t.Fatal("probe key was not removed")
+	}
+	// 在一格的后半段添加1.5秒后过期的key，任务在第二格触发，即约1.3秒后，早于过期时间
+	time.Sleep(700 * time.Millisecond)
+	c.expect("+OK\r\n", "set", "k", "v", "px", "1500")
+	if !waitEmpty(3 * time.Second) {
+		t.Fatal("expired key was not removed")
+	}
+}
@@ -0,0 +1,195 @@
+package redis
+
+import "strings"
+
+// CommandDoc 命令的文档，用于command docs
+type CommandDoc struct {
+	Summary    string
+	Since      string
+	Complexity string
+}
+
+// 时间复杂度为O(1)或O(log(N))的命令属于fast分类，如"O(1) for each element added."
+func (doc CommandDoc) isFast() bool {
+	if strings.HasPrefix(doc.Complexity, "O(1),") {
+		return false
+	}
+	return strings.HasPrefix(doc.Complexity, "O(1)") || doc.Complexity == "O(log(N))" ||
+		strings.HasPrefix(doc.Complexity, "O(log(N)) ")
+}
+
+// 命令所属的分组，由ACL分类得出
+func commandGroup(categories []string) string {
+	groups := []struct {
+		category string
+		group    string
+	}{
+		{CatString, "string"},
+		{CatBitmap, "bitmap"},
+		{CatList, "list"},
+		{CatHash, "hash"},
+		{CatSet, "set"},
+		{CatSortedSet, "sorted-set"},
+		{CatPubsub, "pubsub"},
+		{CatTransaction, "transactions"},
+		{CatScripting, "scripting"},
+		{CatConnection, "connection"},
+		{CatKeyspace, "generic"},
+	}
+	for _, g := range groups {
+		if containsString(categories, g.category) {
+			return g.group
+		}
+	}
+	return "server"
+}
+
+// commandDocs 所有命令的文档，命令名为小写
+var commandDocs = map[string]CommandDoc{
+	// server
+	"sleep":        {"Blocks the connection for a number of seconds.", "1.0.0", ""},
+	"config":       {"A container for server configuration commands.", "2.0.0", "Depends on subcommand."},
+	"acl":          {"A container for Access List Control commands.", "6.0.0", "Depends on subcommand."},
+	"info":         {"Returns information and statistics about the server.", "1.0.0", "O(1)"},
+	"slowlog":      {"A container for slow log commands.", "2.2.12", "Depends on subcommand."},
+	"latency":      {"A container for latency diagnostics commands.", "2.8.13", "Depends on subcommand."},
+	"monitor":      {"Listens for all requests received by the server in real-time.", "1.0.0", ""},
+	"command":      {"Returns detailed information about all commands.", "2.8.13", "O(N) where N is the total number of Redis commands"},
+	"flushdb":      {"Removes all keys from the current database.", "1.0.0", "O(N) where N is the number of keys in the selected database"},
+	"flushall":     {"Removes all keys from all databases.", "1.0.0", "O(N) where N is the total number of keys in all databases"},
+	"rewriteaof":   {"Synchronously rewrites the append-only file.", "1.0.0", ""},
+	"bgrewriteaof": {"Asynchronously rewrites the append-only file to disk.", "1.0.0", "O(1)"},
+	"swapdb":       {"Swaps two Redis databases.", "4.0.0", "O(N) where N is the count of clients watching or blocking on keys from both databases."},
+	"dbsize":       {"Returns the number of keys in the database.", "1.0.0", "O(1)"},
+	// connection
+	"auth":   {"Authenticates the connection.", "1.0.0", "O(N) where N is the number of passwords defined for the user"},
+	"ping":   {"Returns the server's liveliness response.", "1.0.0", "O(1)"},
+	"hello":  {"Handshakes with the Redis server.", "6.0.0", "O(1)"},
+	"select": {"Changes the selected database.", "1.0.0", "O(1)"},
+	"client": {"A container for client connection commands.", "2.4.0", "Depends on subcommand."},
+	"reset":  {"Resets the connection.", "6.2.0", "O(1)"},
+	// pubsub
+	"subscribe":   {"Listens for messages published to channels.", "2.0.0", "O(N) where N is the number of channels to subscribe to."},
+	"unsubscribe": {"Stops listening to messages posted to channels.", "2.0.0", "O(N) where N is the number of channels to unsubscribe."},
+	"publish":     {"Posts a message to a channel.", "2.0.0", "O(N+M) where N is the number of clients subscribed to the receiving channel and M is the total number of subscribed patterns (by any client)."},
+	// transactions
+	"multi":   {"Starts a transaction.", "1.2.0", "O(1)"},
+	"exec":    {"Executes all commands in a transaction.", "1.2.0", "Depends on commands in the transaction"},
+	"discard": {"Discards a transaction.", "2.0.0", "O(N), when N is the number of queued commands"},
+	"watch":   {"Monitors changes to keys to determine the execution of a transaction.", "2.2.0", "O(1) for every key."},
+	"unwatch": {"Forgets about watched keys of a transaction.", "2.2.0", "O(1)"},
+	// scripting
+	"eval":       {"Executes a server-side Lua script.", "2.6.0", "Depends on the script that is executed."},
+	"eval_ro":    {"Executes a read-only server-side Lua script.", "7.0.0", "Depends on the script that is executed."},
+	"evalsha":    {"Executes a server-side Lua script by SHA1 digest.", "2.6.0", "Depends on the script that is executed."},
+	"evalsha_ro": {"Executes a read-only server-side Lua script by SHA1 digest.", "7.0.0", "Depends on the script that is executed."},
+	"script":     {"A container for Lua scripts management commands.", "2.6.0", "Depends on subcommand."},
+	"fcall":      {"Invokes a function.", "7.0.0", "Depends on the function that is executed."},
+	"fcall_ro":   {"Invokes a read-only function.", "7.0.0", "Depends on the function that is executed."},
+	"function":   {"A container for function commands.", "7.0.0", "Depends on subcommand."},
+	// generic
+	"exists":      {"Determines whether one or more keys exist.", "1.0.0", "O(N) where N is the number of keys to check."},
+	"del":         {"Deletes one or more keys.", "1.0.0", "O(N) where N is the number of keys that will be removed."},
+	"expire":      {"Sets the expiration time of a key in seconds.", "1.0.0", "O(1)"},
+	"expireat":    {"Sets the expiration time of a key to a Unix timestamp.", "1.2.0", "O(1)"},
+	"ttl":         {"Returns the expiration time in seconds of a key.", "1.0.0", "O(1)"},
+	"expiretime":  {"Returns the expiration time of a key as a Unix timestamp.", "7.0.0", "O(1)"},
+	"pexpire":     {"Sets the expiration time of a key in milliseconds.", "2.6.0", "O(1)"},
+	"pexpireat":   {"Sets the expiration time of a key to a Unix milliseconds timestamp.", "2.6.0", "O(1)"},
+	"pttl":        {"Returns the expiration time in milliseconds of a key.", "2.6.0", "O(1)"},
+	"pexpiretime": {"Returns the expiration time of a key as a Unix milliseconds timestamp.", "7.0.0", "O(1)"},
+	"persist":     {"Removes the expiration time of a key.", "2.2.0", "O(1)"},
+	"type":        {"Determines the type of value stored at a key.", "1.0.0", "O(1)"},
+	"rename":      {"Renames a key and overwrites the destination.", "1.0.0", "O(1)"},
+	"renamenx":    {"Renames a key only when the target key name doesn't exist.", "1.0.0", "O(1)"},
+	"keys":        {"Returns all key names that match a pattern.", "1.0.0", "O(N) with N being the number of keys in the database"},
+	"copy":        {"Copies the value of a key to a new key.", "6.2.0", "O(N) worst case for collections, where N is the number of nested items. O(1) for string values."},
+	"move":        {"Moves a key to another database.", "1.0.0", "O(1)"},
+	"unlink":      {"Asynchronously deletes one or more keys.", "4.0.0", "O(1) for each key removed regardless of its size. Then the command does O(N) work in a different thread in order to reclaim memory, where N is the number of allocations the deleted objects where composed of."},
+	"touch":       {"Returns the number of existing keys out of those specified after updating the time they were last accessed.", "3.2.1", "O(N) where N is the number of keys that will be touched."},
+	"randomkey":   {"Returns a random key name from the database.", "1.0.0", "O(1)"},
+	"object":      {"Returns information about a Redis object.", "2.2.3", "O(1)"},
+	// bitmap
+	"setbit":   {"Sets or clears the bit at offset of the string value. Creates the key if it doesn't exist.", "2.2.0", "O(1)"},
+	"getbit":   {"Returns a bit value by offset.", "2.2.0", "O(1)"},
+	"bitcount": {"Counts the number of set bits (population counting) in a string.", "2.6.0", "O(N)"},
+	"bitpos":   {"Finds the first set (1) or clear (0) bit in a string.", "2.8.7", "O(N)"},
+	// string
+	"set":         {"Sets the string value of a key, ignoring its type. The key is created if it doesn't exist.", "1.0.0", "O(1)"},
+	"setnx":       {"Set the string value of a key only when the key doesn't exist.", "1.0.0", "O(1)"},
+	"setex":       {"Sets the string value and expiration time of a key. Creates the key if it doesn't exist.", "2.0.0", "O(1)"},
+	"get":         {"Returns the string value of a key.", "1.0.0", "O(1)"},
+	"getex":       {"Returns the string value of a key after setting its expiration time.", "6.2.0", "O(1)"},
+	"getset":      {"Returns the previous string value of a key after setting it to a new value.", "1.0.0", "O(1)"},
+	"getdel":      {"Returns the string value of a key after deleting the key.", "6.2.0", "O(1)"},
+	"strlen":      {"Returns the length of a string value.", "2.2.0", "O(1)"},
+	"append":      {"Appends a string to the value of a key. Creates the key if it doesn't exist.", "2.0.0", "O(1)"},
+	"mset":        {"Atomically creates or modifies the string values of one or more keys.", "1.0.1", "O(N) where N is the number of keys to set."},
+	"msetnx":      {"Atomically modifies the string values of one or more keys only when all keys don't exist.", "1.0.1", "O(N) where N is the number of keys to set."},
+	"mget":        {"Atomically returns the string values of one or more keys.", "1.0.0", "O(N) where N is the number of keys to retrieve."},
+	"setrange":    {"Overwrites a part of a string value with another by an offset. Creates the key if it doesn't exist.", "2.2.0", "O(1), not counting the time taken to copy the new string in place."},
+	"getrange":    {"Returns a substring of the string stored at a key.", "2.4.0", "O(N) where N is the length of the returned string."},
+	"incr":        {"Increments the integer value of a key by one. Uses 0 as initial value if the key doesn't exist.", "1.0.0", "O(1)"},
+	"incrby":      {"Increments the integer value of a key by a number. Uses 0 as initial value if the key doesn't exist.", "1.0.0", "O(1)"},
+	"incrbyfloat": {"Increment the floating point value of a key by a number. Uses 0 as initial value if the key doesn't exist.", "2.6.0", "O(1)"},
+	"decr":        {"Decrements the integer value of a key by one. Uses 0 as initial value if the key doesn't exist.", "1.0.0", "O(1)"},
+	"decrby":      {"Decrements a number from the integer value of a key. Uses 0 as initial value if the key doesn't exist.", "1.0.0", "O(1)"},
+	// list
+	"lpush":     {"Prepends one or more elements to a list. Creates the key if it doesn't exist.", "1.0.0", "O(1) for each element added."},
+	"rpush":     {"Appends one or more elements to a list. Creates the key if it doesn't exist.", "1.0.0", "O(1) for each element added."},
+	"lpushx":    {"Prepends one or more elements to a list only when the list exists.", "2.2.0", "O(1) for each element added."},
+	"rpushx":    {"Appends an element to a list only when the list exists.", "2.2.0", "O(1) for each element added."},
+	"lpop":      {"Returns the first elements in a list after removing it. Deletes the list if the last element was popped.", "1.0.0", "O(N) where N is the number of elements returned"},
+	"rpop":      {"Returns and removes the last elements of a list. Deletes the list if the last element was popped.", "1.0.0", "O(N) where N is the number of elements returned"},
+	"rpoplpush": {"Returns the last element of a list after removing and pushing it to another list. Deletes the list if the last element was popped.", "1.2.0", "O(1)"},
+	"llen":      {"Returns the length of a list.", "1.0.0", "O(1)"},
+	"lindex":    {"Returns an element from a list by its index.", "1.0.0", "O(N) where N is the number of elements to traverse to get to the element at index."},
+	"lset":      {"Sets the value of an element in a list by its index.", "1.0.0", "O(N) where N is the length of the list."},
+	"lrem":      {"Removes elements from a list. Deletes the list if the last element was removed.", "1.0.0", "O(N+M) where N is the length of the list and M is the number of elements removed."},
+	"lrange":    {"Returns a range of elements from a list.", "1.0.0", "O(S+N) where S is the distance of start offset from HEAD and N is the number of elements in the specified range."},
+	// set
+	"sadd":        {"Adds one or more members to a set. Creates the key if it doesn't exist.", "1.0.0", "O(1) for each element added."},
+	"srem":        {"Removes one or more members from a set. Deletes the set if the last member was removed.", "1.0.0", "O(N) where N is the number of members to be removed."},
+	"spop":        {"Returns one or more random members from a set after removing them. Deletes the set if the last member was popped.", "1.0.0", "O(N) where N is the value of the passed count."},
+	"srandmember": {"Get one or multiple random members from a set.", "1.0.0", "O(N) where N is the absolute value of the passed count."},
+	"scard":       {"Returns the number of members in a set.", "1.0.0", "O(1)"},
+	"sismember":   {"Determines whether a member belongs to a set.", "1.0.0", "O(1)"},
+	"smembers":    {"Returns all members of a set.", "1.0.0", "O(N) where N is the set cardinality."},
+	"sinter":      {"Returns the intersect of multiple sets.", "1.0.0", "O(N*M) worst case where N is the cardinality of the smallest set and M is the number of sets."},
+	"sunion":      {"Returns the union of multiple sets.", "1.0.0", "O(N) where N is the total number of elements in all given sets."},
+	"sdiff":       {"Returns the difference of multiple sets.", "1.0.0", "O(N) where N is the total number of elements in all given sets."},
+	"sinterstore": {"Stores the intersect of multiple sets in a key.", "1.0.0", "O(N*M) worst case where N is the cardinality of the smallest set and M is the number of sets."},
+	"sunionstore": {"Stores the union of multiple sets in a key.", "1.0.0", "O(N) where N is the total number of elements in all given sets."},
+	"sdiffstore":  {"Stores the difference of multiple sets in a key.", "1.0.0", "O(N) where N is the total number of elements in all given sets."},
+	// sorted set
+	"zadd":             {"Adds one or more members to a sorted set, or updates their scores. Creates the key if it doesn't exist.", "1.2.0", "O(log(N)) for each item added, where N is the number of elements in the sorted set."},
+	"zrem":             {"Removes one or more members from a sorted set. Deletes the sorted set if all members were removed.", "1.2.0", "O(M*log(N)) with N being the number of elements in the sorted set and M the number of elements to be removed."},
+	"zremrangebyscore": {"Removes members in a sorted set within a range of scores. Deletes the sorted set if all members were removed.", "1.2.0", "O(log(N)+M) with N being the number of elements in the sorted set and M the number of elements removed by the operation."},
+	"zremrangebyrank":  {"Removes members in a sorted set within a range of indexes. Deletes the sorted set if all members were removed.", "2.0.0", "O(log(N)+M) with N being the number of elements in the sorted set and M the number of elements removed by the operation."},
+	"zcard":            {"Returns the number of members in a sorted set.", "1.2.0", "O(1)"},
+	"zcount":           {"Returns the count of members in a sorted set that have scores within a range.", "2.0.0", "O(log(N)) with N being the number of elements in the sorted set."},
+	"zscore":           {"Returns the score of a member in a sorted set.", "1.2.0", "O(1)"},
+	"zrank":            {"Returns the index of a member in a sorted set ordered by ascending scores.", "2.0.0", "O(log(N))"},
+	"zrevrank":         {"Returns the index of a member in a sorted set ordered by descending scores.", "2.0.0", "O(log(N))"},
+	"zrange":           {"Returns members in a sorted set within a range of indexes.", "1.2.0", "O(log(N)+M) with N being the number of elements in the sorted set and M the number of elements returned."},
+	"zrevrange":        {"Returns members in a sorted set within a range of indexes in reverse order.", "1.2.0", "O(log(N)+M) with N being the number of elements in the sorted set and M the number of elements returned."},
+	"zrangebyscore":    {"Returns members in a sorted set within a range of scores.", "1.0.5", "O(log(N)+M) with N being the number of elements in the sorted set and M the number of elements being returned."},
+	"zrevrangebyscore": {"Returns members in a sorted set within a range of scores in reverse order.", "2.2.0", "O(log(N)+M) with N being the number of elements in the sorted set and M the number of elements being returned."},
+	"zpopmin":          {"Returns the lowest-scoring members from a sorted set after removing them. Deletes the sorted set if the last member was popped.", "5.0.0", "O(log(N)*M) with N being the number of elements in the sorted set, and M being the number of elements popped."},
+	"zincrby":          {"Increments the score of a member in a sorted set.", "1.2.0", "O(log(N)) where N is the number of elements in the sorted set."},
+	// hash
+	"hset":         {"Creates or modifies the value of a field in a hash.", "2.0.0", "O(1) for each field/value pair added."},
+	"hsetnx":       {"Sets the value of a field in a hash only when the field doesn't exist.", "2.0.0", "O(1)"},
+	"hget":         {"Returns the value of a field in a hash.", "2.0.0", "O(1)"},
+	"hmget":        {"Returns the values of all fields in a hash.", "2.0.0", "O(N) where N is the number of fields being requested."},
+	"hkeys":        {"Returns all fields in a hash.", "2.0.0", "O(N) where N is the size of the hash."},
+	"hvals":        {"Returns all values in a hash.", "2.0.0", "O(N) where N is the size of the hash."},
+	"hgetall":      {"Returns all fields and values in a hash.", "2.0.0", "O(N) where N is the size of the hash."},
+	"hdel":         {"Deletes one or more fields and their values from a hash. Deletes the hash if no fields remain.", "2.0.0", "O(N) where N is the number of fields to be removed."},
+	"hlen":         {"Returns the number of fields in a hash.", "2.0.0", "O(1)"},
+	"hexists":      {"Determines whether a field exists in a hash.", "2.0.0", "O(1)"},
+	"hstrlen":      {"Returns the length of the value of a field.", "3.2.0", "O(1)"},
+	"hincrby":      {"Increments the integer value of a field in a hash by a number. Uses 0 as initial value if the field doesn't exist.", "2.0.0", "O(1)"},
+	"hincrbyfloat": {"Increments the floating point value of a field by a number. Uses 0 as initial value if the field doesn't exist.", "2.6.0", "O(1)"},
+	"hrandfield":   {"Returns one or more random fields from a hash.", "6.2.0", "O(N) where N is the number of fields returned"},
+}
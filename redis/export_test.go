@@ -0,0 +1,28 @@
+package redis
+
+import "net/http"
+
+// WatchedKeys 返回watcher中记录的被watch的key的个数，用于检查watch状态是否被清除
+func WatchedKeys(server *Server) int {
+	server.watcher.lock.RLock()
+	defer server.watcher.lock.RUnlock()
+	n := 0
+	for _, keys := range server.watcher.keys {
+		n += len(keys)
+	}
+	return n
+}
+
+// MetricsHandler 返回/metrics的处理函数，用于httptest
+func MetricsHandler(server *Server) http.HandlerFunc {
+	return server.serveMetrics
+}
+
+// ReadConfigFile 读取配置文件，include的文件被展开，按出现顺序返回"key value"
+func ReadConfigFile(path string) ([]string, error) {
+	lines := make([]string, 0)
+	err := readConfigFile(path, 0, func(key string, val string) {
+		lines = append(lines, key+" "+val)
+	})
+	return lines, err
+}
@@ -0,0 +1,611 @@
+package redis
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	_interface "go-redis/interface"
+	_type "go-redis/interface/type"
+	"go-redis/redis/utils"
+	"go-redis/resp"
+	Reply "go-redis/resp/reply"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+const luaEngine = "LUA"
+
+// 函数允许声明的flag
+var functionFlags = map[string]bool{
+	"no-writes":             true,
+	"allow-oom":             true,
+	"allow-stale":           true,
+	"no-cluster":            true,
+	"allow-cross-slot-keys": true,
+}
+
+var functionNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+
+// Library 函数库，由FUNCTION LOAD加载，库中的函数通过redis.register_function注册
+type Library struct {
+	Name      string
+	Code      string
+	Functions map[string]*Function
+	proto     *lua.FunctionProto // 编译后的库代码
+}
+
+type Function struct {
+	Name        string
+	Description string
+	Flags       []string
+	Library     *Library
+}
+
+// NoWrites 函数是否声明了no-writes
+func (fn *Function) NoWrites() bool {
+	for _, flag := range fn.Flags {
+		if flag == "no-writes" {
+			return true
+		}
+	}
+	return false
+}
+
+// 执行库代码时，redis.register_function注册的函数
+type registeredFunction struct {
+	meta     *Function
+	callback *lua.LFunction
+}
+
+// Functions 所有已加载的函数库
+type Functions struct {
+	libraries map[string]*Library  // 库名 -> 库
+	functions map[string]*Function // 函数名 -> 函数
+	lock      sync.RWMutex
+}
+
+func NewFunctions() *Functions {
+	return &Functions{
+		libraries: make(map[string]*Library),
+		functions: make(map[string]*Function),
+	}
+}
+
+// 解析代码首行的元数据，形如"#!lua name=mylib"，返回库名和去掉首行后的代码
+func parseLibraryMeta(code string) (string, string, error) {
+	if !strings.HasPrefix(code, "#!") {
+		return "", "", errors.New("Missing library metadata")
+	}
+	end := strings.IndexByte(code, '\n')
+	if end < 0 {
+		end = len(code)
+	}
+	fields := strings.Fields(code[2:end])
+	if len(fields) == 0 || strings.ToUpper(fields[0]) != luaEngine {
+		engine := ""
+		if len(fields) > 0 {
+			engine = fields[0]
+		}
+		return "", "", fmt.Errorf("Engine '%s' not found", engine)
+	}
+	name := ""
+	for _, field := range fields[1:] {
+		if !strings.HasPrefix(field, "name=") {
+			return "", "", fmt.Errorf("Invalid metadata value given: %s", field)
+		}
+		name = field[len("name="):]
+	}
+	if name == "" {
+		return "", "", errors.New("Library name was not given")
+	}
+	if !functionNamePattern.MatchString(name) {
+		return "", "", errors.New("Library names can only contain letters, numbers, or underscores(_) and must be at least one character long")
+	}
+	// 首行替换为空行，保证报错时的行号与原代码一致
+	return name, code[end:], nil
+}
+
+// compileLibrary 编译库代码并执行一次，以收集其中注册的函数
+func compileLibrary(code string) (*Library, error) {
+	name, body, err := parseLibraryMeta(code)
+	if err != nil {
+		return nil, err
+	}
+	proto, err := compileLua("@user_function", body)
+	if err != nil {
+		return nil, fmt.Errorf("Error compiling function: %s", err.Error())
+	}
+	lib := &Library{
+		Name:      name,
+		Code:      code,
+		Functions: make(map[string]*Function),
+		proto:     proto,
+	}
+	// 加载期间不允许调用redis.call
+	L := newLuaState()
+	defer L.Close()
+	L.SetGlobal("redis", newRedisLib(L))
+	if Config.LuaTimeLimit > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(Config.LuaTimeLimit)*time.Millisecond)
+		defer cancel()
+		L.SetContext(ctx)
+	}
+	registered, err := runLibrary(L, lib)
+	if err != nil {
+		return nil, err
+	}
+	if len(registered) == 0 {
+		return nil, errors.New("No functions registered")
+	}
+	for fnName, fn := range registered {
+		lib.Functions[fnName] = fn.meta
+	}
+	return lib, nil
+}
+
+// runLibrary 执行库代码，返回其注册的函数
+func runLibrary(L *lua.LState, lib *Library) (map[string]*registeredFunction, error) {
+	registered := make(map[string]*registeredFunction)
+	mod, ok := L.GetGlobal("redis").(*lua.LTable)
+	if !ok {
+		return nil, errors.New("redis lib is not registered")
+	}
+	mod.RawSetString("register_function", L.NewFunction(func(L *lua.LState) int {
+		fn, err := parseRegisterArgs(L, lib)
+		if err != nil {
+			L.RaiseError("%s", err.Error())
+			return 0
+		}
+		if _, exists := registered[fn.meta.Name]; exists {
+			L.RaiseError("Function already exists in the library")
+			return 0
+		}
+		registered[fn.meta.Name] = fn
+		return 0
+	}))
+	defer mod.RawSetString("register_function", lua.LNil)
+	L.Push(L.NewFunctionFromProto(lib.proto))
+	err := L.PCall(0, 0, nil)
+	if err != nil {
+		if apiErr, ok := err.(*lua.ApiError); ok {
+			return nil, fmt.Errorf("Error registering functions: %s", apiErr.Object.String())
+		}
+		return nil, err
+	}
+	return registered, nil
+}
+
+// 解析redis.register_function的参数，支持(name, callback)和{function_name=..., callback=..., flags=..., description=...}两种形式
+func parseRegisterArgs(L *lua.LState, lib *Library) (*registeredFunction, error) {
+	fn := &registeredFunction{meta: &Function{Library: lib}}
+	switch first := L.Get(1).(type) {
+	case lua.LString:
+		callback, ok := L.Get(2).(*lua.LFunction)
+		if !ok || L.GetTop() != 2 {
+			return nil, errors.New("wrong arguments given to redis.register_function")
+		}
+		fn.meta.Name = string(first)
+		fn.callback = callback
+	case *lua.LTable:
+		var err error
+		first.ForEach(func(k lua.LValue, v lua.LValue) {
+			if err != nil {
+				return
+			}
+			switch k.String() {
+			case "function_name":
+				fn.meta.Name = v.String()
+			case "callback":
+				callback, ok := v.(*lua.LFunction)
+				if !ok {
+					err = errors.New("callback argument given to redis.register_function must be a function")
+					return
+				}
+				fn.callback = callback
+			case "description":
+				fn.meta.Description = v.String()
+			case "flags":
+				flags, ok := v.(*lua.LTable)
+				if !ok {
+					err = errors.New("flags argument to redis.register_function must be a table representing function flags")
+					return
+				}
+				flags.ForEach(func(_ lua.LValue, flag lua.LValue) {
+					if !functionFlags[flag.String()] {
+						err = errors.New("unknown flag given")
+						return
+					}
+					fn.meta.Flags = append(fn.meta.Flags, flag.String())
+				})
+			default:
+				err = errors.New("unknown argument given to redis.register_function")
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+		if fn.callback == nil {
+			return nil, errors.New("redis.register_function must get a callback argument")
+		}
+	default:
+		return nil, errors.New("wrong arguments given to redis.register_function")
+	}
+	if !functionNamePattern.MatchString(fn.meta.Name) {
+		return nil, errors.New("Function names can only contain letters, numbers, or underscores(_) and must be at least one character long")
+	}
+	return fn, nil
+}
+
+// Load 加载一个库，replace为true时替换同名的库
+func (fns *Functions) Load(code string, replace bool) (string, error) {
+	lib, err := compileLibrary(code)
+	if err != nil {
+		return "", err
+	}
+	fns.lock.Lock()
+	defer fns.lock.Unlock()
+	if err = fns.checkConflict(lib, replace); err != nil {
+		return "", err
+	}
+	fns.add(lib)
+	return lib.Name, nil
+}
+
+// 检查库名和函数名是否与已有的冲突，replace为true时允许替换同名库
+func (fns *Functions) checkConflict(lib *Library, replace bool) error {
+	old, exists := fns.libraries[lib.Name]
+	if exists && !replace {
+		return fmt.Errorf("Library '%s' already exists", lib.Name)
+	}
+	for name := range lib.Functions {
+		fn, ok := fns.functions[name]
+		if ok && (old == nil || fn.Library != old) {
+			return fmt.Errorf("Function %s already exists", name)
+		}
+	}
+	return nil
+}
+
+// 添加库，同名的库被替换，调用方需持有写锁
+func (fns *Functions) add(lib *Library) {
+	fns.remove(lib.Name)
+	fns.libraries[lib.Name] = lib
+	for name, fn := range lib.Functions {
+		fns.functions[name] = fn
+	}
+}
+
+// 移除库，调用方需持有写锁
+func (fns *Functions) remove(name string) bool {
+	lib, ok := fns.libraries[name]
+	if !ok {
+		return false
+	}
+	for fnName := range lib.Functions {
+		delete(fns.functions, fnName)
+	}
+	delete(fns.libraries, name)
+	return true
+}
+
+func (fns *Functions) Delete(name string) bool {
+	fns.lock.Lock()
+	defer fns.lock.Unlock()
+	return fns.remove(name)
+}
+
+func (fns *Functions) Flush() {
+	fns.lock.Lock()
+	defer fns.lock.Unlock()
+	fns.libraries = make(map[string]*Library)
+	fns.functions = make(map[string]*Function)
+}
+
+func (fns *Functions) GetFunction(name string) (*Function, bool) {
+	fns.lock.RLock()
+	defer fns.lock.RUnlock()
+	fn, ok := fns.functions[name]
+	return fn, ok
+}
+
+// Libraries 返回按库名排序的所有库
+func (fns *Functions) Libraries() []*Library {
+	fns.lock.RLock()
+	defer fns.lock.RUnlock()
+	libs := make([]*Library, 0, len(fns.libraries))
+	for _, lib := range fns.libraries {
+		libs = append(libs, lib)
+	}
+	sort.Slice(libs, func(i, j int) bool {
+		return libs[i].Name < libs[j].Name
+	})
+	return libs
+}
+
+// Dump 将所有库的代码序列化为一个RESP数组
+func (fns *Functions) Dump() []byte {
+	libs := fns.Libraries()
+	codes := make([][]byte, len(libs))
+	for i, lib := range libs {
+		codes[i] = []byte(lib.Code)
+	}
+	return Reply.NewArrayReply(codes).ToBytes()
+}
+
+// Restore 从Dump的结果中恢复函数库，policy为FLUSH/APPEND/REPLACE
+func (fns *Functions) Restore(payload []byte, policy string) error {
+	codes, err := parseFunctionDump(payload)
+	if err != nil {
+		return err
+	}
+	libs := make([]*Library, len(codes))
+	for i, code := range codes {
+		libs[i], err = compileLibrary(string(code))
+		if err != nil {
+			return err
+		}
+	}
+	fns.lock.Lock()
+	defer fns.lock.Unlock()
+	// 在新的map中检查并添加全部库，全部成功后再替换，保证恢复操作的原子性
+	libraries := make(map[string]*Library)
+	functions := make(map[string]*Function)
+	if policy != "FLUSH" {
+		for name, lib := range fns.libraries {
+			libraries[name] = lib
+		}
+		for name, fn := range fns.functions {
+			functions[name] = fn
+		}
+	}
+	restored := make(map[string]bool, len(libs))
+	for _, lib := range libs {
+		if restored[lib.Name] {
+			return fmt.Errorf("Library '%s' already exists", lib.Name) // payload中的库重名
+		}
+		restored[lib.Name] = true
+		old, exists := libraries[lib.Name]
+		if !exists {
+			continue
+		}
+		if policy != "REPLACE" {
+			return fmt.Errorf("Library '%s' already exists", lib.Name)
+		}
+		// 先移除被替换的库，其中的函数可以由payload中的任意库重新定义
+		for name := range old.Functions {
+			delete(functions, name)
+		}
+		delete(libraries, lib.Name)
+	}
+	for _, lib := range libs {
+		for name := range lib.Functions {
+			if _, ok := functions[name]; ok {
+				return fmt.Errorf("Function %s already exists", name)
+			}
+		}
+		libraries[lib.Name] = lib
+		for name, fn := range lib.Functions {
+			functions[name] = fn
+		}
+	}
+	fns.libraries, fns.functions = libraries, functions
+	return nil
+}
+
+func parseFunctionDump(payload []byte) ([][]byte, error) {
+	var codes [][]byte
+	var err error
+	ch := resp.NewParser(bytes.NewReader(payload)).ParseFile()
+	for p := range ch {
+		if p.Err != nil {
+			if p.Err != io.EOF && err == nil {
+				err = p.Err
+			}
+			continue
+		}
+		arr, ok := p.Data.(*Reply.ArrayReply)
+		if !ok || codes != nil {
+			err = errors.New("payload version or checksum are wrong")
+			continue
+		}
+		codes = arr.Bulks
+	}
+	if err == nil && codes == nil {
+		err = errors.New("payload version or checksum are wrong")
+	}
+	return codes, err
+}
+
+// ToCmds 将所有库转换为FUNCTION LOAD命令，用于AOF重写
+func (fns *Functions) ToCmds() []*Reply.ArrayReply {
+	libs := fns.Libraries()
+	cmds := make([]*Reply.ArrayReply, len(libs))
+	for i, lib := range libs {
+		cmds[i] = Reply.StringToArrayReply("FUNCTION", "LOAD", "REPLACE", lib.Code)
+	}
+	return cmds
+}
+
+/* ---- commands ---- */
+
+func execFCall(server *Server, client _interface.Client, args _type.Args) _interface.Reply {
+	return doFCall(server, client, args, false)
+}
+
+func execFCallRO(server *Server, client _interface.Client, args _type.Args) _interface.Reply {
+	return doFCall(server, client, args, true)
+}
+
+func doFCall(server *Server, client _interface.Client, args _type.Args, readOnly bool) _interface.Reply {
+	fn, ok := server.functions.GetFunction(string(args[0]))
+	if !ok {
+		return Reply.StandardError("Function not found")
+	}
+	if readOnly && !fn.NoWrites() {
+		return Reply.StandardError("Can not execute a script with write flag using *_ro command.")
+	}
+	keys, argv, errReply := parseScriptArgs(args[1:])
+	if errReply != nil {
+		return errReply
+	}
+	return server.callLua(client, keys, readOnly || fn.NoWrites(), func(L *lua.LState) (lua.LValue, []lua.LValue, error) {
+		registered, err := runLibrary(L, fn.Library)
+		if err != nil {
+			return nil, nil, err
+		}
+		callback, ok := registered[fn.Name]
+		if !ok {
+			return nil, nil, errors.New("Function not found")
+		}
+		keyBytes := make([][]byte, len(keys))
+		for i, key := range keys {
+			keyBytes[i] = []byte(key)
+		}
+		params := []lua.LValue{toLuaTable(L, keyBytes), toLuaTable(L, argv)}
+		return callback.callback, params, nil
+	})
+}
+
+func execFunction(server *Server, client _interface.Client, args _type.Args) _interface.Reply {
+	sub := strings.ToLower(string(args[0]))
+	switch sub {
+	case "load":
+		return execFunctionLoad(server, client, args[1:])
+	case "delete":
+		if len(args) != 2 {
+			return Reply.ArgNumError("function|delete")
+		}
+		if !server.functions.Delete(string(args[1])) {
+			return Reply.StandardError("Library not found")
+		}
+		server.functionToAOF(client, utils.ToCmd("FUNCTION", args...))
+		return Reply.NewOkReply()
+	case "flush":
+		if len(args) > 2 {
+			return Reply.ArgNumError("function|flush")
+		}
+		if len(args) == 2 {
+			mode := strings.ToLower(string(args[1]))
+			if mode != "async" && mode != "sync" {
+				return Reply.SyntaxError()
+			}
+		}
+		server.functions.Flush()
+		server.functionToAOF(client, utils.ToCmd("FUNCTION", []byte("FLUSH")))
+		return Reply.NewOkReply()
+	case "list":
+		return execFunctionList(server, args[1:])
+	case "dump":
+		if len(args) != 1 {
+			return Reply.ArgNumError("function|dump")
+		}
+		return Reply.NewBulkReply(server.functions.Dump())
+	case "restore":
+		if len(args) != 2 && len(args) != 3 {
+			return Reply.ArgNumError("function|restore")
+		}
+		policy := "APPEND"
+		if len(args) == 3 {
+			policy = strings.ToUpper(string(args[2]))
+			if policy != "FLUSH" && policy != "APPEND" && policy != "REPLACE" {
+				return Reply.StandardError("Wrong restore policy given, value should be either FLUSH, APPEND or REPLACE.")
+			}
+		}
+		err := server.functions.Restore(args[1], policy)
+		if err != nil {
+			return Reply.StandardError(err.Error())
+		}
+		server.functionToAOF(client, utils.ToCmd("FUNCTION", []byte("RESTORE"), args[1], []byte(policy)))
+		return Reply.NewOkReply()
+	case "kill":
+		if len(args) != 1 {
+			return Reply.ArgNumError("function|kill")
+		}
+		return server.scripts.Kill()
+	}
+	return Reply.StandardError(fmt.Sprintf("unknown subcommand '%s'", sub))
+}
+
+// FUNCTION LOAD [REPLACE] code
+func execFunctionLoad(server *Server, client _interface.Client, args _type.Args) _interface.Reply {
+	replace := false
+	if len(args) == 2 && strings.ToUpper(string(args[0])) == "REPLACE" {
+		replace = true
+		args = args[1:]
+	}
+	if len(args) != 1 {
+		return Reply.ArgNumError("function|load")
+	}
+	name, err := server.functions.Load(string(args[0]), replace)
+	if err != nil {
+		return Reply.StandardError(err.Error())
+	}
+	// 以REPLACE的形式写入aof，保证重放时不会因库已存在而失败
+	server.functionToAOF(client, utils.ToCmd("FUNCTION", []byte("LOAD"), []byte("REPLACE"), args[0]))
+	return Reply.NewBulkReply([]byte(name))
+}
+
+// FUNCTION LIST [LIBRARYNAME pattern] [WITHCODE]
+func execFunctionList(server *Server, args _type.Args) _interface.Reply {
+	withCode, pattern := false, ""
+	for i := 0; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "WITHCODE":
+			withCode = true
+		case "LIBRARYNAME":
+			if i+1 >= len(args) {
+				return Reply.SyntaxError()
+			}
+			pattern = string(args[i+1])
+			i++
+		default:
+			return Reply.SyntaxError()
+		}
+	}
+	replies := make([]_interface.Reply, 0)
+	for _, lib := range server.functions.Libraries() {
+		if pattern != "" && !utils.MatchPattern(pattern, lib.Name) {
+			continue
+		}
+		names := make([]string, 0, len(lib.Functions))
+		for name := range lib.Functions {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fnReplies := make([]_interface.Reply, len(names))
+		for i, name := range names {
+			fn := lib.Functions[name]
+			var desc _interface.Reply = Reply.NewNilBulkReply()
+			if fn.Description != "" {
+				desc = Reply.NewBulkReply([]byte(fn.Description))
+			}
+			fnReplies[i] = Reply.NewRawArrayReply([]_interface.Reply{
+				Reply.NewBulkReply([]byte("name")), Reply.NewBulkReply([]byte(fn.Name)),
+				Reply.NewBulkReply([]byte("description")), desc,
+				Reply.NewBulkReply([]byte("flags")), Reply.StringToArrayReply(fn.Flags...),
+			})
+		}
+		libReply := []_interface.Reply{
+			Reply.NewBulkReply([]byte("library_name")), Reply.NewBulkReply([]byte(lib.Name)),
+			Reply.NewBulkReply([]byte("engine")), Reply.NewBulkReply([]byte(luaEngine)),
+			Reply.NewBulkReply([]byte("functions")), Reply.NewRawArrayReply(fnReplies),
+		}
+		if withCode {
+			libReply = append(libReply, Reply.NewBulkReply([]byte("library_code")), Reply.NewBulkReply([]byte(lib.Code)))
+		}
+		replies = append(replies, Reply.NewRawArrayReply(libReply))
+	}
+	return Reply.NewRawArrayReply(replies)
+}
+
+// 函数库是全局的，写入aof时沿用client当前选择的db，避免多余的select
+func (server *Server) functionToAOF(client _interface.Client, cmdLine _type.CmdLine) {
+	server.clientDatabase(client, client.GetSelectDB()).ToAOF(cmdLine)
+}
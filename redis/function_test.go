@@ -0,0 +1,117 @@
+package redis_test
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// 返回注册了fnNames的库代码，函数返回"<库名>.<函数名>"
+func libraryCode(lib string, fnNames ...string) string {
+	var builder strings.Builder
+	builder.WriteString("#!lua name=" + lib + "\n")
+	for _, name := range fnNames {
+		builder.WriteString(fmt.Sprintf("redis.register_function('%s', function() return '%s.%s' end)\n", name, lib, name))
+	}
+	return builder.String()
+}
+
+// 与FUNCTION DUMP格式相同的payload
+func functionPayload(codes ...string) string {
+	var builder strings.Builder
+	builder.WriteString("*" + strconv.Itoa(len(codes)) + "\r\n")
+	for _, code := range codes {
+		builder.WriteString("$" + strconv.Itoa(len(code)) + "\r\n" + code + "\r\n")
+	}
+	return builder.String()
+}
+
+func (c *testClient) expectFunction(name string, lib string) {
+	c.t.Helper()
+	if lib == "" {
+		if got := c.do("fcall", name, "0"); !strings.Contains(got, "Function not found") {
+			c.t.Fatalf("fcall %s: got %q, want not found", name, got)
+		}
+		return
+	}
+	want := lib + "." + name
+	c.expect("$"+strconv.Itoa(len(want))+"\r\n"+want+"\r\n", "fcall", name, "0")
+}
+
+func TestFunctionRestore(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  string
+		payload []string
+		ok      bool
+		fns     map[string]string // 恢复后函数所属的库，为空表示不存在
+	}{
+		{
+			name:    "flush duplicate function in payload",
+			policy:  "FLUSH",
+			payload: []string{libraryCode("x", "g"), libraryCode("y", "g")},
+			fns:     map[string]string{"f1": "a", "f2": "b", "g": ""},
+		},
+		{
+			name:    "append duplicate library in payload",
+			policy:  "APPEND",
+			payload: []string{libraryCode("x", "g"), libraryCode("x", "h")},
+			fns:     map[string]string{"f1": "a", "g": "", "h": ""},
+		},
+		{
+			name:    "append existing library",
+			policy:  "APPEND",
+			payload: []string{libraryCode("x", "g"), libraryCode("a", "h")},
+			fns:     map[string]string{"f1": "a", "g": "", "h": ""},
+		},
+		{
+			name:    "append existing function",
+			policy:  "APPEND",
+			payload: []string{libraryCode("x", "g"), libraryCode("y", "f2")},
+			fns:     map[string]string{"f2": "b", "g": ""},
+		},
+		{
+			name:    "replace function of another library",
+			policy:  "REPLACE",
+			payload: []string{libraryCode("a", "g"), libraryCode("y", "f2")},
+			fns:     map[string]string{"f1": "a", "f2": "b", "g": ""},
+		},
+		{
+			name:    "replace moves function between libraries",
+			policy:  "REPLACE",
+			payload: []string{libraryCode("x", "f1"), libraryCode("a", "g")},
+			ok:      true,
+			fns:     map[string]string{"f1": "x", "f2": "b", "g": "a"},
+		},
+		{
+			name:    "append",
+			policy:  "APPEND",
+			payload: []string{libraryCode("x", "g")},
+			ok:      true,
+			fns:     map[string]string{"f1": "a", "f2": "b", "g": "x"},
+		},
+		{
+			name:    "flush",
+			policy:  "FLUSH",
+			payload: []string{libraryCode("a", "g"), libraryCode("x", "f2")},
+			ok:      true,
+			fns:     map[string]string{"f1": "", "f2": "x", "g": "a"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestServer(t)
+			c := newTestClient(t, server)
+			c.expect("$1\r\na\r\n", "function", "load", libraryCode("a", "f1"))
+			c.expect("$1\r\nb\r\n", "function", "load", libraryCode("b", "f2"))
+			got := c.do("function", "restore", functionPayload(test.payload...), test.policy)
+			if ok := got == "+OK\r\n"; ok != test.ok {
+				t.Fatalf("function restore: got %q, want ok=%v", got, test.ok)
+			}
+			for name, lib := range test.fns {
+				c.expectFunction(name, lib)
+			}
+		})
+	}
+}
@@ -0,0 +1,377 @@
+package redis
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	_interface "go-redis/interface"
+	_type "go-redis/interface/type"
+	Reply "go-redis/resp/reply"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const opsSampleCount = 16 // instantaneous_ops_per_sec取最近16次采样的平均值
+
+// serverStats server级别的统计信息
+type serverStats struct {
+	startTime time.Time
+	runId     string
+
+	connectedClients    int64
+	totalConnections    int64
+	rejectedConnections int64
+	totalCommands       int64
+
+	opsSamples   [opsSampleCount]int64
+	opsIdx       int
+	lastCommands int64
+	lastSample   time.Time
+	peakMemory   uint64
+	done         chan struct{}
+
+	commands sync.Map // 每个命令的统计信息，name -> *commandStat
+}
+
+// commandStat 单个命令的统计信息，用于info commandstats及metrics
+type commandStat struct {
+	calls       int64
+	failedCalls int64
+	latency     *histogram // 执行耗时
+}
+
+func newServerStats() *serverStats {
+	buf := make([]byte, 20)
+	_, _ = rand.Read(buf)
+	stats := &serverStats{
+		startTime:  time.Now(),
+		runId:      hex.EncodeToString(buf),
+		lastSample: time.Now(),
+		done:       make(chan struct{}),
+	}
+	go stats.sampling()
+	return stats
+}
+
+// 每100毫秒采样一次每秒执行的命令数
+func (stats *serverStats) sampling() {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stats.done:
+			return
+		case now := <-ticker.C:
+			commands := atomic.LoadInt64(&stats.totalCommands)
+			elapsed := now.Sub(stats.lastSample).Milliseconds()
+			if elapsed > 0 {
+				atomic.StoreInt64(&stats.opsSamples[stats.opsIdx], (commands-stats.lastCommands)*1000/elapsed)
+				stats.opsIdx = (stats.opsIdx + 1) % opsSampleCount
+			}
+			stats.lastCommands, stats.lastSample = commands, now
+		}
+	}
+}
+
+func (stats *serverStats) instantaneousOps() int64 {
+	var sum int64
+	for i := range stats.opsSamples {
+		sum += atomic.LoadInt64(&stats.opsSamples[i])
+	}
+	return sum / opsSampleCount
+}
+
+// 记录命令的调用次数、失败次数及耗时，未知命令不记录
+func (stats *serverStats) recordCommand(cmdLine _type.CmdLine, reply _interface.Reply, duration time.Duration) {
+	if _, ok := CommandCategories(strings.ToLower(string(cmdLine[0]))); !ok {
+		return
+	}
+	name := fullCmdName(cmdLine)
+	value, ok := stats.commands.Load(name)
+	if !ok {
+		value, _ = stats.commands.LoadOrStore(name, &commandStat{latency: newHistogram()})
+	}
+	stat := value.(*commandStat)
+	atomic.AddInt64(&stat.calls, 1)
+	if _, isErr := reply.(_interface.ErrorReply); isErr {
+		atomic.AddInt64(&stat.failedCalls, 1)
+	}
+	stat.latency.observe(duration)
+}
+
+// 按名称排序的命令统计
+func (stats *serverStats) commandStats() ([]string, []*commandStat) {
+	names := make([]string, 0)
+	stats.commands.Range(func(key, value any) bool {
+		names = append(names, key.(string))
+		return true
+	})
+	sort.Strings(names)
+	commandStats := make([]*commandStat, len(names))
+	for i, name := range names {
+		value, _ := stats.commands.Load(name)
+		commandStats[i] = value.(*commandStat)
+	}
+	return names, commandStats
+}
+
+func (stats *serverStats) reset() {
+	atomic.StoreInt64(&stats.totalConnections, 0)
+	atomic.StoreInt64(&stats.rejectedConnections, 0)
+	atomic.StoreInt64(&outputBufferLimitDisconnections, 0)
+	atomic.StoreInt64(&stats.totalCommands, 0)
+	stats.commands.Range(func(key, value any) bool {
+		stats.commands.Delete(key)
+		return true
+	})
+}
+
+func (stats *serverStats) close() {
+	close(stats.done)
+}
+
+/* ---- info ---- */
+
+// info的各个section，default中不包含的section需要显式指定
+var infoSections = []struct {
+	name       string
+	byDefault  bool
+	generateFn func(server *Server) [][2]string
+}{
+	{"server", true, infoServer},
+	{"clients", true, infoClients},
+	{"memory", true, infoMemory},
+	{"persistence", true, infoPersistence},
+	{"stats", true, infoStats},
+	{"replication", true, infoReplication},
+	{"commandstats", false, infoCommandStats},
+	{"keyspace", true, infoKeyspace},
+}
+
+func infoServer(server *Server) [][2]string {
+	executable, _ := os.Executable()
+	uptime := int64(time.Since(server.stats.startTime).Seconds())
+	return [][2]string{
+		{"redis_version", RedisVersion},
+		{"redis_mode", "standalone"},
+		{"os", runtime.GOOS + " " + runtime.GOARCH},
+		{"arch_bits", strconv.Itoa(strconv.IntSize)},
+		{"go_version", runtime.Version()},
+		{"process_id", strconv.Itoa(os.Getpid())},
+		{"run_id", server.stats.runId},
+		{"tcp_port", strconv.Itoa(Config.Port)},
+		{"server_time_usec", strconv.FormatInt(time.Now().UnixMicro(), 10)},
+		{"uptime_in_seconds", strconv.FormatInt(uptime, 10)},
+		{"uptime_in_days", strconv.FormatInt(uptime/86400, 10)},
+		{"executable", executable},
+		{"config_file", ConfigFile},
+	}
+}
+
+func infoClients(server *Server) [][2]string {
+	connected, pubsub := 0, 0
+	server.clients.Range(func(key, value any) bool {
+		connected++
+		if value.(_interface.Client).ChannelsCount() > 0 {
+			pubsub++
+		}
+		return true
+	})
+	server.tracking.lock.Lock()
+	tracking := len(server.tracking.clients)
+	server.tracking.lock.Unlock()
+	return [][2]string{
+		{"connected_clients", strconv.Itoa(connected)},
+		{"maxclients", strconv.Itoa(Config.Maxclients)},
+		{"blocked_clients", "0"},
+		{"tracking_clients", strconv.Itoa(tracking)},
+		{"pubsub_clients", strconv.Itoa(pubsub)},
+	}
+}
+
+func infoMemory(server *Server) [][2]string {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	peak := atomic.LoadUint64(&server.stats.peakMemory)
+	if mem.HeapAlloc > peak {
+		peak = mem.HeapAlloc
+		atomic.StoreUint64(&server.stats.peakMemory, peak)
+	}
+	ratio := 0.0
+	if mem.HeapAlloc > 0 {
+		ratio = float64(mem.Sys) / float64(mem.HeapAlloc)
+	}
+	return [][2]string{
+		{"used_memory", strconv.FormatUint(mem.HeapAlloc, 10)},
+		{"used_memory_human", bytesToHuman(mem.HeapAlloc)},
+		{"used_memory_rss", strconv.FormatUint(mem.Sys, 10)},
+		{"used_memory_rss_human", bytesToHuman(mem.Sys)},
+		{"used_memory_peak", strconv.FormatUint(peak, 10)},
+		{"used_memory_peak_human", bytesToHuman(peak)},
+		{"maxmemory", "0"},
+		{"maxmemory_human", "0B"},
+		{"maxmemory_policy", "noeviction"},
+		{"mem_fragmentation_ratio", strconv.FormatFloat(ratio, 'f', 2, 64)},
+		{"mem_allocator", "go"},
+	}
+}
+
+func infoPersistence(server *Server) [][2]string {
+	fields := [][2]string{
+		{"loading", "0"},
+	}
+	if server.persister == nil {
+		return append(fields,
+			[2]string{"aof_enabled", "0"},
+			[2]string{"aof_rewrite_in_progress", "0"},
+			[2]string{"aof_last_rewrite_time_sec", "-1"},
+			[2]string{"aof_last_bgrewrite_status", "ok"},
+		)
+	}
+	rewriting, status, last := server.persister.RewriteStats()
+	return append(fields,
+		[2]string{"aof_enabled", "1"},
+		[2]string{"aof_rewrite_in_progress", boolToFlag(rewriting)},
+		[2]string{"aof_last_rewrite_time_sec", strconv.FormatInt(int64(last.Seconds()), 10)},
+		[2]string{"aof_last_bgrewrite_status", status},
+		[2]string{"aof_rewrites", strconv.FormatInt(server.persister.Rewrites(), 10)},
+		[2]string{"aof_current_size", strconv.FormatInt(server.persister.FileSize(), 10)},
+	)
+}
+
+func infoStats(server *Server) [][2]string {
+	var hits, misses, expired int64
+	for i := range server.databases {
+		h, m, e := server.getDatabase(i).Stats()
+		hits, misses, expired = hits+h, misses+m, expired+e
+	}
+	server.tracking.lock.Lock()
+	trackingKeys := len(server.tracking.keys)
+	server.tracking.lock.Unlock()
+	return [][2]string{
+		{"total_connections_received", strconv.FormatInt(atomic.LoadInt64(&server.stats.totalConnections), 10)},
+		{"total_commands_processed", strconv.FormatInt(atomic.LoadInt64(&server.stats.totalCommands), 10)},
+		{"instantaneous_ops_per_sec", strconv.FormatInt(server.stats.instantaneousOps(), 10)},
+		{"rejected_connections", strconv.FormatInt(atomic.LoadInt64(&server.stats.rejectedConnections), 10)},
+		{"expired_keys", strconv.FormatInt(expired, 10)},
+		{"evicted_keys", "0"},
+		{"keyspace_hits", strconv.FormatInt(hits, 10)},
+		{"keyspace_misses", strconv.FormatInt(misses, 10)},
+		{"pubsub_channels", strconv.Itoa(server.pubsub.table.Len())},
+		{"tracking_total_keys", strconv.Itoa(trackingKeys)},
+		{"client_output_buffer_limit_disconnections", strconv.FormatInt(atomic.LoadInt64(&outputBufferLimitDisconnections), 10)},
+	}
+}
+
+func infoReplication(server *Server) [][2]string {
+	return [][2]string{
+		{"role", "master"},
+		{"connected_slaves", "0"},
+		{"master_replid", server.stats.runId},
+		{"master_repl_offset", "0"},
+	}
+}
+
+func infoCommandStats(server *Server) [][2]string {
+	names, commandStats := server.stats.commandStats()
+	fields := make([][2]string, len(names))
+	for i, name := range names {
+		stat := commandStats[i]
+		calls := atomic.LoadInt64(&stat.calls)
+		usec := stat.latency.sumMicroseconds()
+		perCall := 0.0
+		if calls > 0 {
+			perCall = float64(usec) / float64(calls)
+		}
+		fields[i] = [2]string{"cmdstat_" + name, fmt.Sprintf("calls=%d,usec=%d,usec_per_call=%.2f,failed_calls=%d",
+			calls, usec, perCall, atomic.LoadInt64(&stat.failedCalls))}
+	}
+	return fields
+}
+
+func infoKeyspace(server *Server) [][2]string {
+	fields := make([][2]string, 0)
+	for i := range server.databases {
+		keys, expires := server.getDatabase(i).Size()
+		if keys == 0 {
+			continue
+		}
+		fields = append(fields, [2]string{"db" + strconv.Itoa(i), fmt.Sprintf("keys=%d,expires=%d,avg_ttl=0", keys, expires)})
+	}
+	return fields
+}
+
+func boolToFlag(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+// 将字节数转换为易读的格式，如1.50M
+func bytesToHuman(n uint64) string {
+	units := []string{"B", "K", "M", "G", "T"}
+	value := float64(n)
+	i := 0
+	for value >= 1024 && i < len(units)-1 {
+		value /= 1024
+		i++
+	}
+	if i == 0 {
+		return strconv.FormatUint(n, 10) + "B"
+	}
+	return strconv.FormatFloat(value, 'f', 2, 64) + units[i]
+}
+
+// generateInfo 生成指定section的info，sections为空时使用default
+func (server *Server) generateInfo(sections []string) string {
+	all, useDefault := false, len(sections) == 0
+	wanted := make(map[string]bool)
+	for _, section := range sections {
+		section = strings.ToLower(section)
+		switch section {
+		case "all", "everything":
+			all = true
+		case "default":
+			useDefault = true
+		default:
+			wanted[section] = true
+		}
+	}
+	var builder strings.Builder
+	for _, section := range infoSections {
+		if !all && !wanted[section.name] && !(useDefault && section.byDefault) {
+			continue
+		}
+		if builder.Len() > 0 {
+			builder.WriteString("\r\n")
+		}
+		builder.WriteString("# " + strings.ToUpper(section.name[:1]) + section.name[1:] + "\r\n")
+		for _, field := range section.generateFn(server) {
+			builder.WriteString(field[0] + ":" + field[1] + "\r\n")
+		}
+	}
+	return builder.String()
+}
+
+func execInfo(server *Server, client _interface.Client, args _type.Args) _interface.Reply {
+	sections := make([]string, len(args))
+	for i, arg := range args {
+		sections[i] = string(arg)
+	}
+	return Reply.NewVerbatimReply("txt", server.generateInfo(sections))
+}
+
+// resetStats config resetstat
+func (server *Server) resetStats() {
+	server.stats.reset()
+	for i := range server.databases {
+		server.getDatabase(i).ResetStats()
+	}
+}
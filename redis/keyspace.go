@@ -0,0 +1,215 @@
+package redis
+
+import (
+	_interface "go-redis/interface"
+	_type "go-redis/interface/type"
+	"go-redis/redis/utils"
+	Reply "go-redis/resp/reply"
+	"strconv"
+	"strings"
+)
+
+// 涉及多个数据库的命令，需要访问server，因此作为系统命令实现
+func init() {
+	RegisterSysCommand("copy", execCopy, -3, CatKeyspace, CatWrite).SetKeys(utils.WriteSecondReadFirst)
+	RegisterSysCommand("move", execMove, 3, CatKeyspace, CatWrite).SetKeys(utils.WriteFirst)
+	RegisterSysCommand("swapdb", execSwapDB, 3, CatKeyspace, CatWrite, CatDangerous)
+}
+
+// COPY source destination [DB destination-db] [REPLACE]
+func execCopy(server *Server, client _interface.Client, args _type.Args) _interface.Reply {
+	srcIdx := client.GetSelectDB()
+	dstIdx, replace, errReply := parseCopyOptions(args[2:], srcIdx, server.dataBaseCount())
+	if errReply != nil {
+		return errReply
+	}
+	src, dst := string(args[0]), string(args[1])
+	if srcIdx == dstIdx && src == dst {
+		return Reply.StandardError("source and destination objects are the same")
+	}
+	// 事务中的key已由exec加锁
+	if !client.IsTxState() {
+		locks := server.lockDBs(func(locks *dbKeyLocks) {
+			locks.addPair(server, srcIdx, nil, []string{src}, dstIdx, []string{dst}, nil)
+		})
+		defer locks.unlock()
+	}
+	srcDB, dstDB := server.clientDatabase(client, srcIdx), server.getDatabase(dstIdx)
+	entity, ok := srcDB.Get(src)
+	if !ok {
+		return Reply.NewIntegerReply(0)
+	}
+	if dstDB.Exists(dst) && !replace {
+		return Reply.NewIntegerReply(0)
+	}
+	// 先拷贝再覆盖，拷贝失败时目标key保持不变
+	clone, errReply := copyEntity(entity)
+	if errReply != nil {
+		return errReply
+	}
+	dstDB.Remove(dst)
+	dstDB.Put(dst, clone)
+	if expireTime, ok := srcDB.GetExpireTime(src); ok {
+		dstDB.SetExpire(dst, expireTime)
+	}
+	dstDB.signalModifiedKeys(client, []string{dst})
+	srcDB.ToAOF(utils.ToCmd("Copy", args...))
+	return Reply.NewIntegerReply(1)
+}
+
+// 解析copy的选项，返回目标数据库及是否覆盖
+func parseCopyOptions(args _type.Args, dbIdx int, dbNum int) (int, bool, _interface.Reply) {
+	replace := false
+	for i := 0; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "replace":
+			replace = true
+		case "db":
+			if i+1 >= len(args) {
+				return 0, false, Reply.SyntaxError()
+			}
+			idx, errReply := parseDBIndex(args[i+1], dbNum)
+			if errReply != nil {
+				return 0, false, errReply
+			}
+			dbIdx = idx
+			i++
+		default:
+			return 0, false, Reply.SyntaxError()
+		}
+	}
+	return dbIdx, replace, nil
+}
+
+// MOVE key db
+func execMove(server *Server, client _interface.Client, args _type.Args) _interface.Reply {
+	srcIdx := client.GetSelectDB()
+	dstIdx, errReply := parseDBIndex(args[1], server.dataBaseCount())
+	if errReply != nil {
+		return errReply
+	}
+	if srcIdx == dstIdx {
+		return Reply.StandardError("source and destination objects are the same")
+	}
+	key := string(args[0])
+	keys := []string{key}
+	if !client.IsTxState() {
+		locks := server.lockDBs(func(locks *dbKeyLocks) {
+			locks.addPair(server, srcIdx, keys, nil, dstIdx, keys, nil)
+		})
+		defer locks.unlock()
+	}
+	srcDB, dstDB := server.clientDatabase(client, srcIdx), server.getDatabase(dstIdx)
+	entity, ok := srcDB.Get(key)
+	if !ok || dstDB.Exists(key) {
+		return Reply.NewIntegerReply(0) // key不存在，或目标数据库中已存在
+	}
+	expireTime, hasExpire := srcDB.GetExpireTime(key)
+	srcDB.Remove(key)
+	dstDB.Put(key, entity)
+	if hasExpire {
+		dstDB.SetExpire(key, expireTime)
+	}
+	srcDB.signalModifiedKeys(client, keys)
+	dstDB.signalModifiedKeys(client, keys)
+	srcDB.ToAOF(utils.ToCmd("Move", args...))
+	return Reply.NewIntegerReply(1)
+}
+
+// SWAPDB index1 index2 交换server.databases中两个holder保存的数据库，连接到这两个数据库的client立即看到另一个数据库的数据
+func execSwapDB(server *Server, client _interface.Client, args _type.Args) _interface.Reply {
+	idx1, err := strconv.Atoi(string(args[0]))
+	if err != nil {
+		return Reply.StandardError("invalid first DB index")
+	}
+	idx2, err := strconv.Atoi(string(args[1]))
+	if err != nil {
+		return Reply.StandardError("invalid second DB index")
+	}
+	dbNum := server.dataBaseCount()
+	if idx1 < 0 || idx1 >= dbNum || idx2 < 0 || idx2 >= dbNum {
+		return Reply.StandardError("DB index is out of range")
+	}
+	if idx1 > idx2 {
+		idx1, idx2 = idx2, idx1
+	}
+	if idx1 != idx2 {
+		// 为两个数据库加锁，等待正在执行的命令结束，事务中已由exec加锁
+		if !client.IsTxState() {
+			locks := server.lockDBs(func(locks *dbKeyLocks) {
+				locks.add(server, idx1, true, nil, nil)
+				locks.add(server, idx2, true, nil, nil)
+			})
+			defer locks.unlock()
+		}
+		db1, db2 := server.getDatabase(idx1), server.getDatabase(idx2)
+		server.databases[idx1].Store(db2)
+		server.databases[idx2].Store(db1)
+		db1.setIndex(idx2)
+		db2.setIndex(idx1)
+		// 被watch的key在任一数据库中存在，交换后其值都可能改变
+		exists := func(key string) bool {
+			return db1.Exists(key) || db2.Exists(key)
+		}
+		server.watcher.TouchAll(idx1, exists)
+		server.watcher.TouchAll(idx2, exists)
+		server.tracking.InvalidateAll()
+	}
+	server.clientDatabase(client, client.GetSelectDB()).ToAOF(utils.ToCmd("SwapDB", args...))
+	return Reply.NewOkReply()
+}
+
+// 解析数据库编号
+func parseDBIndex(arg []byte, dbNum int) (int, _interface.Reply) {
+	idx, err := strconv.Atoi(string(arg))
+	if err != nil {
+		return 0, Reply.StandardError("value is not an integer or out of range")
+	}
+	if idx < 0 || idx >= dbNum {
+		return 0, Reply.StandardError("DB index is out of range")
+	}
+	return idx, nil
+}
+
+// targetDBKey 返回move及带有DB选项的copy在目标数据库中写入的key，用于exec加锁
+func targetDBKey(name string, cmdLine _type.CmdLine, dbNum int) (int, string, bool) {
+	switch name {
+	case "move":
+		if len(cmdLine) != 3 {
+			return 0, "", false
+		}
+		idx, errReply := parseDBIndex(cmdLine[2], dbNum)
+		return idx, string(cmdLine[1]), errReply == nil
+	case "copy":
+		if len(cmdLine) < 3 {
+			return 0, "", false
+		}
+		idx, _, errReply := parseCopyOptions(_type.Args(cmdLine[3:]), -1, dbNum)
+		return idx, string(cmdLine[2]), errReply == nil && idx >= 0
+	}
+	return 0, "", false
+}
+
+// lockDBs 按build给出的数据库及key加锁，加锁期间数据库被swapdb交换时重新获取数据库并加锁
+func (server *Server) lockDBs(build func(locks *dbKeyLocks)) *dbKeyLocks {
+	for {
+		locks := &dbKeyLocks{}
+		build(locks)
+		if locks.lock() {
+			return locks
+		}
+	}
+}
+
+// addPair 添加两个数据库中需要加锁的key，同一数据库时合并
+func (locks *dbKeyLocks) addPair(server *Server, idx1 int, writeKeys1 []string, readKeys1 []string,
+	idx2 int, writeKeys2 []string, readKeys2 []string) {
+	if idx1 == idx2 {
+		writeKeys := append(append([]string{}, writeKeys1...), writeKeys2...)
+		readKeys := append(append([]string{}, readKeys1...), readKeys2...)
+		locks.add(server, idx1, false, writeKeys, readKeys)
+		return
+	}
+	locks.add(server, idx1, false, writeKeys1, readKeys1)
+	locks.add(server, idx2, false, writeKeys2, readKeys2)
+}
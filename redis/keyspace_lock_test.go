@@ -0,0 +1,72 @@
+package redis
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newLockTestServer(dbNum int) *Server {
+	server := &Server{databases: make([]*atomic.Value, dbNum)}
+	for i := range server.databases {
+		holder := &atomic.Value{}
+		holder.Store(NewDatabase(i))
+		server.databases[i] = holder
+	}
+	return server
+}
+
+// 交换数据库前后构造的加锁列表按编号排序时顺序相反，应按数据库的唯一标识加锁
+func TestDBKeyLocks_OrderAcrossSwapDB(t *testing.T) {
+	server := newLockTestServer(2)
+	keys := []string{"k"}
+	before := &dbKeyLocks{}
+	before.add(server, 0, false, keys, nil)
+	before.add(server, 1, false, keys, nil)
+	db0, db1 := server.getDatabase(0), server.getDatabase(1)
+	server.databases[0].Store(db1)
+	server.databases[1].Store(db0)
+	after := &dbKeyLocks{}
+	after.add(server, 0, false, keys, nil)
+	after.add(server, 1, false, keys, nil)
+	// 编号不再匹配时lock返回false，这里只关心加锁本身不会死锁
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, locks := range []*dbKeyLocks{before, after} {
+		wg.Add(1)
+		go func(locks *dbKeyLocks) {
+			defer wg.Done()
+			for i := 0; i < 200000; i++ {
+				if locks.lock() {
+					locks.unlock()
+				}
+			}
+		}(locks)
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("deadlock between locks built before and after swapdb")
+	}
+}
+
+// 获取两个编号的数据库之间发生了swapdb，同一数据库出现两次时不加锁
+func TestDBKeyLocks_SameDatabaseTwice(t *testing.T) {
+	server := newLockTestServer(2)
+	locks := &dbKeyLocks{}
+	locks.add(server, 0, true, nil, nil)
+	server.databases[1].Store(server.getDatabase(0))
+	locks.add(server, 1, true, nil, nil)
+	if locks.lock() {
+		t.Fatal("lock should fail when the same database appears twice")
+	}
+	// 数据库未被加锁
+	db := server.getDatabase(0)
+	db.lockAll()
+	db.unLockAll()
+}
@@ -0,0 +1,116 @@
+package redis_test
+
+import (
+	"testing"
+	"time"
+)
+
+// copy深拷贝各类型的值，拷贝与原值相同，修改拷贝不影响原值
+func TestCopy_DeepCopy(t *testing.T) {
+	tests := []struct {
+		name   string
+		setup  []string // 创建src
+		modify []string // 修改拷贝dst
+		read   string   // 读取key的命令
+		args   []string // 读取命令在key之后的参数
+		want   string   // src的值
+	}{
+		{"string", []string{"set", "src", "abc"}, []string{"setrange", "dst", "0", "x"}, "get", nil, "$3\r\nabc\r\n"},
+		{"list", []string{"rpush", "src", "a", "b"}, []string{"lset", "dst", "0", "x"}, "lrange", []string{"0", "-1"}, "*2\r\n$1\r\na\r\n$1\r\nb\r\n"},
+		{"set", []string{"sadd", "src", "a"}, []string{"sadd", "dst", "b"}, "scard", nil, ":1\r\n"},
+		{"zset", []string{"zadd", "src", "1", "a"}, []string{"zadd", "dst", "2", "a"}, "zscore", []string{"a"}, "$1\r\n1\r\n"},
+		{"hash", []string{"hset", "src", "f", "v"}, []string{"hset", "dst", "f", "x"}, "hget", []string{"f"}, "$1\r\nv\r\n"},
+	}
+	c := newTestClient(t, newTestServer(t))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c.t = t
+			read := func(key string) []string {
+				return append([]string{tt.read, key}, tt.args...)
+			}
+			c.expect("+OK\r\n", "flushdb")
+			c.do(tt.setup...)
+			c.expect(":1\r\n", "copy", "src", "dst")
+			c.expect(tt.want, read("dst")...)
+			c.do(tt.modify...)
+			c.expect(tt.want, read("src")...)
+			if got := c.do(read("dst")...); got == tt.want {
+				t.Fatalf("copy was not modified: %q", got)
+			}
+		})
+	}
+}
+
+// copy到其他数据库时保留过期时间，目标存在时只有指定REPLACE才覆盖
+func TestCopy_DBAndReplace(t *testing.T) {
+	c := newTestClient(t, newTestServer(t))
+	c.expect("+OK\r\n", "set", "src", "1", "px", "100000")
+	c.expect("+OK\r\n", "set", "dst", "2")
+	c.expect(":0\r\n", "copy", "src", "dst")
+	c.expect(":1\r\n", "copy", "src", "dst", "replace")
+	c.expect("$1\r\n1\r\n", "get", "dst")
+	c.expect(":1\r\n", "copy", "src", "dst", "db", "1")
+	c.expect("+OK\r\n", "select", "1")
+	c.expect("$1\r\n1\r\n", "get", "dst")
+	if ttl := c.do("pttl", "dst"); ttl == ":-1\r\n" || ttl == ":-2\r\n" {
+		t.Fatalf("copied key lost its ttl: %q", ttl)
+	}
+}
+
+// move将key连同过期时间移动到目标数据库，目标数据库中已存在时不移动
+func TestMove_KeepsTTL(t *testing.T) {
+	c := newTestClient(t, newTestServer(t))
+	c.expect("+OK\r\n", "set", "k", "v", "px", "100000")
+	c.expect("+OK\r\n", "set", "plain", "v")
+	c.expect(":1\r\n", "move", "k", "1")
+	c.expect(":0\r\n", "exists", "k")
+	c.expect("+OK\r\n", "select", "1")
+	c.expect("$1\r\nv\r\n", "get", "k")
+	if ttl := c.do("pttl", "k"); ttl == ":-1\r\n" || ttl == ":-2\r\n" {
+		t.Fatalf("moved key lost its ttl: %q", ttl)
+	}
+	c.expect("+OK\r\n", "set", "plain", "other")
+	c.expect("+OK\r\n", "select", "0")
+	c.expect(":0\r\n", "move", "plain", "1")
+	c.expect("$1\r\nv\r\n", "get", "plain")
+	c.expect(":1\r\n", "move", "plain", "2")
+	c.expect("+OK\r\n", "select", "2")
+	c.expect(":-1\r\n", "pttl", "plain")
+}
+
+// swapdb后，已选择这两个数据库的client立即看到交换后的数据
+func TestSwapDB_ConnectedClients(t *testing.T) {
+	server := newTestServer(t)
+	c0, c1 := newTestClient(t, server), newTestClient(t, server)
+	c0.expect("+OK\r\n", "set", "k", "db0")
+	c1.expect("+OK\r\n", "select", "1")
+	c1.expect("+OK\r\n", "set", "k", "db1")
+	c1.expect("+OK\r\n", "set", "only1", "1")
+	c0.expect("+OK\r\n", "swapdb", "0", "1")
+	c0.expect("$3\r\ndb1\r\n", "get", "k")
+	c0.expect(":1\r\n", "exists", "only1")
+	c1.expect("$3\r\ndb0\r\n", "get", "k")
+	c1.expect(":0\r\n", "exists", "only1")
+	// 交换后的写入作用于client当前选择的数据库
+	c1.expect("+OK\r\n", "set", "after", "1")
+	c0.expect(":0\r\n", "exists", "after")
+	c0.expect("+OK\r\n", "swapdb", "1", "0")
+	c0.expect(":1\r\n", "exists", "after")
+	c0.expect("$3\r\ndb0\r\n", "get", "k")
+}
+
+// object idletime/freq反映访问信息，object本身不算作访问
+func TestObject_IdleTimeAndFreq(t *testing.T) {
+	c := newTestClient(t, newTestServer(t))
+	c.expect("+OK\r\n", "set", "k", "v")
+	c.expect(":0\r\n", "object", "idletime", "k")
+	c.expect(":5\r\n", "object", "freq", "k") // 新key的初始计数
+	c.expect("$1\r\nv\r\n", "get", "k")
+	c.expect(":6\r\n", "object", "freq", "k") // 计数为初始值时每次访问必定加一
+	time.Sleep(1100 * time.Millisecond)
+	c.expect(":1\r\n", "object", "idletime", "k")
+	c.expect(":6\r\n", "object", "freq", "k")
+	c.expect("$1\r\nv\r\n", "get", "k")
+	c.expect(":0\r\n", "object", "idletime", "k")
+	c.expect("$-1\r\n", "object", "idletime", "missing")
+}
@@ -0,0 +1,404 @@
+package redis
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	_interface "go-redis/interface"
+	_type "go-redis/interface/type"
+	"go-redis/redis/utils"
+	Reply "go-redis/resp/reply"
+	"go-redis/utils/logger"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+// 沙箱中开放的标准库，不包含io、os、package、debug等可访问文件系统或操作系统的库
+var luaLibs = []struct {
+	name string
+	open lua.LGFunction
+}{
+	{lua.BaseLibName, lua.OpenBase},
+	{lua.TabLibName, lua.OpenTable},
+	{lua.StringLibName, lua.OpenString},
+	{lua.MathLibName, lua.OpenMath},
+}
+
+// base库中需要移除的函数
+var luaUnsafeFuncs = []string{"dofile", "loadfile", "print"}
+
+// luaCaller 一次脚本执行的上下文，供redis.call/redis.pcall使用
+type luaCaller struct {
+	server   *Server
+	client   _interface.Client
+	db       *Database
+	keys     map[string]bool // 声明的KEYS，脚本只能访问这些key
+	readOnly bool            // 只读脚本，禁止执行写命令
+	running  *runningScript
+}
+
+// runningScript 正在执行的脚本，用于超时和SCRIPT KILL
+type runningScript struct {
+	cancel  context.CancelFunc
+	dbIdx   int      // 脚本所在的数据库
+	keys    []string // 脚本声明并加锁的KEYS
+	mu      sync.Mutex
+	written bool // 是否已执行过写命令，执行过写命令的脚本不可被终止
+	killed  bool
+	reason  string
+	busy    bool // 执行过写命令且超过了lua-time-limit，访问其KEYS的命令返回BUSY
+}
+
+// 尝试终止脚本，已执行过写命令时返回false
+func (rs *runningScript) kill(reason string) bool {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if rs.written {
+		return false
+	}
+	rs.killed = true
+	rs.reason = reason
+	rs.cancel()
+	return true
+}
+
+// 超时后无法终止的脚本，标记为busy
+func (rs *runningScript) setBusy() {
+	rs.mu.Lock()
+	rs.busy = true
+	rs.mu.Unlock()
+}
+
+// 脚本是否为busy，且其KEYS包含keys中的任意一个
+func (rs *runningScript) busyWith(dbIdx int, keys []string) bool {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if !rs.busy || rs.dbIdx != dbIdx {
+		return false
+	}
+	for _, key := range keys {
+		if containsString(rs.keys, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// 返回脚本被终止的原因
+func (rs *runningScript) killReason() (string, bool) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return rs.reason, rs.killed
+}
+
+// 标记脚本即将执行写命令，脚本已被终止时返回false
+func (rs *runningScript) markWritten() bool {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if rs.killed {
+		return false
+	}
+	rs.written = true
+	return true
+}
+
+// Sha1Hex 计算脚本的sha1摘要
+func Sha1Hex(script string) string {
+	sum := sha1.Sum([]byte(script))
+	return hex.EncodeToString(sum[:])
+}
+
+// compileLua 编译lua代码
+func compileLua(name string, code string) (*lua.FunctionProto, error) {
+	chunk, err := parse.Parse(strings.NewReader(code), name)
+	if err != nil {
+		return nil, err
+	}
+	return lua.Compile(chunk, name)
+}
+
+// newLuaState 创建一个沙箱化的lua虚拟机
+func newLuaState() *lua.LState {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	for _, lib := range luaLibs {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	for _, name := range luaUnsafeFuncs {
+		L.SetGlobal(name, lua.LNil)
+	}
+	return L
+}
+
+// newRedisLib 创建redis库中与数据库无关的部分
+func newRedisLib(L *lua.LState) *lua.LTable {
+	mod := L.NewTable()
+	L.SetFuncs(mod, map[string]lua.LGFunction{
+		"sha1hex":      luaSha1Hex,
+		"error_reply":  luaErrorReply,
+		"status_reply": luaStatusReply,
+		"log":          luaLog,
+	})
+	mod.RawSetString("LOG_DEBUG", lua.LNumber(0))
+	mod.RawSetString("LOG_VERBOSE", lua.LNumber(1))
+	mod.RawSetString("LOG_NOTICE", lua.LNumber(2))
+	mod.RawSetString("LOG_WARNING", lua.LNumber(3))
+	return mod
+}
+
+// 注册全局的redis库
+func (caller *luaCaller) register(L *lua.LState) {
+	mod := newRedisLib(L)
+	L.SetFuncs(mod, map[string]lua.LGFunction{
+		"call":  caller.call,
+		"pcall": caller.pcall,
+	})
+	L.SetGlobal("redis", mod)
+}
+
+// redis.call，命令出错时抛出lua错误
+func (caller *luaCaller) call(L *lua.LState) int {
+	reply := caller.exec(L)
+	if errReply, ok := reply.(_interface.ErrorReply); ok {
+		L.Error(luaErrorTable(L, errReply.Error()), 1)
+		return 0
+	}
+	L.Push(replyToLua(L, reply))
+	return 1
+}
+
+// redis.pcall，命令出错时以{err=...}的形式返回
+func (caller *luaCaller) pcall(L *lua.LState) int {
+	reply := caller.exec(L)
+	L.Push(replyToLua(L, reply))
+	return 1
+}
+
+func (caller *luaCaller) exec(L *lua.LState) _interface.Reply {
+	argNum := L.GetTop()
+	if argNum == 0 {
+		return Reply.StandardError("Please specify at least one argument for this redis lib call")
+	}
+	cmdLine := make(_type.CmdLine, argNum)
+	for i := 1; i <= argNum; i++ {
+		switch arg := L.Get(i).(type) {
+		case lua.LString:
+			cmdLine[i-1] = []byte(arg)
+		case lua.LNumber:
+			cmdLine[i-1] = []byte(luaNumberToString(arg))
+		default:
+			return Reply.StandardError("Lua redis lib command arguments must be strings or integers")
+		}
+	}
+	name := strings.ToLower(string(cmdLine[0]))
+	cmd, ok := CmdRouter[name]
+	if !ok {
+		if _, isSys := SysCmdRouter[name]; isSys {
+			return Reply.StandardError("This Redis command is not allowed from script")
+		}
+		return Reply.StandardError("Unknown Redis command called from script")
+	}
+	if !utils.CheckArgNum(cmd.Arity, cmdLine) {
+		return Reply.ArgNumError(name)
+	}
+	if user := caller.server.acl.CurrentUser(caller.client); user != nil {
+		if errReply := caller.server.acl.Check(caller.client, user, cmdLine, "lua"); errReply != nil {
+			return errReply
+		}
+	}
+	// 脚本执行前只为声明的KEYS加了锁，因此不允许访问未声明的key
+	writeKeys, readKeys := cmd.keysFind.Find(_type.Args(cmdLine[1:]))
+	for _, keys := range [][]string{writeKeys, readKeys} {
+		for _, key := range keys {
+			if !caller.keys[key] {
+				return Reply.StandardError("Script attempted to access key '" + key + "' which was not declared in KEYS")
+			}
+		}
+	}
+	if cmd.Status == ReadWrite {
+		if caller.readOnly {
+			return Reply.StandardError("Write commands are not allowed from read-only scripts")
+		}
+		if !caller.running.markWritten() {
+			return Reply.StandardError("Script killed")
+		}
+	}
+	defer caller.server.monitor.Feed(caller.db.index(), monitorSourceLua, cmdLine)
+	return caller.db.ExecuteWithoutLock(caller.client, cmdLine)
+}
+
+func luaSha1Hex(L *lua.LState) int {
+	L.Push(lua.LString(Sha1Hex(L.CheckString(1))))
+	return 1
+}
+
+func luaErrorReply(L *lua.LState) int {
+	L.Push(luaErrorTable(L, L.CheckString(1)))
+	return 1
+}
+
+func luaStatusReply(L *lua.LState) int {
+	L.Push(luaStatusTable(L, L.CheckString(1)))
+	return 1
+}
+
+func luaLog(L *lua.LState) int {
+	level := L.CheckInt(1)
+	parts := make([]string, 0, L.GetTop()-1)
+	for i := 2; i <= L.GetTop(); i++ {
+		parts = append(parts, L.Get(i).String())
+	}
+	msg := "[lua] " + strings.Join(parts, " ")
+	switch {
+	case level <= 1:
+		logger.Debug(msg)
+	case level == 2:
+		logger.Info(msg)
+	default:
+		logger.Warn(msg)
+	}
+	return 0
+}
+
+func luaErrorTable(L *lua.LState, msg string) *lua.LTable {
+	table := L.NewTable()
+	table.RawSetString("err", lua.LString(msg))
+	return table
+}
+
+func luaNumberToString(num lua.LNumber) string {
+	f := float64(num)
+	if f == math.Trunc(f) && math.Abs(f) < 1<<63 {
+		return strconv.FormatInt(int64(f), 10)
+	}
+	return strconv.FormatFloat(f, 'g', 17, 64)
+}
+
+// replyToLua 将redis的回复转换为lua的值
+func replyToLua(L *lua.LState, reply _interface.Reply) lua.LValue {
+	switch r := reply.(type) {
+	case *Reply.IntegerReply:
+		return lua.LNumber(r.Integer)
+	case *Reply.BulkReply:
+		if r.Bulk == nil {
+			return lua.LFalse
+		}
+		return lua.LString(r.Bulk)
+	case *Reply.NilBulkReply:
+		return lua.LFalse
+	case *Reply.EmptyReply:
+		return lua.LString("")
+	case *Reply.StringReply:
+		return luaStatusTable(L, r.Content)
+	case *Reply.OkReply:
+		return luaStatusTable(L, "OK")
+	case *Reply.PongReply:
+		return luaStatusTable(L, "PONG")
+	case *Reply.ErrorReply:
+		return luaErrorTable(L, r.Error)
+	case *Reply.EmptyArrayReply:
+		return L.NewTable()
+	case *Reply.ArrayReply:
+		table := L.NewTable()
+		for _, bulk := range r.Bulks {
+			if bulk == nil {
+				table.Append(lua.LFalse)
+			} else {
+				table.Append(lua.LString(bulk))
+			}
+		}
+		return table
+	case *Reply.RawArrayReply:
+		return repliesToLua(L, r.Replies)
+	// RESP3类型按RESP2的方式转换
+	case *Reply.MapReply:
+		return repliesToLua(L, r.Pairs)
+	case *Reply.SetReply:
+		return repliesToLua(L, r.Members)
+	case *Reply.PushReply:
+		return repliesToLua(L, r.Replies)
+	case *Reply.NullReply:
+		return lua.LFalse
+	case *Reply.DoubleReply:
+		return lua.LString(Reply.FormatDouble(r.Double))
+	case *Reply.BooleanReply:
+		if r.Bool {
+			return lua.LNumber(1)
+		}
+		return lua.LNumber(0)
+	case *Reply.BigNumberReply:
+		return lua.LString(r.Number)
+	case *Reply.VerbatimReply:
+		return lua.LString(r.Content)
+	case _interface.ErrorReply:
+		return luaErrorTable(L, r.Error())
+	}
+	return luaStatusTable(L, strings.TrimSpace(string(reply.ToBytes())))
+}
+
+func repliesToLua(L *lua.LState, replies []_interface.Reply) *lua.LTable {
+	table := L.NewTable()
+	for _, sub := range replies {
+		table.Append(replyToLua(L, sub))
+	}
+	return table
+}
+
+func luaStatusTable(L *lua.LState, status string) *lua.LTable {
+	table := L.NewTable()
+	table.RawSetString("ok", lua.LString(status))
+	return table
+}
+
+// luaToReply 将lua的返回值转换为redis的回复
+func luaToReply(value lua.LValue) _interface.Reply {
+	switch v := value.(type) {
+	case lua.LNumber:
+		return Reply.NewIntegerReply(int64(v))
+	case lua.LString:
+		return Reply.NewBulkReply([]byte(v))
+	case lua.LBool:
+		if v {
+			return Reply.NewIntegerReply(1)
+		}
+		return Reply.NewNilBulkReply()
+	case *lua.LTable:
+		if errMsg, ok := v.RawGetString("err").(lua.LString); ok {
+			return Reply.StandardError(string(errMsg))
+		}
+		if status, ok := v.RawGetString("ok").(lua.LString); ok {
+			return Reply.NewStringReply(string(status))
+		}
+		// 数组，遇到第一个nil时结束
+		replies := make([]_interface.Reply, 0)
+		for i := 1; ; i++ {
+			item := v.RawGetInt(i)
+			if item == lua.LNil {
+				break
+			}
+			replies = append(replies, luaToReply(item))
+		}
+		return Reply.NewRawArrayReply(replies)
+	}
+	return Reply.NewNilBulkReply()
+}
+
+// 将脚本执行出错时抛出的lua错误转换为redis的回复
+func luaErrorToReply(err error) _interface.Reply {
+	if apiErr, ok := err.(*lua.ApiError); ok {
+		if table, ok := apiErr.Object.(*lua.LTable); ok {
+			if errMsg, ok := table.RawGetString("err").(lua.LString); ok {
+				return Reply.StandardError(string(errMsg))
+			}
+		}
+		return Reply.StandardError(fmt.Sprintf("Error running script: %s", apiErr.Object.String()))
+	}
+	return Reply.StandardError("Error running script: " + err.Error())
+}
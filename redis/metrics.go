@@ -0,0 +1,243 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"go-redis/utils/logger"
+	"math"
+	"net"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// 直方图的桶上限(秒)
+var histogramBuckets = []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1}
+
+// histogram 耗时直方图，各个桶分别计数，输出时再累加
+type histogram struct {
+	buckets [10]int64 // 最后一个桶为+Inf
+	sum     int64     // 微秒
+}
+
+func newHistogram() *histogram {
+	return &histogram{}
+}
+
+func (h *histogram) observe(duration time.Duration) {
+	seconds := duration.Seconds()
+	i := 0
+	for i < len(histogramBuckets) && seconds > histogramBuckets[i] {
+		i++
+	}
+	atomic.AddInt64(&h.buckets[i], 1)
+	atomic.AddInt64(&h.sum, duration.Microseconds())
+}
+
+func (h *histogram) sumMicroseconds() int64 {
+	return atomic.LoadInt64(&h.sum)
+}
+
+/* ---- exposition ---- */
+
+// 由info字段导出的指标，与info使用相同的统计数据
+var infoMetrics = []struct {
+	section string
+	field   string
+	name    string
+	kind    string
+	help    string
+}{
+	{"server", "uptime_in_seconds", "redis_uptime_in_seconds", "gauge", "Number of seconds since the server started."},
+	{"clients", "connected_clients", "redis_connected_clients", "gauge", "Number of client connections."},
+	{"clients", "maxclients", "redis_max_clients", "gauge", "Maximum number of client connections."},
+	{"clients", "tracking_clients", "redis_tracking_clients", "gauge", "Number of clients being tracked."},
+	{"clients", "pubsub_clients", "redis_pubsub_clients", "gauge", "Number of clients in pub/sub mode."},
+	{"memory", "used_memory", "redis_memory_used_bytes", "gauge", "Total number of bytes allocated."},
+	{"memory", "used_memory_rss", "redis_memory_used_rss_bytes", "gauge", "Number of bytes obtained from the OS."},
+	{"memory", "used_memory_peak", "redis_memory_used_peak_bytes", "gauge", "Peak memory consumed."},
+	{"persistence", "aof_enabled", "redis_aof_enabled", "gauge", "Whether AOF is enabled."},
+	{"persistence", "aof_rewrite_in_progress", "redis_aof_rewrite_in_progress", "gauge", "Whether an AOF rewrite is in progress."},
+	{"persistence", "aof_last_rewrite_time_sec", "redis_aof_last_rewrite_duration_seconds", "gauge", "Duration of the last AOF rewrite."},
+	{"persistence", "aof_rewrites", "redis_aof_rewrites_total", "counter", "Number of AOF rewrites."},
+	{"persistence", "aof_current_size", "redis_aof_current_size_bytes", "gauge", "Current size of the AOF file."},
+	{"stats", "total_connections_received", "redis_connections_received_total", "counter", "Total number of connections accepted."},
+	{"stats", "rejected_connections", "redis_rejected_connections_total", "counter", "Number of connections rejected because of maxclients."},
+	{"stats", "total_commands_processed", "redis_commands_processed_total", "counter", "Total number of commands processed."},
+	{"stats", "instantaneous_ops_per_sec", "redis_instantaneous_ops_per_sec", "gauge", "Number of commands processed per second."},
+	{"stats", "expired_keys", "redis_expired_keys_total", "counter", "Total number of key expiration events."},
+	{"stats", "evicted_keys", "redis_evicted_keys_total", "counter", "Number of evicted keys due to maxmemory limit."},
+	{"stats", "keyspace_hits", "redis_keyspace_hits_total", "counter", "Number of successful lookups of keys."},
+	{"stats", "keyspace_misses", "redis_keyspace_misses_total", "counter", "Number of failed lookups of keys."},
+	{"stats", "client_output_buffer_limit_disconnections", "redis_client_output_buffer_limit_disconnections_total", "counter", "Number of clients disconnected because of output buffer limits."},
+	{"stats", "pubsub_channels", "redis_pubsub_channels", "gauge", "Number of pub/sub channels with subscribers."},
+}
+
+// metricsWriter 以Prometheus文本格式或OpenMetrics格式输出指标
+type metricsWriter struct {
+	builder     strings.Builder
+	openMetrics bool
+}
+
+// 输出指标族的HELP与TYPE，OpenMetrics中counter的族名不带_total后缀
+func (w *metricsWriter) family(name string, kind string, help string) {
+	if w.openMetrics && kind == "counter" {
+		name = strings.TrimSuffix(name, "_total")
+	}
+	w.builder.WriteString("# HELP " + name + " " + help + "\n")
+	w.builder.WriteString("# TYPE " + name + " " + kind + "\n")
+}
+
+func (w *metricsWriter) sample(name string, labels string, value string) {
+	w.builder.WriteString(name)
+	if labels != "" {
+		w.builder.WriteString("{" + labels + "}")
+	}
+	w.builder.WriteString(" " + value + "\n")
+}
+
+func (w *metricsWriter) histogram(name string, labels string, h *histogram) {
+	prefix := labels
+	if prefix != "" {
+		prefix += ","
+	}
+	var cumulative int64
+	for i, bound := range histogramBuckets {
+		cumulative += atomic.LoadInt64(&h.buckets[i])
+		w.sample(name+"_bucket", prefix+`le="`+formatFloat(bound)+`"`, strconv.FormatInt(cumulative, 10))
+	}
+	cumulative += atomic.LoadInt64(&h.buckets[len(histogramBuckets)])
+	w.sample(name+"_bucket", prefix+`le="+Inf"`, strconv.FormatInt(cumulative, 10))
+	w.sample(name+"_sum", labels, formatFloat(float64(atomic.LoadInt64(&h.sum))/1e6))
+	w.sample(name+"_count", labels, strconv.FormatInt(cumulative, 10))
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// 转义label的值
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// generateMetrics 生成所有指标
+func (server *Server) generateMetrics(openMetrics bool) string {
+	w := &metricsWriter{openMetrics: openMetrics}
+	// info中的字段
+	sections := make(map[string]map[string]string)
+	for _, section := range infoSections {
+		fields := make(map[string]string)
+		for _, field := range section.generateFn(server) {
+			fields[field[0]] = field[1]
+		}
+		sections[section.name] = fields
+	}
+	for _, metric := range infoMetrics {
+		value, ok := sections[metric.section][metric.field]
+		if !ok {
+			continue
+		}
+		w.family(metric.name, metric.kind, metric.help)
+		w.sample(metric.name, "", value)
+	}
+	// keyspace
+	w.family("redis_db_keys", "gauge", "Number of keys in each database.")
+	for i := range server.databases {
+		keys, _ := server.getDatabase(i).Size()
+		w.sample("redis_db_keys", `db="db`+strconv.Itoa(i)+`"`, strconv.Itoa(keys))
+	}
+	w.family("redis_db_keys_expiring", "gauge", "Number of keys with an expiration in each database.")
+	for i := range server.databases {
+		_, expires := server.getDatabase(i).Size()
+		w.sample("redis_db_keys_expiring", `db="db`+strconv.Itoa(i)+`"`, strconv.Itoa(expires))
+	}
+	// 命令统计
+	names, commandStats := server.stats.commandStats()
+	w.family("redis_commands_total", "counter", "Number of calls of each command.")
+	for i, name := range names {
+		w.sample("redis_commands_total", `cmd="`+escapeLabel(name)+`"`, strconv.FormatInt(atomic.LoadInt64(&commandStats[i].calls), 10))
+	}
+	w.family("redis_commands_failed_total", "counter", "Number of failed calls of each command.")
+	for i, name := range names {
+		w.sample("redis_commands_failed_total", `cmd="`+escapeLabel(name)+`"`, strconv.FormatInt(atomic.LoadInt64(&commandStats[i].failedCalls), 10))
+	}
+	w.family("redis_command_duration_seconds", "histogram", "Command execution latency.")
+	for i, name := range names {
+		w.histogram("redis_command_duration_seconds", `cmd="`+escapeLabel(name)+`"`, commandStats[i].latency)
+	}
+	// aof fsync
+	if server.persister != nil {
+		w.family("redis_aof_fsync_duration_seconds", "histogram", "AOF fsync latency.")
+		w.histogram("redis_aof_fsync_duration_seconds", "", server.persister.fsyncLatency)
+	}
+	// go runtime
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	w.family("go_goroutines", "gauge", "Number of goroutines that currently exist.")
+	w.sample("go_goroutines", "", strconv.Itoa(runtime.NumGoroutine()))
+	w.family("go_info", "gauge", "Information about the Go environment.")
+	w.sample("go_info", `version="`+runtime.Version()+`"`, "1")
+	w.family("go_memstats_heap_alloc_bytes", "gauge", "Number of heap bytes allocated and still in use.")
+	w.sample("go_memstats_heap_alloc_bytes", "", strconv.FormatUint(mem.HeapAlloc, 10))
+	w.family("go_memstats_heap_objects", "gauge", "Number of allocated objects.")
+	w.sample("go_memstats_heap_objects", "", strconv.FormatUint(mem.HeapObjects, 10))
+	w.family("go_memstats_sys_bytes", "gauge", "Number of bytes obtained from system.")
+	w.sample("go_memstats_sys_bytes", "", strconv.FormatUint(mem.Sys, 10))
+	w.family("go_gc_cycles_total", "counter", "Number of completed GC cycles.")
+	w.sample("go_gc_cycles_total", "", strconv.FormatUint(uint64(mem.NumGC), 10))
+	w.family("go_gc_pause_seconds_total", "counter", "Total GC pause time.")
+	w.sample("go_gc_pause_seconds_total", "", formatFloat(float64(mem.PauseTotalNs)/1e9))
+	if openMetrics {
+		w.builder.WriteString("# EOF\n")
+	}
+	return w.builder.String()
+}
+
+// 根据Accept头选择OpenMetrics或Prometheus文本格式
+func (server *Server) serveMetrics(writer http.ResponseWriter, request *http.Request) {
+	openMetrics := strings.Contains(request.Header.Get("Accept"), "application/openmetrics-text")
+	if openMetrics {
+		writer.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+	} else {
+		writer.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	}
+	_, _ = writer.Write([]byte(server.generateMetrics(openMetrics)))
+}
+
+// 开启metrics服务，metrics-port不大于0时不开启
+func (server *Server) startMetrics() {
+	if Config.MetricsPort <= 0 {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", server.serveMetrics)
+	address := net.JoinHostPort(Config.Bind, strconv.Itoa(Config.MetricsPort))
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		logger.Error("metrics listen failed: " + err.Error())
+		return
+	}
+	server.metrics = &http.Server{Handler: mux}
+	logger.Info(fmt.Sprintf("metrics served on http://%s/metrics", address))
+	go func() {
+		if err := server.metrics.Serve(listener); err != nil && err != http.ErrServerClosed {
+			logger.Error("metrics server error: " + err.Error())
+		}
+	}()
+}
+
+func (server *Server) stopMetrics() {
+	if server.metrics == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_ = server.metrics.Shutdown(ctx)
+}
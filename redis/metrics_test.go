@@ -0,0 +1,118 @@
+package redis_test
+
+import (
+	"go-redis/redis"
+	"io"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// scrape 请求/metrics，返回Content-Type与内容
+func scrape(t *testing.T, server *redis.Server, accept string) (string, string) {
+	t.Helper()
+	request := httptest.NewRequest("GET", "/metrics", nil)
+	if accept != "" {
+		request.Header.Set("Accept", accept)
+	}
+	recorder := httptest.NewRecorder()
+	redis.MetricsHandler(server)(recorder, request)
+	body, _ := io.ReadAll(recorder.Result().Body)
+	return recorder.Result().Header.Get("Content-Type"), string(body)
+}
+
+// metricValue 返回指定指标(含label)的值
+func metricValue(t *testing.T, body string, metric string) string {
+	t.Helper()
+	match := regexp.MustCompile(`(?m)^` + regexp.QuoteMeta(metric) + ` (\S+)$`).FindStringSubmatch(body)
+	if match == nil {
+		t.Fatalf("metric %s not found", metric)
+	}
+	return match[1]
+}
+
+var sampleLine = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*(\{[a-zA-Z_][a-zA-Z0-9_]*="(\\.|[^"\\])*"(,[a-zA-Z_][a-zA-Z0-9_]*="(\\.|[^"\\])*")*\})? \S+$`)
+
+// Prometheus文本格式：每个指标族先输出HELP与TYPE，之后为样本
+func TestMetrics_TextFormat(t *testing.T) {
+	server := newTestServer(t)
+	contentType, body := scrape(t, server, "")
+	if contentType != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Fatalf("content type: got %q", contentType)
+	}
+	if !strings.Contains(body, "# HELP redis_commands_processed_total Total number of commands processed.\n"+
+		"# TYPE redis_commands_processed_total counter\nredis_commands_processed_total ") {
+		t.Fatalf("missing redis_commands_processed_total family:\n%s", body)
+	}
+	if strings.Contains(body, "# EOF") {
+		t.Fatal("text format must not end with # EOF")
+	}
+	typed := make(map[string]bool)
+	for _, line := range strings.Split(strings.TrimSuffix(body, "\n"), "\n") {
+		if strings.HasPrefix(line, "# TYPE ") {
+			typed[strings.Fields(line)[2]] = true
+			continue
+		}
+		if strings.HasPrefix(line, "# HELP ") {
+			continue
+		}
+		if !sampleLine.MatchString(line) {
+			t.Fatalf("malformed sample line %q", line)
+		}
+		name := line[:strings.IndexAny(line, "{ ")]
+		family := regexp.MustCompile(`_(bucket|sum|count)$`).ReplaceAllString(name, "")
+		if !typed[name] && !typed[family] {
+			t.Fatalf("sample %q has no TYPE", line)
+		}
+	}
+}
+
+// OpenMetrics格式：counter的族名不带_total，以# EOF结尾
+func TestMetrics_OpenMetricsFormat(t *testing.T) {
+	server := newTestServer(t)
+	contentType, body := scrape(t, server, "application/openmetrics-text; version=1.0.0")
+	if contentType != "application/openmetrics-text; version=1.0.0; charset=utf-8" {
+		t.Fatalf("content type: got %q", contentType)
+	}
+	if !strings.Contains(body, "# TYPE redis_commands_processed counter\nredis_commands_processed_total ") {
+		t.Fatalf("counter family should drop _total:\n%s", body)
+	}
+	if !strings.HasSuffix(body, "# EOF\n") {
+		t.Fatal("openmetrics output must end with # EOF")
+	}
+}
+
+// 执行命令后计数器随之变化
+func TestMetrics_CountersMove(t *testing.T) {
+	server := newTestServer(t)
+	c := newTestClient(t, server)
+	if _, before := scrape(t, server, ""); metricValue(t, before, "redis_commands_processed_total") != "0" {
+		t.Fatal("redis_commands_processed_total should start at 0")
+	}
+	c.expect("+OK\r\n", "set", "a", "1")
+	c.expect("+OK\r\n", "set", "b", "x")
+	c.expect(":2\r\n", "incr", "a")
+	c.expect("-ERR: value is not an integer or out of range\r\n", "incr", "b")
+	_, after := scrape(t, server, "")
+	tests := []struct {
+		metric string
+		want   string
+	}{
+		{`redis_commands_processed_total`, "4"},
+		{`redis_commands_total{cmd="set"}`, "2"},
+		{`redis_commands_total{cmd="incr"}`, "2"},
+		{`redis_commands_failed_total{cmd="set"}`, "0"},
+		{`redis_commands_failed_total{cmd="incr"}`, "1"},
+		{`redis_command_duration_seconds_count{cmd="set"}`, "2"},
+		{`redis_command_duration_seconds_bucket{cmd="set",le="+Inf"}`, "2"},
+		{`redis_db_keys{db="db0"}`, "2"},
+		{`redis_db_keys{db="db1"}`, "0"},
+		{`redis_connected_clients`, "1"},
+	}
+	for _, tt := range tests {
+		if got := metricValue(t, after, tt.metric); got != tt.want {
+			t.Fatalf("%s: got %s, want %s", tt.metric, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package redis
+
+import (
+	"fmt"
+	_interface "go-redis/interface"
+	_type "go-redis/interface/type"
+	Reply "go-redis/resp/reply"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 命令来源，非client发出的命令在monitor中以来源代替地址
+const (
+	monitorSourceLua = "lua"
+	monitorSourceAof = "aof"
+)
+
+// Monitor 执行了monitor命令的client，每条被执行的命令都会发送给它们
+type Monitor struct {
+	clients map[_interface.Client]struct{}
+	count   int32 // client个数，为0时跳过格式化，避免额外开销
+	lock    sync.RWMutex
+}
+
+func NewMonitor() *Monitor {
+	return &Monitor{
+		clients: make(map[_interface.Client]struct{}),
+	}
+}
+
+func (monitor *Monitor) Add(client _interface.Client) {
+	monitor.lock.Lock()
+	defer monitor.lock.Unlock()
+	monitor.clients[client] = struct{}{}
+	atomic.StoreInt32(&monitor.count, int32(len(monitor.clients)))
+}
+
+func (monitor *Monitor) Remove(client _interface.Client) {
+	monitor.lock.Lock()
+	defer monitor.lock.Unlock()
+	delete(monitor.clients, client)
+	atomic.StoreInt32(&monitor.count, int32(len(monitor.clients)))
+}
+
+func (monitor *Monitor) IsMonitor(client _interface.Client) bool {
+	if atomic.LoadInt32(&monitor.count) == 0 {
+		return false
+	}
+	monitor.lock.RLock()
+	defer monitor.lock.RUnlock()
+	_, ok := monitor.clients[client]
+	return ok
+}
+
+// Feed 将命令发送给所有monitor，格式为: +<ts> [db addr] "cmd" "arg"...
+func (monitor *Monitor) Feed(dbIdx int, source string, cmdLine _type.CmdLine) {
+	if atomic.LoadInt32(&monitor.count) == 0 {
+		return
+	}
+	// 未知命令以及管理类命令不发送
+	name := strings.ToLower(string(cmdLine[0]))
+	categories, ok := CommandCategories(name)
+	if !ok || containsString(categories, CatAdmin) {
+		return
+	}
+	now := time.Now()
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("+%d.%06d [%d %s]", now.Unix(), now.Nanosecond()/1000, dbIdx, source))
+	for i, arg := range redactArgs(name, cmdLine) {
+		builder.WriteByte(' ')
+		if i > 0 && arg == nil {
+			builder.WriteString(`"(redacted)"`)
+			continue
+		}
+		builder.WriteString(quoteArg(arg))
+	}
+	builder.WriteString("\r\n")
+	data := []byte(builder.String())
+	monitor.lock.RLock()
+	defer monitor.lock.RUnlock()
+	for client := range monitor.clients {
+		_, _ = client.Write(data)
+	}
+}
+
+// 隐藏命令中的密码，被隐藏的参数置为nil
+func redactArgs(name string, cmdLine _type.CmdLine) _type.CmdLine {
+	switch name {
+	case "auth":
+		redacted := make(_type.CmdLine, len(cmdLine))
+		redacted[0] = cmdLine[0]
+		return redacted
+	case "hello":
+		redacted := make(_type.CmdLine, len(cmdLine))
+		copy(redacted, cmdLine)
+		for i := 2; i < len(cmdLine); i++ {
+			if strings.ToLower(string(cmdLine[i])) == "auth" {
+				for j := i + 1; j < len(cmdLine) && j <= i+2; j++ {
+					redacted[j] = nil
+				}
+				break
+			}
+		}
+		return redacted
+	}
+	return cmdLine
+}
+
+// 为参数加上引号，并转义其中的特殊字符和不可打印字符
+func quoteArg(arg []byte) string {
+	var builder strings.Builder
+	builder.WriteByte('"')
+	for _, b := range arg {
+		switch b {
+		case '\\', '"':
+			builder.WriteByte('\\')
+			builder.WriteByte(b)
+		case '\n':
+			builder.WriteString(`\n`)
+		case '\r':
+			builder.WriteString(`\r`)
+		case '\t':
+			builder.WriteString(`\t`)
+		case '\a':
+			builder.WriteString(`\a`)
+		case '\b':
+			builder.WriteString(`\b`)
+		default:
+			if b < 0x20 || b >= 0x7f {
+				builder.WriteString(`\x` + strconv.FormatUint(uint64(b)>>4, 16) + strconv.FormatUint(uint64(b)&0xf, 16))
+			} else {
+				builder.WriteByte(b)
+			}
+		}
+	}
+	builder.WriteByte('"')
+	return builder.String()
+}
+
+func execMonitor(server *Server, client _interface.Client, args _type.Args) _interface.Reply {
+	server.monitor.Add(client)
+	return Reply.NewOkReply()
+}
@@ -0,0 +1,47 @@
+package redis_test
+
+import (
+	"regexp"
+	"testing"
+)
+
+// monitor收到的每行包含时间戳、db编号、client地址及加引号的参数，AUTH、HELLO中的密码被隐藏
+func TestMonitor_Format(t *testing.T) {
+	restoreConfig(t, "requirepass")
+	server := newTestServer(t)
+	m, c := newPushClient(t, server), newTestClient(t, server)
+	c.expect("+OK\r\n", "config", "set", "requirepass", "secret")
+	c.expect("+OK\r\n", "auth", "secret")
+	m.expect("+OK\r\n", "auth", "secret")
+	m.expect("+OK\r\n", "monitor")
+	c.expect("+OK\r\n", "set", "k", "v")
+	c.expect("+OK\r\n", "select", "2")
+	c.expect("+OK\r\n", "set", "a b", "x\"\ny\x01")
+	c.expect("+OK\r\n", "auth", "secret")
+	c.do("hello", "2", "auth", "default", "secret", "setname", "foo")
+	// 管理类命令不发送
+	c.expect("+OK\r\n", "config", "set", "requirepass", "")
+	c.expect("+PONG\r\n", "ping")
+	m.waitPushed(`"ping"`)
+
+	m.lock.Lock()
+	pushed := m.pushed.String()
+	m.lock.Unlock()
+	lines := regexp.MustCompile(`(?m)^\+\d+\.\d{6} \[(\d+) (\S+)\] (.*)\r$`).FindAllStringSubmatch(pushed, -1)
+	want := [][3]string{
+		{"0", "pipe", `"set" "k" "v"`},
+		{"0", "pipe", `"select" "2"`},
+		{"2", "pipe", `"set" "a b" "x\"\ny\x01"`},
+		{"2", "pipe", `"auth" "(redacted)"`},
+		{"2", "pipe", `"hello" "2" "auth" "(redacted)" "(redacted)" "setname" "foo"`},
+		{"2", "pipe", `"ping"`},
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("monitor output %q: got %d lines, want %d", pushed, len(lines), len(want))
+	}
+	for i, line := range lines {
+		if got := [3]string{line[1], line[2], line[3]}; got != want[i] {
+			t.Fatalf("line %d: got %q, want %q", i, got, want[i])
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package redis_test
+
+import (
+	"strings"
+	"testing"
+)
+
+// HELLO切换协议版本并返回server信息，RESP3下为map，RESP2下为数组
+func TestHello_SwitchProtocol(t *testing.T) {
+	c := newTestClient(t, newTestServer(t))
+	tests := []struct {
+		args   []string
+		prefix string
+		proto  string
+	}{
+		{[]string{"hello"}, "*14\r\n", ":2\r\n"},
+		{[]string{"hello", "3"}, "%7\r\n", ":3\r\n"},
+		{[]string{"hello"}, "%7\r\n", ":3\r\n"},
+		{[]string{"hello", "2"}, "*14\r\n", ":2\r\n"},
+	}
+	for _, tt := range tests {
+		got := c.do(tt.args...)
+		if !strings.HasPrefix(got, tt.prefix+"$6\r\nserver\r\n$5\r\nredis\r\n") {
+			t.Fatalf("%s: got %q, want prefix %q", strings.Join(tt.args, " "), got, tt.prefix)
+		}
+		if !strings.Contains(got, "$5\r\nproto\r\n"+tt.proto) {
+			t.Fatalf("%s: got %q, want proto %q", strings.Join(tt.args, " "), got, tt.proto)
+		}
+	}
+	c.expect("-ERR: NOPROTO unsupported protocol version\r\n", "hello", "4")
+	c.expect("-ERR: Protocol version is not an integer or out of range\r\n", "hello", "x")
+	// 切换失败时协议版本不变
+	if got := c.do("hello"); !strings.HasPrefix(got, "*14\r\n") {
+		t.Fatalf("hello after failed switch: got %q", got)
+	}
+}
+
+// RESP3下HGETALL、CONFIG GET回复map，空值回复_，RESP2下分别为数组和空bulk string
+func TestRESP3_Replies(t *testing.T) {
+	c := newTestClient(t, newTestServer(t))
+	c.expect(":1\r\n", "hset", "h", "f", "v")
+	tests := []struct {
+		args  []string
+		resp2 string
+		resp3 string
+	}{
+		{[]string{"hgetall", "h"}, "*2\r\n$1\r\nf\r\n$1\r\nv\r\n", "%1\r\n$1\r\nf\r\n$1\r\nv\r\n"},
+		{[]string{"config", "get", "maxclients"}, "*2\r\n$10\r\nmaxclients\r\n$3\r\n128\r\n", "%1\r\n$10\r\nmaxclients\r\n$3\r\n128\r\n"},
+		{[]string{"get", "nokey"}, "$-1\r\n", "_\r\n"},
+		{[]string{"hget", "h", "nofield"}, "$-1\r\n", "_\r\n"},
+	}
+	for _, tt := range tests {
+		c.expect(tt.resp2, tt.args...)
+	}
+	c.do("hello", "3")
+	for _, tt := range tests {
+		c.expect(tt.resp3, tt.args...)
+	}
+	c.do("hello", "2")
+	for _, tt := range tests {
+		c.expect(tt.resp2, tt.args...)
+	}
+}
@@ -6,7 +6,6 @@ import (
 	_interface "go-redis/interface"
 	Reply "go-redis/resp/reply"
 	_sync "go-redis/utils/sync"
-	"strconv"
 )
 
 type Pubsub struct {
@@ -41,10 +40,9 @@ func (ps *Pubsub) Subscribe(client _interface.Client, channels []string) _interf
 			continue
 		}
 		subscribers.Add(client)
-		reply := Reply.StringToArrayReply("subscribe", channel)
-		_, _ = client.Write(reply.ToBytes())
+		_, _ = client.WriteReply(pubsubReply("subscribe", channel, client.ChannelsCount()))
 	}
-	return Reply.NewEmptyBulkReply()
+	return Reply.NewNoReply()
 }
 
 func (ps *Pubsub) UnSubscribe(client _interface.Client, channels []string) _interface.Reply {
@@ -53,28 +51,43 @@ func (ps *Pubsub) UnSubscribe(client _interface.Client, channels []string) _inte
 	defer ps.locker.UnLocks(channels...)
 	//
 	if len(channels) == 0 {
-		reply := Reply.StringToArrayReply("unsubscribe", "-1", "0")
-		_, _ = client.Write(reply.ToBytes())
+		reply := Reply.NewPushReply([]_interface.Reply{
+			Reply.StringToBulkReply("unsubscribe"), Reply.NewNilBulkReply(), Reply.NewIntegerReply(0),
+		})
+		_, _ = client.WriteReply(reply)
 	}
 	// unsubscribe
 	for _, channel := range channels {
-		client.UnSubscribe(channel)
-		subscribers, ok := ps.table.Get(channel)
-		// 当前channel不存在
-		if !ok {
-			continue
-		}
-		equalFunc := func(target _interface.Client) bool {
-			return client == target
-		}
-		subscribers.RemoveAll(equalFunc)
-		if subscribers.Len() == 0 {
-			ps.table.Remove(channel) // 无任何订阅者，移除该channel
-		}
-		reply := Reply.StringToArrayReply("unsubscribe", channel, strconv.Itoa(client.ChannelsCount()))
-		_, _ = client.Write(reply.ToBytes())
+		ps.unsubscribe(client, channel)
+		_, _ = client.WriteReply(pubsubReply("unsubscribe", channel, client.ChannelsCount()))
+	}
+	return Reply.NewNoReply()
+}
+
+// RemoveClient 在client关闭时取消其所有订阅，不发送回复
+func (ps *Pubsub) RemoveClient(client _interface.Client) {
+	channels := client.GetChannels()
+	ps.locker.Locks(channels...)
+	defer ps.locker.UnLocks(channels...)
+	for _, channel := range channels {
+		ps.unsubscribe(client, channel)
+	}
+}
+
+func (ps *Pubsub) unsubscribe(client _interface.Client, channel string) {
+	client.UnSubscribe(channel)
+	subscribers, ok := ps.table.Get(channel)
+	// 当前channel不存在
+	if !ok {
+		return
+	}
+	equalFunc := func(target _interface.Client) bool {
+		return client == target
+	}
+	subscribers.RemoveAll(equalFunc)
+	if subscribers.Len() == 0 {
+		ps.table.Remove(channel) // 无任何订阅者，移除该channel
 	}
-	return Reply.NewEmptyBulkReply()
 }
 
 func (ps *Pubsub) Publish(client _interface.Client, channel string, message []byte) _interface.Reply {
@@ -86,10 +99,19 @@ func (ps *Pubsub) Publish(client _interface.Client, channel string, message []by
 		return Reply.NewIntegerReply(0)
 	}
 	respFunc := func(i int, client _interface.Client) bool {
-		reply := Reply.StringToArrayReply("message", channel, string(message))
-		_, _ = client.Write(reply.ToBytes())
+		reply := Reply.NewPushReply([]_interface.Reply{
+			Reply.StringToBulkReply("message"), Reply.StringToBulkReply(channel), Reply.NewBulkReply(message),
+		})
+		_, _ = client.WriteReply(reply)
 		return true
 	}
 	subscribers.ForEach(respFunc)
 	return Reply.NewIntegerReply(int64(subscribers.Len()))
 }
+
+// subscribe/unsubscribe的确认消息，RESP3下以push的形式发送
+func pubsubReply(kind string, channel string, count int) *Reply.PushReply {
+	return Reply.NewPushReply([]_interface.Reply{
+		Reply.StringToBulkReply(kind), Reply.StringToBulkReply(channel), Reply.NewIntegerReply(int64(count)),
+	})
+}
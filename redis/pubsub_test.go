@@ -0,0 +1,43 @@
+package redis_test
+
+import (
+	"bytes"
+	"go-redis/redis"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// client关闭时从所有channel中移除，且不向正在关闭的连接发送unsubscribe回复
+func TestPubsub_CloseClientUnsubscribes(t *testing.T) {
+	server := newTestServer(t)
+	publisher := newTestClient(t, server)
+	for _, channels := range [][]string{{"a", "b"}, nil} {
+		conn, peer := net.Pipe()
+		received := make(chan []byte)
+		go func() {
+			var buf bytes.Buffer
+			_, _ = io.Copy(&buf, peer)
+			received <- buf.Bytes()
+		}()
+		subscriber := redis.NewClient(conn)
+		if err := server.AddClient(subscriber); err != nil {
+			t.Fatal(err)
+		}
+		if len(channels) > 0 {
+			cmdLine := [][]byte{[]byte("subscribe")}
+			for _, channel := range channels {
+				cmdLine = append(cmdLine, []byte(channel))
+			}
+			server.ExecCommand(subscriber, cmdLine)
+			publisher.expect(":1\r\n", "publish", "a", "m")
+		}
+		server.CloseClient(subscriber)
+		if data := <-received; strings.Contains(string(data), "unsubscribe") {
+			t.Fatalf("unsubscribe reply sent to closing client: %q", data)
+		}
+		_ = peer.Close()
+		publisher.expect(":0\r\n", "publish", "a", "m")
+	}
+}
@@ -3,6 +3,7 @@ package redis
 import (
 	_interface "go-redis/interface"
 	_type "go-redis/interface/type"
+	"go-redis/redis/utils"
 	"strings"
 )
 
@@ -11,29 +12,136 @@ const (
 	ReadOnly  = 1
 )
 
+// ACL分类，read和write由命令的Status自动得出，fast和slow由文档中的时间复杂度得出
+const (
+	CatKeyspace    = "keyspace"
+	CatRead        = "read"
+	CatWrite       = "write"
+	CatString      = "string"
+	CatBitmap      = "bitmap"
+	CatList        = "list"
+	CatHash        = "hash"
+	CatSet         = "set"
+	CatSortedSet   = "sortedset"
+	CatPubsub      = "pubsub"
+	CatAdmin       = "admin"
+	CatFast        = "fast"
+	CatSlow        = "slow"
+	CatDangerous   = "dangerous"
+	CatConnection  = "connection"
+	CatTransaction = "transaction"
+	CatScripting   = "scripting"
+)
+
+// Categories 所有的ACL分类
+var Categories = []string{
+	CatKeyspace, CatRead, CatWrite, CatString, CatBitmap, CatList, CatHash, CatSet, CatSortedSet,
+	CatPubsub, CatAdmin, CatFast, CatSlow, CatDangerous, CatConnection, CatTransaction, CatScripting,
+}
+
+// 命令的flag，大部分由Status和ACL分类自动得出，其余通过SetFlags指定
+const (
+	FlagWrite       = "write"
+	FlagReadOnly    = "readonly"
+	FlagAdmin       = "admin"
+	FlagPubsub      = "pubsub"
+	FlagNoScript    = "noscript"
+	FlagFast        = "fast"
+	FlagMovableKeys = "movablekeys"
+	FlagNoAuth      = "no_auth"
+	FlagNoMulti     = "no_multi"
+	FlagLoading     = "loading"
+	FlagStale       = "stale"
+)
+
+// commandMeta 命令的元信息，用于command命令
+type commandMeta struct {
+	Name       string
+	Arity      int      // 大于等于零时表示参数个数，小于零时表示参数个数的最小值
+	Categories []string // 所属的ACL分类
+	Flags      []string
+	Doc        CommandDoc
+	keysFind   utils.KeysFind
+
+	subcommands map[string]*commandMeta // 有单独ACL分类的子命令
+}
+
+func newCommandMeta(name string, arity int, keysFind utils.KeysFind, categories []string) commandMeta {
+	doc := commandDocs[name]
+	if doc.isFast() && !containsString(categories, CatAdmin) && !containsString(categories, CatDangerous) {
+		categories = append(categories, CatFast)
+	} else {
+		categories = append(categories, CatSlow)
+	}
+	return commandMeta{
+		Name:       name,
+		Arity:      arity,
+		Categories: categories,
+		Doc:        doc,
+		keysFind:   keysFind,
+	}
+}
+
+// 由ACL分类等得出的flag
+func (meta *commandMeta) flags() []string {
+	flags := make([]string, 0)
+	if containsString(meta.Categories, CatWrite) {
+		flags = append(flags, FlagWrite)
+	} else if containsString(meta.Categories, CatRead) {
+		flags = append(flags, FlagReadOnly)
+	}
+	if containsString(meta.Categories, CatAdmin) {
+		flags = append(flags, FlagAdmin)
+	}
+	if containsString(meta.Categories, CatPubsub) {
+		flags = append(flags, FlagPubsub)
+	}
+	if containsString(meta.Categories, CatFast) {
+		flags = append(flags, FlagFast)
+	}
+	if meta.keysFind.Movable {
+		flags = append(flags, FlagMovableKeys)
+	}
+	for _, flag := range meta.Flags {
+		if !containsString(flags, flag) {
+			flags = append(flags, flag)
+		}
+	}
+	return flags
+}
+
 /* ---- database command ---- */
 
 type Executor func(db *Database, args _type.Args) _interface.Reply
 
-type keysFind func(args _type.Args) ([]string, []string)
-
 type command struct {
+	commandMeta
 	Executor Executor
-	keysFind keysFind
-	Arity    int // 大于等于零时表示参数个数，小于零时表示参数个数的最小值
 	Status   int // 当前命令是读命令还是写命令
 }
 
 var CmdRouter = make(map[string]*command)
 
-func RegisterCommand(name string, executor Executor, keysFind keysFind, arity int, status int) {
+func RegisterCommand(name string, executor Executor, keysFind utils.KeysFind, arity int, status int, categories ...string) *command {
 	name = strings.ToLower(name)
-	CmdRouter[name] = &command{
-		Executor: executor,
-		keysFind: keysFind,
-		Arity:    arity,
-		Status:   status,
+	if status == ReadOnly {
+		categories = append(categories, CatRead)
+	} else {
+		categories = append(categories, CatWrite)
+	}
+	cmd := &command{
+		commandMeta: newCommandMeta(name, arity, keysFind, categories),
+		Executor:    executor,
+		Status:      status,
 	}
+	CmdRouter[name] = cmd
+	return cmd
+}
+
+// SetFlags 指定无法自动得出的flag
+func (cmd *command) SetFlags(flags ...string) *command {
+	cmd.Flags = append(cmd.Flags, flags...)
+	return cmd
 }
 
 /* ---- system command ---- */
@@ -41,18 +149,99 @@ func RegisterCommand(name string, executor Executor, keysFind keysFind, arity in
 type SysExecutor func(server *Server, client _interface.Client, args _type.Args) _interface.Reply
 
 type sysCommand struct {
+	commandMeta
 	Executor SysExecutor
-	Arity    int // 大于等于零时表示参数个数，小于零时表示参数个数的最小值
 }
 
 var SysCmdRouter = make(map[string]*sysCommand)
 
-func RegisterSysCommand(name string, sysExec SysExecutor, arity int) {
+// RegisterSysCommand 注册系统命令，系统命令默认不含key，且不能在lua脚本中执行
+func RegisterSysCommand(name string, sysExec SysExecutor, arity int, categories ...string) *sysCommand {
 	name = strings.ToLower(name)
-	SysCmdRouter[name] = &sysCommand{
-		Executor: sysExec,
-		Arity:    arity,
+	sysCmd := &sysCommand{
+		commandMeta: newCommandMeta(name, arity, utils.WriteNilReadNil, categories),
+		Executor:    sysExec,
+	}
+	sysCmd.Flags = []string{FlagNoScript}
+	SysCmdRouter[name] = sysCmd
+	return sysCmd
+}
+
+// SetFlags 指定无法自动得出的flag
+func (sysCmd *sysCommand) SetFlags(flags ...string) *sysCommand {
+	sysCmd.Flags = append(sysCmd.Flags, flags...)
+	return sysCmd
+}
+
+// SetSubcommand 为子命令指定单独的ACL分类，如client|kill，未指定的子命令按父命令检查权限
+func (sysCmd *sysCommand) SetSubcommand(sub string, arity int, categories ...string) *sysCommand {
+	sub = strings.ToLower(sub)
+	meta := newCommandMeta(sysCmd.Name+"|"+sub, arity, utils.WriteNilReadNil, categories)
+	meta.Flags = sysCmd.Flags
+	if sysCmd.subcommands == nil {
+		sysCmd.subcommands = make(map[string]*commandMeta)
+	}
+	sysCmd.subcommands[sub] = &meta
+	return sysCmd
+}
+
+// SetKeys 指定系统命令中key的位置，用于command命令及exec加锁
+func (sysCmd *sysCommand) SetKeys(keysFind utils.KeysFind) *sysCommand {
+	sysCmd.keysFind = keysFind
+	return sysCmd
+}
+
+// lookupCommand 返回命令的元信息，name为parent|sub时返回子命令的元信息
+func lookupCommand(name string) (*commandMeta, bool) {
+	if idx := strings.IndexByte(name, '|'); idx >= 0 {
+		parent, ok := lookupCommand(name[:idx])
+		if !ok {
+			return nil, false
+		}
+		sub, ok := parent.subcommands[name[idx+1:]]
+		return sub, ok
+	}
+	if cmd, ok := CmdRouter[name]; ok {
+		return &cmd.commandMeta, true
+	}
+	if sysCmd, ok := SysCmdRouter[name]; ok {
+		return &sysCmd.commandMeta, true
+	}
+	return nil, false
+}
+
+// CommandCategories 返回命令所属的ACL分类
+func CommandCategories(name string) ([]string, bool) {
+	meta, ok := lookupCommand(name)
+	if !ok {
+		return nil, false
+	}
+	return meta.Categories, true
+}
+
+// CommandNames 返回所有已注册的命令名
+func CommandNames() []string {
+	names := make([]string, 0, len(CmdRouter)+len(SysCmdRouter))
+	for name := range CmdRouter {
+		names = append(names, name)
+	}
+	for name := range SysCmdRouter {
+		names = append(names, name)
+	}
+	return names
+}
+
+// subcommandNames 返回命令中有单独ACL分类的子命令，格式为parent|sub
+func subcommandNames(name string) []string {
+	meta, ok := lookupCommand(name)
+	if !ok {
+		return nil
+	}
+	names := make([]string, 0, len(meta.subcommands))
+	for _, sub := range meta.subcommands {
+		names = append(names, sub.Name)
 	}
+	return names
 }
 
 /* ---- 事务相关的命令 ---- */
@@ -63,6 +252,7 @@ var TxCmd = map[string]bool{
 	"discard": true,
 	"watch":   true,
 	"unwatch": true,
+	"reset":   true,
 }
 
 func IsTxCmd(cmd string) bool {
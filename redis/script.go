@@ -0,0 +1,329 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	_interface "go-redis/interface"
+	_type "go-redis/interface/type"
+	Reply "go-redis/resp/reply"
+	"go-redis/utils/logger"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+const (
+	killedByUser    = "Script killed by user with SCRIPT KILL..."
+	killedByTimeout = "Script exceeded the lua-time-limit and was killed"
+)
+
+// Scripts 脚本缓存，以及正在执行的脚本
+type Scripts struct {
+	cache     map[string]*lua.FunctionProto // sha1 -> 编译后的脚本
+	cacheLock sync.RWMutex
+
+	running     map[*runningScript]struct{}
+	runningLock sync.Mutex
+}
+
+func NewScripts() *Scripts {
+	return &Scripts{
+		cache:   make(map[string]*lua.FunctionProto),
+		running: make(map[*runningScript]struct{}),
+	}
+}
+
+// Load 编译并缓存脚本，返回其sha1
+func (scripts *Scripts) Load(script string) (string, error) {
+	sha := Sha1Hex(script)
+	scripts.cacheLock.RLock()
+	_, ok := scripts.cache[sha]
+	scripts.cacheLock.RUnlock()
+	if ok {
+		return sha, nil
+	}
+	proto, err := compileLua("@user_script", script)
+	if err != nil {
+		return "", err
+	}
+	scripts.cacheLock.Lock()
+	scripts.cache[sha] = proto
+	scripts.cacheLock.Unlock()
+	return sha, nil
+}
+
+func (scripts *Scripts) Get(sha string) (*lua.FunctionProto, bool) {
+	scripts.cacheLock.RLock()
+	defer scripts.cacheLock.RUnlock()
+	proto, ok := scripts.cache[strings.ToLower(sha)]
+	return proto, ok
+}
+
+func (scripts *Scripts) Exists(sha string) bool {
+	_, ok := scripts.Get(sha)
+	return ok
+}
+
+func (scripts *Scripts) Flush() {
+	scripts.cacheLock.Lock()
+	scripts.cache = make(map[string]*lua.FunctionProto)
+	scripts.cacheLock.Unlock()
+}
+
+// Kill 终止所有未执行过写命令的脚本
+func (scripts *Scripts) Kill() _interface.Reply {
+	scripts.runningLock.Lock()
+	defer scripts.runningLock.Unlock()
+	if len(scripts.running) == 0 {
+		return Reply.StandardError("NOTBUSY No scripts in execution right now.")
+	}
+	killed := 0
+	for rs := range scripts.running {
+		if rs.kill(killedByUser) {
+			killed++
+		}
+	}
+	if killed == 0 {
+		return Reply.StandardError("UNKILLABLE Sorry the script already executed write commands against the dataset.")
+	}
+	return Reply.NewOkReply()
+}
+
+// Busy 是否有超时且无法终止的脚本持有这些key
+func (scripts *Scripts) Busy(dbIdx int, keys []string) bool {
+	scripts.runningLock.Lock()
+	defer scripts.runningLock.Unlock()
+	for rs := range scripts.running {
+		if rs.busyWith(dbIdx, keys) {
+			return true
+		}
+	}
+	return false
+}
+
+func (scripts *Scripts) addRunning(rs *runningScript) {
+	scripts.runningLock.Lock()
+	scripts.running[rs] = struct{}{}
+	scripts.runningLock.Unlock()
+}
+
+func (scripts *Scripts) removeRunning(rs *runningScript) {
+	scripts.runningLock.Lock()
+	delete(scripts.running, rs)
+	scripts.runningLock.Unlock()
+}
+
+// 解析"numkeys key [key ...] arg [arg ...]"形式的参数
+func parseScriptArgs(args _type.Args) ([]string, _type.Args, _interface.Reply) {
+	numKeys, err := strconv.Atoi(string(args[0]))
+	if err != nil {
+		return nil, nil, Reply.StandardError("value is not an integer or out of range")
+	}
+	if numKeys < 0 {
+		return nil, nil, Reply.StandardError("Number of keys can't be negative")
+	}
+	if numKeys > len(args)-1 {
+		return nil, nil, Reply.StandardError("Number of keys can't be greater than number of args")
+	}
+	keys := make([]string, numKeys)
+	for i := 0; i < numKeys; i++ {
+		keys[i] = string(args[i+1])
+	}
+	return keys, args[1+numKeys:], nil
+}
+
+// luaPrepare 在虚拟机中准备好待执行的函数及其参数
+type luaPrepare func(L *lua.LState) (fn lua.LValue, params []lua.LValue, err error)
+
+// callLua 在沙箱中执行lua函数，执行期间为声明的keys加写锁，以保证脚本执行的原子性
+// 事务中的脚本由exec执行，声明的keys已由exec加锁
+func (server *Server) callLua(client _interface.Client, keys []string, readOnly bool, prepare luaPrepare) _interface.Reply {
+	// 脚本中的写命令先缓存，执行完毕后以MULTI/EXEC包裹写入aof，宕机时不会只加载脚本的一部分
+	// 事务中的脚本已由exec缓存
+	var aofCmds []aofCmd
+	bufferAOF := server.persister != nil && client.GetTxAOF() == nil
+	if bufferAOF {
+		client.SetTxAOF(func(dbIdx int, cmdLine _type.CmdLine) {
+			aofCmds = append(aofCmds, aofCmd{cmdLine: cmdLine, dbIdx: dbIdx})
+		})
+	}
+	dbIdx := client.GetSelectDB()
+	db := server.clientDatabase(client, dbIdx)
+	if !client.IsTxState() {
+		db.lockKeys(keys, nil)
+		// 等待加锁期间数据库被swapdb交换，重新获取
+		for db.index() != dbIdx {
+			db.unLockKeys(keys, nil)
+			db = server.clientDatabase(client, dbIdx)
+			db.lockKeys(keys, nil)
+		}
+		defer db.unLockKeys(keys, nil)
+	}
+	if bufferAOF {
+		// 在解锁前写入，以保证与其他client的命令顺序一致
+		defer func() {
+			client.SetTxAOF(nil)
+			server.persister.ToAOFTx(aofCmds)
+		}()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	running := &runningScript{cancel: cancel, dbIdx: dbIdx, keys: keys}
+	server.scripts.addRunning(running)
+	defer server.scripts.removeRunning(running)
+	// 超时后终止脚本，已执行过写命令的脚本无法终止，之后访问其KEYS的命令返回BUSY，而不是等待脚本释放锁
+	if Config.LuaTimeLimit > 0 {
+		limit := time.Duration(Config.LuaTimeLimit) * time.Millisecond
+		timer := time.AfterFunc(limit, func() {
+			if !running.kill(killedByTimeout) {
+				running.setBusy()
+				logger.Warn(fmt.Sprintf("script exceeded the lua-time-limit of %d ms but can not be killed after writes", Config.LuaTimeLimit))
+			}
+		})
+		defer timer.Stop()
+	}
+
+	L := newLuaState()
+	defer L.Close()
+	caller := &luaCaller{
+		server:   server,
+		client:   client,
+		db:       db,
+		keys:     make(map[string]bool, len(keys)),
+		readOnly: readOnly,
+		running:  running,
+	}
+	for _, key := range keys {
+		caller.keys[key] = true
+	}
+	caller.register(L)
+	fn, params, err := prepare(L)
+	if err != nil {
+		return Reply.StandardError(err.Error())
+	}
+	L.SetContext(ctx)
+	L.Push(fn)
+	for _, param := range params {
+		L.Push(param)
+	}
+	err = L.PCall(len(params), 1, nil)
+	if err != nil {
+		if reason, killed := running.killReason(); killed {
+			return Reply.StandardError(reason)
+		}
+		return luaErrorToReply(err)
+	}
+	ret := L.Get(-1)
+	L.Pop(1)
+	return luaToReply(ret)
+}
+
+// 将字符串数组转换为lua的table
+func toLuaTable(L *lua.LState, items [][]byte) *lua.LTable {
+	table := L.CreateTable(len(items), 0)
+	for _, item := range items {
+		table.Append(lua.LString(item))
+	}
+	return table
+}
+
+func (server *Server) evalScript(client _interface.Client, proto *lua.FunctionProto, args _type.Args, readOnly bool) _interface.Reply {
+	keys, argv, errReply := parseScriptArgs(args)
+	if errReply != nil {
+		return errReply
+	}
+	return server.callLua(client, keys, readOnly, func(L *lua.LState) (lua.LValue, []lua.LValue, error) {
+		keyBytes := make([][]byte, len(keys))
+		for i, key := range keys {
+			keyBytes[i] = []byte(key)
+		}
+		L.SetGlobal("KEYS", toLuaTable(L, keyBytes))
+		L.SetGlobal("ARGV", toLuaTable(L, argv))
+		return L.NewFunctionFromProto(proto), nil, nil
+	})
+}
+
+/* ---- commands ---- */
+
+func execEval(server *Server, client _interface.Client, args _type.Args) _interface.Reply {
+	return doEval(server, client, args, false)
+}
+
+func execEvalRO(server *Server, client _interface.Client, args _type.Args) _interface.Reply {
+	return doEval(server, client, args, true)
+}
+
+func doEval(server *Server, client _interface.Client, args _type.Args, readOnly bool) _interface.Reply {
+	sha, err := server.scripts.Load(string(args[0]))
+	if err != nil {
+		return Reply.StandardError("Error compiling script: " + err.Error())
+	}
+	proto, _ := server.scripts.Get(sha)
+	return server.evalScript(client, proto, args[1:], readOnly)
+}
+
+func execEvalSha(server *Server, client _interface.Client, args _type.Args) _interface.Reply {
+	return doEvalSha(server, client, args, false)
+}
+
+func execEvalShaRO(server *Server, client _interface.Client, args _type.Args) _interface.Reply {
+	return doEvalSha(server, client, args, true)
+}
+
+func doEvalSha(server *Server, client _interface.Client, args _type.Args, readOnly bool) _interface.Reply {
+	proto, ok := server.scripts.Get(string(args[0]))
+	if !ok {
+		return Reply.StandardError("NOSCRIPT No matching script. Please use EVAL.")
+	}
+	return server.evalScript(client, proto, args[1:], readOnly)
+}
+
+func execScript(server *Server, client _interface.Client, args _type.Args) _interface.Reply {
+	sub := strings.ToLower(string(args[0]))
+	switch sub {
+	case "load":
+		if len(args) != 2 {
+			return Reply.ArgNumError("script|load")
+		}
+		sha, err := server.scripts.Load(string(args[1]))
+		if err != nil {
+			return Reply.StandardError("Error compiling script: " + err.Error())
+		}
+		return Reply.NewBulkReply([]byte(sha))
+	case "exists":
+		if len(args) < 2 {
+			return Reply.ArgNumError("script|exists")
+		}
+		replies := make([]_interface.Reply, len(args)-1)
+		for i, sha := range args[1:] {
+			if server.scripts.Exists(string(sha)) {
+				replies[i] = Reply.NewIntegerReply(1)
+			} else {
+				replies[i] = Reply.NewIntegerReply(0)
+			}
+		}
+		return Reply.NewRawArrayReply(replies)
+	case "flush":
+		if len(args) > 2 {
+			return Reply.ArgNumError("script|flush")
+		}
+		if len(args) == 2 {
+			mode := strings.ToLower(string(args[1]))
+			if mode != "async" && mode != "sync" {
+				return Reply.SyntaxError()
+			}
+		}
+		server.scripts.Flush()
+		return Reply.NewOkReply()
+	case "kill":
+		if len(args) != 1 {
+			return Reply.ArgNumError("script|kill")
+		}
+		return server.scripts.Kill()
+	}
+	return Reply.StandardError(fmt.Sprintf("unknown subcommand '%s'", sub))
+}
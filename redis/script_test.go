@@ -0,0 +1,95 @@
+package redis_test
+
+import (
+	"testing"
+	"time"
+)
+
+// startEval 在后台执行eval，返回其回复
+func startEval(c *testClient, args ...string) <-chan string {
+	done := make(chan string, 1)
+	go func() { done <- c.do(append([]string{"eval"}, args...)...) }()
+	return done
+}
+
+// waitScriptKill 重复执行SCRIPT KILL，直到回复不再是NOTBUSY，用于等待脚本开始执行
+func waitScriptKill(t *testing.T, c *testClient) string {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		reply := c.do("script", "kill")
+		if reply != "-ERR: NOTBUSY No scripts in execution right now.\r\n" {
+			return reply
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("script did not start")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// 脚本中不能使用os、io库及dofile、loadfile
+func TestEval_Sandbox(t *testing.T) {
+	c := newTestClient(t, newTestServer(t))
+	c.expect("*4\r\n$3\r\nnil\r\n$3\r\nnil\r\n$3\r\nnil\r\n$3\r\nnil\r\n",
+		"eval", "return {type(os), type(io), type(dofile), type(loadfile)}", "0")
+	c.expect("$5\r\ntable\r\n", "eval", "return type(string)", "0")
+}
+
+// 脚本只能访问KEYS中声明的key
+func TestEval_UndeclaredKey(t *testing.T) {
+	c := newTestClient(t, newTestServer(t))
+	c.expect("-ERR: Script attempted to access key 'b' which was not declared in KEYS\r\n",
+		"eval", "return redis.call('set', 'b', '1')", "1", "a")
+	c.expect("+OK\r\n", "eval", "return redis.call('set', KEYS[1], '1')", "1", "a")
+	c.expect(":0\r\n", "exists", "b")
+}
+
+func TestEvalSha_NoScript(t *testing.T) {
+	c := newTestClient(t, newTestServer(t))
+	c.expect("-ERR: NOSCRIPT No matching script. Please use EVAL.\r\n",
+		"evalsha", "0123456789012345678901234567890123456789", "0")
+}
+
+// 超过lua-time-limit且未执行写命令的脚本被终止
+func TestEval_TimeLimitKills(t *testing.T) {
+	restoreConfig(t, "lua-time-limit")
+	c := newTestClient(t, newTestServer(t))
+	c.expect("+OK\r\n", "config", "set", "lua-time-limit", "50")
+	c.expect("-ERR: Script exceeded the lua-time-limit and was killed\r\n", "eval", "while true do end", "0")
+}
+
+// SCRIPT KILL终止未执行写命令的脚本
+func TestScriptKill(t *testing.T) {
+	restoreConfig(t, "lua-time-limit")
+	server := newTestServer(t)
+	a, b := newTestClient(t, server), newTestClient(t, server)
+	b.expect("+OK\r\n", "config", "set", "lua-time-limit", "0")
+	done := startEval(a, "while true do end", "0")
+	if reply := waitScriptKill(t, b); reply != "+OK\r\n" {
+		t.Fatalf("script kill: got %q", reply)
+	}
+	if reply := <-done; reply != "-ERR: Script killed by user with SCRIPT KILL...\r\n" {
+		t.Fatalf("eval: got %q", reply)
+	}
+	b.expect("-ERR: NOTBUSY No scripts in execution right now.\r\n", "script", "kill")
+}
+
+// 执行过写命令的脚本无法终止，超过lua-time-limit后访问其KEYS的命令返回BUSY
+func TestEval_BusyAfterWrite(t *testing.T) {
+	restoreConfig(t, "lua-time-limit")
+	server := newTestServer(t)
+	a, b := newTestClient(t, server), newTestClient(t, server)
+	b.expect("+OK\r\n", "config", "set", "lua-time-limit", "50")
+	done := startEval(a, "redis.call('set', KEYS[1], 'v') for i = 1, 5000000 do end return 1", "1", "k")
+	waitDBSize(t, b, "1")
+	b.expect("-ERR: UNKILLABLE Sorry the script already executed write commands against the dataset.\r\n", "script", "kill")
+	// 超过lua-time-limit后不再等待脚本释放锁
+	time.Sleep(100 * time.Millisecond)
+	b.expect("-ERR: BUSY Redis is busy running a script. You can only call SCRIPT KILL or SHUTDOWN NOSCRIPT.\r\n", "get", "k")
+	b.expect("$-1\r\n", "get", "other")
+	if reply := <-done; reply != ":1\r\n" {
+		t.Fatalf("eval: got %q", reply)
+	}
+	b.expect("$1\r\nv\r\n", "get", "k")
+}
@@ -1,23 +1,40 @@
 package redis
 
 import (
+	"errors"
 	"fmt"
 	_interface "go-redis/interface"
 	_type "go-redis/interface/type"
 	"go-redis/redis/utils"
 	Reply "go-redis/resp/reply"
 	"go-redis/utils/logger"
+	"net/http"
 	"runtime/debug"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 )
 
+// RedisVersion 兼容的redis版本
+const RedisVersion = "7.0.0"
+
 type Server struct {
 	databases []*atomic.Value // 若干个redis数据库
 	persister *Persister      // AOF持久化
 	pubsub    *Pubsub         // pub/sub
-	txing     bool            // 正在执行事务
+	scripts   *Scripts        // lua脚本
+	functions *Functions      // 函数库
+	acl       *ACL            // 用户及权限
+	tracking  *Tracking       // client tracking
+	watcher   *Watcher        // 被watch的key
+	clients   sync.Map        // 所有连接的client，id -> client
+	pause     clientPause     // client pause
+	stats     *serverStats    // 统计信息，用于info
+	slowlog   *SlowLog        // 慢日志
+	monitor   *Monitor        // monitor
+	metrics   *http.Server    // Prometheus指标服务
+	done      chan struct{}   // 关闭server时通知后台任务退出
 }
 
 // NewServer 读取配置，创建server
@@ -37,6 +54,35 @@ func NewServer() *Server {
 	}
 	// pub/sub
 	server.pubsub = NewPubsub()
+	// 统计信息
+	server.stats = newServerStats()
+	server.slowlog = NewSlowLog()
+	server.monitor = NewMonitor()
+	// client tracking
+	server.tracking = NewTracking(server)
+	for i := range server.databases {
+		db := server.databases[i].Load().(*Database)
+		db.TrackKeys = server.tracking.TrackKeys
+		db.InvalidateKeys = server.tracking.InvalidateKeys
+	}
+	// watch
+	server.watcher = NewWatcher(len(server.databases))
+	for i := range server.databases {
+		db := server.databases[i].Load().(*Database)
+		db.TouchKeys = func(keys []string) {
+			server.watcher.Touch(db.index(), keys)
+		}
+	}
+	// ACL
+	server.acl = NewACL()
+	if Config.Aclfile != "" {
+		if err := server.acl.LoadFile(Config.Aclfile); err != nil {
+			logger.Fatal("Aborting Redis startup because of ACL errors: " + err.Error())
+		}
+	}
+	// lua脚本与函数库
+	server.scripts = NewScripts()
+	server.functions = NewFunctions()
 	// AOF持久化
 	if Config.Appendonly {
 		filename, fsync := Config.Appendfilename, Config.Appendfsync
@@ -45,7 +91,7 @@ func NewServer() *Server {
 		for i := range server.databases {
 			db := server.databases[i].Load().(*Database)
 			db.ToAOF = func(cmdLine _type.CmdLine) {
-				persister.ToAOF(db.idx, cmdLine)
+				persister.ToAOF(db.index(), cmdLine)
 			}
 		}
 		persister.ReadAOF(-1) // 加载整个AOF文件
@@ -53,6 +99,11 @@ func NewServer() *Server {
 		persister.Listening() // 开启AOF监听
 		server.persister = persister
 	}
+	// Prometheus指标
+	server.startMetrics()
+	// 后台任务
+	server.done = make(chan struct{})
+	go server.clientsCron()
 	return server
 }
 
@@ -71,6 +122,9 @@ func MakeFakeServer() *Server {
 		holder.Store(db)
 		server.databases[i] = holder
 	}
+	server.functions = NewFunctions()
+	server.monitor = NewMonitor()
+	server.watcher = NewWatcher(dbNum)
 	return server
 }
 
@@ -82,20 +136,45 @@ func (server *Server) ExecCommand(client _interface.Client, cmdLine _type.CmdLin
 			reply = &Reply.UnknownErrReply{}
 		}
 	}()
-	// server正在执行事务，等待
-	for server.IsTxing() {
-		time.Sleep(1 * time.Millisecond)
-	}
-
 	cmd := strings.ToLower(string(cmdLine[0]))
-	// 鉴权未通过，且当前命令不是auth命令
-	if !server.isAuth(client) && cmd != "auth" {
+	client.SetLastCmd(fullCmdName(cmdLine))
+	atomic.AddInt64(&server.stats.totalCommands, 1)
+	// 鉴权未通过，且当前命令不是auth、hello、reset命令
+	user := server.acl.CurrentUser(client)
+	if user == nil && cmd != "auth" && cmd != "hello" && cmd != "reset" {
 		return Reply.StandardError("NOAUTH Authentication required.")
 	}
+	// ACL权限检查，事务中被拒绝的命令会导致整个事务被放弃
+	if user != nil {
+		context := "toplevel"
+		if client.IsTxState() {
+			context = "multi"
+		}
+		if errReply := server.acl.Check(client, user, cmdLine, context); errReply != nil {
+			if client.IsTxState() && !IsTxCmd(cmd) {
+				client.AddTxError(errReply)
+			}
+			return errReply
+		}
+	}
+	// client caching的设置只对下一条命令有效
+	defer server.tracking.AfterCommand(client, cmdLine)
+	// client pause期间阻塞，事务中入队的命令以及client命令本身不受影响
+	if cmd != "client" && !(client.IsTxState() && !IsTxCmd(cmd)) {
+		server.pause.Wait(client, cmdLine)
+	}
 	// 事务处理(client处于事务状态，且cmd不是事务相关命令)
 	if client.IsTxState() && !IsTxCmd(cmd) {
 		return server.handleTX(client, cmdLine)
 	}
+	// 命令访问的key被超时且无法终止的脚本持有
+	if server.busyScriptKeys(client, cmd, cmdLine) {
+		return Reply.StandardError("BUSY Redis is busy running a script. You can only call SCRIPT KILL or SHUTDOWN NOSCRIPT.")
+	}
+	// 记录耗时，用于slowlog、latency及命令统计
+	defer func(start time.Time) { server.recordCommand(client, cmdLine, reply, time.Since(start)) }(time.Now())
+	// 命令执行后再发送给monitor，事务中的命令会先于exec发送
+	defer server.monitor.Feed(client.GetSelectDB(), client.RemoteAddr(), cmdLine)
 	// 分发命令
 	_, ok := SysCmdRouter[cmd]
 	if ok {
@@ -105,6 +184,23 @@ func (server *Server) ExecCommand(client _interface.Client, cmdLine _type.CmdLin
 	}
 }
 
+// busyScriptKeys 命令访问的key是否被超过lua-time-limit且执行过写命令的脚本持有，等待锁可能一直阻塞
+func (server *Server) busyScriptKeys(client _interface.Client, cmd string, cmdLine _type.CmdLine) bool {
+	meta, ok := lookupCommand(cmd)
+	if !ok || meta.keysFind.Find == nil || !utils.CheckArgNum(meta.Arity, cmdLine) {
+		return false
+	}
+	writeKeys, readKeys := meta.keysFind.Find(_type.Args(cmdLine[1:]))
+	return server.scripts.Busy(client.GetSelectDB(), append(writeKeys, readKeys...))
+}
+
+// 命令执行结束后记录慢日志、延迟及命令统计
+func (server *Server) recordCommand(client _interface.Client, cmdLine _type.CmdLine, reply _interface.Reply, duration time.Duration) {
+	server.slowlog.Record(client, cmdLine, duration)
+	LatencyMonitor.Add("command", duration)
+	server.stats.recordCommand(cmdLine, reply, duration)
+}
+
 func (server *Server) ExecForTX(client _interface.Client, cmdLine _type.CmdLine) (reply _interface.Reply) {
 	// 异常处理
 	defer func() {
@@ -114,12 +210,14 @@ func (server *Server) ExecForTX(client _interface.Client, cmdLine _type.CmdLine)
 		}
 	}()
 	cmd := strings.ToLower(string(cmdLine[0]))
+	defer func(start time.Time) { server.recordCommand(client, cmdLine, reply, time.Since(start)) }(time.Now())
+	defer server.monitor.Feed(client.GetSelectDB(), client.RemoteAddr(), cmdLine)
 	// 分发命令
 	_, ok := SysCmdRouter[cmd]
 	if ok {
 		return server.execSysCommand(client, cmdLine) // 执行系统命令
 	} else {
-		return server.execCommand(client, cmdLine) // 执行数据库命令
+		return server.execCommandWithoutLock(client, cmdLine) // 执行数据库命令，key已由exec加锁
 	}
 }
 
@@ -132,6 +230,7 @@ func (server *Server) ExecForAOF(client _interface.Client, cmdLine _type.CmdLine
 		}
 	}()
 	cmd := strings.ToLower(string(cmdLine[0]))
+	defer server.monitor.Feed(client.GetSelectDB(), monitorSourceAof, cmdLine)
 	// 分发命令
 	_, ok := SysCmdRouter[cmd]
 	if ok {
@@ -162,8 +261,24 @@ func (server *Server) execCommand(client _interface.Client, cmdLine _type.CmdLin
 		err := fmt.Sprintf("selected index is out of range[0, %d]", len(server.databases)-1)
 		return Reply.StandardError(err)
 	}
-	db := server.databases[dbIdx].Load().(*Database)
-	return db.Execute(client, cmdLine)
+	for {
+		db := server.getDatabase(dbIdx)
+		if reply, ok := db.Execute(client, dbIdx, cmdLine); ok {
+			return reply
+		}
+		// 等待加锁期间数据库被swapdb交换，重新获取
+	}
+}
+
+// execCommandWithoutLock 执行数据库命令但不为key加锁，用于事务中的命令
+func (server *Server) execCommandWithoutLock(client _interface.Client, cmdLine _type.CmdLine) _interface.Reply {
+	dbIdx := client.GetSelectDB()
+	if dbIdx < 0 || dbIdx >= len(server.databases) {
+		err := fmt.Sprintf("selected index is out of range[0, %d]", len(server.databases)-1)
+		return Reply.StandardError(err)
+	}
+	db := server.clientDatabase(client, dbIdx)
+	return db.ExecuteWithoutLock(client, cmdLine)
 }
 
 func (server *Server) handleTX(client _interface.Client, cmdLine _type.CmdLine) _interface.Reply {
@@ -198,43 +313,104 @@ func (server *Server) handleTX(client _interface.Client, cmdLine _type.CmdLine)
 	return errReply
 }
 
-func (server *Server) SetTxing(flag bool) {
-	server.txing = flag
+// ErrMaxClients 连接数已达到maxclients，新连接被拒绝
+var ErrMaxClients = errors.New("max number of clients reached")
+
+// AddClient 记录新连接，连接数达到maxclients时返回ErrMaxClients
+func (server *Server) AddClient(client _interface.Client) error {
+	atomic.AddInt64(&server.stats.totalConnections, 1)
+	if atomic.AddInt64(&server.stats.connectedClients, 1) > int64(Config.Maxclients) {
+		atomic.AddInt64(&server.stats.connectedClients, -1)
+		atomic.AddInt64(&server.stats.rejectedConnections, 1)
+		return ErrMaxClients
+	}
+	server.clients.Store(client.GetId(), client)
+	// 以客户端证书的CN作为用户完成鉴权
+	if user, ok := server.certUser(client); ok {
+		client.SetUser(user)
+	}
+	return nil
 }
 
-func (server *Server) IsTxing() bool {
-	return server.txing
+func (server *Server) getClient(id int64) (_interface.Client, bool) {
+	client, ok := server.clients.Load(id)
+	if !ok {
+		return nil, false
+	}
+	return client.(_interface.Client), true
+}
+
+// clientsCron 每秒检查一次，断开空闲时间超过timeout的client
+// 订阅者与monitor长时间不发送命令属于正常情况，不会被断开
+func (server *Server) clientsCron() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-server.done:
+			return
+		case now := <-ticker.C:
+			if Config.Timeout <= 0 {
+				continue
+			}
+			timeout := time.Duration(Config.Timeout) * time.Second
+			server.clients.Range(func(key, value any) bool {
+				client := value.(_interface.Client)
+				if client.ChannelsCount() > 0 || server.monitor.IsMonitor(client) {
+					return true
+				}
+				if now.Sub(client.GetLastTime()) > timeout {
+					logger.Info(fmt.Sprintf("closing idle client [%s]", client.RemoteAddr()))
+					client.Kill() // 由读取该连接的goroutine负责清理
+				}
+				return true
+			})
+		}
+	}
 }
 
 func (server *Server) CloseClient(client _interface.Client) {
+	// 先清理与client有关的状态，再关闭连接
+	if _, ok := server.clients.LoadAndDelete(client.GetId()); ok {
+		atomic.AddInt64(&server.stats.connectedClients, -1)
+	}
+	server.tracking.Disable(client)
+	server.monitor.Remove(client)
+	server.watcher.UnwatchAll(client)
+	// 取消订阅
+	server.pubsub.RemoveClient(client)
 	err := client.Close()
 	if err != nil {
 		logger.Warn("client close err: " + err.Error())
 	}
-	// 取消订阅
-	channels := client.GetChannels()
-	server.pubsub.UnSubscribe(client, channels)
 	logger.Info(fmt.Sprintf("client [%s] closed successfully.", client.RemoteAddr()))
 }
 
 func (server *Server) Close() {
+	close(server.done)
+	server.stats.close()
+	server.stopMetrics()
 	if server.persister != nil {
 		server.persister.Close()
 	}
 	logger.Info("redis server closed successfully.")
 }
 
-func (server *Server) isAuth(client _interface.Client) bool {
-	if Config.Requirepass == "" {
-		return true // 未设置密码
-	}
-	return client.GetPassword() == Config.Requirepass // 密码是否一致
-}
-
 func (server *Server) getDatabase(dbIdx int) *Database {
 	return server.databases[dbIdx].Load().(*Database)
 }
 
+// clientDatabase 返回client执行命令时使用的数据库，exec期间命令写入aof时先写入事务的缓存
+func (server *Server) clientDatabase(client _interface.Client, dbIdx int) *Database {
+	db := server.getDatabase(dbIdx)
+	if toAOF := client.GetTxAOF(); toAOF != nil {
+		return db.withAOF(func(cmdLine _type.CmdLine) {
+			toAOF(dbIdx, cmdLine)
+		})
+	}
+	return db
+}
+
 func (server *Server) dataBaseCount() int {
 	return len(server.databases)
 }
@@ -0,0 +1,75 @@
+package redis_test
+
+import (
+	"go-redis/redis"
+	_ "go-redis/redis/commands"
+	Reply "go-redis/resp/reply"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// newTestServer 创建不开启aof的server，测试结束时关闭
+func newTestServer(t *testing.T) *redis.Server {
+	t.Helper()
+	server := redis.NewServer()
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newAOFServer 以dir中的aof文件创建server，启动时加载该文件
+func newAOFServer(t *testing.T, filename string) *redis.Server {
+	t.Helper()
+	appendonly, appendfilename := redis.Config.Appendonly, redis.Config.Appendfilename
+	redis.Config.Appendonly, redis.Config.Appendfilename = true, filename
+	defer func() {
+		redis.Config.Appendonly, redis.Config.Appendfilename = appendonly, appendfilename
+	}()
+	server := redis.NewServer()
+	t.Cleanup(server.Close)
+	return server
+}
+
+// testClient 通过net.Pipe连接的client，直接调用server执行命令并返回回复
+type testClient struct {
+	t      *testing.T
+	server *redis.Server
+	client *redis.Client
+}
+
+func newTestClient(t *testing.T, server *redis.Server) *testClient {
+	t.Helper()
+	conn, peer := net.Pipe()
+	go func() { _, _ = io.Copy(io.Discard, peer) }() // 丢弃pub/sub等推送的数据
+	client := redis.NewClient(conn)
+	if err := server.AddClient(client); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		server.CloseClient(client)
+		_ = peer.Close()
+	})
+	return &testClient{t: t, server: server, client: client}
+}
+
+// do 执行命令，返回按client的协议版本编码的回复
+func (c *testClient) do(args ...string) string {
+	cmdLine := make([][]byte, len(args))
+	for i, arg := range args {
+		cmdLine[i] = []byte(arg)
+	}
+	reply := c.server.ExecCommand(c.client, cmdLine)
+	if reply == nil {
+		return ""
+	}
+	return string(Reply.Encode(reply, c.client.GetProtocol()))
+}
+
+// expect 执行命令并检查回复
+func (c *testClient) expect(want string, args ...string) {
+	c.t.Helper()
+	if got := c.do(args...); got != want {
+		c.t.Fatalf("%s: got %q, want %q", strings.Join(args, " "), got, want)
+	}
+}
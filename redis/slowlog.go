@@ -0,0 +1,376 @@
+package redis
+
+import (
+	"fmt"
+	_interface "go-redis/interface"
+	_type "go-redis/interface/type"
+	Reply "go-redis/resp/reply"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	slowlogMaxArgc   = 32  // 每条慢日志最多记录的参数个数
+	slowlogMaxArgLen = 128 // 每个参数最多记录的字节数
+	latencySamples   = 160 // 每个事件最多保留的延迟样本数
+)
+
+/* ---- slowlog ---- */
+
+type slowlogEntry struct {
+	id         int64
+	time       time.Time
+	duration   time.Duration
+	args       []string
+	clientAddr string
+	clientName string
+}
+
+// SlowLog 记录执行时间超过slowlog-log-slower-than的命令
+type SlowLog struct {
+	entries []*slowlogEntry // 按时间倒序
+	nextId  int64
+	lock    sync.Mutex
+}
+
+func NewSlowLog() *SlowLog {
+	return &SlowLog{}
+}
+
+// Record 命令执行结束后调用，执行时间超过阈值时记录
+func (slowlog *SlowLog) Record(client _interface.Client, cmdLine _type.CmdLine, duration time.Duration) {
+	threshold := Config.SlowlogLogSlowerThan
+	if threshold < 0 || duration < time.Duration(threshold)*time.Microsecond {
+		return
+	}
+	entry := &slowlogEntry{
+		time:       time.Now(),
+		duration:   duration,
+		args:       truncateArgs(cmdLine),
+		clientAddr: client.RemoteAddr(),
+		clientName: client.GetName(),
+	}
+	slowlog.lock.Lock()
+	defer slowlog.lock.Unlock()
+	entry.id = slowlog.nextId
+	slowlog.nextId++
+	slowlog.entries = append([]*slowlogEntry{entry}, slowlog.entries...)
+	slowlog.trim()
+}
+
+// 保留最近的slowlog-max-len条记录
+func (slowlog *SlowLog) trim() {
+	maxLen := Config.SlowlogMaxLen
+	if maxLen < 0 {
+		maxLen = 0
+	}
+	if len(slowlog.entries) > maxLen {
+		slowlog.entries = slowlog.entries[:maxLen]
+	}
+}
+
+// Trim slowlog-max-len被修改后调用
+func (slowlog *SlowLog) Trim() {
+	slowlog.lock.Lock()
+	defer slowlog.lock.Unlock()
+	slowlog.trim()
+}
+
+func (slowlog *SlowLog) Len() int {
+	slowlog.lock.Lock()
+	defer slowlog.lock.Unlock()
+	return len(slowlog.entries)
+}
+
+func (slowlog *SlowLog) Reset() {
+	slowlog.lock.Lock()
+	defer slowlog.lock.Unlock()
+	slowlog.entries = nil
+}
+
+// Get 返回最近的count条记录，count小于0时返回全部
+func (slowlog *SlowLog) Get(count int) _interface.Reply {
+	slowlog.lock.Lock()
+	defer slowlog.lock.Unlock()
+	if count < 0 || count > len(slowlog.entries) {
+		count = len(slowlog.entries)
+	}
+	replies := make([]_interface.Reply, count)
+	for i, entry := range slowlog.entries[:count] {
+		replies[i] = Reply.NewRawArrayReply([]_interface.Reply{
+			Reply.NewIntegerReply(entry.id),
+			Reply.NewIntegerReply(entry.time.Unix()),
+			Reply.NewIntegerReply(entry.duration.Microseconds()),
+			Reply.StringToArrayReply(entry.args...),
+			Reply.StringToBulkReply(entry.clientAddr),
+			Reply.StringToBulkReply(entry.clientName),
+		})
+	}
+	return Reply.NewRawArrayReply(replies)
+}
+
+// 截断过多或过长的参数
+func truncateArgs(cmdLine _type.CmdLine) []string {
+	argc := len(cmdLine)
+	if argc > slowlogMaxArgc {
+		argc = slowlogMaxArgc
+	}
+	args := make([]string, 0, argc)
+	for i := 0; i < argc; i++ {
+		if i == slowlogMaxArgc-1 && len(cmdLine) > slowlogMaxArgc {
+			args = append(args, fmt.Sprintf("... (%d more arguments)", len(cmdLine)-slowlogMaxArgc+1))
+			break
+		}
+		arg := cmdLine[i]
+		if len(arg) > slowlogMaxArgLen {
+			args = append(args, fmt.Sprintf("%s... (%d more bytes)", arg[:slowlogMaxArgLen], len(arg)-slowlogMaxArgLen))
+		} else {
+			args = append(args, string(arg))
+		}
+	}
+	return args
+}
+
+/* ---- latency monitor ---- */
+
+type latencySample struct {
+	time    time.Time
+	latency int64 // 毫秒
+}
+
+type latencyEvent struct {
+	samples []latencySample // 按时间顺序，同一秒内只保留最大值
+	max     int64
+}
+
+// Latency 记录各类事件的延迟，只记录不小于latency-monitor-threshold的样本
+type Latency struct {
+	events map[string]*latencyEvent
+	lock   sync.Mutex
+}
+
+// LatencyMonitor 全局的延迟监控，供aof、过期等没有server引用的模块使用
+var LatencyMonitor = NewLatency()
+
+func NewLatency() *Latency {
+	return &Latency{
+		events: make(map[string]*latencyEvent),
+	}
+}
+
+// Add 记录一次事件的耗时
+func (latency *Latency) Add(event string, duration time.Duration) {
+	threshold := Config.LatencyMonitorThreshold
+	ms := duration.Milliseconds()
+	if threshold <= 0 || ms < int64(threshold) {
+		return
+	}
+	latency.lock.Lock()
+	defer latency.lock.Unlock()
+	ev, ok := latency.events[event]
+	if !ok {
+		ev = &latencyEvent{}
+		latency.events[event] = ev
+	}
+	now := time.Now()
+	if n := len(ev.samples); n > 0 && ev.samples[n-1].time.Unix() == now.Unix() {
+		if ms > ev.samples[n-1].latency {
+			ev.samples[n-1].latency = ms
+		}
+	} else {
+		ev.samples = append(ev.samples, latencySample{time: now, latency: ms})
+		if len(ev.samples) > latencySamples {
+			ev.samples = ev.samples[1:]
+		}
+	}
+	if ms > ev.max {
+		ev.max = ms
+	}
+}
+
+// 按名称排序的事件名
+func (latency *Latency) eventNames() []string {
+	names := make([]string, 0, len(latency.events))
+	for name := range latency.events {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (latency *Latency) Latest() _interface.Reply {
+	latency.lock.Lock()
+	defer latency.lock.Unlock()
+	replies := make([]_interface.Reply, 0, len(latency.events))
+	for _, name := range latency.eventNames() {
+		ev := latency.events[name]
+		last := ev.samples[len(ev.samples)-1]
+		replies = append(replies, Reply.NewRawArrayReply([]_interface.Reply{
+			Reply.StringToBulkReply(name),
+			Reply.NewIntegerReply(last.time.Unix()),
+			Reply.NewIntegerReply(last.latency),
+			Reply.NewIntegerReply(ev.max),
+		}))
+	}
+	return Reply.NewRawArrayReply(replies)
+}
+
+func (latency *Latency) History(event string) _interface.Reply {
+	latency.lock.Lock()
+	defer latency.lock.Unlock()
+	ev, ok := latency.events[event]
+	if !ok {
+		return Reply.NewEmptyArrayReply()
+	}
+	replies := make([]_interface.Reply, len(ev.samples))
+	for i, sample := range ev.samples {
+		replies[i] = Reply.NewRawArrayReply([]_interface.Reply{
+			Reply.NewIntegerReply(sample.time.Unix()),
+			Reply.NewIntegerReply(sample.latency),
+		})
+	}
+	return Reply.NewRawArrayReply(replies)
+}
+
+// Reset 清除指定事件(为空时清除全部)，返回清除的事件数
+func (latency *Latency) Reset(events ...string) int {
+	latency.lock.Lock()
+	defer latency.lock.Unlock()
+	if len(events) == 0 {
+		count := len(latency.events)
+		latency.events = make(map[string]*latencyEvent)
+		return count
+	}
+	count := 0
+	for _, event := range events {
+		if _, ok := latency.events[event]; ok {
+			delete(latency.events, event)
+			count++
+		}
+	}
+	return count
+}
+
+// Doctor 生成可读的延迟分析报告
+func (latency *Latency) Doctor() string {
+	latency.lock.Lock()
+	defer latency.lock.Unlock()
+	var builder strings.Builder
+	if Config.LatencyMonitorThreshold <= 0 {
+		builder.WriteString("I'm sorry, Dave, I can't do that. Latency monitoring is disabled in this Redis instance. ")
+		builder.WriteString("You may use \"CONFIG SET latency-monitor-threshold <milliseconds>.\" in order to enable it.\n")
+		return builder.String()
+	}
+	if len(latency.events) == 0 {
+		builder.WriteString("Dave, no latency spike was observed during the lifetime of this Redis instance, not in the slightest bit.\n")
+		return builder.String()
+	}
+	builder.WriteString("Dave, I have observed latency spikes in this Redis instance. You don't mind talking about it, do you Dave?\n\n")
+	advices := make(map[string]bool)
+	for i, name := range latency.eventNames() {
+		ev := latency.events[name]
+		var sum int64
+		for _, sample := range ev.samples {
+			sum += sample.latency
+		}
+		first := ev.samples[0].time
+		builder.WriteString(fmt.Sprintf("%d. %s: %d latency spikes (average %dms, mean deviation %dms, period %s). Worst all time event %dms.\n",
+			i+1, name, len(ev.samples), sum/int64(len(ev.samples)), meanDeviation(ev.samples, sum),
+			time.Since(first).Truncate(time.Second), ev.max))
+		switch {
+		case name == "command":
+			advices["- Check your Slow Log to understand what are the commands you are running which are too slow to execute. Please check https://redis.io/commands/slowlog for more information.\n"] = true
+		case strings.HasPrefix(name, "aof"):
+			advices["- The AOF fsync or rewrite is slow, consider using 'appendfsync everysec' or a faster disk.\n"] = true
+		case name == "expire-cycle":
+			advices["- Deleting expired keys is slow, avoid having many keys expiring at the same time.\n"] = true
+		}
+	}
+	builder.WriteString("\nI have a few advices for you:\n\n")
+	list := make([]string, 0, len(advices))
+	for advice := range advices {
+		list = append(list, advice)
+	}
+	sort.Strings(list)
+	for _, advice := range list {
+		builder.WriteString(advice)
+	}
+	return builder.String()
+}
+
+func meanDeviation(samples []latencySample, sum int64) int64 {
+	avg := sum / int64(len(samples))
+	var dev int64
+	for _, sample := range samples {
+		diff := sample.latency - avg
+		if diff < 0 {
+			diff = -diff
+		}
+		dev += diff
+	}
+	return dev / int64(len(samples))
+}
+
+/* ---- commands ---- */
+
+func execSlowLog(server *Server, client _interface.Client, args _type.Args) _interface.Reply {
+	sub := strings.ToLower(string(args[0]))
+	switch sub {
+	case "get":
+		if len(args) > 2 {
+			return Reply.ArgNumError("slowlog|get")
+		}
+		count := 10
+		if len(args) == 2 {
+			n, err := strconv.Atoi(string(args[1]))
+			if err != nil || n < -1 {
+				return Reply.StandardError("count should be greater than or equal to -1")
+			}
+			count = n
+		}
+		return server.slowlog.Get(count)
+	case "len":
+		if len(args) != 1 {
+			return Reply.ArgNumError("slowlog|len")
+		}
+		return Reply.NewIntegerReply(int64(server.slowlog.Len()))
+	case "reset":
+		if len(args) != 1 {
+			return Reply.ArgNumError("slowlog|reset")
+		}
+		server.slowlog.Reset()
+		return Reply.NewOkReply()
+	}
+	return Reply.StandardError(fmt.Sprintf("unknown subcommand '%s'", sub))
+}
+
+func execLatency(server *Server, client _interface.Client, args _type.Args) _interface.Reply {
+	sub := strings.ToLower(string(args[0]))
+	switch sub {
+	case "latest":
+		if len(args) != 1 {
+			return Reply.ArgNumError("latency|latest")
+		}
+		return LatencyMonitor.Latest()
+	case "history":
+		if len(args) != 2 {
+			return Reply.ArgNumError("latency|history")
+		}
+		return LatencyMonitor.History(string(args[1]))
+	case "reset":
+		events := make([]string, len(args)-1)
+		for i, arg := range args[1:] {
+			events[i] = string(arg)
+		}
+		return Reply.NewIntegerReply(int64(LatencyMonitor.Reset(events...)))
+	case "doctor":
+		if len(args) != 1 {
+			return Reply.ArgNumError("latency|doctor")
+		}
+		return Reply.NewVerbatimReply("txt", LatencyMonitor.Doctor())
+	}
+	return Reply.StandardError(fmt.Sprintf("unknown subcommand '%s'", sub))
+}
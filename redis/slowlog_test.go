@@ -0,0 +1,94 @@
+package redis_test
+
+import (
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+// expectMatch 执行命令并用正则检查回复，返回匹配的分组
+func expectMatch(c *testClient, pattern string, args ...string) []string {
+	c.t.Helper()
+	got := c.do(args...)
+	match := regexp.MustCompile(pattern).FindStringSubmatch(got)
+	if match == nil {
+		c.t.Fatalf("%v: got %q, want match %q", args, got, pattern)
+	}
+	return match
+}
+
+// slowlog-log-slower-than为0时记录所有命令，包括参数、client地址及名称
+func TestSlowLog_GetLenReset(t *testing.T) {
+	restoreConfig(t, "slowlog-log-slower-than", "slowlog-max-len")
+	c := newTestClient(t, newTestServer(t))
+	c.expect("+OK\r\n", "config", "set", "slowlog-max-len", "128")
+	c.expect("+OK\r\n", "config", "set", "slowlog-log-slower-than", "0")
+	c.expect("+OK\r\n", "slowlog", "reset")
+	// 命令执行结束后才记录，slowlog reset本身被记录，id不因reset重置
+	c.expect(":1\r\n", "slowlog", "len")
+	c.expect("+OK\r\n", "client", "setname", "foo")
+	c.expect("+OK\r\n", "set", "k", "v")
+	expectMatch(c, `^\*2\r\n`+
+		`\*6\r\n:\d+\r\n:\d+\r\n:\d+\r\n\*3\r\n\$3\r\nset\r\n\$1\r\nk\r\n\$1\r\nv\r\n\$4\r\npipe\r\n\$3\r\nfoo\r\n`+
+		`\*6\r\n:\d+\r\n:\d+\r\n:\d+\r\n\*3\r\n\$6\r\nclient\r\n\$7\r\nsetname\r\n\$3\r\nfoo\r\n\$4\r\npipe\r\n\$3\r\nfoo\r\n$`,
+		"slowlog", "get", "2")
+	c.expect(":5\r\n", "slowlog", "len")
+	c.expect("-ERR: count should be greater than or equal to -1\r\n", "slowlog", "get", "-2")
+
+	// 为-1时不记录
+	c.expect("+OK\r\n", "config", "set", "slowlog-log-slower-than", "-1")
+	c.expect("+OK\r\n", "slowlog", "reset")
+	c.expect("+PONG\r\n", "ping")
+	c.expect(":0\r\n", "slowlog", "len")
+	c.expect("*0\r\n", "slowlog", "get")
+	// 只记录超过阈值的命令
+	c.expect("+OK\r\n", "config", "set", "slowlog-log-slower-than", "1000000")
+	c.expect("+PONG\r\n", "ping")
+	c.expect(":0\r\n", "slowlog", "len")
+}
+
+// 修改slowlog-max-len后立即丢弃多余的旧记录
+func TestSlowLog_MaxLenTrim(t *testing.T) {
+	restoreConfig(t, "slowlog-log-slower-than", "slowlog-max-len")
+	c := newTestClient(t, newTestServer(t))
+	c.expect("+OK\r\n", "config", "set", "slowlog-max-len", "128")
+	c.expect("+OK\r\n", "config", "set", "slowlog-log-slower-than", "0")
+	for i := 0; i < 10; i++ {
+		c.expect("+OK\r\n", "set", "k", strconv.Itoa(i))
+	}
+	c.expect(":11\r\n", "slowlog", "len")
+	c.expect("+OK\r\n", "config", "set", "slowlog-max-len", "3")
+	c.expect(":3\r\n", "slowlog", "len")
+	// 保留最近的记录：slowlog len、config set、slowlog len
+	expectMatch(c, `^\*3\r\n\*6\r\n(?s:.*)\*4\r\n\$6\r\nconfig\r\n\$3\r\nset\r\n\$15\r\nslowlog-max-len\r\n\$1\r\n3\r\n`, "slowlog", "get", "-1")
+	for i := 0; i < 10; i++ {
+		c.expect("+OK\r\n", "set", "k", strconv.Itoa(i))
+	}
+	c.expect(":3\r\n", "slowlog", "len")
+	c.expect("+OK\r\n", "config", "set", "slowlog-max-len", "0")
+	c.expect(":0\r\n", "slowlog", "len")
+}
+
+// LATENCY LATEST返回超过latency-monitor-threshold的事件，LATENCY RESET清除
+func TestLatency_LatestReset(t *testing.T) {
+	restoreConfig(t, "latency-monitor-threshold")
+	c := newTestClient(t, newTestServer(t))
+	c.expect("+OK\r\n", "config", "set", "latency-monitor-threshold", "100")
+	c.do("latency", "reset")
+	c.expect("+PONG\r\n", "ping")
+	c.expect("*0\r\n", "latency", "latest")
+	c.expect("+sleep over\r\n", "sleep", "1")
+	match := expectMatch(c, `^\*1\r\n\*4\r\n\$7\r\ncommand\r\n:\d+\r\n:(\d+)\r\n:(\d+)\r\n$`, "latency", "latest")
+	for _, ms := range match[1:] {
+		if n, _ := strconv.Atoi(ms); n < 1000 {
+			t.Fatalf("latency: got %dms, want >= 1000ms", n)
+		}
+	}
+	c.expect(":0\r\n", "latency", "reset", "nosuchevent")
+	c.expect(":1\r\n", "latency", "reset", "command")
+	c.expect("*0\r\n", "latency", "latest")
+	// 为0时关闭
+	c.expect("+OK\r\n", "config", "set", "latency-monitor-threshold", "0")
+	c.expect("+sleep over\r\n", "sleep", "1")
+	c.expect("*0\r\n", "latency", "latest")
+}
@@ -6,33 +6,57 @@ import (
 	_type "go-redis/interface/type"
 	"go-redis/redis/utils"
 	Reply "go-redis/resp/reply"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 )
 
 func init() {
-	RegisterSysCommand("sleep", execSleep, 2) // sleep，用于测试
-	RegisterSysCommand("auth", execAuth, 2)
-	RegisterSysCommand("ping", execPing, -1)
-	RegisterSysCommand("config", execConfig, -2)
-	RegisterSysCommand("select", execSelect, 2)
-
-	RegisterSysCommand("flushdb", execFlushDB, 1)
-	RegisterSysCommand("flushall", execFlushAll, 1)
-
-	RegisterSysCommand("subscribe", execSubscribe, -2)
-	RegisterSysCommand("unsubscribe", execUnSubscribe, 1)
-	RegisterSysCommand("publish", execPublish, 3)
-
-	RegisterSysCommand("rewriteaof", execReWriteAOF, 1)     // aof重写
-	RegisterSysCommand("bgrewriteaof", execBGReWriteAOF, 1) // 异步aof重写
-
-	RegisterSysCommand("multi", execMulti, 1)     // 开启事务
-	RegisterSysCommand("exec", execExec, 1)       // 执行事务
-	RegisterSysCommand("discard", execDiscard, 1) // 退出事务
-	RegisterSysCommand("watch", execWatch, -2)
-	RegisterSysCommand("unwatch", execUnWatch, 1)
+	RegisterSysCommand("sleep", execSleep, 2, CatAdmin, CatDangerous) // sleep，用于测试
+	RegisterSysCommand("auth", execAuth, -2, CatConnection).SetFlags(FlagNoAuth, FlagLoading, FlagStale)
+	RegisterSysCommand("ping", execPing, -1, CatConnection)
+	RegisterSysCommand("hello", execHello, -1, CatConnection).SetFlags(FlagNoAuth, FlagLoading, FlagStale)
+	RegisterSysCommand("config", execConfig, -2, CatAdmin, CatDangerous)
+	RegisterSysCommand("select", execSelect, 2, CatConnection)
+	RegisterSysCommand("acl", execACL, -2, CatAdmin, CatDangerous)
+	RegisterSysCommand("client", execClient, -2, CatConnection).
+		SetSubcommand("kill", -3, CatAdmin, CatDangerous, CatConnection).
+		SetSubcommand("pause", -3, CatAdmin, CatDangerous, CatConnection).
+		SetSubcommand("unpause", 2, CatAdmin, CatDangerous, CatConnection).
+		SetSubcommand("no-evict", 3, CatAdmin, CatDangerous, CatConnection).
+		SetSubcommand("unblock", -3, CatAdmin, CatDangerous, CatConnection)
+	RegisterSysCommand("info", execInfo, -1, CatAdmin, CatDangerous)
+	RegisterSysCommand("slowlog", execSlowLog, -2, CatAdmin, CatDangerous)
+	RegisterSysCommand("latency", execLatency, -2, CatAdmin, CatDangerous)
+	RegisterSysCommand("monitor", execMonitor, 1, CatAdmin, CatDangerous)
+	RegisterSysCommand("command", execCommands, -1, CatConnection).SetFlags(FlagLoading, FlagStale)
+
+	RegisterSysCommand("flushdb", execFlushDB, -1, CatKeyspace, CatWrite, CatDangerous)
+	RegisterSysCommand("flushall", execFlushAll, -1, CatKeyspace, CatWrite, CatDangerous)
+
+	RegisterSysCommand("subscribe", execSubscribe, -2, CatPubsub)
+	RegisterSysCommand("unsubscribe", execUnSubscribe, -1, CatPubsub)
+	RegisterSysCommand("publish", execPublish, 3, CatPubsub)
+
+	RegisterSysCommand("rewriteaof", execReWriteAOF, 1, CatAdmin, CatDangerous)     // aof重写
+	RegisterSysCommand("bgrewriteaof", execBGReWriteAOF, 1, CatAdmin, CatDangerous) // 异步aof重写
+
+	RegisterSysCommand("multi", execMulti, 1, CatTransaction).SetFlags(FlagNoMulti) // 开启事务
+	RegisterSysCommand("exec", execExec, 1, CatTransaction)                         // 执行事务
+	RegisterSysCommand("discard", execDiscard, 1, CatTransaction)                   // 退出事务
+	RegisterSysCommand("watch", execWatch, -2, CatTransaction).SetKeys(utils.ReadAll).SetFlags(FlagNoMulti)
+	RegisterSysCommand("unwatch", execUnWatch, 1, CatTransaction)
+	RegisterSysCommand("reset", execReset, 1, CatConnection).SetFlags(FlagNoAuth, FlagLoading, FlagStale)
+
+	RegisterSysCommand("eval", execEval, -3, CatScripting).SetKeys(utils.NumKeys)
+	RegisterSysCommand("eval_ro", execEvalRO, -3, CatScripting).SetKeys(utils.NumKeys)
+	RegisterSysCommand("evalsha", execEvalSha, -3, CatScripting).SetKeys(utils.NumKeys)
+	RegisterSysCommand("evalsha_ro", execEvalShaRO, -3, CatScripting).SetKeys(utils.NumKeys)
+	RegisterSysCommand("script", execScript, -2, CatScripting)
+	RegisterSysCommand("fcall", execFCall, -3, CatScripting).SetKeys(utils.NumKeys)
+	RegisterSysCommand("fcall_ro", execFCallRO, -3, CatScripting).SetKeys(utils.NumKeys)
+	RegisterSysCommand("function", execFunction, -2, CatScripting)
 }
 
 func execSleep(server *Server, client _interface.Client, args _type.Args) _interface.Reply {
@@ -57,16 +81,60 @@ func execPing(server *Server, client _interface.Client, args _type.Args) _interf
 	return Reply.ArgNumError("Ping")
 }
 
-func execAuth(server *Server, client _interface.Client, args _type.Args) _interface.Reply {
-	if Config.Requirepass == "" {
-		return Reply.StandardError("no password is set.")
+// hello [protover [AUTH username password] [SETNAME clientname]]
+func execHello(server *Server, client _interface.Client, args _type.Args) _interface.Reply {
+	protocol := client.GetProtocol()
+	if len(args) > 0 {
+		ver, err := strconv.Atoi(string(args[0]))
+		if err != nil {
+			return Reply.StandardError("Protocol version is not an integer or out of range")
+		}
+		if ver != 2 && ver != 3 {
+			return Reply.StandardError("NOPROTO unsupported protocol version")
+		}
+		protocol = ver
 	}
-	password := string(args[0])
-	client.SetPassword(password)
-	if password != Config.Requirepass {
-		return Reply.StandardError("invalid password.")
+	var username, password, name string
+	authed, named := false, false
+	for i := 1; i < len(args); i++ {
+		opt := strings.ToLower(string(args[i]))
+		switch {
+		case opt == "auth" && i+2 < len(args):
+			username, password = string(args[i+1]), string(args[i+2])
+			authed = true
+			i += 2
+		case opt == "setname" && i+1 < len(args):
+			name = string(args[i+1])
+			named = true
+			i++
+		default:
+			return Reply.StandardError("Syntax error in HELLO option '" + string(args[i]) + "'")
+		}
 	}
-	return Reply.NewOkReply()
+	if authed {
+		if !server.acl.Authenticate(client, username, password) {
+			return Reply.StandardError("WRONGPASS invalid username-password pair or user is disabled.")
+		}
+		client.SetUser(username)
+	} else if server.acl.CurrentUser(client) == nil {
+		return Reply.StandardError("NOAUTH HELLO must be called with the client already authenticated, otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client and select the RESP protocol version at the same time")
+	}
+	if named {
+		if !validClientName(name) {
+			return Reply.StandardError("Client names cannot contain spaces, newlines or special characters.")
+		}
+		client.SetName(name)
+	}
+	client.SetProtocol(protocol)
+	return Reply.NewMapReply([]_interface.Reply{
+		Reply.StringToBulkReply("server"), Reply.StringToBulkReply("redis"),
+		Reply.StringToBulkReply("version"), Reply.StringToBulkReply(RedisVersion),
+		Reply.StringToBulkReply("proto"), Reply.NewIntegerReply(int64(protocol)),
+		Reply.StringToBulkReply("id"), Reply.NewIntegerReply(client.GetId()),
+		Reply.StringToBulkReply("mode"), Reply.StringToBulkReply("standalone"),
+		Reply.StringToBulkReply("role"), Reply.StringToBulkReply("master"),
+		Reply.StringToBulkReply("modules"), Reply.NewEmptyArrayReply(),
+	})
 }
 
 func execSelect(server *Server, client _interface.Client, args _type.Args) _interface.Reply {
@@ -86,44 +154,107 @@ func execSelect(server *Server, client _interface.Client, args _type.Args) _inte
 
 func execConfig(server *Server, client _interface.Client, args _type.Args) _interface.Reply {
 	cmd := strings.ToLower(string(args[0]))
-	if cmd == "get" {
+	switch cmd {
+	case "get":
 		return execConfigGet(server, client, args)
-	}
-	if cmd == "set" {
+	case "set":
 		return execConfigSet(server, client, args)
+	case "rewrite":
+		if len(args) != 1 {
+			return Reply.ArgNumError("config|rewrite")
+		}
+		if err := rewriteConfig(ConfigFile); err != nil {
+			return Reply.StandardError("Rewriting config file: " + err.Error())
+		}
+		return Reply.NewOkReply()
+	case "resetstat":
+		if len(args) != 1 {
+			return Reply.ArgNumError("config|resetstat")
+		}
+		server.resetStats()
+		return Reply.NewOkReply()
 	}
 	return Reply.StandardError(fmt.Sprintf("unknown subcommand '%s'", cmd))
 }
 
+// config get parameter [parameter ...]，parameter支持glob风格的通配符
 func execConfigGet(server *Server, client _interface.Client, args _type.Args) _interface.Reply {
 	num := len(args)
 	if num < 2 {
 		return Reply.ArgNumError("config|get")
 	}
-	var result []string
-	for i := 1; i < num; i++ {
-		key := strings.ToLower(string(args[i]))
-		val, ok := GetConfig(key)
-		if !ok {
-			continue
+	matched := make(map[string]bool)
+	var result []_interface.Reply
+	for _, option := range sortedConfigOptions() {
+		for i := 1; i < num; i++ {
+			pattern := strings.ToLower(string(args[i]))
+			if !utils.MatchPattern(pattern, option.name) && option.alias != pattern {
+				continue
+			}
+			if !matched[option.name] {
+				matched[option.name] = true
+				result = append(result, Reply.StringToBulkReply(option.name), Reply.StringToBulkReply(option.value.get()))
+			}
+			break
 		}
-		result = append(result, key)
-		result = append(result, val)
 	}
-	return Reply.StringToArrayReply(result...)
+	return Reply.NewMapReply(result)
 }
 
+// config set parameter value [parameter value ...]，所有参数要么全部生效，要么全部不生效
 func execConfigSet(server *Server, client _interface.Client, args _type.Args) _interface.Reply {
 	num := len(args)
-	if num < 2 || num%2 == 0 {
+	if num < 3 || num%2 == 0 {
 		return Reply.ArgNumError("config|set")
 	}
-	for i := 0; i < num/2; i++ {
-		key := strings.ToLower(string(args[2*i+1]))
-		val := strings.ToLower(string(args[2*i+2]))
-		err := SetConfig(key, val)
-		if err != nil {
-			return Reply.StandardError(err.Error())
+	type change struct {
+		option *configOption
+		old    string
+	}
+	changes := make([]change, 0, num/2)
+	// 出错时回滚已修改的配置项
+	rollback := func() {
+		for i := len(changes) - 1; i >= 0; i-- {
+			_ = changes[i].option.value.set(changes[i].old)
+		}
+	}
+	for i := 1; i < num; i += 2 {
+		name := string(args[i])
+		option, ok := lookupConfig(name)
+		if !ok {
+			rollback()
+			return Reply.StandardError(fmt.Sprintf("Unknown option or number of arguments for CONFIG SET - '%s'", name))
+		}
+		for _, c := range changes {
+			if c.option == option {
+				rollback()
+				return Reply.StandardError(fmt.Sprintf("CONFIG SET failed (possibly related to argument '%s') - duplicate parameter", name))
+			}
+		}
+		if option.immutable {
+			rollback()
+			return Reply.StandardError(fmt.Sprintf("CONFIG SET failed (possibly related to argument '%s') - can't set immutable config", name))
+		}
+		old := option.value.get()
+		if err := option.value.set(string(args[i+1])); err != nil {
+			rollback()
+			return Reply.StandardError(fmt.Sprintf("CONFIG SET failed (possibly related to argument '%s') - %s", name, err.Error()))
+		}
+		changes = append(changes, change{option, old})
+	}
+	// 使修改生效，出错时回滚配置并重新应用已生效的修改
+	applied := make(map[*configOption]bool)
+	for _, c := range changes {
+		if c.option.apply == nil || applied[c.option] {
+			continue
+		}
+		applied[c.option] = true
+		if err := c.option.apply(server); err != nil {
+			rollback()
+			for option := range applied {
+				_ = option.apply(server)
+			}
+			return Reply.StandardError(fmt.Sprintf("CONFIG SET failed (possibly related to argument '%s') - %s", c.option.name, err.Error()))
 		}
 	}
 	return Reply.NewOkReply()
@@ -131,22 +262,64 @@ func execConfigSet(server *Server, client _interface.Client, args _type.Args) _i
 
 /* ---- flush ---- */
 
+// 检查flushdb、flushall的ASYNC|SYNC选项，两者行为相同：数据从数据库中分离后由GC回收
+func checkFlushMode(args _type.Args) _interface.Reply {
+	if len(args) == 0 {
+		return nil
+	}
+	if len(args) == 1 {
+		switch strings.ToLower(string(args[0])) {
+		case "async", "sync":
+			return nil
+		}
+	}
+	return Reply.SyntaxError()
+}
+
+// FLUSHDB [ASYNC|SYNC]
 func execFlushDB(server *Server, client _interface.Client, args _type.Args) _interface.Reply {
+	if errReply := checkFlushMode(args); errReply != nil {
+		return errReply
+	}
 	dbIdx := client.GetSelectDB()
+	// 为整个数据库加锁，等待正在执行的命令及事务结束，事务中已由exec加锁
+	if !client.IsTxState() {
+		locks := server.lockDBs(func(locks *dbKeyLocks) {
+			locks.add(server, dbIdx, true, nil, nil)
+		})
+		defer locks.unlock()
+	}
 	db := server.getDatabase(dbIdx)
+	server.watcher.TouchAll(dbIdx, db.Exists)
 	db.Flush()
-	db.ToAOF(utils.ToCmd("flushdb", []byte(strconv.Itoa(dbIdx))))
+	server.clientDatabase(client, dbIdx).ToAOF(utils.ToCmd("flushdb", []byte(strconv.Itoa(dbIdx))))
+	server.tracking.InvalidateAll()
 	return Reply.NewOkReply()
 }
 
+// FLUSHALL [ASYNC|SYNC]
 func execFlushAll(server *Server, client _interface.Client, args _type.Args) _interface.Reply {
+	if errReply := checkFlushMode(args); errReply != nil {
+		return errReply
+	}
+	// 为所有数据库加锁，事务中已由exec加锁
+	if !client.IsTxState() {
+		locks := server.lockDBs(func(locks *dbKeyLocks) {
+			for i := 0; i < len(server.databases); i++ {
+				locks.add(server, i, true, nil, nil)
+			}
+		})
+		defer locks.unlock()
+	}
 	for i := 0; i < len(server.databases); i++ {
-		db := server.databases[i].Load().(*Database)
+		db := server.getDatabase(i)
+		server.watcher.TouchAll(i, db.Exists)
 		db.Flush()
 		if i == 0 {
-			db.ToAOF(utils.ToCmd("flushall"))
+			server.clientDatabase(client, i).ToAOF(utils.ToCmd("flushall"))
 		}
 	}
+	server.tracking.InvalidateAll()
 	return Reply.NewOkReply()
 }
 
@@ -201,19 +374,18 @@ func execWatch(server *Server, client _interface.Client, args _type.Args) _inter
 	if client.IsTxState() {
 		return Reply.StandardError("WATCH inside MULTI is not allowed")
 	}
-	client.InitWatch(server.dataBaseCount())
 	dbIdx := client.GetSelectDB()
 	db := server.getDatabase(dbIdx)
 	for i := 0; i < len(args); i++ {
 		key := string(args[i])
-		version := db.GetVersion(key)
-		client.SetWatchKey(dbIdx, key, version)
+		client.SetWatchKey(dbIdx, key, db.IsExpired(key))
+		server.watcher.Watch(client, dbIdx, key)
 	}
 	return Reply.NewOkReply()
 }
 
 func execUnWatch(server *Server, client _interface.Client, args _type.Args) _interface.Reply {
-	client.DestroyWatch()
+	server.watcher.UnwatchAll(client)
 	return Reply.NewOkReply()
 }
 
@@ -229,42 +401,201 @@ func execExec(server *Server, client _interface.Client, args _type.Args) _interf
 	if !client.IsTxState() {
 		return Reply.StandardError("EXEC without MULTI")
 	}
-	// 执行事务期间禁止server执行其他命令
-	server.SetTxing(true)
-	defer server.SetTxing(false)
 	// 解除client事务状态，并清空txQueue和txWatch
 	defer client.SetTxState(false)
 	defer client.ClearTxQueue()
-	defer client.DestroyWatch()
-	// 检查被watch的keys是否被更改
-	for i, keys := range client.GetWatchKeys() {
-		db := server.getDatabase(i)
-		for key, version := range keys {
-			currVersion := db.GetVersion(key)
-			if version != currVersion {
-				return Reply.NewNilBulkReply() // 已被修改，放弃事务执行
-			}
-		}
-	}
-	// 检查是否存在错误，有错误则不拒绝执行事务
+	defer server.watcher.UnwatchAll(client)
+	// 与redis一致，入队时存在错误(如命令不存在、参数个数错误)时拒绝执行事务，即使被watch的key已被修改
 	if len(client.GetTxError()) > 0 {
 		return Reply.StandardError("EXECABORT Transaction discarded because of previous errors.")
 	}
-	// 执行
+	// 为事务涉及的key加锁，其他client对这些key的命令需等待事务执行完毕，其余命令不受影响
 	cmdLines := client.GetTxQueue()
+	locks := server.txLocks(client, cmdLines)
+	for !locks.lock() {
+		locks = server.txLocks(client, cmdLines) // 等待加锁期间数据库被swapdb交换，重新计算
+	}
+	defer locks.unlock()
+	// 检查被watch的keys是否被修改、删除或过期
+	if client.IsWatchDirty() || server.watchedKeyExpired(client) {
+		return Reply.NewNilBulkReply() // 已被修改，放弃事务执行
+	}
+	// 事务中的写命令先缓存，执行完毕后以MULTI/EXEC包裹写入aof，在解锁前写入以保证与其他client的命令顺序一致
+	var aofCmds []aofCmd
+	if server.persister != nil {
+		client.SetTxAOF(func(dbIdx int, cmdLine _type.CmdLine) {
+			aofCmds = append(aofCmds, aofCmd{cmdLine: cmdLine, dbIdx: dbIdx})
+		})
+	}
+	// 执行，与redis一致，某条命令执行出错不影响其他命令，错误作为该命令的回复返回
 	replies := make([]_interface.Reply, 0, len(cmdLines))
 	for _, cmdLine := range cmdLines {
-		reply := server.ExecForTX(client, cmdLine) // 执行当前命令（无需加锁）
+		reply := server.ExecForTX(client, cmdLine) // 执行当前命令（已加锁）
 		replies = append(replies, reply)
 	}
+	if server.persister != nil {
+		client.SetTxAOF(nil)
+		server.persister.ToAOFTx(aofCmds)
+	}
 	return Reply.NewRawArrayReply(replies)
 }
+
+// watchedKeyExpired watch的key在watch之后已过期，但还未被删除
+func (server *Server) watchedKeyExpired(client _interface.Client) bool {
+	for dbIdx, keys := range client.GetWatchKeys() {
+		db := server.getDatabase(dbIdx)
+		for key, expired := range keys {
+			if !expired && db.IsExpired(key) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// dbKeyLocks 多个数据库中需要加锁的key，用于事务及跨数据库的命令
+type dbKeyLocks struct {
+	idxs      []int // 数据库编号
+	dbs       []*Database
+	all       []bool // 是否为整个数据库加锁，用于swapdb、flushdb、flushall
+	writeKeys [][]string
+	readKeys  [][]string
+}
+
+// add 添加一个数据库中需要加锁的key，每个编号只添加一次
+func (locks *dbKeyLocks) add(server *Server, dbIdx int, all bool, writeKeys []string, readKeys []string) {
+	locks.idxs = append(locks.idxs, dbIdx)
+	locks.dbs = append(locks.dbs, server.getDatabase(dbIdx))
+	locks.all = append(locks.all, all)
+	locks.writeKeys = append(locks.writeKeys, writeKeys)
+	locks.readKeys = append(locks.readKeys, readKeys)
+}
+
+// txLocks 计算事务中所有命令涉及的key，以及被watch的key，队列中的select会改变之后命令所在的数据库
+func (server *Server) txLocks(client _interface.Client, cmdLines []_type.CmdLine) *dbKeyLocks {
+	dbNum := server.dataBaseCount()
+	writeKeys := make([][]string, dbNum)
+	readKeys := make([][]string, dbNum)
+	all := make([]bool, dbNum)
+	// 被watch的key加读锁，使检查与执行之间key不会被修改
+	for dbIdx, keys := range client.GetWatchKeys() {
+		for key := range keys {
+			readKeys[dbIdx] = append(readKeys[dbIdx], key)
+		}
+	}
+	dbIdx := client.GetSelectDB()
+	for _, cmdLine := range cmdLines {
+		name := strings.ToLower(string(cmdLine[0]))
+		if name == "select" {
+			if idx, err := strconv.Atoi(string(cmdLine[1])); err == nil && idx >= 0 && idx < dbNum {
+				dbIdx = idx
+			}
+			continue
+		}
+		meta, ok := lookupCommand(name)
+		if !ok || meta.keysFind.Find == nil {
+			continue
+		}
+		wKeys, rKeys := meta.keysFind.Find(_type.Args(cmdLine[1:]))
+		writeKeys[dbIdx] = append(writeKeys[dbIdx], wKeys...)
+		readKeys[dbIdx] = append(readKeys[dbIdx], rKeys...)
+		// 涉及其他数据库的命令
+		switch name {
+		case "move", "copy":
+			if target, key, ok := targetDBKey(name, cmdLine, dbNum); ok {
+				writeKeys[target] = append(writeKeys[target], key)
+			}
+		case "swapdb":
+			for _, arg := range cmdLine[1:] {
+				if idx, err := strconv.Atoi(string(arg)); err == nil && idx >= 0 && idx < dbNum {
+					all[idx] = true
+				}
+			}
+		case "flushdb":
+			all[dbIdx] = true
+		case "flushall":
+			for i := range all {
+				all[i] = true
+			}
+		}
+	}
+	locks := &dbKeyLocks{}
+	for i := 0; i < dbNum; i++ {
+		if len(writeKeys[i]) == 0 && len(readKeys[i]) == 0 && !all[i] {
+			continue
+		}
+		locks.add(server, i, all[i], writeKeys[i], readKeys[i])
+	}
+	return locks
+}
+
+// lock 按数据库唯一标识的顺序加锁，同一数据库中的key由Locker按固定顺序加锁，避免死锁
+// swapdb会改变数据库的编号，按编号排序时，交换前后获取数据库的两个client可能以相反的顺序加锁
+// 加锁后若发现数据库已被swapdb交换到其他编号，则解锁并返回false，调用方需重新获取数据库
+func (locks *dbKeyLocks) lock() bool {
+	order := make([]int, len(locks.dbs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool {
+		return locks.dbs[order[a]].id < locks.dbs[order[b]].id
+	})
+	for i := 1; i < len(order); i++ {
+		// 获取各编号的数据库之间发生了swapdb，同一数据库出现两次
+		if locks.dbs[order[i]] == locks.dbs[order[i-1]] {
+			return false
+		}
+	}
+	for _, i := range order {
+		if locks.all[i] {
+			locks.dbs[i].lockAll()
+		} else {
+			locks.dbs[i].lockKeys(locks.writeKeys[i], locks.readKeys[i])
+		}
+	}
+	for i, db := range locks.dbs {
+		if db.index() != locks.idxs[i] {
+			locks.unlock()
+			return false
+		}
+	}
+	return true
+}
+
+func (locks *dbKeyLocks) unlock() {
+	for i := len(locks.dbs) - 1; i >= 0; i-- {
+		if locks.all[i] {
+			locks.dbs[i].unLockAll()
+		} else {
+			locks.dbs[i].unLockKeys(locks.writeKeys[i], locks.readKeys[i])
+		}
+	}
+}
+
+// execReset 重置连接的状态：退出事务并取消watch，关闭client tracking，退出monitor，取消所有订阅，
+// 选择0号数据库，恢复RESP2协议、client reply on及默认的名称，并取消认证
+func execReset(server *Server, client _interface.Client, args _type.Args) _interface.Reply {
+	client.SetTxState(false)
+	client.ClearTxQueue()
+	server.watcher.UnwatchAll(client)
+	server.tracking.Disable(client)
+	server.monitor.Remove(client)
+	server.pubsub.RemoveClient(client)
+	client.SetSelectDB(0)
+	client.SetProtocol(2)
+	client.SetName("")
+	client.SetReplyMode("on")
+	client.SetNoEvict(false)
+	client.SetUser("")
+	return Reply.NewStringReply("RESET")
+}
+
 func execDiscard(server *Server, client _interface.Client, args _type.Args) _interface.Reply {
 	if !client.IsTxState() {
 		return Reply.StandardError("DISCARD without MULTI")
 	}
 	client.SetTxState(false)
 	client.ClearTxQueue()
-	client.DestroyWatch()
+	server.watcher.UnwatchAll(client)
 	return Reply.NewOkReply()
 }
@@ -0,0 +1,167 @@
+package redis
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	_interface "go-redis/interface"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// tls-auth-clients的取值
+const (
+	TLSAuthNo       = "no"
+	TLSAuthOptional = "optional"
+	TLSAuthYes      = "yes"
+)
+
+// tlsProtocols tls-protocols中可用的协议版本
+var tlsProtocols = map[string]uint16{
+	"tlsv1":   tls.VersionTLS10,
+	"tlsv1.1": tls.VersionTLS11,
+	"tlsv1.2": tls.VersionTLS12,
+	"tlsv1.3": tls.VersionTLS13,
+}
+
+// 当前生效的tls配置，证书等重新加载后被替换，已建立的连接不受影响
+var tlsConfig atomic.Value
+
+// TLSConfig 返回用于tls listener的配置，每个新连接都会使用最新加载的证书及配置
+func TLSConfig() *tls.Config {
+	return &tls.Config{
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			config, ok := tlsConfig.Load().(*tls.Config)
+			if !ok {
+				return nil, errors.New("TLS is not configured")
+			}
+			return config, nil
+		},
+	}
+}
+
+// LoadTLS 根据tls-*配置项加载证书并生成tls配置，加载失败时保持原有配置
+func LoadTLS() error {
+	config, err := buildTLSConfig()
+	if err != nil {
+		return err
+	}
+	tlsConfig.Store(config)
+	return nil
+}
+
+func buildTLSConfig() (*tls.Config, error) {
+	if Config.TlsCertFile == "" || Config.TlsKeyFile == "" {
+		return nil, errors.New("tls-cert-file and tls-key-file must be specified")
+	}
+	cert, err := tls.LoadX509KeyPair(Config.TlsCertFile, Config.TlsKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load certificate: %s", err.Error())
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	// 客户端证书
+	switch Config.TlsAuthClients {
+	case TLSAuthNo:
+		config.ClientAuth = tls.NoClientCert
+	case TLSAuthOptional:
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	default:
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	if Config.TlsCaCertFile != "" {
+		pem, err := os.ReadFile(Config.TlsCaCertFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load CA certificate: %s", err.Error())
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("failed to load CA certificate: no certificate found in '%s'", Config.TlsCaCertFile)
+		}
+		config.ClientCAs = pool
+	} else if config.ClientAuth != tls.NoClientCert {
+		return nil, errors.New("tls-ca-cert-file must be specified when tls-auth-clients is enabled")
+	}
+	// 协议版本
+	if Config.TlsProtocols != "" {
+		config.MinVersion, config.MaxVersion, err = parseTLSProtocols(Config.TlsProtocols)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// 加密套件，只对TLSv1.2及以下的版本有效
+	if Config.TlsCiphers != "" {
+		config.CipherSuites, err = parseTLSCiphers(Config.TlsCiphers)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return config, nil
+}
+
+// 解析形如"TLSv1.2 TLSv1.3"的协议列表，返回最低和最高版本
+func parseTLSProtocols(protocols string) (uint16, uint16, error) {
+	var min, max uint16
+	for _, name := range strings.Fields(protocols) {
+		version, ok := tlsProtocols[strings.ToLower(name)]
+		if !ok {
+			return 0, 0, fmt.Errorf("invalid tls-protocols '%s'", name)
+		}
+		if min == 0 || version < min {
+			min = version
+		}
+		if version > max {
+			max = version
+		}
+	}
+	if min == 0 {
+		return 0, 0, errors.New("tls-protocols must not be empty")
+	}
+	return min, max, nil
+}
+
+// 解析以冒号或空格分隔的加密套件名称，如TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256
+func parseTLSCiphers(ciphers string) ([]uint16, error) {
+	suites := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		suites[suite.Name] = suite.ID
+	}
+	ids := make([]uint16, 0)
+	for _, name := range strings.FieldsFunc(ciphers, func(r rune) bool { return r == ':' || r == ' ' }) {
+		id, ok := suites[strings.ToUpper(name)]
+		if !ok {
+			return nil, fmt.Errorf("invalid tls-ciphers '%s'", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// applyTLS 修改tls相关配置后重新加载证书，加载失败时修改被回滚
+func applyTLS(server *Server) error {
+	if Config.TlsPort <= 0 {
+		return nil // 未开启tls
+	}
+	return LoadTLS()
+}
+
+// certUser 返回客户端证书的CN对应的ACL用户，tls-auth-clients-user为CN时生效
+func (server *Server) certUser(client _interface.Client) (string, bool) {
+	if !strings.EqualFold(Config.TlsAuthClientsUser, "cn") {
+		return "", false
+	}
+	state := client.TLSConnectionState()
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return "", false
+	}
+	name := state.PeerCertificates[0].Subject.CommonName
+	user, ok := server.acl.GetUser(name)
+	if !ok || !user.enabled {
+		return "", false
+	}
+	return name, true
+}
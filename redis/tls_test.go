@@ -0,0 +1,285 @@
+package redis
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testCert 进程内生成的证书，parent为nil时为自签名证书(CA)
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+func newTestCert(t *testing.T, cn string, serial int64, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+// 将证书和私钥写入文件，返回文件路径
+func (c *testCert) writeFiles(t *testing.T, dir string, name string) (string, string) {
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	keyDer, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.der}, PrivateKey: c.key}
+}
+
+// 准备CA及服务端证书，并设置tls相关的配置项，测试结束后恢复
+func setupTLS(t *testing.T, authClients string) (*testCert, string) {
+	saved := *Config
+	t.Cleanup(func() {
+		*Config = saved
+		tlsConfig = atomic.Value{}
+	})
+	dir := t.TempDir()
+	ca := newTestCert(t, "test-ca", 1, nil)
+	caFile, _ := ca.writeFiles(t, dir, "ca")
+	server := newTestCert(t, "server", 2, ca)
+	Config.TlsCertFile, Config.TlsKeyFile = server.writeFiles(t, dir, "server")
+	Config.TlsCaCertFile = caFile
+	Config.TlsAuthClients = authClients
+	Config.TlsProtocols = ""
+	Config.TlsCiphers = ""
+	if err := LoadTLS(); err != nil {
+		t.Fatal(err)
+	}
+	return ca, dir
+}
+
+// handshake 通过本地的tcp连接进行tls握手，返回服务端及客户端的连接
+// TLSv1.3中客户端先于服务端完成握手，服务端拒绝客户端证书时，客户端需要读取才能发现错误
+func handshake(t *testing.T, clientConfig *tls.Config) (*tls.Conn, *tls.Conn, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	clientSide, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverSide, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConn := tls.Server(serverSide, TLSConfig())
+	clientConn := tls.Client(clientSide, clientConfig)
+	t.Cleanup(func() {
+		_ = serverConn.Close()
+		_ = clientConn.Close()
+	})
+	_ = serverConn.SetDeadline(time.Now().Add(5 * time.Second))
+	_ = clientConn.SetDeadline(time.Now().Add(5 * time.Second))
+	errCh := make(chan error, 1)
+	go func() {
+		err := clientConn.Handshake()
+		if err == nil {
+			_, err = clientConn.Read(make([]byte, 1)) // 等待服务端的alert或数据
+		} else {
+			_ = clientConn.Close()
+		}
+		errCh <- err
+	}()
+	if err = serverConn.Handshake(); err != nil {
+		<-errCh
+		return nil, nil, err
+	}
+	_, _ = serverConn.Write([]byte{'+'})
+	if err = <-errCh; err != nil {
+		return nil, nil, err
+	}
+	return serverConn, clientConn, nil
+}
+
+func clientConfigFor(ca *testCert, cert *testCert) *tls.Config {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	config := &tls.Config{RootCAs: pool, ServerName: "127.0.0.1"}
+	if cert != nil {
+		// 总是发送证书，即使不是由服务端接受的CA签发的
+		certificate := cert.tlsCertificate()
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return &certificate, nil
+		}
+	}
+	return config
+}
+
+func TestTLS_RequireClientCert(t *testing.T) {
+	ca, _ := setupTLS(t, TLSAuthYes)
+	// 没有客户端证书
+	if _, _, err := handshake(t, clientConfigFor(ca, nil)); err == nil {
+		t.Fatal("handshake without client certificate should fail")
+	}
+	// 客户端证书不是由CA签发的
+	other := newTestCert(t, "other-ca", 3, nil)
+	if _, _, err := handshake(t, clientConfigFor(ca, newTestCert(t, "alice", 4, other))); err == nil {
+		t.Fatal("handshake with untrusted client certificate should fail")
+	}
+	// 由CA签发的客户端证书
+	serverConn, _, err := handshake(t, clientConfigFor(ca, newTestCert(t, "alice", 5, ca)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	peers := serverConn.ConnectionState().PeerCertificates
+	if len(peers) == 0 || peers[0].Subject.CommonName != "alice" {
+		t.Fatalf("unexpected peer certificates: %v", peers)
+	}
+}
+
+func TestTLS_OptionalClientCert(t *testing.T) {
+	ca, _ := setupTLS(t, TLSAuthOptional)
+	serverConn, _, err := handshake(t, clientConfigFor(ca, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(serverConn.ConnectionState().PeerCertificates) != 0 {
+		t.Fatal("no client certificate expected")
+	}
+	other := newTestCert(t, "other-ca", 3, nil)
+	if _, _, err = handshake(t, clientConfigFor(ca, newTestCert(t, "alice", 4, other))); err == nil {
+		t.Fatal("handshake with untrusted client certificate should fail")
+	}
+}
+
+func TestTLS_Protocols(t *testing.T) {
+	ca, _ := setupTLS(t, TLSAuthNo)
+	Config.TlsProtocols = "TLSv1.3"
+	if err := LoadTLS(); err != nil {
+		t.Fatal(err)
+	}
+	config := clientConfigFor(ca, nil)
+	config.MaxVersion = tls.VersionTLS12
+	if _, _, err := handshake(t, config); err == nil {
+		t.Fatal("TLSv1.2 should be rejected")
+	}
+	config.MaxVersion = tls.VersionTLS13
+	_, clientConn, err := handshake(t, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version := clientConn.ConnectionState().Version; version != tls.VersionTLS13 {
+		t.Fatalf("expected TLSv1.3, got %x", version)
+	}
+	// 不合法的配置不会替换已加载的配置
+	Config.TlsProtocols = "SSLv3"
+	if err = LoadTLS(); err == nil {
+		t.Fatal("invalid tls-protocols should fail")
+	}
+	if _, _, err = handshake(t, config); err != nil {
+		t.Fatal(err)
+	}
+	Config.TlsProtocols = ""
+	Config.TlsCiphers = "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256:bogus"
+	if err = LoadTLS(); err == nil {
+		t.Fatal("invalid tls-ciphers should fail")
+	}
+}
+
+func TestTLS_Reload(t *testing.T) {
+	ca, dir := setupTLS(t, TLSAuthNo)
+	_, clientConn, err := handshake(t, clientConfigFor(ca, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serial := clientConn.ConnectionState().PeerCertificates[0].SerialNumber.Int64(); serial != 2 {
+		t.Fatalf("expected serial 2, got %d", serial)
+	}
+	// 在原路径上替换证书后重新加载
+	newTestCert(t, "server", 10, ca).writeFiles(t, dir, "server")
+	if err = LoadTLS(); err != nil {
+		t.Fatal(err)
+	}
+	_, clientConn, err = handshake(t, clientConfigFor(ca, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serial := clientConn.ConnectionState().PeerCertificates[0].SerialNumber.Int64(); serial != 10 {
+		t.Fatalf("expected serial 10 after reload, got %d", serial)
+	}
+}
+
+func TestTLS_CertUser(t *testing.T) {
+	ca, _ := setupTLS(t, TLSAuthYes)
+	server := &Server{acl: NewACL()}
+	if err := server.acl.SetUser("alice", []string{"on", "nopass", "+@all"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.acl.SetUser("bob", []string{"off"}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		cn       string
+		mapping  string
+		expected string
+	}{
+		{"alice", "cn", "alice"},
+		{"alice", "off", ""},
+		{"bob", "cn", ""},   // 用户未启用
+		{"carol", "cn", ""}, // 用户不存在
+	}
+	for i, test := range tests {
+		Config.TlsAuthClientsUser = test.mapping
+		serverConn, _, err := handshake(t, clientConfigFor(ca, newTestCert(t, test.cn, int64(20+i), ca)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		user, _ := server.certUser(&Client{conn: serverConn})
+		if user != test.expected {
+			t.Errorf("cn %s, mapping %s: expected user '%s', got '%s'", test.cn, test.mapping, test.expected, user)
+		}
+	}
+}
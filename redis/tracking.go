@@ -0,0 +1,472 @@
+package redis
+
+import (
+	_interface "go-redis/interface"
+	_type "go-redis/interface/type"
+	Reply "go-redis/resp/reply"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 以RESP2协议重定向时，失效消息发送到该channel
+const invalidateChannel = "__redis__:invalidate"
+
+// trackingState 一个开启了tracking的client的状态
+type trackingState struct {
+	client   _interface.Client
+	redirect int64               // 失效消息重定向到的client id，0表示不重定向
+	bcast    bool                // 广播模式，按前缀而非读取过的key发送失效消息
+	prefixes []string            // 广播模式下订阅的前缀
+	optIn    bool                // 只有client caching yes之后的命令读取的key才被记录
+	optOut   bool                // client caching no之后的命令读取的key不被记录
+	noLoop   bool                // 不接收自身修改导致的失效消息
+	caching  string              // client caching设置的值，yes或no，只对下一条命令有效
+	broken   bool                // 重定向的client已断开
+	keys     map[string]struct{} // 失效表中记录的该client读取过的key，关闭tracking时从失效表中清除
+}
+
+// 是否记录当前命令读取的key
+func (state *trackingState) shouldTrack() bool {
+	switch {
+	case state.bcast:
+		return false
+	case state.optIn:
+		return state.caching == "yes"
+	case state.optOut:
+		return state.caching != "no"
+	}
+	return true
+}
+
+// Tracking 服务端的失效表，记录key被哪些client读取过
+type Tracking struct {
+	server   *Server
+	clients  map[int64]*trackingState
+	keys     map[string]map[int64]struct{} // key -> client ids
+	prefixes map[string]map[int64]struct{} // 广播模式的前缀 -> client ids
+	lock     sync.Mutex
+}
+
+func NewTracking(server *Server) *Tracking {
+	return &Tracking{
+		server:   server,
+		clients:  make(map[int64]*trackingState),
+		keys:     make(map[string]map[int64]struct{}),
+		prefixes: make(map[string]map[int64]struct{}),
+	}
+}
+
+// Enable 开启或重新设置client的tracking
+func (tracking *Tracking) Enable(client _interface.Client, state *trackingState) {
+	tracking.lock.Lock()
+	defer tracking.lock.Unlock()
+	id := client.GetId()
+	state.keys = make(map[string]struct{})
+	if old, ok := tracking.clients[id]; ok {
+		state.keys = old.keys
+		tracking.removePrefixes(id, old.prefixes)
+		// 与redis相同，重复开启时保留之前的前缀
+		for _, prefix := range old.prefixes {
+			if !containsString(state.prefixes, prefix) {
+				state.prefixes = append(state.prefixes, prefix)
+			}
+		}
+	}
+	state.client = client
+	tracking.clients[id] = state
+	if state.bcast {
+		if len(state.prefixes) == 0 {
+			state.prefixes = []string{""} // 未指定前缀时匹配所有key
+		}
+		for _, prefix := range state.prefixes {
+			ids, ok := tracking.prefixes[prefix]
+			if !ok {
+				ids = make(map[int64]struct{})
+				tracking.prefixes[prefix] = ids
+			}
+			ids[id] = struct{}{}
+		}
+	}
+}
+
+// Disable 关闭client的tracking，并从失效表中清除该client读取过的key
+func (tracking *Tracking) Disable(client _interface.Client) {
+	tracking.lock.Lock()
+	defer tracking.lock.Unlock()
+	id := client.GetId()
+	state, ok := tracking.clients[id]
+	if !ok {
+		return
+	}
+	tracking.removePrefixes(id, state.prefixes)
+	for key := range state.keys {
+		if ids, ok := tracking.keys[key]; ok {
+			delete(ids, id)
+			if len(ids) == 0 {
+				delete(tracking.keys, key)
+			}
+		}
+	}
+	delete(tracking.clients, id)
+}
+
+func (tracking *Tracking) removePrefixes(id int64, prefixes []string) {
+	for _, prefix := range prefixes {
+		if ids, ok := tracking.prefixes[prefix]; ok {
+			delete(ids, id)
+			if len(ids) == 0 {
+				delete(tracking.prefixes, prefix)
+			}
+		}
+	}
+}
+
+// 返回client的tracking状态的副本
+func (tracking *Tracking) getState(client _interface.Client) (trackingState, bool) {
+	tracking.lock.Lock()
+	defer tracking.lock.Unlock()
+	state, ok := tracking.clients[client.GetId()]
+	if !ok {
+		return trackingState{}, false
+	}
+	return *state, true
+}
+
+// SetCaching 设置client caching的值，只对下一条命令有效
+func (tracking *Tracking) SetCaching(client _interface.Client, value string) {
+	tracking.lock.Lock()
+	defer tracking.lock.Unlock()
+	if state, ok := tracking.clients[client.GetId()]; ok {
+		state.caching = value
+	}
+}
+
+// AfterCommand 命令执行结束后清除client caching的设置
+func (tracking *Tracking) AfterCommand(client _interface.Client, cmdLine _type.CmdLine) {
+	if len(cmdLine) >= 2 && strings.ToLower(string(cmdLine[0])) == "client" && strings.ToLower(string(cmdLine[1])) == "caching" {
+		return
+	}
+	tracking.SetCaching(client, "")
+}
+
+// TrackKeys 记录client读取过的key
+func (tracking *Tracking) TrackKeys(client _interface.Client, keys []string) {
+	if client == nil || len(keys) == 0 {
+		return
+	}
+	tracking.lock.Lock()
+	id := client.GetId()
+	state, ok := tracking.clients[id]
+	if !ok || !state.shouldTrack() {
+		tracking.lock.Unlock()
+		return
+	}
+	for _, key := range keys {
+		ids, ok := tracking.keys[key]
+		if !ok {
+			ids = make(map[int64]struct{})
+			tracking.keys[key] = ids
+		}
+		ids[id] = struct{}{}
+		state.keys[key] = struct{}{}
+	}
+	targets := tracking.evict()
+	tracking.lock.Unlock()
+	tracking.sendTargets(targets)
+}
+
+// Trim tracking-table-max-keys被修改后调用
+func (tracking *Tracking) Trim() {
+	tracking.lock.Lock()
+	targets := tracking.evict()
+	tracking.lock.Unlock()
+	tracking.sendTargets(targets)
+}
+
+// 失效表中的key超过tracking-table-max-keys时淘汰多余的key，读取过这些key的client会收到失效消息
+func (tracking *Tracking) evict() map[*trackingState][]string {
+	targets := make(map[*trackingState][]string)
+	maxKeys := Config.TrackingTableMaxKeys
+	if maxKeys <= 0 {
+		return targets
+	}
+	// map的遍历顺序是随机的，与redis相同随机淘汰
+	for key := range tracking.keys {
+		if len(tracking.keys) <= maxKeys {
+			break
+		}
+		tracking.removeKey(targets, key, -1)
+	}
+	return targets
+}
+
+// 从失效表中删除key，并将其加入读取过该key的client的失效消息
+func (tracking *Tracking) removeKey(targets map[*trackingState][]string, key string, selfId int64) {
+	ids, ok := tracking.keys[key]
+	if !ok {
+		return
+	}
+	// 失效消息只发送一次，之后需重新读取才会再次记录
+	delete(tracking.keys, key)
+	for id := range ids {
+		if state, ok := tracking.clients[id]; ok {
+			delete(state.keys, key)
+		}
+		tracking.addTarget(targets, id, selfId, key)
+	}
+}
+
+// InvalidateKeys 向读取过这些key(或订阅了其前缀)的client发送失效消息
+func (tracking *Tracking) InvalidateKeys(client _interface.Client, keys []string) {
+	if len(keys) == 0 {
+		return
+	}
+	var selfId int64 = -1
+	if client != nil {
+		selfId = client.GetId()
+	}
+	targets := make(map[*trackingState][]string)
+	tracking.lock.Lock()
+	if len(tracking.clients) == 0 {
+		tracking.lock.Unlock()
+		return
+	}
+	for _, key := range keys {
+		tracking.removeKey(targets, key, selfId)
+		for prefix, ids := range tracking.prefixes {
+			if strings.HasPrefix(key, prefix) {
+				for id := range ids {
+					tracking.addTarget(targets, id, selfId, key)
+				}
+			}
+		}
+	}
+	tracking.lock.Unlock()
+	tracking.sendTargets(targets)
+}
+
+func (tracking *Tracking) addTarget(targets map[*trackingState][]string, id int64, selfId int64, key string) {
+	state, ok := tracking.clients[id]
+	if !ok {
+		return // 已关闭tracking
+	}
+	if state.noLoop && id == selfId {
+		return
+	}
+	if !containsString(targets[state], key) {
+		targets[state] = append(targets[state], key)
+	}
+}
+
+// 向各client发送其失效的key，调用时不能持有锁
+func (tracking *Tracking) sendTargets(targets map[*trackingState][]string) {
+	for state, keys := range targets {
+		tracking.send(state, Reply.StringToArrayReply(keys...))
+	}
+}
+
+// InvalidateAll flushdb/flushall时，向所有开启了tracking的client发送null失效消息
+func (tracking *Tracking) InvalidateAll() {
+	tracking.lock.Lock()
+	tracking.keys = make(map[string]map[int64]struct{})
+	states := make([]*trackingState, 0, len(tracking.clients))
+	for _, state := range tracking.clients {
+		state.keys = make(map[string]struct{})
+		states = append(states, state)
+	}
+	tracking.lock.Unlock()
+	for _, state := range states {
+		tracking.send(state, Reply.NewNullReply())
+	}
+}
+
+// 发送失效消息，RESP3下为push消息，重定向到RESP2的client时为__redis__:invalidate上的message
+func (tracking *Tracking) send(state *trackingState, keys _interface.Reply) {
+	target := state.client
+	if state.redirect != 0 {
+		var ok bool
+		target, ok = tracking.server.getClient(state.redirect)
+		if !ok {
+			tracking.lock.Lock()
+			state.broken = true
+			tracking.lock.Unlock()
+			if state.client.GetProtocol() == 3 {
+				reply := Reply.NewPushReply([]_interface.Reply{
+					Reply.StringToBulkReply("tracking-redir-broken"), Reply.NewIntegerReply(state.redirect),
+				})
+				_, _ = state.client.WriteReply(reply)
+			}
+			return
+		}
+	}
+	if target.GetProtocol() == 3 {
+		_, _ = target.WriteReply(Reply.NewPushReply([]_interface.Reply{Reply.StringToBulkReply("invalidate"), keys}))
+		return
+	}
+	if state.redirect != 0 && containsString(target.GetChannels(), invalidateChannel) {
+		reply := Reply.NewPushReply([]_interface.Reply{
+			Reply.StringToBulkReply("message"), Reply.StringToBulkReply(invalidateChannel), keys,
+		})
+		_, _ = target.WriteReply(reply)
+	}
+	// RESP2且未重定向时无法发送失效消息
+}
+
+func containsString(items []string, target string) bool {
+	for _, item := range items {
+		if item == target {
+			return true
+		}
+	}
+	return false
+}
+
+/* ---- client subcommands ---- */
+
+// client tracking on|off [redirect id] [prefix p ...] [bcast] [optin] [optout] [noloop]
+func clientTracking(server *Server, client _interface.Client, args _type.Args) _interface.Reply {
+	if len(args) < 1 {
+		return Reply.ArgNumError("client|tracking")
+	}
+	state := &trackingState{}
+	for i := 1; i < len(args); i++ {
+		opt := strings.ToLower(string(args[i]))
+		switch {
+		case opt == "redirect" && i+1 < len(args):
+			id, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return Reply.StandardError("value is not an integer or out of range")
+			}
+			state.redirect = id
+			i++
+		case opt == "prefix" && i+1 < len(args):
+			state.prefixes = append(state.prefixes, string(args[i+1]))
+			i++
+		case opt == "bcast":
+			state.bcast = true
+		case opt == "optin":
+			state.optIn = true
+		case opt == "optout":
+			state.optOut = true
+		case opt == "noloop":
+			state.noLoop = true
+		default:
+			return Reply.SyntaxError()
+		}
+	}
+	switch strings.ToLower(string(args[0])) {
+	case "on":
+		if len(state.prefixes) > 0 && !state.bcast {
+			return Reply.StandardError("PREFIX option requires BCAST mode to be enabled")
+		}
+		if state.optIn && state.optOut {
+			return Reply.StandardError("You can't use both OPTIN and OPTOUT")
+		}
+		if state.bcast && (state.optIn || state.optOut) {
+			return Reply.StandardError("OPTIN and OPTOUT are not compatible with BCAST")
+		}
+		if old, ok := server.tracking.getState(client); ok {
+			if old.bcast != state.bcast || old.optIn != state.optIn || old.optOut != state.optOut {
+				return Reply.StandardError("You can't switch BCAST, OPTIN or OPTOUT mode before disabling tracking for this client, and then re-enabling it with a different mode.")
+			}
+		}
+		if state.redirect != 0 {
+			if state.redirect == client.GetId() {
+				return Reply.StandardError("A client can only redirect to a different client")
+			}
+			if _, ok := server.getClient(state.redirect); !ok {
+				return Reply.StandardError("The client ID you want redirect to does not exist")
+			}
+		}
+		server.tracking.Enable(client, state)
+	case "off":
+		server.tracking.Disable(client)
+	default:
+		return Reply.SyntaxError()
+	}
+	return Reply.NewOkReply()
+}
+
+// client caching yes|no
+func clientCaching(server *Server, client _interface.Client, args _type.Args) _interface.Reply {
+	if len(args) != 1 {
+		return Reply.ArgNumError("client|caching")
+	}
+	state, ok := server.tracking.getState(client)
+	if !ok || !(state.optIn || state.optOut) {
+		return Reply.StandardError("CLIENT CACHING can be called only when the client is in tracking mode with OPTIN or OPTOUT mode enabled")
+	}
+	value := strings.ToLower(string(args[0]))
+	switch {
+	case value == "yes" && state.optIn, value == "no" && state.optOut:
+		server.tracking.SetCaching(client, value)
+	case value == "yes":
+		return Reply.StandardError("CLIENT CACHING YES is only valid when tracking is enabled in OPTIN mode.")
+	case value == "no":
+		return Reply.StandardError("CLIENT CACHING NO is only valid when tracking is enabled in OPTOUT mode.")
+	default:
+		return Reply.SyntaxError()
+	}
+	return Reply.NewOkReply()
+}
+
+// client getredir
+func clientGetRedir(server *Server, client _interface.Client, args _type.Args) _interface.Reply {
+	if len(args) != 0 {
+		return Reply.ArgNumError("client|getredir")
+	}
+	state, ok := server.tracking.getState(client)
+	if !ok {
+		return Reply.NewIntegerReply(-1)
+	}
+	return Reply.NewIntegerReply(state.redirect)
+}
+
+// client trackinginfo
+func clientTrackingInfo(server *Server, client _interface.Client, args _type.Args) _interface.Reply {
+	if len(args) != 0 {
+		return Reply.ArgNumError("client|trackinginfo")
+	}
+	var flags []string
+	var redirect int64 = -1
+	var prefixes []string
+	if state, ok := server.tracking.getState(client); ok {
+		flags = append(flags, "on")
+		redirect = state.redirect
+		if state.bcast {
+			flags = append(flags, "bcast")
+			prefixes = state.prefixes
+		}
+		if state.optIn {
+			flags = append(flags, "optin")
+		}
+		if state.optOut {
+			flags = append(flags, "optout")
+		}
+		if state.caching != "" {
+			flags = append(flags, "caching-"+state.caching)
+		}
+		if state.noLoop {
+			flags = append(flags, "noloop")
+		}
+		if state.broken {
+			flags = append(flags, "broken_redirect")
+		}
+	} else {
+		flags = append(flags, "off")
+	}
+	return Reply.NewMapReply([]_interface.Reply{
+		Reply.StringToBulkReply("flags"), Reply.NewSetReply(Reply.BulksToReplies(stringsToBulks(flags))),
+		Reply.StringToBulkReply("redirect"), Reply.NewIntegerReply(redirect),
+		Reply.StringToBulkReply("prefixes"), Reply.StringToArrayReply(prefixes...),
+	})
+}
+
+func stringsToBulks(items []string) [][]byte {
+	bulks := make([][]byte, len(items))
+	for i, item := range items {
+		bulks[i] = []byte(item)
+	}
+	return bulks
+}
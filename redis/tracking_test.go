@@ -0,0 +1,147 @@
+package redis_test
+
+import (
+	"bytes"
+	"go-redis/redis"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// pushClient 记录服务端主动推送的消息的client
+type pushClient struct {
+	*testClient
+	lock   sync.Mutex
+	pushed bytes.Buffer
+}
+
+func newPushClient(t *testing.T, server *redis.Server) *pushClient {
+	t.Helper()
+	conn, peer := net.Pipe()
+	c := &pushClient{testClient: &testClient{t: t, server: server, client: redis.NewClient(conn)}}
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := peer.Read(buf)
+			if err != nil {
+				return
+			}
+			c.lock.Lock()
+			c.pushed.Write(buf[:n])
+			c.lock.Unlock()
+		}
+	}()
+	if err := server.AddClient(c.client); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		server.CloseClient(c.client)
+		_ = peer.Close()
+	})
+	return c
+}
+
+// waitPushed 等待推送的消息中出现want
+func (c *pushClient) waitPushed(want string) {
+	c.t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		c.lock.Lock()
+		pushed := c.pushed.String()
+		c.lock.Unlock()
+		if strings.Contains(pushed, want) {
+			return
+		}
+		if time.Now().After(deadline) {
+			c.t.Fatalf("pushed %q does not contain %q", pushed, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// 失效消息的个数
+func (c *pushClient) invalidations() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return strings.Count(c.pushed.String(), "invalidate")
+}
+
+// waitInvalidations 等待收到n条失效消息
+func (c *pushClient) waitInvalidations(n int) {
+	c.t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for c.invalidations() < n {
+		if time.Now().After(deadline) {
+			c.t.Fatalf("got %d invalidations, want %d", c.invalidations(), n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// expectTrackedKeys 检查失效表中key的个数
+func expectTrackedKeys(t *testing.T, c *testClient, n string) {
+	t.Helper()
+	if info := c.do("info", "stats"); !strings.Contains(info, "tracking_total_keys:"+n+"\r\n") {
+		t.Fatalf("info stats %q does not report %s tracked keys", info, n)
+	}
+}
+
+// 关闭tracking时从失效表中清除该client读取过的key，其他client读取的key保留
+func TestTracking_DisablePurgesKeys(t *testing.T) {
+	server := newTestServer(t)
+	c1, c2 := newPushClient(t, server), newPushClient(t, server)
+	for _, c := range []*pushClient{c1, c2} {
+		c.do("hello", "3")
+		c.expect("+OK\r\n", "client", "tracking", "on")
+	}
+	c1.do("get", "a")
+	c1.do("get", "b")
+	c2.do("get", "a")
+	expectTrackedKeys(t, c1.testClient, "2")
+	c1.expect("+OK\r\n", "client", "tracking", "off")
+	expectTrackedKeys(t, c1.testClient, "1")
+	// 重新开启后不会收到关闭前读取的key的失效消息
+	c1.expect("+OK\r\n", "client", "tracking", "on")
+	c2.expect("+OK\r\n", "set", "a", "1")
+	c2.expect("+OK\r\n", "set", "b", "1")
+	c2.waitPushed("invalidate")
+	expectTrackedKeys(t, c1.testClient, "0")
+	if n := c1.invalidations(); n != 0 {
+		t.Fatalf("client received %d invalidations for keys read before disabling tracking", n)
+	}
+	// 断开连接同样清除
+	c2.do("get", "c")
+	expectTrackedKeys(t, c1.testClient, "1")
+	server.CloseClient(c2.client)
+	expectTrackedKeys(t, c1.testClient, "0")
+}
+
+// 失效表中的key超过tracking-table-max-keys时淘汰多余的key，并向读取过的client发送失效消息
+func TestTracking_TableMaxKeys(t *testing.T) {
+	restoreConfig(t, "tracking-table-max-keys")
+	server := newTestServer(t)
+	c := newPushClient(t, server)
+	c.expect("+OK\r\n", "config", "set", "tracking-table-max-keys", "2")
+	c.do("hello", "3")
+	c.expect("+OK\r\n", "client", "tracking", "on")
+	for _, key := range []string{"a", "b", "c"} {
+		c.do("get", key)
+	}
+	expectTrackedKeys(t, c.testClient, "2")
+	c.waitPushed(">2\r\n$10\r\ninvalidate\r\n*1\r\n")
+	// 调小上限后立即淘汰
+	c.expect("+OK\r\n", "config", "set", "tracking-table-max-keys", "1")
+	expectTrackedKeys(t, c.testClient, "1")
+	c.waitInvalidations(2)
+	// 为0时不限制
+	c.expect("+OK\r\n", "config", "set", "tracking-table-max-keys", "0")
+	for _, key := range []string{"d", "e", "f"} {
+		c.do("get", key)
+	}
+	expectTrackedKeys(t, c.testClient, "4")
+	if n := c.invalidations(); n != 2 {
+		t.Fatalf("got %d invalidations, want 2", n)
+	}
+}
@@ -0,0 +1,187 @@
+package redis_test
+
+import (
+	"go-redis/redis"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startTx 在后台执行事务，事务中的sleep 1使exec持有锁约一秒，返回exec的回复
+func startTx(c *testClient, cmds ...[]string) <-chan string {
+	c.expect("+OK\r\n", "multi")
+	for _, cmd := range cmds {
+		c.expect("+QUEUED\r\n", cmd...)
+	}
+	done := make(chan string, 1)
+	go func() { done <- c.do("exec") }()
+	return done
+}
+
+// waitDBSize 等待当前数据库的key个数达到n，dbsize不加锁，用于判断事务已开始执行
+func waitDBSize(t *testing.T, c *testClient, n string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for c.do("dbsize") != ":"+n+"\r\n" {
+		if time.Now().After(deadline) {
+			t.Fatal("transaction did not start")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// elapsed 执行命令并返回耗时
+func elapsed(c *testClient, want string, args ...string) time.Duration {
+	c.t.Helper()
+	start := time.Now()
+	c.expect(want, args...)
+	return time.Since(start)
+}
+
+// exec只为事务涉及的key加锁，不同key上的事务可以并发执行，相同key上的命令需等待
+func TestExec_DisjointTransactionsConcurrent(t *testing.T) {
+	server := newTestServer(t)
+	a, b, c := newTestClient(t, server), newTestClient(t, server), newTestClient(t, server)
+	done := startTx(a, []string{"set", "a", "1"}, []string{"sleep", "1"})
+	waitDBSize(t, c, "1")
+
+	b.expect("+OK\r\n", "multi")
+	b.expect("+QUEUED\r\n", "set", "b", "1")
+	if d := elapsed(b, "*1\r\n+OK\r\n", "exec"); d > 500*time.Millisecond {
+		t.Fatalf("transaction on another key waited %s", d)
+	}
+	c.expect("+OK\r\n", "multi")
+	c.expect("+QUEUED\r\n", "get", "a")
+	if d := elapsed(c, "*1\r\n$1\r\n1\r\n", "exec"); d < 300*time.Millisecond {
+		t.Fatalf("transaction on the same key did not wait (%s)", d)
+	}
+	if got := <-done; got != "*2\r\n+OK\r\n+sleep over\r\n" {
+		t.Fatalf("exec: got %q", got)
+	}
+}
+
+// 事务中的select使之后的命令在新的数据库中执行及加锁，exec后client仍在新的数据库
+func TestExec_QueuedSelect(t *testing.T) {
+	server := newTestServer(t)
+	a, b := newTestClient(t, server), newTestClient(t, server)
+	done := startTx(a, []string{"set", "x", "0"}, []string{"select", "1"}, []string{"set", "x", "1"}, []string{"sleep", "1"})
+	b.expect("+OK\r\n", "select", "1")
+	waitDBSize(t, b, "1")
+
+	// db 1中的x被事务加锁，db 0中的y不受影响
+	b.expect("+OK\r\n", "select", "0")
+	if d := elapsed(b, "+OK\r\n", "set", "y", "0"); d > 500*time.Millisecond {
+		t.Fatalf("set in db 0 waited %s", d)
+	}
+	b.expect("+OK\r\n", "select", "1")
+	if d := elapsed(b, "$1\r\n1\r\n", "get", "x"); d < 300*time.Millisecond {
+		t.Fatalf("get in db 1 did not wait (%s)", d)
+	}
+	if got := <-done; got != "*4\r\n+OK\r\n+OK\r\n+OK\r\n+sleep over\r\n" {
+		t.Fatalf("exec: got %q", got)
+	}
+	a.expect("$1\r\n1\r\n", "get", "x")
+	a.expect("+OK\r\n", "select", "0")
+	a.expect("$1\r\n0\r\n", "get", "x")
+}
+
+// 被watch的key在检查之后、事务执行完毕之前保持加锁，其他client的修改需等待事务结束
+func TestExec_WatchedKeysLocked(t *testing.T) {
+	server := newTestServer(t)
+	a, b := newTestClient(t, server), newTestClient(t, server)
+	a.expect("+OK\r\n", "watch", "w")
+	done := startTx(a, []string{"set", "marker", "1"}, []string{"sleep", "1"})
+	waitDBSize(t, b, "1")
+
+	if d := elapsed(b, "+OK\r\n", "set", "w", "1"); d < 300*time.Millisecond {
+		t.Fatalf("set on watched key did not wait (%s)", d)
+	}
+	if got := <-done; got != "*2\r\n+OK\r\n+sleep over\r\n" {
+		t.Fatalf("exec: got %q, want executed", got)
+	}
+}
+
+// flushdb、flushall为整个数据库加锁，等待持有key锁的事务执行完毕，事务中的key不会在执行中途消失
+func TestFlush_WaitsForTransaction(t *testing.T) {
+	for _, flush := range []string{"flushdb", "flushall"} {
+		t.Run(flush, func(t *testing.T) {
+			server := newTestServer(t)
+			a, b := newTestClient(t, server), newTestClient(t, server)
+			a.expect("+OK\r\n", "set", "x", "1")
+			done := startTx(a, []string{"set", "marker", "1"}, []string{"sleep", "1"}, []string{"get", "x"})
+			waitDBSize(t, b, "2")
+
+			if d := elapsed(b, "+OK\r\n", flush); d < 300*time.Millisecond {
+				t.Fatalf("%s did not wait for the transaction (%s)", flush, d)
+			}
+			if got := <-done; got != "*3\r\n+OK\r\n+sleep over\r\n$1\r\n1\r\n" {
+				t.Fatalf("exec: got %q", got)
+			}
+			b.expect(":0\r\n", "dbsize")
+		})
+	}
+}
+
+// 事务中的flushdb使exec为整个数据库加锁，其他数据库不受影响
+func TestExec_QueuedFlushLocksDB(t *testing.T) {
+	server := newTestServer(t)
+	a, b := newTestClient(t, server), newTestClient(t, server)
+	a.expect("+OK\r\n", "set", "x", "1")
+	done := startTx(a, []string{"flushdb"}, []string{"set", "marker", "1"}, []string{"sleep", "1"})
+	waitDBSize(t, b, "1")
+
+	b.expect("+OK\r\n", "select", "1")
+	if d := elapsed(b, "+OK\r\n", "set", "y", "1"); d > 500*time.Millisecond {
+		t.Fatalf("set in db 1 waited %s", d)
+	}
+	b.expect("+OK\r\n", "select", "0")
+	if d := elapsed(b, "+OK\r\n", "set", "y", "1"); d < 300*time.Millisecond {
+		t.Fatalf("set in the flushed db did not wait (%s)", d)
+	}
+	if got := <-done; got != "*3\r\n+OK\r\n+OK\r\n+sleep over\r\n" {
+		t.Fatalf("exec: got %q", got)
+	}
+	b.expect(":2\r\n", "dbsize")
+}
+
+// RESET清除事务、watch、订阅、monitor、tracking、协议、名称、db及reply模式等连接状态
+func TestReset(t *testing.T) {
+	server := newTestServer(t)
+	c := newTestClient(t, server)
+	c.do("hello", "3")
+	c.expect("+OK\r\n", "client", "setname", "foo")
+	c.expect("+OK\r\n", "select", "2")
+	c.expect("+OK\r\n", "client", "tracking", "on")
+	c.expect("+OK\r\n", "client", "no-evict", "on")
+	c.expect("+OK\r\n", "watch", "k")
+	c.do("subscribe", "ch")
+	c.do("monitor")
+	c.do("client", "reply", "off")
+	info := c.do("client", "info")
+	for _, want := range []string{"name=foo ", "flags=POte ", "db=2 ", "sub=1 ", "resp=3 "} {
+		if !strings.Contains(info, want) {
+			t.Fatalf("client info %q does not contain %q before reset", info, want)
+		}
+	}
+	if c.client.ShouldReply() {
+		t.Fatal("client reply off is not set")
+	}
+	c.do("multi")
+	c.do("set", "k", "v")
+
+	c.expect("+RESET\r\n", "reset")
+	info = c.do("client", "info")
+	for _, want := range []string{"name= ", "flags=N ", "db=0 ", "sub=0 ", "multi=-1 ", "user=default ", "resp=2 "} {
+		if !strings.Contains(info, want) {
+			t.Fatalf("client info %q does not contain %q after reset", info, want)
+		}
+	}
+	if !c.client.ShouldReply() {
+		t.Fatal("client reply mode is not reset")
+	}
+	if n := redis.WatchedKeys(server); n != 0 {
+		t.Fatalf("%d keys still watched after reset", n)
+	}
+	c.expect("-ERR: EXEC without MULTI\r\n", "exec")
+	c.expect("$-1\r\n", "get", "k")
+}
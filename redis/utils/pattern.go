@@ -0,0 +1,98 @@
+package utils
+
+// MatchPattern 判断str是否匹配glob风格的pattern，支持 * ? [abc] [^a] [a-z] 以及 \ 转义
+func MatchPattern(pattern string, str string) bool {
+	p, s := 0, 0
+	starP, starS := -1, 0 // 最近一个*的位置，用于回溯
+	for s < len(str) {
+		if p < len(pattern) {
+			switch pattern[p] {
+			case '*':
+				// 合并连续的*
+				for p < len(pattern) && pattern[p] == '*' {
+					p++
+				}
+				if p == len(pattern) {
+					return true
+				}
+				starP, starS = p, s
+				continue
+			case '?':
+				p++
+				s++
+				continue
+			case '[':
+				end, matched := matchClass(pattern, p, str[s])
+				if matched {
+					p = end
+					s++
+					continue
+				}
+			case '\\':
+				if p+1 < len(pattern) {
+					if pattern[p+1] == str[s] {
+						p += 2
+						s++
+						continue
+					}
+					break
+				}
+				fallthrough
+			default:
+				if pattern[p] == str[s] {
+					p++
+					s++
+					continue
+				}
+			}
+		}
+		// 不匹配时回溯到上一个*，令其多匹配一个字符
+		if starP < 0 {
+			return false
+		}
+		starS++
+		p, s = starP, starS
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// 匹配字符集合[...]，返回集合结束后的位置以及是否匹配
+func matchClass(pattern string, start int, ch byte) (int, bool) {
+	p := start + 1
+	negate := false
+	if p < len(pattern) && pattern[p] == '^' {
+		negate = true
+		p++
+	}
+	matched := false
+	for p < len(pattern) && pattern[p] != ']' {
+		switch {
+		case pattern[p] == '\\' && p+1 < len(pattern):
+			if pattern[p+1] == ch {
+				matched = true
+			}
+			p += 2
+		case p+2 < len(pattern) && pattern[p+1] == '-' && pattern[p+2] != ']':
+			lo, hi := pattern[p], pattern[p+2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			if ch >= lo && ch <= hi {
+				matched = true
+			}
+			p += 3
+		default:
+			if pattern[p] == ch {
+				matched = true
+			}
+			p++
+		}
+	}
+	if p < len(pattern) {
+		p++ // 跳过]
+	}
+	return p, matched != negate
+}
@@ -1,18 +1,48 @@
 package utils
 
-import _type "go-redis/interface/type"
+import (
+	_type "go-redis/interface/type"
+	"strconv"
+)
 
-func ReadFirst(args _type.Args) ([]string, []string) {
+// KeysFind 从命令参数中找出要写入和读取的key
+// First、Last、Step为key在命令中的位置(命令名为0)，Last为负数时从末尾倒数，用于command命令
+// Movable表示key的位置由参数决定(如numkeys)，此时只能通过Find获取key
+type KeysFind struct {
+	Find    func(args _type.Args) ([]string, []string)
+	First   int
+	Last    int
+	Step    int
+	Movable bool
+}
+
+var (
+	ReadFirst            = KeysFind{Find: readFirst, First: 1, Last: 1, Step: 1}
+	ReadFirstTwo         = KeysFind{Find: readFirstTwo, First: 1, Last: 2, Step: 1}
+	ReadAll              = KeysFind{Find: readAll, First: 1, Last: -1, Step: 1}
+	WriteFirst           = KeysFind{Find: writeFirst, First: 1, Last: 1, Step: 1}
+	WriteAll             = KeysFind{Find: writeAll, First: 1, Last: -1, Step: 1}
+	WriteEven            = KeysFind{Find: writeEven, First: 1, Last: -1, Step: 2}
+	WriteFirstReadSecond = KeysFind{Find: writeFirstReadSecond, First: 1, Last: 2, Step: 1}
+	WriteFirstReadOthers = KeysFind{Find: writeFirstReadOthers, First: 1, Last: -1, Step: 1}
+	WriteSecondReadFirst = KeysFind{Find: writeSecondReadFirst, First: 1, Last: 2, Step: 1}
+	ReadSecond           = KeysFind{Find: readSecond, First: 2, Last: 2, Step: 1}
+	WriteNilReadNil      = KeysFind{Find: writeNilReadNil}
+	// NumKeys 形如"cmd script numkeys key [key ...] arg [arg ...]"的命令，如eval、fcall
+	NumKeys = KeysFind{Find: numKeys, Movable: true}
+)
+
+func readFirst(args _type.Args) ([]string, []string) {
 	key := string(args[0])
 	return nil, []string{key}
 }
 
-func ReadFirstTwo(args _type.Args) ([]string, []string) {
+func readFirstTwo(args _type.Args) ([]string, []string) {
 	key1, key2 := string(args[0]), string(args[1])
 	return []string{key1, key2}, nil
 }
 
-func ReadAll(args _type.Args) ([]string, []string) {
+func readAll(args _type.Args) ([]string, []string) {
 	rKeys := make([]string, len(args))
 	for i, key := range args {
 		rKeys[i] = string(key)
@@ -20,19 +50,19 @@ func ReadAll(args _type.Args) ([]string, []string) {
 	return nil, rKeys
 }
 
-func WriteFirst(args _type.Args) ([]string, []string) {
+func writeFirst(args _type.Args) ([]string, []string) {
 	key := string(args[0])
 	return []string{key}, nil
 }
 
-func WriteAll(args _type.Args) ([]string, []string) {
+func writeAll(args _type.Args) ([]string, []string) {
 	wKeys := make([]string, len(args))
 	for i, key := range args {
 		wKeys[i] = string(key)
 	}
 	return wKeys, nil
 }
-func WriteEven(args _type.Args) ([]string, []string) {
+func writeEven(args _type.Args) ([]string, []string) {
 	wKeys := make([]string, len(args)/2)
 	for i := 0; i < len(wKeys); i++ {
 		wKeys[i] = string(args[2*i])
@@ -40,13 +70,13 @@ func WriteEven(args _type.Args) ([]string, []string) {
 	return wKeys, nil
 }
 
-func WriteFirstReadSecond(args _type.Args) ([]string, []string) {
+func writeFirstReadSecond(args _type.Args) ([]string, []string) {
 	wKeys := []string{string(args[0])}
 	rKeys := []string{string(args[1])}
 	return wKeys, rKeys
 }
 
-func WriteFirstReadOthers(args _type.Args) ([]string, []string) {
+func writeFirstReadOthers(args _type.Args) ([]string, []string) {
 	wKeys := []string{string(args[0])}
 	rKeys := make([]string, len(args)-1)
 	for i := 0; i < len(args)-1; i++ {
@@ -55,6 +85,36 @@ func WriteFirstReadOthers(args _type.Args) ([]string, []string) {
 	return wKeys, rKeys
 }
 
-func WriteNilReadNil(args _type.Args) ([]string, []string) {
+func writeSecondReadFirst(args _type.Args) ([]string, []string) {
+	wKeys := []string{string(args[1])}
+	rKeys := []string{string(args[0])}
+	return wKeys, rKeys
+}
+
+// 形如"cmd subcommand key"的命令，如object，没有key的子命令(如help)返回nil
+func readSecond(args _type.Args) ([]string, []string) {
+	if len(args) < 2 {
+		return nil, nil
+	}
+	return nil, []string{string(args[1])}
+}
+
+func writeNilReadNil(args _type.Args) ([]string, []string) {
 	return nil, nil
 }
+
+// numkeys不合法时返回nil
+func numKeys(args _type.Args) ([]string, []string) {
+	if len(args) < 2 {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(string(args[1]))
+	if err != nil || n < 0 || n > len(args)-2 {
+		return nil, nil
+	}
+	wKeys := make([]string, n)
+	for i := 0; i < n; i++ {
+		wKeys[i] = string(args[i+2])
+	}
+	return wKeys, nil
+}
@@ -12,33 +12,119 @@ import (
 	"time"
 )
 
-// ParseCmds 将一行输入解析为cmdLine，""中的内容为一个参数
+// ParseCmds 将一行输入解析为cmdLine，参数之间以任意个空白分隔，与redis的sdssplitargs一致
+// 参数可以用双引号(支持\n、\r、\t、\b、\a、\"、\\及\xHH转义)或单引号(只支持\'转义)包裹，以包含空白或表示空参数
+// 未加引号的参数中出现的引号开始一段引号内的内容，与前面的内容属于同一个参数，如foo"bar"解析为foobar
+// 引号不匹配，或右引号后面不是空白时返回错误
 func ParseCmds(line []byte) ([][]byte, error) {
-	cmdLine, arg := make([][]byte, 0), make([]byte, 0)
-	num := 0
-	for i, ch := range line {
-		if ch == ' ' {
-			if num%2 == 0 {
-				cmdLine = append(cmdLine, arg)
-				arg = make([]byte, 0)
-			} else {
-				arg = append(arg, ch)
+	cmdLine := make([][]byte, 0)
+	i, n := 0, len(line)
+	for {
+		// 跳过空白
+		for i < n && isSpace(line[i]) {
+			i++
+		}
+		if i >= n {
+			return cmdLine, nil
+		}
+		arg := make([]byte, 0)
+		for i < n && !isSpace(line[i]) {
+			var err error
+			switch line[i] {
+			case '"':
+				arg, i, err = parseDoubleQuoted(line, i+1, arg)
+			case '\'':
+				arg, i, err = parseSingleQuoted(line, i+1, arg)
+			default:
+				arg = append(arg, line[i])
+				i++
+				continue
+			}
+			if err != nil {
+				return nil, err
 			}
-		} else if ch == '"' {
-			if i > 0 && line[i-1] == '\\' {
-				arg = append(arg, ch)
-			} else {
-				num++
-				if num%2 == 1 && i > 0 && line[i-1] == '"' {
-					return nil, errors.New("invalid argument(s)")
+			// 右引号后必须是空白或行尾
+			if i < n && !isSpace(line[i]) {
+				return nil, errors.New("closing quote must be followed by a space or nothing at all")
+			}
+		}
+		cmdLine = append(cmdLine, arg)
+	}
+}
+
+// 解析从line[i]开始的双引号内的内容，追加到arg，返回右引号之后的位置
+func parseDoubleQuoted(line []byte, i int, arg []byte) ([]byte, int, error) {
+	n := len(line)
+	for {
+		if i >= n {
+			return nil, i, errors.New("unbalanced quotes")
+		}
+		if line[i] == '"' {
+			return arg, i + 1, nil
+		}
+		if line[i] == '\\' && i+1 < n {
+			i++
+			switch line[i] {
+			case 'n':
+				arg = append(arg, '\n')
+			case 'r':
+				arg = append(arg, '\r')
+			case 't':
+				arg = append(arg, '\t')
+			case 'b':
+				arg = append(arg, '\b')
+			case 'a':
+				arg = append(arg, '\a')
+			case 'x':
+				if b, ok := parseHexByte(line, i+1); ok {
+					arg = append(arg, b)
+					i += 2
+				} else {
+					arg = append(arg, 'x')
 				}
+			default:
+				arg = append(arg, line[i])
 			}
-		} else {
-			arg = append(arg, ch)
+			i++
+			continue
+		}
+		arg = append(arg, line[i])
+		i++
+	}
+}
+
+// 解析从line[i]开始的单引号内的内容，追加到arg，返回右引号之后的位置
+func parseSingleQuoted(line []byte, i int, arg []byte) ([]byte, int, error) {
+	n := len(line)
+	for {
+		if i >= n {
+			return nil, i, errors.New("unbalanced quotes")
 		}
+		if line[i] == '\'' {
+			return arg, i + 1, nil
+		}
+		if line[i] == '\\' && i+1 < n && line[i+1] == '\'' {
+			i++
+		}
+		arg = append(arg, line[i])
+		i++
+	}
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\r' || b == '\n' || b == '\v' || b == '\f'
+}
+
+// 解析line[i:i+2]中的两位十六进制数
+func parseHexByte(line []byte, i int) (byte, bool) {
+	if i+2 > len(line) {
+		return 0, false
+	}
+	b, err := strconv.ParseUint(string(line[i:i+2]), 16, 8)
+	if err != nil {
+		return 0, false
 	}
-	cmdLine = append(cmdLine, arg)
-	return cmdLine, nil
+	return byte(b), true
 }
 
 // ParseRange 解析边界，返回的边界一律符合左闭右开[a, b)
@@ -0,0 +1,65 @@
+package utils
+
+import "testing"
+
+// 与redis的sdssplitargs的结果一致
+func TestParseCmds(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"", []string{}},
+		{"   ", []string{}},
+		{"set k v", []string{"set", "k", "v"}},
+		{"  set \t k   v  \r\n", []string{"set", "k", "v"}},
+		{`set k "a b"`, []string{"set", "k", "a b"}},
+		{`set k ""`, []string{"set", "k", ""}},
+		{`set k ''`, []string{"set", "k", ""}},
+		{`set k 'a "b"'`, []string{"set", "k", `a "b"`}},
+		{`set k "a\"b\\c"`, []string{"set", "k", `a"b\c`}},
+		{`set k "\n\r\t\b\a"`, []string{"set", "k", "\n\r\t\b\a"}},
+		{`set k "\x41\x4a\x4B"`, []string{"set", "k", "AJK"}},
+		{`set k "\x4"`, []string{"set", "k", "x4"}},
+		{`set k "\xzz"`, []string{"set", "k", "xzz"}},
+		{`set k '\'a\n'`, []string{"set", "k", `'a\n`}},
+		// 未加引号的参数中的引号与前后内容属于同一个参数
+		{`set foo"bar" v`, []string{"set", "foobar", "v"}},
+		{`set foo'bar' v`, []string{"set", "foobar", "v"}},
+		{`set foo"a b"`, []string{"set", "fooa b"}},
+		{`set foo"" v`, []string{"set", "foo", "v"}},
+	}
+	for _, test := range tests {
+		cmdLine, err := ParseCmds([]byte(test.input))
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", test.input, err)
+			continue
+		}
+		if len(cmdLine) != len(test.expected) {
+			t.Errorf("%q: expected %q, got %q", test.input, test.expected, cmdLine)
+			continue
+		}
+		for i, arg := range cmdLine {
+			if string(arg) != test.expected[i] {
+				t.Errorf("%q: expected %q, got %q", test.input, test.expected, cmdLine)
+				break
+			}
+		}
+	}
+}
+
+func TestParseCmds_Errors(t *testing.T) {
+	for _, input := range []string{
+		`set k "v`,
+		`set k 'v`,
+		`set k "v\"`,
+		`set k "a"b`,
+		`set k 'a'b`,
+		`set foo"bar"baz`,
+		`set k "a""b"`,
+		`set k a\"b`,
+	} {
+		if cmdLine, err := ParseCmds([]byte(input)); err == nil {
+			t.Errorf("%q: expected error, got %q", input, cmdLine)
+		}
+	}
+}
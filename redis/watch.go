@@ -0,0 +1,91 @@
+package redis
+
+import (
+	_interface "go-redis/interface"
+	"sync"
+	"sync/atomic"
+)
+
+// Watcher 记录各个数据库中被watch的key，以及watch了该key的client
+// key被修改、删除、过期，或所在的数据库被清空时，watch了该key的client被标记为dirty，之后的exec将放弃执行
+// 只记录被watch的key，未被watch的key不占用内存
+type Watcher struct {
+	lock  sync.RWMutex
+	count int64                                       // 被watch的key的个数，为0时修改key无需加锁
+	keys  []map[string]map[_interface.Client]struct{} // 数据库编号 -> key -> client
+}
+
+func NewWatcher(dbNum int) *Watcher {
+	keys := make([]map[string]map[_interface.Client]struct{}, dbNum)
+	for i := range keys {
+		keys[i] = make(map[string]map[_interface.Client]struct{})
+	}
+	return &Watcher{keys: keys}
+}
+
+// Watch client开始watch指定数据库中的key
+func (watcher *Watcher) Watch(client _interface.Client, dbIdx int, key string) {
+	watcher.lock.Lock()
+	defer watcher.lock.Unlock()
+	clients, ok := watcher.keys[dbIdx][key]
+	if !ok {
+		clients = make(map[_interface.Client]struct{})
+		watcher.keys[dbIdx][key] = clients
+		atomic.AddInt64(&watcher.count, 1)
+	}
+	clients[client] = struct{}{}
+}
+
+// UnwatchAll 取消client watch的所有key，并清除client的watch状态
+func (watcher *Watcher) UnwatchAll(client _interface.Client) {
+	watchKeys := client.GetWatchKeys()
+	if len(watchKeys) > 0 {
+		watcher.lock.Lock()
+		for dbIdx, keys := range watchKeys {
+			for key := range keys {
+				clients, ok := watcher.keys[dbIdx][key]
+				if !ok {
+					continue
+				}
+				delete(clients, client)
+				if len(clients) == 0 {
+					delete(watcher.keys[dbIdx], key)
+					atomic.AddInt64(&watcher.count, -1)
+				}
+			}
+		}
+		watcher.lock.Unlock()
+	}
+	client.DestroyWatch()
+}
+
+// Touch 指定数据库中的key被修改，watch了这些key的client被标记为dirty
+func (watcher *Watcher) Touch(dbIdx int, keys []string) {
+	if atomic.LoadInt64(&watcher.count) == 0 {
+		return
+	}
+	watcher.lock.RLock()
+	defer watcher.lock.RUnlock()
+	for _, key := range keys {
+		for client := range watcher.keys[dbIdx][key] {
+			client.SetWatchDirty()
+		}
+	}
+}
+
+// TouchAll 数据库被清空时，watch了其中已存在的key的client被标记为dirty
+func (watcher *Watcher) TouchAll(dbIdx int, exists func(key string) bool) {
+	if atomic.LoadInt64(&watcher.count) == 0 {
+		return
+	}
+	watcher.lock.RLock()
+	defer watcher.lock.RUnlock()
+	for key, clients := range watcher.keys[dbIdx] {
+		if !exists(key) {
+			continue
+		}
+		for client := range clients {
+			client.SetWatchDirty()
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package redis_test
+
+import (
+	"go-redis/redis"
+	"testing"
+	"time"
+)
+
+// watch后由另一个client执行modify，之后的exec应返回nil(aborted为false时应正常执行)
+func TestWatch_Abort(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   [][]string
+		modify  [][]string
+		wait    time.Duration
+		aborted bool
+	}{
+		{"set", [][]string{{"set", "k", "v"}}, [][]string{{"set", "k", "v"}}, 0, true},
+		{"del then recreate", [][]string{{"set", "k", "v"}}, [][]string{{"del", "k"}, {"set", "k", "v"}}, 0, true},
+		{"create", nil, [][]string{{"set", "k", "v"}}, 0, true},
+		{"other key", [][]string{{"set", "k", "v"}}, [][]string{{"set", "other", "v"}}, 0, false},
+		{"expire", [][]string{{"set", "k", "v", "px", "50"}}, nil, 100 * time.Millisecond, true},
+		{"already expired", [][]string{{"set", "k", "v", "px", "1"}}, nil, 0, false},
+		{"flushdb", [][]string{{"set", "k", "v"}}, [][]string{{"flushdb"}}, 0, true},
+		{"flushdb without key", nil, [][]string{{"set", "other", "v"}, {"flushdb"}}, 0, false},
+		{"flushall", [][]string{{"set", "k", "v"}}, [][]string{{"flushall"}}, 0, true},
+		{"flushall other db", nil, [][]string{{"select", "1"}, {"set", "k", "v"}, {"flushall"}}, 0, false},
+		{"swapdb", [][]string{{"set", "k", "v"}}, [][]string{{"swapdb", "0", "1"}}, 0, true},
+		{"swapdb with key in other db", [][]string{{"select", "1"}, {"set", "k", "v"}, {"select", "0"}}, [][]string{{"swapdb", "0", "1"}}, 0, true},
+		{"swapdb without key", nil, [][]string{{"swapdb", "0", "1"}}, 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestServer(t)
+			c, other := newTestClient(t, server), newTestClient(t, server)
+			for _, cmd := range test.setup {
+				c.do(cmd...)
+			}
+			time.Sleep(5 * time.Millisecond) // 使px 1的key在watch之前过期
+			c.expect("+OK\r\n", "watch", "k")
+			for _, cmd := range test.modify {
+				other.do(cmd...)
+			}
+			time.Sleep(test.wait)
+			c.expect("+OK\r\n", "multi")
+			c.expect("+QUEUED\r\n", "ping")
+			if test.aborted {
+				c.expect("$-1\r\n", "exec")
+			} else {
+				c.expect("*1\r\n+PONG\r\n", "exec")
+			}
+		})
+	}
+}
+
+// 入队时出错且被watch的key被修改时，exec返回EXECABORT而不是nil，与redis一致
+func TestWatch_QueueErrorBeforeWatch(t *testing.T) {
+	server := newTestServer(t)
+	c, other := newTestClient(t, server), newTestClient(t, server)
+	c.expect("+OK\r\n", "watch", "k")
+	other.expect("+OK\r\n", "set", "k", "v")
+	c.expect("+OK\r\n", "multi")
+	c.expect("+QUEUED\r\n", "set", "x", "1")
+	c.expect("-ERR: unknown command 'nosuchcmd'\r\n", "nosuchcmd")
+	c.expect("-ERR: EXECABORT Transaction discarded because of previous errors.\r\n", "exec")
+	c.expect(":0\r\n", "exists", "x")
+	if n := redis.WatchedKeys(server); n != 0 {
+		t.Fatalf("%d keys still watched after aborted exec", n)
+	}
+}
+
+// exec、discard、unwatch、reset以及client关闭后，watcher中不再记录该client watch的key
+func TestWatch_Cleanup(t *testing.T) {
+	server := newTestServer(t)
+	ends := map[string][][]string{
+		"exec":    {{"multi"}, {"exec"}},
+		"discard": {{"multi"}, {"discard"}},
+		"unwatch": {{"unwatch"}},
+		"reset":   {{"reset"}},
+		"close":   nil,
+	}
+	for name, cmds := range ends {
+		c, other := newTestClient(t, server), newTestClient(t, server)
+		c.expect("+OK\r\n", "watch", "a", "b")
+		other.expect("+OK\r\n", "watch", "b")
+		c.expect("+OK\r\n", "select", "1")
+		c.expect("+OK\r\n", "watch", "a")
+		if n := redis.WatchedKeys(server); n != 3 {
+			t.Fatalf("%s: %d keys watched, want 3", name, n)
+		}
+		if cmds == nil {
+			server.CloseClient(c.client)
+		}
+		for _, cmd := range cmds {
+			c.do(cmd...)
+		}
+		if n := redis.WatchedKeys(server); n != 1 {
+			t.Fatalf("%s: %d keys watched, want 1", name, n)
+		}
+		other.expect("+OK\r\n", "unwatch")
+		if n := redis.WatchedKeys(server); n != 0 {
+			t.Fatalf("%s: %d keys watched, want 0", name, n)
+		}
+	}
+}
@@ -4,10 +4,11 @@ import (
 	"bufio"
 	"bytes"
 	"errors"
-	"go-redis/redis/utils"
+	_interface "go-redis/interface"
 	Reply "go-redis/resp/reply"
 	"go-redis/utils/logger"
 	"io"
+	"math/big"
 	"runtime/debug"
 	"strconv"
 )
@@ -15,6 +16,7 @@ import (
 type Parser struct {
 	reader *bufio.Reader
 	ch     chan *Payload
+	offset int64 // 已解析的字节数，包括被忽略的行
 }
 
 func NewParser(reader io.Reader) *Parser {
@@ -29,12 +31,6 @@ func (parser *Parser) ParseFile() <-chan *Payload {
 	return parser.ch
 }
 
-func (parser *Parser) ParseCLI() <-chan *Payload {
-	go parser.parseRESP() // 客户端使用RESP时，如redis-cli
-	//go parser.parseNoRESP() // 客户端不使用RESP时，如telnet
-	return parser.ch
-}
-
 func (parser *Parser) parseRESP() {
 	// 异常处理
 	defer func() {
@@ -44,9 +40,9 @@ func (parser *Parser) parseRESP() {
 	}()
 	// parsing
 	for {
-		line, err := parser.reader.ReadBytes('\n')
+		line, err := parser.readLine()
 		if err != nil {
-			parser.ch <- &Payload{Err: err}
+			parser.send(&Payload{Err: err})
 			close(parser.ch)
 			return // 出现错误，终止
 		}
@@ -61,7 +57,7 @@ func (parser *Parser) parseRESP() {
 			// 简单字符串(Simple String)
 			err := parser.parseSimpleString(line)
 			if err != nil {
-				parser.ch <- &Payload{Err: err}
+				parser.send(&Payload{Err: err})
 				close(parser.ch)
 				return
 			}
@@ -69,7 +65,7 @@ func (parser *Parser) parseRESP() {
 			// 字符串(Bulk String)
 			err := parser.parseBulkString(line)
 			if err != nil {
-				parser.ch <- &Payload{Err: err}
+				parser.send(&Payload{Err: err})
 				close(parser.ch)
 				return
 			}
@@ -77,7 +73,7 @@ func (parser *Parser) parseRESP() {
 			// 数组(Multi Bulk Strings)
 			err := parser.parseMultiBulk(line)
 			if err != nil {
-				parser.ch <- &Payload{Err: err}
+				parser.send(&Payload{Err: err})
 				close(parser.ch)
 				return
 			}
@@ -85,53 +81,32 @@ func (parser *Parser) parseRESP() {
 			// 整数(Integer)
 			err := parser.parseInteger(line)
 			if err != nil {
-				parser.ch <- &Payload{Err: err}
+				parser.send(&Payload{Err: err})
 				close(parser.ch)
 				return
 			}
 		case '-':
 			// 错误信息(Error)
 			reply := Reply.StandardError(string(line[1:]))
-			parser.ch <- &Payload{Data: reply}
+			parser.send(&Payload{Data: reply})
+		case '_', '#', ',', '(', '=', '!', '%', '~', '>':
+			// RESP3类型
+			reply, err := parser.parseRESP3(line)
+			if err != nil {
+				parser.send(&Payload{Err: err})
+				close(parser.ch)
+				return
+			}
+			parser.send(&Payload{Data: reply})
 		default:
 			args := bytes.Split(line, []byte{' '})
 			reply := Reply.NewArrayReply(args)
-			parser.ch <- &Payload{Data: reply}
+			parser.send(&Payload{Data: reply})
 		}
 
 	}
 }
 
-func (parser *Parser) parseNoRESP() {
-	// 异常处理
-	defer func() {
-		if err := recover(); err != nil {
-			logger.Error(err, string(debug.Stack()))
-		}
-	}()
-	// parsing
-	for {
-		line, err := parser.reader.ReadBytes('\n')
-		if err != nil {
-			parser.ch <- &Payload{Err: err}
-			close(parser.ch)
-			return // 读取出现错误，终止
-		}
-		line = bytes.TrimSpace(line) // 去除两端空白
-		println(string(line))
-		if len(line) == 0 {
-			continue // 忽略空行
-		}
-		cmdLine, err := utils.ParseCmds(line)
-		if err != nil {
-			parser.ch <- &Payload{Err: err}
-			continue // 命令行解析错误
-		}
-		reply := Reply.NewArrayReply(cmdLine)
-		parser.ch <- &Payload{Data: reply}
-	}
-}
-
 func (parser *Parser) parseInteger(line []byte) error {
 	value, err := strconv.ParseInt(string(line[1:]), 10, 64)
 	if err != nil {
@@ -139,14 +114,14 @@ func (parser *Parser) parseInteger(line []byte) error {
 		return nil
 	}
 	reply := Reply.NewIntegerReply(value)
-	parser.ch <- &Payload{Data: reply}
+	parser.send(&Payload{Data: reply})
 	return nil
 }
 
 func (parser *Parser) parseSimpleString(line []byte) error {
 	status := string(line[1:])
 	reply := Reply.NewStringReply(status)
-	parser.ch <- &Payload{Data: reply}
+	parser.send(&Payload{Data: reply})
 	return nil
 }
 
@@ -157,17 +132,17 @@ func (parser *Parser) parseBulkString(header []byte) error {
 		return nil
 	} else if size == -1 {
 		reply := Reply.NewNilBulkReply() // Null Bulk String
-		parser.ch <- &Payload{Data: reply}
+		parser.send(&Payload{Data: reply})
 		return nil
 	} else {
 		body := make([]byte, size+2) // 正文长度+CRLF的长度
-		_, err = io.ReadFull(parser.reader, body)
+		_, err = parser.readFull(body)
 		if err != nil {
 			return err
 		}
 		args := body[:len(body)-2] // 去掉末尾的CRLF
 		reply := Reply.NewBulkReply(args)
-		parser.ch <- &Payload{Data: reply}
+		parser.send(&Payload{Data: reply})
 		return nil
 	}
 }
@@ -179,29 +154,29 @@ func (parser *Parser) parseMultiBulk(header []byte) error {
 		return nil
 	} else if size == 0 {
 		reply := Reply.NewEmptyArrayReply() // Empty Multi Bulk Strings
-		parser.ch <- &Payload{Data: reply}
+		parser.send(&Payload{Data: reply})
 		return nil
 	}
 	bulks := make([][]byte, 0, size)
 	for i := int64(0); i < size; i++ {
-		header, err := parser.reader.ReadBytes('\n')
+		header, err := parser.readLine()
 		if err != nil {
 			return err
 		}
 		length := len(header)
 		if length < 4 || header[0] != '$' || header[length-2] != '\r' {
 			parser.handleError("illegal bulk string header '" + string(header) + "'")
-			break
+			return nil // 不完整的命令不发送
 		}
 		size, err := strconv.ParseInt(string(header[1:length-2]), 10, 64) // 解析当前bulk string的正文长度
 		if err != nil || size < -1 {
 			parser.handleError("illegal bulk string length '" + string(header) + "'")
-			break
+			return nil // 不完整的命令不发送
 		} else if size == -1 {
 			bulks = append(bulks, []byte{}) // null buck string
 		} else {
 			body := make([]byte, size+2) // 正文长度+CRLF长度
-			_, err := io.ReadFull(parser.reader, body)
+			_, err := parser.readFull(body)
 			if err != nil {
 				return err
 			}
@@ -209,11 +184,154 @@ func (parser *Parser) parseMultiBulk(header []byte) error {
 		}
 	}
 	reply := Reply.NewArrayReply(bulks)
-	parser.ch <- &Payload{Data: reply}
+	parser.send(&Payload{Data: reply})
 	return nil
 }
 
+// parseRESP3 解析RESP3新增的类型，聚合类型的元素可以是任意类型
+func (parser *Parser) parseRESP3(line []byte) (_interface.Reply, error) {
+	switch line[0] {
+	case '_':
+		// 空值(Null)
+		return Reply.NewNullReply(), nil
+	case '#':
+		// 布尔值(Boolean)
+		switch string(line[1:]) {
+		case "t":
+			return Reply.NewBooleanReply(true), nil
+		case "f":
+			return Reply.NewBooleanReply(false), nil
+		}
+		return nil, errors.New("RESP error: illegal boolean '" + string(line[1:]) + "'")
+	case ',':
+		// 浮点数(Double)
+		value, err := strconv.ParseFloat(string(line[1:]), 64)
+		if err != nil {
+			return nil, errors.New("RESP error: illegal double '" + string(line[1:]) + "'")
+		}
+		return Reply.NewDoubleReply(value), nil
+	case '(':
+		// 大数(Big Number)
+		if _, ok := new(big.Int).SetString(string(line[1:]), 10); !ok {
+			return nil, errors.New("RESP error: illegal big number '" + string(line[1:]) + "'")
+		}
+		return Reply.NewBigNumberReply(string(line[1:])), nil
+	case '=', '!':
+		// 格式化字符串(Verbatim String)和错误字符串(Blob Error)
+		body, err := parser.readBlob(line)
+		if err != nil {
+			return nil, err
+		}
+		if line[0] == '!' {
+			return Reply.StandardError(string(body)), nil
+		}
+		if len(body) < 4 || body[3] != ':' {
+			return nil, errors.New("RESP error: illegal verbatim string '" + string(body) + "'")
+		}
+		return Reply.NewVerbatimReply(string(body[:3]), string(body[4:])), nil
+	case '%', '~', '>', '*':
+		// 映射(Map)、集合(Set)、推送(Push)，以及嵌套在其中的数组
+		size, err := strconv.Atoi(string(line[1:]))
+		if err != nil || size < -1 {
+			return nil, errors.New("RESP error: illegal aggregate header '" + string(line) + "'")
+		}
+		if size == -1 {
+			return Reply.NewNullReply(), nil
+		}
+		count := size
+		if line[0] == '%' {
+			count = 2 * size
+		}
+		replies := make([]_interface.Reply, count)
+		for i := 0; i < count; i++ {
+			replies[i], err = parser.readValue()
+			if err != nil {
+				return nil, err
+			}
+		}
+		switch line[0] {
+		case '%':
+			return Reply.NewMapReply(replies), nil
+		case '~':
+			return Reply.NewSetReply(replies), nil
+		case '>':
+			return Reply.NewPushReply(replies), nil
+		}
+		return Reply.NewRawArrayReply(replies), nil
+	}
+	return nil, errors.New("RESP error: unknown type '" + string(line[:1]) + "'")
+}
+
+// readValue 读取一个完整的任意类型的值，用于解析聚合类型中的元素
+func (parser *Parser) readValue() (_interface.Reply, error) {
+	line, err := parser.readLine()
+	if err != nil {
+		return nil, err
+	}
+	length := len(line)
+	if length < 3 || line[length-2] != '\r' {
+		return nil, errors.New("RESP error: illegal line '" + string(line) + "'")
+	}
+	line = line[:length-2]
+	switch line[0] {
+	case '+':
+		return Reply.NewStringReply(string(line[1:])), nil
+	case '-':
+		return Reply.StandardError(string(line[1:])), nil
+	case ':':
+		value, err := strconv.ParseInt(string(line[1:]), 10, 64)
+		if err != nil {
+			return nil, errors.New("RESP error: illegal number '" + string(line[1:]) + "'")
+		}
+		return Reply.NewIntegerReply(value), nil
+	case '$':
+		if string(line[1:]) == "-1" {
+			return Reply.NewNilBulkReply(), nil
+		}
+		body, err := parser.readBlob(line)
+		if err != nil {
+			return nil, err
+		}
+		return Reply.NewBulkReply(body), nil
+	}
+	return parser.parseRESP3(line)
+}
+
+// readBlob 根据"<type><length>"的头部读取定长的正文
+func (parser *Parser) readBlob(header []byte) ([]byte, error) {
+	size, err := strconv.Atoi(string(header[1:]))
+	if err != nil || size < 0 {
+		return nil, errors.New("RESP error: illegal blob header '" + string(header) + "'")
+	}
+	body := make([]byte, size+2) // 正文长度+CRLF的长度
+	_, err = parser.readFull(body)
+	if err != nil {
+		return nil, err
+	}
+	return body[:size], nil
+}
+
+// readLine 读取一行，并记录已解析的字节数
+func (parser *Parser) readLine() ([]byte, error) {
+	line, err := parser.reader.ReadBytes('\n')
+	parser.offset += int64(len(line))
+	return line, err
+}
+
+// readFull 读取定长的数据，并记录已解析的字节数
+func (parser *Parser) readFull(buf []byte) (int, error) {
+	n, err := io.ReadFull(parser.reader, buf)
+	parser.offset += int64(n)
+	return n, err
+}
+
+// send 发送解析结果，附带其结束位置在输入中的偏移量
+func (parser *Parser) send(payload *Payload) {
+	payload.Offset = parser.offset
+	parser.ch <- payload
+}
+
 func (parser *Parser) handleError(msg string) {
 	err := errors.New("RESP error: " + msg)
-	parser.ch <- &Payload{Err: err}
+	parser.send(&Payload{Err: err})
 }
@@ -5,6 +5,7 @@ import (
 )
 
 type Payload struct {
-	Data _interface.Reply
-	Err  error
+	Data   _interface.Reply
+	Err    error
+	Offset int64 // 该结果结束时在输入中的偏移量，用于截断AOF文件
 }
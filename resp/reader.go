@@ -0,0 +1,300 @@
+package resp
+
+import (
+	"bytes"
+	"errors"
+	_type "go-redis/interface/type"
+	"go-redis/redis/utils"
+	"io"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	readBufferSize = 16 * 1024 // 读缓冲区的初始大小
+	bigArgSize     = 32 * 1024 // 不小于该长度的参数直接从连接读入参数自身的内存中，不经过读缓冲区
+	maxPrealloc    = 1024      // 根据数组长度预分配参数时的上限，避免恶意的超大长度
+)
+
+// MaxInlineSize inline命令的最大长度，超过时视为协议错误
+const MaxInlineSize = 64 * 1024
+
+// 单个bulk string的最大长度，对应配置项proto-max-bulk-len，config set时由其他goroutine修改
+var maxBulkLen int64 = 512 * 1024 * 1024
+
+// SetMaxBulkLen 修改bulk string的最大长度，对之后读取的命令生效，只限制client发送的命令，不限制aof文件
+func SetMaxBulkLen(n int64) {
+	atomic.StoreInt64(&maxBulkLen, n)
+}
+
+// 单个client未执行的命令所占用的最大内存，对应配置项client-query-buffer-limit，config set时由其他goroutine修改
+var maxQueryBufferLen int64 = 1024 * 1024 * 1024
+
+// SetMaxQueryBufferLen 修改client未执行的命令所占用的最大内存，对之后读取的命令生效
+func SetMaxQueryBufferLen(n int64) {
+	atomic.StoreInt64(&maxQueryBufferLen, n)
+}
+
+var (
+	ErrQueryBufferLimit  = errors.New("Protocol error: query buffer limit reached")
+	errTooBigInline      = errors.New("Protocol error: too big inline request")
+	errTooBigCount       = errors.New("Protocol error: too big mbulk count string")
+	errTooBigBulkCount   = errors.New("Protocol error: too big bulk count string")
+	errUnbalancedQuotes  = errors.New("Protocol error: unbalanced quotes in request")
+	errInvalidMultiBulk  = errors.New("Protocol error: invalid multibulk length")
+	errInvalidBulkLength = errors.New("Protocol error: invalid bulk length")
+)
+
+// 读缓冲区的复用池，用于空闲时释放读缓冲区的连接
+var readBufferPool = sync.Pool{
+	New: func() any {
+		return make([]byte, readBufferSize)
+	},
+}
+
+// Reader 在client的goroutine中同步读取命令，不再为每个连接开启解析goroutine
+// 读缓冲区被反复使用，命令的参数不能引用读缓冲区(执行命令时参数可能被保存，如set的value)，因此：
+// 小参数被复制到每条命令各自的一块连续内存中，每条命令只需一次分配；
+// 大参数(不小于bigArgSize)直接从连接读入参数自身的内存中，不经过读缓冲区，避免大块数据的复制
+// 读取返回错误(如非阻塞连接的EAGAIN)时已读取的数据被保留，再次调用ReadCommand时继续解析
+type Reader struct {
+	rd   io.Reader
+	buf  []byte // 读缓冲区，buf[r:w]为未解析的数据
+	r, w int
+
+	// 当前正在解析的命令，数据不完整时保留，读取更多数据后继续解析
+	pending int      // 还未读取的参数个数，0表示当前没有正在解析的RESP数组
+	args    []argRef // 已读取的参数
+	arena   []byte   // 小参数的数据
+	size    int64    // 已读取的参数的总长度，用于client-query-buffer-limit
+	bulkLen int      // 当前参数的长度，-1表示还未读取长度
+	big     []byte   // 正在读取的大参数(包括末尾的CRLF)
+	bigRead int      // 大参数已读取的长度
+}
+
+// argRef 参数在arena中的位置，大参数的数据单独存放在data中
+type argRef struct {
+	start, end int
+	data       []byte
+}
+
+func NewReader(rd io.Reader) *Reader {
+	return &Reader{
+		rd:      rd,
+		bulkLen: -1, // 读缓冲区在第一次读取时获取
+	}
+}
+
+// Buffered 读缓冲区中未解析的数据长度
+func (reader *Reader) Buffered() int {
+	return reader.w - reader.r
+}
+
+// ReadCommand 读取一条完整的命令，'*'开头的为RESP数组，其余为inline命令
+// 返回io.EOF等读取错误，或以"Protocol error"开头的协议错误，出现错误后不能继续读取
+func (reader *Reader) ReadCommand() (_type.CmdLine, error) {
+	for {
+		cmdLine, ok, err := reader.parse()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return cmdLine, nil
+		}
+		if err = reader.fill(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parse 从读缓冲区中解析命令，数据不完整时返回false
+func (reader *Reader) parse() (_type.CmdLine, bool, error) {
+	for {
+		if reader.pending == 0 {
+			if reader.r == reader.w {
+				return nil, false, nil
+			}
+			if reader.buf[reader.r] != '*' {
+				cmdLine, ok, err := reader.parseInline()
+				if err != nil || !ok || len(cmdLine) > 0 {
+					return cmdLine, ok, err
+				}
+				continue // 忽略空行
+			}
+			// 数组长度
+			line, ok := reader.readLine()
+			if !ok {
+				if reader.Buffered() > MaxInlineSize {
+					return nil, false, errTooBigCount
+				}
+				return nil, false, nil
+			}
+			count, err := strconv.ParseInt(string(line[1:]), 10, 64)
+			if err != nil || count > 1024*1024*1024 {
+				return nil, false, errInvalidMultiBulk
+			}
+			if count <= 0 {
+				continue // 空数组被忽略
+			}
+			reader.pending = int(count)
+			if cap(reader.args) < reader.pending && reader.pending <= maxPrealloc {
+				reader.args = make([]argRef, 0, reader.pending)
+			}
+		}
+		// 参数
+		for reader.pending > 0 {
+			if reader.bulkLen < 0 {
+				if reader.r == reader.w {
+					return nil, false, nil
+				}
+				if reader.buf[reader.r] != '$' {
+					return nil, false, errors.New("Protocol error: expected '$', got '" + string(reader.buf[reader.r]) + "'")
+				}
+				line, ok := reader.readLine()
+				if !ok {
+					if reader.Buffered() > MaxInlineSize {
+						return nil, false, errTooBigBulkCount
+					}
+					return nil, false, nil
+				}
+				size, err := strconv.ParseInt(string(line[1:]), 10, 64)
+				if err != nil || size < 0 || size > atomic.LoadInt64(&maxBulkLen) {
+					return nil, false, errInvalidBulkLength
+				}
+				reader.size += size
+				if reader.size > atomic.LoadInt64(&maxQueryBufferLen) {
+					return nil, false, ErrQueryBufferLimit
+				}
+				reader.bulkLen = int(size)
+			}
+			if reader.bulkLen >= bigArgSize {
+				if err := reader.readBigArg(); err != nil {
+					return nil, false, err
+				}
+				continue
+			}
+			// 参数及末尾的CRLF已完整读入缓冲区
+			if reader.Buffered() < reader.bulkLen+2 {
+				return nil, false, nil
+			}
+			start := len(reader.arena)
+			reader.arena = append(reader.arena, reader.buf[reader.r:reader.r+reader.bulkLen]...)
+			reader.args = append(reader.args, argRef{start: start, end: len(reader.arena)})
+			reader.r += reader.bulkLen + 2
+			reader.bulkLen = -1
+			reader.pending--
+		}
+		return reader.finishCommand(), true, nil
+	}
+}
+
+// readBigArg 将大参数已在缓冲区中的部分复制到参数自身的内存中，剩余部分直接从连接读取
+func (reader *Reader) readBigArg() error {
+	if reader.big == nil {
+		reader.big = make([]byte, reader.bulkLen+2)
+		reader.bigRead = copy(reader.big, reader.buf[reader.r:reader.w])
+		reader.r += reader.bigRead
+	}
+	for reader.bigRead < len(reader.big) {
+		n, err := reader.rd.Read(reader.big[reader.bigRead:])
+		reader.bigRead += n
+		if err != nil && reader.bigRead < len(reader.big) {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+	}
+	reader.args = append(reader.args, argRef{data: reader.big[:reader.bulkLen]})
+	reader.big = nil
+	reader.bulkLen = -1
+	reader.pending--
+	return nil
+}
+
+// finishCommand 由已读取的参数生成命令，并重置解析状态
+func (reader *Reader) finishCommand() _type.CmdLine {
+	cmdLine := make(_type.CmdLine, len(reader.args))
+	for i, arg := range reader.args {
+		if arg.data != nil {
+			cmdLine[i] = arg.data
+		} else {
+			cmdLine[i] = reader.arena[arg.start:arg.end:arg.end]
+		}
+	}
+	reader.args = reader.args[:0]
+	reader.arena = nil // arena被命令引用，不能复用
+	reader.size = 0
+	return cmdLine
+}
+
+// parseInline 解析一行inline命令，空行返回长度为0的命令
+func (reader *Reader) parseInline() (_type.CmdLine, bool, error) {
+	line, ok := reader.readLine()
+	if !ok {
+		if reader.Buffered() > MaxInlineSize {
+			return nil, false, errTooBigInline
+		}
+		return nil, false, nil
+	}
+	args, err := utils.ParseCmds(line)
+	if err != nil {
+		return nil, false, errUnbalancedQuotes
+	}
+	return args, true, nil
+}
+
+// readLine 读取缓冲区中的一行，去掉末尾的CRLF(或LF)，返回的数据引用读缓冲区
+func (reader *Reader) readLine() ([]byte, bool) {
+	i := bytes.IndexByte(reader.buf[reader.r:reader.w], '\n')
+	if i < 0 {
+		return nil, false
+	}
+	line := reader.buf[reader.r : reader.r+i]
+	reader.r += i + 1
+	return bytes.TrimSuffix(line, []byte{'\r'}), true
+}
+
+// Release 读缓冲区中没有未解析的数据时，将其放回复用池，下次读取时再获取
+// 用于由event loop处理的连接，空闲的连接不占用读缓冲区
+func (reader *Reader) Release() {
+	if reader.buf == nil || reader.r != reader.w {
+		return
+	}
+	if len(reader.buf) == readBufferSize {
+		readBufferPool.Put(reader.buf) // 扩容后的缓冲区直接丢弃
+	}
+	reader.buf = nil
+	reader.r, reader.w = 0, 0
+}
+
+// fill 从连接读取数据，缓冲区已满时先丢弃已解析的数据，仍然不足时扩容
+func (reader *Reader) fill() error {
+	if reader.buf == nil {
+		reader.buf = readBufferPool.Get().([]byte)
+	}
+	if reader.r == reader.w {
+		reader.r, reader.w = 0, 0
+	}
+	if reader.w == len(reader.buf) {
+		if reader.r > 0 {
+			reader.w = copy(reader.buf, reader.buf[reader.r:reader.w])
+			reader.r = 0
+		} else {
+			// 未解析的数据占满了缓冲区，如较长的inline命令或较多的小参数
+			if int64(len(reader.buf))+reader.size > atomic.LoadInt64(&maxQueryBufferLen) {
+				return ErrQueryBufferLimit
+			}
+			buf := make([]byte, 2*len(reader.buf))
+			copy(buf, reader.buf[:reader.w])
+			reader.buf = buf
+		}
+	}
+	n, err := reader.rd.Read(reader.buf[reader.w:])
+	reader.w += n
+	if err != nil && n > 0 {
+		return nil // 先处理已读取的数据，错误会在下一次读取时再次出现
+	}
+	return err
+}
@@ -0,0 +1,243 @@
+package resp
+
+import (
+	"bytes"
+	"errors"
+	_type "go-redis/interface/type"
+	Reply "go-redis/resp/reply"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func readAll(t *testing.T, rd io.Reader) []_type.CmdLine {
+	reader := NewReader(rd)
+	cmdLines := make([]_type.CmdLine, 0)
+	for {
+		cmdLine, err := reader.ReadCommand()
+		if err == io.EOF {
+			return cmdLines
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		cmdLines = append(cmdLines, cmdLine)
+	}
+}
+
+func TestReader_ReadCommand(t *testing.T) {
+	big := strings.Repeat("v", 100*1024)
+	input := "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n" +
+		"\r\n" + // 空行被忽略
+		"*0\r\n" + // 空数组被忽略
+		"ping\r\n" +
+		"set k \"a b\\n\" 'c'\n" +
+		"set foo\"bar\" v\r\n" +
+		"*3\r\n$3\r\nSET\r\n$3\r\nbig\r\n$" + strconv.Itoa(len(big)) + "\r\n" + big + "\r\n" +
+		"*2\r\n$4\r\nECHO\r\n$0\r\n\r\n"
+	expected := [][]string{
+		{"SET", "key", "value"},
+		{"ping"},
+		{"set", "k", "a b\n", "c"},
+		{"set", "foobar", "v"},
+		{"SET", "big", big},
+		{"ECHO", ""},
+	}
+	// 一次读取全部数据，以及每次只读取一个字节
+	for _, rd := range []io.Reader{strings.NewReader(input), iotest.OneByteReader(strings.NewReader(input))} {
+		cmdLines := readAll(t, rd)
+		if len(cmdLines) != len(expected) {
+			t.Fatalf("expected %d commands, got %d", len(expected), len(cmdLines))
+		}
+		for i, cmdLine := range cmdLines {
+			if len(cmdLine) != len(expected[i]) {
+				t.Fatalf("command %d: expected %q, got %q", i, expected[i], cmdLine)
+			}
+			for j, arg := range cmdLine {
+				if string(arg) != expected[i][j] {
+					t.Fatalf("command %d: expected %q, got %q", i, expected[i], cmdLine)
+				}
+			}
+		}
+	}
+}
+
+func TestReader_ArgsNotShared(t *testing.T) {
+	input := "*2\r\n$3\r\nGET\r\n$1\r\na\r\n*2\r\n$3\r\nGET\r\n$1\r\nb\r\n"
+	cmdLines := readAll(t, strings.NewReader(input))
+	// 参数不引用读缓冲区，也不与其他命令共享内存
+	cmdLines[0][1] = append(cmdLines[0][1], 'x')
+	if string(cmdLines[1][0]) != "GET" || string(cmdLines[1][1]) != "b" {
+		t.Fatalf("arguments overwritten: %q", cmdLines[1])
+	}
+}
+
+// againReader 每次读取最多返回n个字节，每两次读取之间返回一次errAgain，模拟非阻塞连接
+type againReader struct {
+	rd    io.Reader
+	n     int
+	again bool
+}
+
+var errAgain = errors.New("again")
+
+func (r *againReader) Read(p []byte) (int, error) {
+	r.again = !r.again
+	if r.again {
+		return 0, errAgain
+	}
+	if len(p) > r.n {
+		p = p[:r.n]
+	}
+	return r.rd.Read(p)
+}
+
+func TestReader_Resume(t *testing.T) {
+	big := strings.Repeat("b", 50*1024)
+	input := "*2\r\n$4\r\nECHO\r\n$5\r\nhello\r\n" +
+		"*2\r\n$4\r\nECHO\r\n$" + strconv.Itoa(len(big)) + "\r\n" + big + "\r\n" +
+		"ping\r\n"
+	reader := NewReader(&againReader{rd: strings.NewReader(input), n: 7000})
+	expected := []string{"hello", big, ""}
+	for i := 0; i < len(expected); {
+		cmdLine, err := reader.ReadCommand()
+		if err == errAgain {
+			reader.Release()
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if last := string(cmdLine[len(cmdLine)-1]); expected[i] != "" && last != expected[i] {
+			t.Fatalf("command %d: unexpected argument of length %d", i, len(last))
+		}
+		i++
+	}
+}
+
+func TestReader_Errors(t *testing.T) {
+	savedBulk, savedQuery := maxBulkLen, maxQueryBufferLen
+	defer func() {
+		SetMaxBulkLen(savedBulk)
+		SetMaxQueryBufferLen(savedQuery)
+	}()
+	SetMaxBulkLen(64 * 1024)
+	SetMaxQueryBufferLen(1024 * 1024)
+	tests := []struct {
+		input    string
+		expected error
+	}{
+		{"*1\r\n$65537\r\n", errInvalidBulkLength},
+		{"*1\r\n$-1\r\n", errInvalidBulkLength},
+		{"*x\r\n", errInvalidMultiBulk},
+		{"*1\r\n+OK\r\n", nil}, // expected '$'
+		{"set k \"v\r\n", errUnbalancedQuotes},
+		{strings.Repeat("a", MaxInlineSize+1), errTooBigInline},
+		{"*20\r\n" + strings.Repeat("$60000\r\n"+strings.Repeat("v", 60000)+"\r\n", 20), ErrQueryBufferLimit},
+		{"*2\r\n$3\r\nGET\r\n", io.EOF},
+		{"*1\r\n$40000\r\nvalue", io.ErrUnexpectedEOF},
+	}
+	for _, test := range tests {
+		_, err := NewReader(strings.NewReader(test.input)).ReadCommand()
+		if err == nil || (test.expected != nil && err != test.expected) {
+			t.Errorf("input %q: expected error %v, got %v", test.input[:min(len(test.input), 20)], test.expected, err)
+		}
+	}
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// config set修改限制时其他连接正在读取命令，使用-race检查
+func TestReader_SetLimitsConcurrently(t *testing.T) {
+	savedBulk, savedQuery := maxBulkLen, maxQueryBufferLen
+	defer func() {
+		SetMaxBulkLen(savedBulk)
+		SetMaxQueryBufferLen(savedQuery)
+	}()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			SetMaxBulkLen(int64(1<<20 + i))
+			SetMaxQueryBufferLen(int64(1<<30 + i))
+		}
+	}()
+	if cmdLines := readAll(t, bytes.NewReader(pipeline(1000, 16))); len(cmdLines) != 1000 {
+		t.Fatalf("expected 1000 commands, got %d", len(cmdLines))
+	}
+	<-done
+}
+
+// pipeline 生成包含n条SET命令的数据，模拟pipeline
+func pipeline(n int, valueSize int) []byte {
+	value := strings.Repeat("v", valueSize)
+	var buf bytes.Buffer
+	for i := 0; i < n; i++ {
+		key := "key:" + strconv.Itoa(i)
+		buf.WriteString("*3\r\n$3\r\nSET\r\n$" + strconv.Itoa(len(key)) + "\r\n" + key + "\r\n")
+		buf.WriteString("$" + strconv.Itoa(len(value)) + "\r\n" + value + "\r\n")
+	}
+	return buf.Bytes()
+}
+
+// 基于goroutine及channel的解析器，每条命令都经过channel传递
+func benchmarkParser(b *testing.B, data []byte, n int) {
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		count := 0
+		for payload := range NewParser(bytes.NewReader(data)).ParseFile() {
+			if payload.Err != nil {
+				break
+			}
+			if _, ok := payload.Data.(*Reply.ArrayReply); ok {
+				count++
+			}
+		}
+		if count != n {
+			b.Fatalf("expected %d commands, got %d", n, count)
+		}
+	}
+}
+
+// 同步读取命令，读缓冲区被复用
+func benchmarkReader(b *testing.B, data []byte, n int) {
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		reader := NewReader(bytes.NewReader(data))
+		count := 0
+		for {
+			if _, err := reader.ReadCommand(); err != nil {
+				break
+			}
+			count++
+		}
+		if count != n {
+			b.Fatalf("expected %d commands, got %d", n, count)
+		}
+	}
+}
+
+func BenchmarkParser_Pipeline(b *testing.B) {
+	benchmarkParser(b, pipeline(1000, 16), 1000)
+}
+
+func BenchmarkReader_Pipeline(b *testing.B) {
+	benchmarkReader(b, pipeline(1000, 16), 1000)
+}
+
+func BenchmarkParser_PipelineLargeValue(b *testing.B) {
+	benchmarkParser(b, pipeline(100, 64*1024), 100)
+}
+
+func BenchmarkReader_PipelineLargeValue(b *testing.B) {
+	benchmarkReader(b, pipeline(100, 64*1024), 100)
+}
@@ -48,6 +48,10 @@ func (r *NilBulkReply) ToBytes() []byte {
 	return nilBulkBytes
 }
 
+func (r *NilBulkReply) ToRESP3() []byte {
+	return nullBytes
+}
+
 /* ---- Empty Bulk String Reply ---- */
 
 type EmptyReply struct{}
@@ -95,3 +99,43 @@ func NewQueuedReply() *QueuedReply {
 func (r *QueuedReply) ToBytes() []byte {
 	return queuedBytes
 }
+
+/* ---- No Reply ---- */
+
+// NoReply 不向客户端发送任何内容，用于已自行写出回复的命令，如subscribe
+type NoReply struct{}
+
+var noReply = &NoReply{}
+
+var noBytes = []byte{}
+
+func NewNoReply() *NoReply {
+	return noReply
+}
+
+func (r *NoReply) ToBytes() []byte {
+	return noBytes
+}
+
+/* ---- Null Reply ---- */
+
+// NullReply RESP3中的null，RESP2下编码为null array
+type NullReply struct{}
+
+var nullReply = &NullReply{}
+
+var nullArrayBytes = []byte("*-1\r\n")
+
+var nullBytes = []byte("_\r\n")
+
+func NewNullReply() *NullReply {
+	return nullReply
+}
+
+func (r *NullReply) ToBytes() []byte {
+	return nullArrayBytes
+}
+
+func (r *NullReply) ToRESP3() []byte {
+	return nullBytes
+}
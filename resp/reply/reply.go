@@ -75,6 +75,13 @@ func (r *BulkReply) ToBytes() []byte {
 	return []byte("$" + strconv.Itoa(len(r.Bulk)) + CRLF + string(r.Bulk) + CRLF)
 }
 
+func (r *BulkReply) ToRESP3() []byte {
+	if r.Bulk == nil {
+		return nullBytes
+	}
+	return r.ToBytes()
+}
+
 /* ---- Array Reply (multi bulk strings) ---- */
 
 type ArrayReply struct {
@@ -88,12 +95,21 @@ func NewArrayReply(bulks [][]byte) *ArrayReply {
 }
 
 func (r *ArrayReply) ToBytes() []byte {
+	return r.encode(nilBulkBytes)
+}
+
+func (r *ArrayReply) ToRESP3() []byte {
+	return r.encode(nullBytes)
+}
+
+// 编码数组，nil元素编码为null
+func (r *ArrayReply) encode(null []byte) []byte {
 	length := len(r.Bulks)
 	var buf bytes.Buffer
 	buf.WriteString("*" + strconv.Itoa(length) + CRLF)
 	for _, arg := range r.Bulks {
 		if arg == nil {
-			buf.Write(nilBulkBytes)
+			buf.Write(null)
 		} else {
 			buf.WriteString("$" + strconv.Itoa(len(arg)) + CRLF + string(arg) + CRLF)
 		}
@@ -114,11 +130,9 @@ func NewRawArrayReply(replies []_interface.Reply) *RawArrayReply {
 }
 
 func (r *RawArrayReply) ToBytes() []byte {
-	argLen := len(r.Replies)
-	var buf bytes.Buffer
-	buf.WriteString("*" + strconv.Itoa(argLen) + CRLF)
-	for _, reply := range r.Replies {
-		buf.Write(reply.ToBytes())
-	}
-	return buf.Bytes()
+	return encodeAggregate('*', len(r.Replies), r.Replies, 2)
+}
+
+func (r *RawArrayReply) ToRESP3() []byte {
+	return encodeAggregate('*', len(r.Replies), r.Replies, 3)
 }
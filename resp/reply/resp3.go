@@ -0,0 +1,201 @@
+package reply
+
+import (
+	"bytes"
+	_interface "go-redis/interface"
+	"math"
+	"strconv"
+)
+
+// RESP3新增的回复类型，ToBytes为降级到RESP2时的编码，ToRESP3为RESP3下的编码
+
+/* ---- Map Reply ---- */
+
+type MapReply struct {
+	Pairs []_interface.Reply // key1, value1, key2, value2...
+}
+
+func NewMapReply(pairs []_interface.Reply) *MapReply {
+	return &MapReply{
+		Pairs: pairs,
+	}
+}
+
+func (r *MapReply) ToBytes() []byte {
+	return encodeAggregate('*', len(r.Pairs), r.Pairs, 2)
+}
+
+func (r *MapReply) ToRESP3() []byte {
+	return encodeAggregate('%', len(r.Pairs)/2, r.Pairs, 3)
+}
+
+/* ---- Set Reply ---- */
+
+type SetReply struct {
+	Members []_interface.Reply
+}
+
+func NewSetReply(members []_interface.Reply) *SetReply {
+	return &SetReply{
+		Members: members,
+	}
+}
+
+func (r *SetReply) ToBytes() []byte {
+	return encodeAggregate('*', len(r.Members), r.Members, 2)
+}
+
+func (r *SetReply) ToRESP3() []byte {
+	return encodeAggregate('~', len(r.Members), r.Members, 3)
+}
+
+/* ---- Push Reply ---- */
+
+type PushReply struct {
+	Replies []_interface.Reply
+}
+
+func NewPushReply(replies []_interface.Reply) *PushReply {
+	return &PushReply{
+		Replies: replies,
+	}
+}
+
+func (r *PushReply) ToBytes() []byte {
+	return encodeAggregate('*', len(r.Replies), r.Replies, 2)
+}
+
+func (r *PushReply) ToRESP3() []byte {
+	return encodeAggregate('>', len(r.Replies), r.Replies, 3)
+}
+
+/* ---- Double Reply ---- */
+
+type DoubleReply struct {
+	Double float64
+}
+
+func NewDoubleReply(double float64) *DoubleReply {
+	return &DoubleReply{
+		Double: double,
+	}
+}
+
+func (r *DoubleReply) ToBytes() []byte {
+	return NewBulkReply([]byte(FormatDouble(r.Double))).ToBytes()
+}
+
+func (r *DoubleReply) ToRESP3() []byte {
+	return []byte("," + FormatDouble(r.Double) + CRLF)
+}
+
+// FormatDouble 按redis的格式输出浮点数
+func FormatDouble(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+/* ---- Boolean Reply ---- */
+
+type BooleanReply struct {
+	Bool bool
+}
+
+var (
+	trueReply  = &BooleanReply{Bool: true}
+	falseReply = &BooleanReply{Bool: false}
+)
+
+func NewBooleanReply(b bool) *BooleanReply {
+	if b {
+		return trueReply
+	}
+	return falseReply
+}
+
+func (r *BooleanReply) ToBytes() []byte {
+	if r.Bool {
+		return []byte(":1" + CRLF)
+	}
+	return []byte(":0" + CRLF)
+}
+
+func (r *BooleanReply) ToRESP3() []byte {
+	if r.Bool {
+		return []byte("#t" + CRLF)
+	}
+	return []byte("#f" + CRLF)
+}
+
+/* ---- Big Number Reply ---- */
+
+type BigNumberReply struct {
+	Number string
+}
+
+func NewBigNumberReply(number string) *BigNumberReply {
+	return &BigNumberReply{
+		Number: number,
+	}
+}
+
+func (r *BigNumberReply) ToBytes() []byte {
+	return NewBulkReply([]byte(r.Number)).ToBytes()
+}
+
+func (r *BigNumberReply) ToRESP3() []byte {
+	return []byte("(" + r.Number + CRLF)
+}
+
+/* ---- Verbatim String Reply ---- */
+
+type VerbatimReply struct {
+	Format  string // 三个字符的格式，如txt、mkd
+	Content string
+}
+
+func NewVerbatimReply(format string, content string) *VerbatimReply {
+	return &VerbatimReply{
+		Format:  format,
+		Content: content,
+	}
+}
+
+func (r *VerbatimReply) ToBytes() []byte {
+	return NewBulkReply([]byte(r.Content)).ToBytes()
+}
+
+func (r *VerbatimReply) ToRESP3() []byte {
+	body := r.Format + ":" + r.Content
+	return []byte("=" + strconv.Itoa(len(body)) + CRLF + body + CRLF)
+}
+
+/* ---- encode ---- */
+
+// Encode 按指定的协议版本编码回复
+func Encode(reply _interface.Reply, protocol int) []byte {
+	if protocol == 3 {
+		if r3, ok := reply.(_interface.RESP3Reply); ok {
+			return r3.ToRESP3()
+		}
+	}
+	return reply.ToBytes()
+}
+
+// 编码聚合类型，子元素按同一协议版本编码
+func encodeAggregate(prefix byte, size int, replies []_interface.Reply, protocol int) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(prefix)
+	buf.WriteString(strconv.Itoa(size) + CRLF)
+	for _, reply := range replies {
+		buf.Write(Encode(reply, protocol))
+	}
+	return buf.Bytes()
+}
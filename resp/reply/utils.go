@@ -23,3 +23,12 @@ func IsOKReply(reply _interface.Reply) bool {
 func IsErrorReply(reply _interface.Reply) bool {
 	return reply.ToBytes()[0] == '-'
 }
+
+// BulksToReplies 将若干bulk string转换为回复数组，用于构造map、set等RESP3回复
+func BulksToReplies(bulks [][]byte) []_interface.Reply {
+	replies := make([]_interface.Reply, len(bulks))
+	for i, bulk := range bulks {
+		replies[i] = NewBulkReply(bulk)
+	}
+	return replies
+}
@@ -0,0 +1,325 @@
+//go:build linux
+
+package tcp
+
+import (
+	"errors"
+	"fmt"
+	"go-redis/redis"
+	"go-redis/resp"
+	"go-redis/utils/logger"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// 监听读事件时使用的epoll事件，连接可读、对端关闭或出错时触发
+const readEvents = syscall.EPOLLIN | syscall.EPOLLRDHUP
+
+// eventLoops 一组event loop，新连接轮流分配给各个event loop
+type eventLoops struct {
+	loops []*eventLoop
+	next  uint32
+}
+
+// eventLoop 通过epoll处理一组连接，连接可读时启动goroutine非阻塞地读取并执行命令，数据读完后goroutine退出
+// 命令可能阻塞(client pause、等待key的锁等)，因此不在loop中执行，以免阻塞同一loop上的其他连接
+// 回复由client的writer goroutine发送，空闲的连接不占用goroutine
+type eventLoop struct {
+	epfd    int
+	handler *Handler
+	lock    sync.Mutex
+	conns   map[int]*pollConn // fd -> 连接
+}
+
+func newEventLoops(n int, handler *Handler) (*eventLoops, error) {
+	loops := &eventLoops{}
+	for i := 0; i < n; i++ {
+		epfd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+		if err != nil {
+			for _, loop := range loops.loops {
+				_ = syscall.Close(loop.epfd)
+			}
+			return nil, fmt.Errorf("epoll_create failed: %s", err.Error())
+		}
+		loops.loops = append(loops.loops, &eventLoop{
+			epfd:    epfd,
+			handler: handler,
+			conns:   make(map[int]*pollConn),
+		})
+	}
+	for _, loop := range loops.loops {
+		go loop.run()
+	}
+	return loops, nil
+}
+
+// serve 将连接交给event loop处理
+func (loops *eventLoops) serve(conn net.Conn) {
+	pc, err := newPollConn(conn)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("connection %s can not be polled: %s", conn.RemoteAddr().String(), err.Error()))
+		_ = conn.Close()
+		return
+	}
+	loop := loops.loops[atomic.AddUint32(&loops.next, 1)%uint32(len(loops.loops))]
+	pc.loop = loop
+	client := loop.handler.open(pc, redis.NewLazyClient)
+	if client == nil {
+		pc.release()
+		return
+	}
+	pc.client = client
+	pc.reader = resp.NewReader(&flushReader{conn: pc, client: client})
+	if err = loop.add(pc); err != nil {
+		logger.Warn(fmt.Sprintf("epoll_ctl failed: %s", err.Error()))
+		loop.handler.closeClient(client)
+		pc.release()
+	}
+}
+
+func (loop *eventLoop) add(conn *pollConn) error {
+	loop.lock.Lock()
+	loop.conns[conn.fd] = conn
+	loop.lock.Unlock()
+	event := &syscall.EpollEvent{Events: readEvents | syscall.EPOLLONESHOT, Fd: int32(conn.fd)}
+	if err := syscall.EpollCtl(loop.epfd, syscall.EPOLL_CTL_ADD, conn.fd, event); err != nil {
+		loop.lock.Lock()
+		delete(loop.conns, conn.fd)
+		loop.lock.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (loop *eventLoop) remove(conn *pollConn) {
+	_ = syscall.EpollCtl(loop.epfd, syscall.EPOLL_CTL_DEL, conn.fd, nil)
+	loop.lock.Lock()
+	delete(loop.conns, conn.fd)
+	loop.lock.Unlock()
+}
+
+// watchWritable 发送缓冲区已满时，同时监听写事件，可写后恢复为只监听读事件
+func (loop *eventLoop) watchWritable(conn *pollConn) error {
+	conn.stateLock.Lock()
+	defer conn.stateLock.Unlock()
+	conn.waitWrite = true
+	return loop.rearm(conn)
+}
+
+// rearm 按连接的状态重新注册事件，正在执行命令时不监听读事件，保证同一连接同时只有一个goroutine读取
+// 调用方需持有conn.stateLock
+func (loop *eventLoop) rearm(conn *pollConn) error {
+	// 使用EPOLLONESHOT，事件触发后由event loop或执行命令的goroutine按连接的状态重新注册
+	events := uint32(syscall.EPOLLONESHOT)
+	if !conn.processing {
+		events |= readEvents
+	}
+	if conn.waitWrite {
+		events |= syscall.EPOLLOUT
+	}
+	event := &syscall.EpollEvent{Events: events, Fd: int32(conn.fd)}
+	return syscall.EpollCtl(loop.epfd, syscall.EPOLL_CTL_MOD, conn.fd, event)
+}
+
+func (loop *eventLoop) run() {
+	events := make([]syscall.EpollEvent, 256)
+	for {
+		n, err := syscall.EpollWait(loop.epfd, events, -1)
+		if err != nil {
+			if err == syscall.EINTR {
+				continue
+			}
+			logger.Error("epoll_wait failed: " + err.Error())
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+		for i := 0; i < n; i++ {
+			loop.lock.Lock()
+			conn := loop.conns[int(events[i].Fd)]
+			loop.lock.Unlock()
+			if conn == nil {
+				continue // 已被移除
+			}
+			conn.stateLock.Lock()
+			if events[i].Events&syscall.EPOLLOUT != 0 && conn.waitWrite {
+				conn.waitWrite = false
+				select {
+				case conn.writable <- struct{}{}:
+				default:
+				}
+			}
+			read := events[i].Events&(readEvents|syscall.EPOLLHUP|syscall.EPOLLERR) != 0 && !conn.processing
+			if read {
+				conn.processing = true
+			}
+			_ = loop.rearm(conn)
+			conn.stateLock.Unlock()
+			if read {
+				go loop.read(conn)
+			}
+		}
+	}
+}
+
+// read 读取并执行已收到的命令，数据读完后重新监听读事件并退出
+func (loop *eventLoop) read(conn *pollConn) {
+	conn.readable = true
+	err := loop.handler.process(conn.client, conn.reader)
+	if errors.Is(err, syscall.EAGAIN) {
+		conn.client.Flush()
+		conn.reader.Release() // 空闲的连接不占用读缓冲区
+		conn.stateLock.Lock()
+		conn.processing = false
+		err = loop.rearm(conn)
+		conn.stateLock.Unlock()
+		if err == nil {
+			return
+		}
+	}
+	// 连接已断开或出错，不再监听，关闭时需要等待剩余数据发送完毕，因此在单独的goroutine中进行
+	loop.remove(conn)
+	go func() {
+		loop.handler.finish(conn.client, err)
+		conn.release()
+	}()
+}
+
+// pollConn 由event loop处理的非阻塞连接，实现了net.Conn
+// 读取只在可读事件触发的goroutine中进行，每次可读事件只读取一次，没有数据时返回EAGAIN；写入时发送缓冲区已满则等待可写事件
+type pollConn struct {
+	fd         int
+	loop       *eventLoop
+	client     *redis.Client
+	reader     *resp.Reader
+	localAddr  net.Addr
+	remoteAddr net.Addr
+	readable   bool          // 本次可读事件中是否还未读取
+	writable   chan struct{} // 可写事件的通知
+	stateLock  sync.Mutex    // 保护processing与waitWrite，并使重新注册事件与其保持一致
+	processing bool          // 是否有goroutine正在读取并执行命令
+	waitWrite  bool          // writer goroutine是否在等待可写事件
+	closed     int32
+	closeCh    chan struct{} // Close后被关闭，用于唤醒等待可写的writer goroutine
+}
+
+// newPollConn 复制连接的fd并设置为非阻塞，原连接被关闭，之后通过复制的fd读写
+func newPollConn(conn net.Conn) (*pollConn, error) {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return nil, errors.New("not a socket")
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	var fd int
+	var dupErr error
+	err = raw.Control(func(s uintptr) {
+		fd, dupErr = syscall.Dup(int(s))
+	})
+	if err == nil {
+		err = dupErr
+	}
+	localAddr, remoteAddr := conn.LocalAddr(), conn.RemoteAddr()
+	_ = conn.Close() // 复制的fd仍指向该socket，socket不会被关闭
+	if err != nil {
+		return nil, err
+	}
+	syscall.CloseOnExec(fd)
+	if err = syscall.SetNonblock(fd, true); err != nil {
+		_ = syscall.Close(fd)
+		return nil, err
+	}
+	return &pollConn{
+		fd:         fd,
+		localAddr:  localAddr,
+		remoteAddr: remoteAddr,
+		writable:   make(chan struct{}, 1),
+		closeCh:    make(chan struct{}),
+	}, nil
+}
+
+func (conn *pollConn) Read(p []byte) (int, error) {
+	if !conn.readable {
+		return 0, syscall.EAGAIN // 本次事件已读取过，避免一个连接长时间占用event loop
+	}
+	conn.readable = false
+	for {
+		n, err := syscall.Read(conn.fd, p)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			if atomic.LoadInt32(&conn.closed) == 1 {
+				return 0, net.ErrClosed
+			}
+			return 0, err
+		}
+		if n == 0 {
+			return 0, io.EOF
+		}
+		return n, nil
+	}
+}
+
+func (conn *pollConn) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		if atomic.LoadInt32(&conn.closed) == 1 {
+			return written, net.ErrClosed
+		}
+		n, err := syscall.Write(conn.fd, p[written:])
+		if n > 0 {
+			written += n
+		}
+		switch err {
+		case nil, syscall.EINTR:
+		case syscall.EAGAIN:
+			// 发送缓冲区已满，等待可写
+			if err = conn.loop.watchWritable(conn); err != nil {
+				return written, err
+			}
+			select {
+			case <-conn.writable:
+			case <-conn.closeCh:
+				return written, net.ErrClosed
+			}
+		default:
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// Close 关闭socket的读写，event loop随后收到事件并完成清理，fd在清理完成后才被关闭，避免被复用
+func (conn *pollConn) Close() error {
+	if !atomic.CompareAndSwapInt32(&conn.closed, 0, 1) {
+		return net.ErrClosed
+	}
+	close(conn.closeCh)
+	_ = syscall.Shutdown(conn.fd, syscall.SHUT_RDWR)
+	return nil
+}
+
+// release 关闭fd
+func (conn *pollConn) release() {
+	_ = conn.Close()
+	_ = syscall.Close(conn.fd)
+}
+
+func (conn *pollConn) LocalAddr() net.Addr {
+	return conn.localAddr
+}
+
+func (conn *pollConn) RemoteAddr() net.Addr {
+	return conn.remoteAddr
+}
+
+// 非阻塞连接不使用deadline
+func (conn *pollConn) SetDeadline(time.Time) error      { return nil }
+func (conn *pollConn) SetReadDeadline(time.Time) error  { return nil }
+func (conn *pollConn) SetWriteDeadline(time.Time) error { return nil }
@@ -0,0 +1,117 @@
+package tcp
+
+import (
+	"go-redis/redis"
+	"io"
+	"net"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestEventLoop_FlushBeforeBlockingRead(t *testing.T) {
+	handler := NewHandler()
+	defer func() { _ = handler.Close() }()
+	loops, err := newEventLoops(1, handler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = listener.Close() }()
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			loops.serve(conn)
+		}
+	}()
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	testPartialPipeline(t, conn)
+}
+
+// BenchmarkIdleConnections 比较两种io-model下空闲连接占用的内存及goroutine，每次迭代建立一个连接并执行一次PING
+// 连接建立后保持空闲，结束时报告每个连接平均占用的heap(包括测试中客户端一侧的连接)、goroutine栈及goroutine个数
+// 每个连接占用两个文件描述符：go test ./tcp -run ^$ -bench IdleConnections -benchtime 5000x
+func BenchmarkIdleConnections(b *testing.B) {
+	for _, model := range []string{redis.IOModelGoroutine, redis.IOModelEpoll} {
+		b.Run(model, func(b *testing.B) {
+			benchmarkIdleConnections(b, model)
+		})
+	}
+}
+
+func benchmarkIdleConnections(b *testing.B, model string) {
+	maxclients := redis.Config.Maxclients
+	redis.Config.Maxclients = b.N + 1
+	defer func() { redis.Config.Maxclients = maxclients }()
+	handler := NewHandler()
+	defer func() { _ = handler.Close() }()
+	serve := func(conn net.Conn) { go handler.Handle(conn) }
+	if model == redis.IOModelEpoll {
+		loops, err := newEventLoops(runtime.NumCPU(), handler)
+		if err != nil {
+			b.Fatal(err)
+		}
+		serve = loops.serve
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer func() { _ = listener.Close() }()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			serve(conn)
+		}
+	}()
+
+	conns := make([]net.Conn, 0, b.N)
+	defer func() {
+		for _, conn := range conns {
+			_ = conn.Close()
+		}
+	}()
+	heapBefore, stackBefore := memInuse()
+	goroutinesBefore := runtime.NumGoroutine()
+	b.ResetTimer()
+	reply := make([]byte, len("+PONG\r\n"))
+	for i := 0; i < b.N; i++ {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			b.Fatal(err)
+		}
+		conns = append(conns, conn)
+		_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+		if _, err := conn.Write([]byte("*1\r\n$4\r\nPING\r\n")); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+	// 等待处理PING的goroutine退出
+	time.Sleep(100 * time.Millisecond)
+	heap, stack := memInuse()
+	b.ReportMetric(float64(heap-heapBefore)/float64(b.N), "heap-B/conn")
+	b.ReportMetric(float64(stack-stackBefore)/float64(b.N), "stack-B/conn")
+	b.ReportMetric(float64(runtime.NumGoroutine()-goroutinesBefore)/float64(b.N), "goroutines/conn")
+}
+
+// memInuse GC后正在使用的heap及goroutine栈
+func memInuse() (heap int64, stack int64) {
+	runtime.GC()
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	return int64(mem.HeapInuse), int64(mem.StackInuse)
+}
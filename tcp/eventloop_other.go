@@ -0,0 +1,17 @@
+//go:build !linux
+
+package tcp
+
+import (
+	"errors"
+	"net"
+)
+
+// eventLoops epoll仅支持linux，其他平台使用goroutine模型
+type eventLoops struct{}
+
+func newEventLoops(n int, handler *Handler) (*eventLoops, error) {
+	return nil, errors.New("io-model epoll is only supported on linux")
+}
+
+func (loops *eventLoops) serve(conn net.Conn) {}
@@ -1,6 +1,8 @@
 package tcp
 
 import (
+	"crypto/tls"
+	"fmt"
 	_interface "go-redis/interface"
 	"go-redis/redis"
 	"go-redis/redis/commands"
@@ -8,12 +10,15 @@ import (
 	Reply "go-redis/resp/reply"
 	"go-redis/utils/logger"
 	_sync "go-redis/utils/sync"
-	"io"
 	"net"
 	"strings"
 	"sync"
+	"time"
 )
 
+// tls握手的超时时间
+const tlsHandshakeTimeout = 10 * time.Second
+
 type Handler struct {
 	server  _interface.Server
 	clients sync.Map
@@ -29,57 +34,94 @@ func NewHandler() *Handler {
 }
 
 func (handler *Handler) Handle(conn net.Conn) {
+	client := handler.open(conn, redis.NewClient)
+	if client == nil {
+		return
+	}
+	// handle，在当前goroutine中同步读取并执行命令
+	reader := resp.NewReader(&flushReader{conn: conn, client: client})
+	err := handler.process(client, reader)
+	handler.finish(client, err)
+}
+
+// open 建立连接，包装为client并记录到clients，连接被拒绝时返回nil
+func (handler *Handler) open(conn net.Conn, newClient func(net.Conn) *redis.Client) *redis.Client {
 	if handler.closing.Get() {
 		_ = conn.Close() // handler正处于closing状态，拒绝该连接
-		return
+		return nil
+	}
+
+	// tls连接先完成握手，以便得到客户端证书
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		_ = tlsConn.SetDeadline(time.Now().Add(tlsHandshakeTimeout))
+		if err := tlsConn.Handshake(); err != nil {
+			logger.Warn(fmt.Sprintf("tls handshake with %s failed: %s", conn.RemoteAddr().String(), err.Error()))
+			_ = conn.Close()
+			return nil
+		}
+		_ = tlsConn.SetDeadline(time.Time{})
 	}
 
 	// 包装为client，并记录到clients
-	client := redis.NewClient(conn)
+	client := newClient(conn)
+	if err := handler.server.AddClient(client); err != nil {
+		// 超过maxclients，返回错误后关闭连接
+		_, _ = client.Write([]byte("-ERR " + err.Error() + "\r\n"))
+		logger.Info(fmt.Sprintf("connection from %s rejected: %s", client.RemoteAddr(), err.Error()))
+		_ = client.Close()
+		return nil
+	}
 	handler.clients.Store(client, struct{}{})
+	return client
+}
 
-	// handle
-	parser := resp.NewParser(conn)
-	ch := parser.ParseCLI()
-	for payload := range ch {
-		if payload.Err != nil {
-			// EOF错误，连接已断开
-			if payload.Err == io.EOF || payload.Err == io.ErrUnexpectedEOF || strings.Contains(payload.Err.Error(), "use of closed network connection") {
-				handler.closeClient(client)
-				logger.Info("connection closed: " + client.RemoteAddr())
-				return
-			}
-			// 其他错误
-			errReply := Reply.StandardError(payload.Err.Error())
-			_, err := client.Write(errReply.ToBytes())
-			if err != nil {
-				handler.closeClient(client)
-				logger.Info("connection closed: " + client.RemoteAddr())
-				return
-			}
-			continue
-		}
-		if payload.Data == nil {
-			logger.Error("empty payload")
-			continue
-		}
-		// 构建commands
-		reply, ok := payload.Data.(*Reply.ArrayReply)
-		if !ok {
-			logger.Error("wrong commands line: require multi bulk strings")
-			continue
+// process 读取并执行命令，直到读取出错，返回该错误
+func (handler *Handler) process(client *redis.Client, reader *resp.Reader) error {
+	for {
+		cmdLine, err := reader.ReadCommand()
+		if err != nil {
+			return err
 		}
-		cmdLine := reply.Bulks
 		// 执行命令
 		result := handler.server.ExecCommand(client, cmdLine)
-		if result != nil {
-			_, _ = client.Write(result.ToBytes())
-		} else {
-			_, _ = client.Write(Reply.UnknownError().ToBytes())
+		if client.ShouldReply() {
+			if result == nil {
+				result = Reply.UnknownError()
+			}
+			client.AddReply(result)
 		}
 	}
 }
 
+// finish 读取出错后关闭连接，协议错误时先返回错误信息
+func (handler *Handler) finish(client *redis.Client, err error) {
+	if err == resp.ErrQueryBufferLimit {
+		logger.Warn("Closing client that reached max query buffer length: " + client.RemoteAddr())
+	} else if strings.HasPrefix(err.Error(), "Protocol error") {
+		_, _ = client.WriteReply(Reply.StandardError(err.Error()))
+	} else {
+		logger.Info("connection closed: " + client.RemoteAddr())
+	}
+	handler.closeClient(client)
+}
+
+// flushReader 从连接读取数据前，先发送已缓冲的回复
+// 输入缓冲区中的命令都已执行完毕时才会从连接读取，因此pipeline中的回复被一次性发送
+type flushReader struct {
+	conn   net.Conn
+	client *redis.Client
+}
+
+func (r *flushReader) Read(p []byte) (int, error) {
+	r.client.Flush()
+	return r.conn.Read(p)
+}
+
+// Reload 重新读取配置文件，使可修改的配置项立即生效
+func (handler *Handler) Reload() error {
+	return handler.server.ReloadConfig()
+}
+
 func (handler *Handler) Close() error {
 	logger.Info("handler closing...")
 	handler.closing.Set(true) // 设置为closing状态
@@ -0,0 +1,41 @@
+package tcp
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// 一次读取中包含完整的命令及下一条命令的一部分时，读取剩余部分之前应先发送已执行命令的回复
+func testPartialPipeline(t *testing.T, conn net.Conn) {
+	t.Helper()
+	expect := func(want string) {
+		t.Helper()
+		_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		buf := make([]byte, len(want))
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			t.Fatalf("want %q: %v", want, err)
+		}
+		if string(buf) != want {
+			t.Fatalf("got %q, want %q", buf, want)
+		}
+	}
+	if _, err := conn.Write([]byte("*1\r\n$4\r\nPING\r\n*2\r\n$4\r\nPING\r\n$5\r\nhel")); err != nil {
+		t.Fatal(err)
+	}
+	expect("+PONG\r\n")
+	if _, err := conn.Write([]byte("lo\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	expect("+hello\r\n")
+}
+
+func TestHandler_FlushBeforeBlockingRead(t *testing.T) {
+	handler := NewHandler()
+	defer func() { _ = handler.Close() }()
+	conn, peer := net.Pipe()
+	go handler.Handle(conn)
+	defer func() { _ = peer.Close() }()
+	testPartialPipeline(t, peer)
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package tcp
+
+import (
+	"net"
+)
+
+// listenTCP 非unix系统无法指定backlog，使用系统默认值
+func listenTCP(address string, backlog int) (*net.TCPListener, error) {
+	tcpAddr, err := net.ResolveTCPAddr("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	return net.ListenTCP("tcp", tcpAddr)
+}
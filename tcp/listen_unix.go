@@ -0,0 +1,74 @@
+//go:build unix
+
+package tcp
+
+import (
+	"fmt"
+	"go-redis/utils/logger"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// listenTCP 创建listener，net.Listen的backlog固定取自系统配置，因此手动创建socket以指定backlog
+func listenTCP(address string, backlog int) (*net.TCPListener, error) {
+	tcpAddr, err := net.ResolveTCPAddr("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	checkSomaxconn(backlog)
+	// 创建socket
+	var family int
+	var sockaddr syscall.Sockaddr
+	if ip4 := tcpAddr.IP.To4(); tcpAddr.IP == nil || ip4 != nil {
+		family = syscall.AF_INET
+		sa := &syscall.SockaddrInet4{Port: tcpAddr.Port}
+		copy(sa.Addr[:], ip4)
+		sockaddr = sa
+	} else {
+		family = syscall.AF_INET6
+		sa := &syscall.SockaddrInet6{Port: tcpAddr.Port}
+		copy(sa.Addr[:], tcpAddr.IP.To16())
+		sockaddr = sa
+	}
+	fd, err := syscall.Socket(family, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	syscall.CloseOnExec(fd)
+	// bind、listen
+	if err = syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1); err != nil {
+		_ = syscall.Close(fd)
+		return nil, os.NewSyscallError("setsockopt", err)
+	}
+	if err = syscall.Bind(fd, sockaddr); err != nil {
+		_ = syscall.Close(fd)
+		return nil, os.NewSyscallError("bind", err)
+	}
+	if err = syscall.Listen(fd, backlog); err != nil {
+		_ = syscall.Close(fd)
+		return nil, os.NewSyscallError("listen", err)
+	}
+	// 包装为net.TCPListener，FileListener会复制fd，原fd随file关闭
+	file := os.NewFile(uintptr(fd), "tcp-listener")
+	defer file.Close()
+	listener, err := net.FileListener(file)
+	if err != nil {
+		return nil, err
+	}
+	return listener.(*net.TCPListener), nil
+}
+
+// backlog大于系统的somaxconn时会被截断，打印警告
+func checkSomaxconn(backlog int) {
+	content, err := os.ReadFile("/proc/sys/net/core/somaxconn")
+	if err != nil {
+		return
+	}
+	somaxconn, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err == nil && backlog > somaxconn {
+		logger.Warn(fmt.Sprintf("The TCP backlog setting of %d cannot be enforced because /proc/sys/net/core/somaxconn is set to the lower value of %d.", backlog, somaxconn))
+	}
+}
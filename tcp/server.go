@@ -1,21 +1,30 @@
 package tcp
 
 import (
+	"crypto/tls"
+	"errors"
 	"fmt"
 	_interface "go-redis/interface"
+	"go-redis/redis"
 	"go-redis/utils/logger"
 	"net"
 	"os"
 	"os/signal"
 	"sync"
 	"syscall"
+	"time"
 )
 
 type Server struct {
-	address  string
-	handler  _interface.Handler
-	closeCh  chan struct{}
-	signalCh chan os.Signal
+	address    string      // 普通连接的地址，为空时不监听
+	tlsAddress string      // tls连接的地址，为空时不监听
+	tlsConfig  *tls.Config // tls配置
+	unixSocket string      // unix socket的路径，为空时不监听
+	unixPerm   os.FileMode // unix socket文件的权限，为0时使用默认权限
+	eventLoops *eventLoops // 不为nil时，普通连接及unix socket连接由event loop处理
+	handler    _interface.Handler
+	closeCh    chan struct{}
+	signalCh   chan os.Signal
 }
 
 func NewServer(address string, handler _interface.Handler) *Server {
@@ -27,36 +36,102 @@ func NewServer(address string, handler _interface.Handler) *Server {
 	}
 }
 
+// EnableTLS 在指定地址上监听tls连接
+func (server *Server) EnableTLS(address string, config *tls.Config) {
+	server.tlsAddress = address
+	server.tlsConfig = config
+}
+
+// EnableUnixSocket 在指定路径上监听unix socket连接
+func (server *Server) EnableUnixSocket(path string, perm os.FileMode) {
+	server.unixSocket = path
+	server.unixPerm = perm
+}
+
+// EnableEventLoop 使用n个基于epoll的event loop处理普通连接及unix socket连接，tls连接仍然每个连接一个goroutine
+func (server *Server) EnableEventLoop(n int) error {
+	handler, ok := server.handler.(*Handler)
+	if !ok {
+		return errors.New("event loop requires tcp.Handler")
+	}
+	loops, err := newEventLoops(n, handler)
+	if err != nil {
+		return err
+	}
+	server.eventLoops = loops
+	return nil
+}
+
+// listener 监听的地址，tlsConfig不为nil时连接需要经过tls握手
+type listener struct {
+	netListener net.Listener
+	tlsConfig   *tls.Config
+}
+
 // Start 开启服务
 func (server *Server) Start() error {
 	signal.Notify(server.signalCh, syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGINT)
 	// 开启goroutine，用于监听并处理signal
 	go func() {
-		sig := <-server.signalCh
-		switch sig {
-		case syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGINT:
-			server.closeCh <- struct{}{} // 接收到signal后，写入closeChan
+		for sig := range server.signalCh {
+			switch sig {
+			case syscall.SIGHUP: // 重新加载配置，不关闭服务
+				logger.Info("get SIGHUP, reloading config...")
+				if err := server.handler.Reload(); err != nil {
+					logger.Error("reload config failed: " + err.Error())
+				}
+			case syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGINT:
+				server.closeCh <- struct{}{} // 接收到signal后，写入closeChan
+				return
+			}
 		}
 	}()
 
 	// 创建listener
-	tcpAddr, err := net.ResolveTCPAddr("tcp", server.address)
-	if err != nil {
-		return err
+	listeners := make([]*listener, 0, 2)
+	closeAll := func() {
+		for _, l := range listeners {
+			_ = l.netListener.Close()
+		}
 	}
-	tcpListener, err := net.ListenTCP("tcp", tcpAddr)
-	if err != nil {
-		return err
+	for _, addr := range []struct {
+		address   string
+		tlsConfig *tls.Config
+	}{{server.address, nil}, {server.tlsAddress, server.tlsConfig}} {
+		if addr.address == "" {
+			continue
+		}
+		tcpListener, err := listenTCP(addr.address, redis.Config.TcpBacklog)
+		if err != nil {
+			closeAll()
+			return err
+		}
+		if addr.tlsConfig != nil {
+			logger.Info(fmt.Sprintf("bind %s (tls) successful, start listening...", addr.address))
+		} else {
+			logger.Info(fmt.Sprintf("bind %s successful, start listening...", addr.address))
+		}
+		listeners = append(listeners, &listener{netListener: tcpListener, tlsConfig: addr.tlsConfig})
+	}
+	if server.unixSocket != "" {
+		unixListener, err := listenUnix(server.unixSocket, server.unixPerm)
+		if err != nil {
+			closeAll()
+			return err
+		}
+		logger.Info(fmt.Sprintf("bind %s successful, start listening...", server.unixSocket))
+		listeners = append(listeners, &listener{netListener: unixListener})
+	}
+	if len(listeners) == 0 {
+		return fmt.Errorf("no listening address, port, tls-port and unixsocket are all disabled")
 	}
-	logger.Info(fmt.Sprintf("bind %s successful, start listening...", server.address))
-	server.ListenAndServe(tcpListener)
+	server.ListenAndServe(listeners)
 	return nil
 }
 
 // ListenAndServe 监听并服务
-func (server *Server) ListenAndServe(tcpListener *net.TCPListener) {
-	errorCh := make(chan error) // 用于监听error
-	defer close(errorCh)
+func (server *Server) ListenAndServe(listeners []*listener) {
+	errorCh := make(chan error, len(listeners)) // 用于监听error
 
 	// 开启goroutine，用于处理signal和error
 	go func() {
@@ -67,25 +142,73 @@ func (server *Server) ListenAndServe(tcpListener *net.TCPListener) {
 			logger.Info(fmt.Sprintf("accept error: %s, shutting down...\n", er.Error()))
 		}
 		// close
-		_ = tcpListener.Close()
+		for _, l := range listeners {
+			_ = l.netListener.Close()
+		}
 		_ = server.handler.Close()
 	}()
 
 	// 监听并服务
 	var wait sync.WaitGroup
+	var accepting sync.WaitGroup
+	for _, l := range listeners {
+		accepting.Add(1)
+		go func(l *listener) {
+			defer accepting.Done()
+			server.accept(l, &wait, errorCh)
+		}(l)
+	}
+	accepting.Wait()
+	wait.Wait() // 等待所有连接都handle完毕
+}
+
+// listenUnix 监听unix socket，已存在的socket文件(如上次未正常退出时遗留的)会被删除
+func listenUnix(path string, perm os.FileMode) (*net.UnixListener, error) {
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		_ = os.Remove(path)
+	}
+	unixListener, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	if perm != 0 {
+		if err = os.Chmod(path, perm); err != nil {
+			_ = unixListener.Close()
+			return nil, err
+		}
+	}
+	return unixListener, nil
+}
+
+// accept 接受连接，直到listener被关闭
+func (server *Server) accept(l *listener, wait *sync.WaitGroup, errorCh chan<- error) {
 	for {
-		tcpConn, err := tcpListener.AcceptTCP()
+		conn, err := l.netListener.Accept()
 		if err != nil {
 			errorCh <- err // 出现error，写入errorCh
-			break
+			return
+		}
+		if tcpConn, ok := conn.(*net.TCPConn); ok {
+			logger.Info(fmt.Sprintf("accept new connection from %s", tcpConn.RemoteAddr().String()))
+			// 开启TCP keepalive，及时发现已失效的连接
+			if keepalive := redis.Config.TcpKeepalive; keepalive > 0 {
+				_ = tcpConn.SetKeepAlive(true)
+				_ = tcpConn.SetKeepAlivePeriod(time.Duration(keepalive) * time.Second)
+			}
+		} else {
+			logger.Info(fmt.Sprintf("accept new connection on %s", l.netListener.Addr().String()))
+		}
+		if l.tlsConfig != nil {
+			conn = tls.Server(conn, l.tlsConfig) // 握手在handle中进行
+		} else if server.eventLoops != nil {
+			server.eventLoops.serve(conn) // 由event loop处理，不占用goroutine
+			continue
 		}
-		logger.Info(fmt.Sprintf("accept new connection from %s", tcpConn.RemoteAddr().String()))
 		// 开启goroutine，用于handle该连接
 		wait.Add(1)
 		go func() {
 			defer wait.Done()
-			server.handler.Handle(tcpConn) // handle
+			server.handler.Handle(conn) // handle
 		}()
 	}
-	wait.Wait() // 等待所有连接都handle完毕
 }
@@ -0,0 +1,117 @@
+//go:build unix
+
+package tcp
+
+import (
+	"bufio"
+	"go-redis/redis"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// startUnixServer 只在临时目录中的unix socket上监听，返回socket路径，测试结束时关闭
+func startUnixServer(t *testing.T, perm os.FileMode) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "redis.sock")
+	server := NewServer("", NewHandler())
+	server.EnableUnixSocket(path, perm)
+	done := make(chan error, 1)
+	go func() { done <- server.Start() }()
+	// 开始监听前已注册signal
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+		select {
+		case err := <-done:
+			t.Fatalf("server exited: %v", err)
+		default:
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("server did not start listening")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Cleanup(func() {
+		signal.Stop(server.signalCh)
+		server.closeCh <- struct{}{}
+		<-done
+	})
+	return path
+}
+
+// 收到SIGHUP时重新加载配置文件，可修改的配置项生效，不可修改的配置项保持原值
+func TestServer_SIGHUPReloadsConfig(t *testing.T) {
+	configFile := redis.ConfigFile
+	maxclients, _ := redis.GetConfig("maxclients")
+	port, _ := redis.GetConfig("port")
+	t.Cleanup(func() {
+		redis.ConfigFile = configFile
+		_ = redis.SetConfig("maxclients", maxclients)
+		_ = redis.SetConfig("port", port)
+	})
+	redis.ConfigFile = filepath.Join(t.TempDir(), "redis.conf")
+	if err := os.WriteFile(redis.ConfigFile, []byte("maxclients 77\nport 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	startUnixServer(t, 0)
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if got, _ := redis.GetConfig("maxclients"); got == "77" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("SIGHUP did not reload maxclients")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got, _ := redis.GetConfig("port"); got != port {
+		t.Fatalf("immutable port changed by reload: got %s, want %s", got, port)
+	}
+}
+
+// 监听unix socket时按unixsocketperm设置文件权限，通过它建立的连接在CLIENT LIST中带有U标志
+func TestServer_UnixSocket(t *testing.T) {
+	path := startUnixServer(t, 0700)
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSocket == 0 || info.Mode().Perm() != 0700 {
+		t.Fatalf("socket file mode: got %v, want socket with 0700", info.Mode())
+	}
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+	if _, err = conn.Write([]byte("*2\r\n$6\r\nCLIENT\r\n$4\r\nLIST\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	reader := bufio.NewReader(conn)
+	header, err := reader.ReadString('\n')
+	if err != nil || !strings.HasPrefix(header, "$") {
+		t.Fatalf("client list: got %q, %v", header, err)
+	}
+	size, _ := strconv.Atoi(strings.TrimSpace(header[1:]))
+	body := make([]byte, size)
+	if _, err = io.ReadFull(reader, body); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), " addr="+path+":0 ") || !strings.Contains(string(body), " flags=U ") {
+		t.Fatalf("client list %q does not show a unix socket client", body)
+	}
+}
@@ -81,6 +81,21 @@ func (locker *Locker) RUnLocks(keys ...string) {
 	}
 }
 
+/* ---- Lock All ----- */
+
+// LockAll 按序为所有mutex上写锁，用于需要独占整个数据库的操作，如swapdb
+func (locker *Locker) LockAll() {
+	for _, mu := range locker.table {
+		mu.Lock()
+	}
+}
+
+func (locker *Locker) UnLockAll() {
+	for i := len(locker.table) - 1; i >= 0; i-- {
+		locker.table[i].Unlock()
+	}
+}
+
 /* ---- Lock Keys ----- */
 
 // LockKeys 给定一组write key和一组read key，按序进行上锁